@@ -23,6 +23,8 @@ const _ = connect.IsAtLeastVersion0_1_0
 const (
 	// ZanzigoServiceName is the fully-qualified name of the ZanzigoService service.
 	ZanzigoServiceName = "zanzigo.v1.ZanzigoService"
+	// StoreServiceName is the fully-qualified name of the StoreService service.
+	StoreServiceName = "zanzigo.v1.StoreService"
 )
 
 // These constants are the fully-qualified names of the RPCs defined in this package. They're
@@ -37,18 +39,39 @@ const (
 	ZanzigoServiceWriteProcedure = "/zanzigo.v1.ZanzigoService/Write"
 	// ZanzigoServiceReadProcedure is the fully-qualified name of the ZanzigoService's Read RPC.
 	ZanzigoServiceReadProcedure = "/zanzigo.v1.ZanzigoService/Read"
+	// ZanzigoServiceDeleteProcedure is the fully-qualified name of the ZanzigoService's Delete RPC.
+	ZanzigoServiceDeleteProcedure = "/zanzigo.v1.ZanzigoService/Delete"
 	// ZanzigoServiceCheckProcedure is the fully-qualified name of the ZanzigoService's Check RPC.
 	ZanzigoServiceCheckProcedure = "/zanzigo.v1.ZanzigoService/Check"
 	// ZanzigoServiceListProcedure is the fully-qualified name of the ZanzigoService's List RPC.
 	ZanzigoServiceListProcedure = "/zanzigo.v1.ZanzigoService/List"
+	// ZanzigoServiceImportTuplesProcedure is the fully-qualified name of the ZanzigoService's
+	// ImportTuples RPC.
+	ZanzigoServiceImportTuplesProcedure = "/zanzigo.v1.ZanzigoService/ImportTuples"
+	// ZanzigoServiceExportTuplesProcedure is the fully-qualified name of the ZanzigoService's
+	// ExportTuples RPC.
+	ZanzigoServiceExportTuplesProcedure = "/zanzigo.v1.ZanzigoService/ExportTuples"
+	// StoreServiceCreateStoreProcedure is the fully-qualified name of the StoreService's CreateStore
+	// RPC.
+	StoreServiceCreateStoreProcedure = "/zanzigo.v1.StoreService/CreateStore"
+	// StoreServiceListStoresProcedure is the fully-qualified name of the StoreService's ListStores RPC.
+	StoreServiceListStoresProcedure = "/zanzigo.v1.StoreService/ListStores"
+	// StoreServiceDeleteStoreProcedure is the fully-qualified name of the StoreService's DeleteStore
+	// RPC.
+	StoreServiceDeleteStoreProcedure = "/zanzigo.v1.StoreService/DeleteStore"
 )
 
 // ZanzigoServiceClient is a client for the zanzigo.v1.ZanzigoService service.
 type ZanzigoServiceClient interface {
 	Write(context.Context, *connect.Request[v1.WriteRequest]) (*connect.Response[v1.WriteResponse], error)
 	Read(context.Context, *connect.Request[v1.ReadRequest]) (*connect.Response[v1.ReadResponse], error)
+	Delete(context.Context, *connect.Request[v1.DeleteRequest]) (*connect.Response[v1.DeleteResponse], error)
 	Check(context.Context, *connect.Request[v1.CheckRequest]) (*connect.Response[v1.CheckResponse], error)
 	List(context.Context, *connect.Request[v1.ListRequest]) (*connect.Response[v1.ListResponse], error)
+	// Writes the tuples of all messages, each message is written atomically.
+	ImportTuples(context.Context) *connect.ClientStreamForClient[v1.ImportTuplesRequest, v1.ImportTuplesResponse]
+	// Streams all tuples matching the filter.
+	ExportTuples(context.Context, *connect.Request[v1.ExportTuplesRequest]) (*connect.ServerStreamForClient[v1.ExportTuplesResponse], error)
 }
 
 // NewZanzigoServiceClient constructs a client for the zanzigo.v1.ZanzigoService service. By
@@ -71,6 +94,11 @@ func NewZanzigoServiceClient(httpClient connect.HTTPClient, baseURL string, opts
 			baseURL+ZanzigoServiceReadProcedure,
 			opts...,
 		),
+		delete: connect.NewClient[v1.DeleteRequest, v1.DeleteResponse](
+			httpClient,
+			baseURL+ZanzigoServiceDeleteProcedure,
+			opts...,
+		),
 		check: connect.NewClient[v1.CheckRequest, v1.CheckResponse](
 			httpClient,
 			baseURL+ZanzigoServiceCheckProcedure,
@@ -81,15 +109,28 @@ func NewZanzigoServiceClient(httpClient connect.HTTPClient, baseURL string, opts
 			baseURL+ZanzigoServiceListProcedure,
 			opts...,
 		),
+		importTuples: connect.NewClient[v1.ImportTuplesRequest, v1.ImportTuplesResponse](
+			httpClient,
+			baseURL+ZanzigoServiceImportTuplesProcedure,
+			opts...,
+		),
+		exportTuples: connect.NewClient[v1.ExportTuplesRequest, v1.ExportTuplesResponse](
+			httpClient,
+			baseURL+ZanzigoServiceExportTuplesProcedure,
+			opts...,
+		),
 	}
 }
 
 // zanzigoServiceClient implements ZanzigoServiceClient.
 type zanzigoServiceClient struct {
-	write *connect.Client[v1.WriteRequest, v1.WriteResponse]
-	read  *connect.Client[v1.ReadRequest, v1.ReadResponse]
-	check *connect.Client[v1.CheckRequest, v1.CheckResponse]
-	list  *connect.Client[v1.ListRequest, v1.ListResponse]
+	write        *connect.Client[v1.WriteRequest, v1.WriteResponse]
+	read         *connect.Client[v1.ReadRequest, v1.ReadResponse]
+	delete       *connect.Client[v1.DeleteRequest, v1.DeleteResponse]
+	check        *connect.Client[v1.CheckRequest, v1.CheckResponse]
+	list         *connect.Client[v1.ListRequest, v1.ListResponse]
+	importTuples *connect.Client[v1.ImportTuplesRequest, v1.ImportTuplesResponse]
+	exportTuples *connect.Client[v1.ExportTuplesRequest, v1.ExportTuplesResponse]
 }
 
 // Write calls zanzigo.v1.ZanzigoService.Write.
@@ -102,6 +143,11 @@ func (c *zanzigoServiceClient) Read(ctx context.Context, req *connect.Request[v1
 	return c.read.CallUnary(ctx, req)
 }
 
+// Delete calls zanzigo.v1.ZanzigoService.Delete.
+func (c *zanzigoServiceClient) Delete(ctx context.Context, req *connect.Request[v1.DeleteRequest]) (*connect.Response[v1.DeleteResponse], error) {
+	return c.delete.CallUnary(ctx, req)
+}
+
 // Check calls zanzigo.v1.ZanzigoService.Check.
 func (c *zanzigoServiceClient) Check(ctx context.Context, req *connect.Request[v1.CheckRequest]) (*connect.Response[v1.CheckResponse], error) {
 	return c.check.CallUnary(ctx, req)
@@ -112,12 +158,27 @@ func (c *zanzigoServiceClient) List(ctx context.Context, req *connect.Request[v1
 	return c.list.CallUnary(ctx, req)
 }
 
+// ImportTuples calls zanzigo.v1.ZanzigoService.ImportTuples.
+func (c *zanzigoServiceClient) ImportTuples(ctx context.Context) *connect.ClientStreamForClient[v1.ImportTuplesRequest, v1.ImportTuplesResponse] {
+	return c.importTuples.CallClientStream(ctx)
+}
+
+// ExportTuples calls zanzigo.v1.ZanzigoService.ExportTuples.
+func (c *zanzigoServiceClient) ExportTuples(ctx context.Context, req *connect.Request[v1.ExportTuplesRequest]) (*connect.ServerStreamForClient[v1.ExportTuplesResponse], error) {
+	return c.exportTuples.CallServerStream(ctx, req)
+}
+
 // ZanzigoServiceHandler is an implementation of the zanzigo.v1.ZanzigoService service.
 type ZanzigoServiceHandler interface {
 	Write(context.Context, *connect.Request[v1.WriteRequest]) (*connect.Response[v1.WriteResponse], error)
 	Read(context.Context, *connect.Request[v1.ReadRequest]) (*connect.Response[v1.ReadResponse], error)
+	Delete(context.Context, *connect.Request[v1.DeleteRequest]) (*connect.Response[v1.DeleteResponse], error)
 	Check(context.Context, *connect.Request[v1.CheckRequest]) (*connect.Response[v1.CheckResponse], error)
 	List(context.Context, *connect.Request[v1.ListRequest]) (*connect.Response[v1.ListResponse], error)
+	// Writes the tuples of all messages, each message is written atomically.
+	ImportTuples(context.Context, *connect.ClientStream[v1.ImportTuplesRequest]) (*connect.Response[v1.ImportTuplesResponse], error)
+	// Streams all tuples matching the filter.
+	ExportTuples(context.Context, *connect.Request[v1.ExportTuplesRequest], *connect.ServerStream[v1.ExportTuplesResponse]) error
 }
 
 // NewZanzigoServiceHandler builds an HTTP handler from the service implementation. It returns the
@@ -136,6 +197,11 @@ func NewZanzigoServiceHandler(svc ZanzigoServiceHandler, opts ...connect.Handler
 		svc.Read,
 		opts...,
 	)
+	zanzigoServiceDeleteHandler := connect.NewUnaryHandler(
+		ZanzigoServiceDeleteProcedure,
+		svc.Delete,
+		opts...,
+	)
 	zanzigoServiceCheckHandler := connect.NewUnaryHandler(
 		ZanzigoServiceCheckProcedure,
 		svc.Check,
@@ -146,16 +212,32 @@ func NewZanzigoServiceHandler(svc ZanzigoServiceHandler, opts ...connect.Handler
 		svc.List,
 		opts...,
 	)
+	zanzigoServiceImportTuplesHandler := connect.NewClientStreamHandler(
+		ZanzigoServiceImportTuplesProcedure,
+		svc.ImportTuples,
+		opts...,
+	)
+	zanzigoServiceExportTuplesHandler := connect.NewServerStreamHandler(
+		ZanzigoServiceExportTuplesProcedure,
+		svc.ExportTuples,
+		opts...,
+	)
 	return "/zanzigo.v1.ZanzigoService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
 		case ZanzigoServiceWriteProcedure:
 			zanzigoServiceWriteHandler.ServeHTTP(w, r)
 		case ZanzigoServiceReadProcedure:
 			zanzigoServiceReadHandler.ServeHTTP(w, r)
+		case ZanzigoServiceDeleteProcedure:
+			zanzigoServiceDeleteHandler.ServeHTTP(w, r)
 		case ZanzigoServiceCheckProcedure:
 			zanzigoServiceCheckHandler.ServeHTTP(w, r)
 		case ZanzigoServiceListProcedure:
 			zanzigoServiceListHandler.ServeHTTP(w, r)
+		case ZanzigoServiceImportTuplesProcedure:
+			zanzigoServiceImportTuplesHandler.ServeHTTP(w, r)
+		case ZanzigoServiceExportTuplesProcedure:
+			zanzigoServiceExportTuplesHandler.ServeHTTP(w, r)
 		default:
 			http.NotFound(w, r)
 		}
@@ -173,6 +255,10 @@ func (UnimplementedZanzigoServiceHandler) Read(context.Context, *connect.Request
 	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("zanzigo.v1.ZanzigoService.Read is not implemented"))
 }
 
+func (UnimplementedZanzigoServiceHandler) Delete(context.Context, *connect.Request[v1.DeleteRequest]) (*connect.Response[v1.DeleteResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("zanzigo.v1.ZanzigoService.Delete is not implemented"))
+}
+
 func (UnimplementedZanzigoServiceHandler) Check(context.Context, *connect.Request[v1.CheckRequest]) (*connect.Response[v1.CheckResponse], error) {
 	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("zanzigo.v1.ZanzigoService.Check is not implemented"))
 }
@@ -180,3 +266,125 @@ func (UnimplementedZanzigoServiceHandler) Check(context.Context, *connect.Reques
 func (UnimplementedZanzigoServiceHandler) List(context.Context, *connect.Request[v1.ListRequest]) (*connect.Response[v1.ListResponse], error) {
 	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("zanzigo.v1.ZanzigoService.List is not implemented"))
 }
+
+func (UnimplementedZanzigoServiceHandler) ImportTuples(context.Context, *connect.ClientStream[v1.ImportTuplesRequest]) (*connect.Response[v1.ImportTuplesResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("zanzigo.v1.ZanzigoService.ImportTuples is not implemented"))
+}
+
+func (UnimplementedZanzigoServiceHandler) ExportTuples(context.Context, *connect.Request[v1.ExportTuplesRequest], *connect.ServerStream[v1.ExportTuplesResponse]) error {
+	return connect.NewError(connect.CodeUnimplemented, errors.New("zanzigo.v1.ZanzigoService.ExportTuples is not implemented"))
+}
+
+// StoreServiceClient is a client for the zanzigo.v1.StoreService service.
+type StoreServiceClient interface {
+	CreateStore(context.Context, *connect.Request[v1.CreateStoreRequest]) (*connect.Response[v1.CreateStoreResponse], error)
+	ListStores(context.Context, *connect.Request[v1.ListStoresRequest]) (*connect.Response[v1.ListStoresResponse], error)
+	DeleteStore(context.Context, *connect.Request[v1.DeleteStoreRequest]) (*connect.Response[v1.DeleteStoreResponse], error)
+}
+
+// NewStoreServiceClient constructs a client for the zanzigo.v1.StoreService service. By default, it
+// uses the Connect protocol with the binary Protobuf Codec, asks for gzipped responses, and sends
+// uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the connect.WithGRPC() or
+// connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewStoreServiceClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) StoreServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &storeServiceClient{
+		createStore: connect.NewClient[v1.CreateStoreRequest, v1.CreateStoreResponse](
+			httpClient,
+			baseURL+StoreServiceCreateStoreProcedure,
+			opts...,
+		),
+		listStores: connect.NewClient[v1.ListStoresRequest, v1.ListStoresResponse](
+			httpClient,
+			baseURL+StoreServiceListStoresProcedure,
+			opts...,
+		),
+		deleteStore: connect.NewClient[v1.DeleteStoreRequest, v1.DeleteStoreResponse](
+			httpClient,
+			baseURL+StoreServiceDeleteStoreProcedure,
+			opts...,
+		),
+	}
+}
+
+// storeServiceClient implements StoreServiceClient.
+type storeServiceClient struct {
+	createStore *connect.Client[v1.CreateStoreRequest, v1.CreateStoreResponse]
+	listStores  *connect.Client[v1.ListStoresRequest, v1.ListStoresResponse]
+	deleteStore *connect.Client[v1.DeleteStoreRequest, v1.DeleteStoreResponse]
+}
+
+// CreateStore calls zanzigo.v1.StoreService.CreateStore.
+func (c *storeServiceClient) CreateStore(ctx context.Context, req *connect.Request[v1.CreateStoreRequest]) (*connect.Response[v1.CreateStoreResponse], error) {
+	return c.createStore.CallUnary(ctx, req)
+}
+
+// ListStores calls zanzigo.v1.StoreService.ListStores.
+func (c *storeServiceClient) ListStores(ctx context.Context, req *connect.Request[v1.ListStoresRequest]) (*connect.Response[v1.ListStoresResponse], error) {
+	return c.listStores.CallUnary(ctx, req)
+}
+
+// DeleteStore calls zanzigo.v1.StoreService.DeleteStore.
+func (c *storeServiceClient) DeleteStore(ctx context.Context, req *connect.Request[v1.DeleteStoreRequest]) (*connect.Response[v1.DeleteStoreResponse], error) {
+	return c.deleteStore.CallUnary(ctx, req)
+}
+
+// StoreServiceHandler is an implementation of the zanzigo.v1.StoreService service.
+type StoreServiceHandler interface {
+	CreateStore(context.Context, *connect.Request[v1.CreateStoreRequest]) (*connect.Response[v1.CreateStoreResponse], error)
+	ListStores(context.Context, *connect.Request[v1.ListStoresRequest]) (*connect.Response[v1.ListStoresResponse], error)
+	DeleteStore(context.Context, *connect.Request[v1.DeleteStoreRequest]) (*connect.Response[v1.DeleteStoreResponse], error)
+}
+
+// NewStoreServiceHandler builds an HTTP handler from the service implementation. It returns the
+// path on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewStoreServiceHandler(svc StoreServiceHandler, opts ...connect.HandlerOption) (string, http.Handler) {
+	storeServiceCreateStoreHandler := connect.NewUnaryHandler(
+		StoreServiceCreateStoreProcedure,
+		svc.CreateStore,
+		opts...,
+	)
+	storeServiceListStoresHandler := connect.NewUnaryHandler(
+		StoreServiceListStoresProcedure,
+		svc.ListStores,
+		opts...,
+	)
+	storeServiceDeleteStoreHandler := connect.NewUnaryHandler(
+		StoreServiceDeleteStoreProcedure,
+		svc.DeleteStore,
+		opts...,
+	)
+	return "/zanzigo.v1.StoreService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case StoreServiceCreateStoreProcedure:
+			storeServiceCreateStoreHandler.ServeHTTP(w, r)
+		case StoreServiceListStoresProcedure:
+			storeServiceListStoresHandler.ServeHTTP(w, r)
+		case StoreServiceDeleteStoreProcedure:
+			storeServiceDeleteStoreHandler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// UnimplementedStoreServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedStoreServiceHandler struct{}
+
+func (UnimplementedStoreServiceHandler) CreateStore(context.Context, *connect.Request[v1.CreateStoreRequest]) (*connect.Response[v1.CreateStoreResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("zanzigo.v1.StoreService.CreateStore is not implemented"))
+}
+
+func (UnimplementedStoreServiceHandler) ListStores(context.Context, *connect.Request[v1.ListStoresRequest]) (*connect.Response[v1.ListStoresResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("zanzigo.v1.StoreService.ListStores is not implemented"))
+}
+
+func (UnimplementedStoreServiceHandler) DeleteStore(context.Context, *connect.Request[v1.DeleteStoreRequest]) (*connect.Response[v1.DeleteStoreResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("zanzigo.v1.StoreService.DeleteStore is not implemented"))
+}
@@ -0,0 +1,165 @@
+// Package authz enforces checks before requests are handled, using net/http middleware or Connect and gRPC interceptors.
+// The tuple to check is derived from the request and the principal authenticated beforehand, e.g. by an earlier middleware:
+//
+//	middleware := authz.NewMiddleware(authz.ClientChecker(c), principalFromContext,
+//		func(r *http.Request, user string) (zanzigo.Tuple, error) {
+//			return zanzigo.Tuple{ObjectType: "doc", ObjectID: strings.TrimPrefix(r.URL.Path, "/docs/"), ObjectRelation: "viewer", SubjectType: "user", SubjectID: user}, nil
+//		})
+//
+// Decisions are cached for the duration of a request, handlers can use [Check] to run further checks using the same cache.
+package authz
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/trevex/zanzigo"
+	"github.com/trevex/zanzigo/client"
+
+	"github.com/samber/lo"
+)
+
+// Returned by [Check], if the context was not created by a middleware or interceptor of this package or [NewContext].
+var ErrNoChecker = errors.New("no checker in context")
+
+// A Checker decides whether a tuple is allowed, see [ResolverChecker] and [ClientChecker].
+type Checker interface {
+	Check(ctx context.Context, t zanzigo.Tuple) (bool, error)
+}
+
+type CheckerFunc func(ctx context.Context, t zanzigo.Tuple) (bool, error)
+
+func (fn CheckerFunc) Check(ctx context.Context, t zanzigo.Tuple) (bool, error) {
+	return fn(ctx, t)
+}
+
+// ResolverChecker checks tuples using an embedded resolver.
+func ResolverChecker(resolver *zanzigo.Resolver, options ...zanzigo.CheckOption) Checker {
+	return CheckerFunc(func(ctx context.Context, t zanzigo.Tuple) (bool, error) {
+		return resolver.Check(ctx, t, options...)
+	})
+}
+
+// ClientChecker checks tuples using a client, e.g. of a remote server.
+func ClientChecker(c client.Client, options ...client.CheckOption) Checker {
+	return CheckerFunc(func(ctx context.Context, t zanzigo.Tuple) (bool, error) {
+		return c.Check(ctx, t, options...)
+	})
+}
+
+// PrincipalFunc returns the principal authenticated for the request of ctx, e.g. the user set by an authentication middleware.
+// If no principal was authenticated, ok is false and the request is rejected as unauthenticated.
+type PrincipalFunc[P any] func(ctx context.Context) (principal P, ok bool)
+
+type Option interface {
+	do(*config)
+}
+
+type config struct {
+	log *slog.Logger
+}
+
+type functionAdapter func(*config)
+
+func (fn functionAdapter) do(c *config) {
+	fn(c)
+}
+
+// WithLogger logs failed checks, which are otherwise only reported to the caller as internal error. Defaults to [slog.Default].
+func WithLogger(log *slog.Logger) Option {
+	return functionAdapter(func(c *config) { c.log = log })
+}
+
+func newConfig(options []Option) config {
+	c := config{log: slog.Default()}
+	lo.ForEach(options, func(o Option, _ int) { o.do(&c) })
+	return c
+}
+
+type decisionsKey struct{}
+
+// decisions caches the results of a checker for a single request.
+type decisions struct {
+	checker Checker
+	mu      sync.Mutex
+	allowed map[string]bool
+}
+
+// NewContext returns a context, which caches the decisions of checker for [Check], e.g. to use the cache outside of requests.
+func NewContext(ctx context.Context, checker Checker) context.Context {
+	return context.WithValue(ctx, decisionsKey{}, &decisions{checker: checker, allowed: map[string]bool{}})
+}
+
+// Check checks t using the checker of ctx, decisions are cached, so every tuple is only checked once per request.
+// Failed checks are not cached.
+func Check(ctx context.Context, t zanzigo.Tuple) (bool, error) {
+	d, ok := ctx.Value(decisionsKey{}).(*decisions)
+	if !ok {
+		return false, ErrNoChecker
+	}
+	key := t.ToString()
+	d.mu.Lock()
+	allowed, ok := d.allowed[key]
+	d.mu.Unlock()
+	if ok {
+		return allowed, nil
+	}
+	allowed, err := d.checker.Check(ctx, t)
+	if err != nil {
+		return false, err
+	}
+	d.mu.Lock()
+	d.allowed[key] = allowed
+	d.mu.Unlock()
+	return allowed, nil
+}
+
+// Call describes an RPC for the interceptors of this package.
+type Call struct {
+	// Full name of the procedure, e.g. "/acme.v1.DocumentService/GetDocument".
+	Procedure string
+	Header    http.Header
+	// The request message of unary calls, nil for streaming calls, as checks happen before messages are received.
+	Message any
+}
+
+// CallTupleFunc returns the tuple to check before call is handled. If it returns [zanzigo.EmptyTuple], the call is not checked,
+// e.g. for public procedures. Calls without principal are passed the zero value of P and are only handled, if no tuple is returned.
+// Errors reject the call with connect.CodeInvalidArgument or codes.InvalidArgument.
+type CallTupleFunc[P any] func(ctx context.Context, call Call, principal P) (zanzigo.Tuple, error)
+
+// authorizeCall authorizes the call as described by [CallTupleFunc] and returns the context of the request.
+// The returned error is either errUnauthenticated, errDenied, errCheckFailed or an error of tuple.
+func authorizeCall[P any](ctx context.Context, opts *config, checker Checker, principal PrincipalFunc[P], tuple CallTupleFunc[P], call Call) (context.Context, error) {
+	ctx = NewContext(ctx, checker)
+	p, ok := principal(ctx)
+	t, err := tuple(ctx, call, p)
+	if !ok && (err != nil || t != zanzigo.EmptyTuple) {
+		return ctx, errUnauthenticated
+	}
+	if err != nil || t == zanzigo.EmptyTuple {
+		return ctx, err
+	}
+	return ctx, authorize(ctx, opts, t)
+}
+
+var (
+	errUnauthenticated = errors.New("unauthenticated")
+	errDenied          = errors.New("permission denied")
+	errCheckFailed     = errors.New("failed to check permission")
+)
+
+func authorize(ctx context.Context, opts *config, t zanzigo.Tuple) error {
+	allowed, err := Check(ctx, t)
+	if err != nil {
+		opts.log.Error("failed to check tuple", slog.String("tuple", t.ToString()), slog.Any("error", err))
+		return errCheckFailed
+	}
+	if !allowed {
+		return errDenied
+	}
+	return nil
+}
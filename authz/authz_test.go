@@ -0,0 +1,148 @@
+package authz_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/trevex/zanzigo"
+	v1 "github.com/trevex/zanzigo/api/zanzigo/v1"
+	"github.com/trevex/zanzigo/authz"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type userKey struct{}
+
+func principal(ctx context.Context) (string, bool) {
+	user, ok := ctx.Value(userKey{}).(string)
+	return user, ok
+}
+
+// checker allows alice to view doc:readme and counts the checks.
+type checker struct {
+	checks int
+}
+
+func (c *checker) Check(ctx context.Context, t zanzigo.Tuple) (bool, error) {
+	c.checks++
+	if t.ObjectID == "broken" {
+		return false, errors.New("storage unavailable")
+	}
+	return t.ToString() == "doc:readme#viewer@user:alice", nil
+}
+
+func viewer(object, user string) zanzigo.Tuple {
+	return zanzigo.Tuple{ObjectType: "doc", ObjectID: object, ObjectRelation: "viewer", SubjectType: "user", SubjectID: user}
+}
+
+func TestMiddleware(t *testing.T) {
+	c := &checker{}
+	middleware := authz.NewMiddleware(c, principal, func(r *http.Request, user string) (zanzigo.Tuple, error) {
+		object := strings.TrimPrefix(r.URL.Path, "/docs/")
+		switch object {
+		case "":
+			return zanzigo.EmptyTuple, errors.New("missing document")
+		case "public":
+			return zanzigo.EmptyTuple, nil
+		}
+		return viewer(object, user), nil
+	}, authz.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The decision of the middleware is cached
+		allowed, err := authz.Check(r.Context(), viewer("readme", "alice"))
+		require.NoError(t, err)
+		require.True(t, allowed)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	request := func(path, user string) int {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if user != "" {
+			r = r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	require.Equal(t, http.StatusNoContent, request("/docs/readme", "alice"))
+	require.Equal(t, 1, c.checks)
+	require.Equal(t, http.StatusForbidden, request("/docs/readme", "bob"))
+	require.Equal(t, http.StatusUnauthorized, request("/docs/readme", ""))
+	require.Equal(t, http.StatusBadRequest, request("/docs/", "alice"))
+	require.Equal(t, http.StatusUnauthorized, request("/docs/", ""))
+	require.Equal(t, http.StatusInternalServerError, request("/docs/broken", "alice"))
+	c.checks = 0
+	// Only the handler checks public documents
+	require.Equal(t, http.StatusNoContent, request("/docs/public", "bob"))
+	require.Equal(t, 1, c.checks)
+	// Public documents do not require a principal
+	require.Equal(t, http.StatusNoContent, request("/docs/public", ""))
+
+	_, err := authz.Check(context.Background(), viewer("readme", "alice"))
+	require.ErrorIs(t, err, authz.ErrNoChecker)
+}
+
+func callTuple(ctx context.Context, call authz.Call, user string) (zanzigo.Tuple, error) {
+	req, ok := call.Message.(*v1.ReadRequest)
+	if !ok {
+		return zanzigo.EmptyTuple, errors.New("unexpected message")
+	}
+	if req.Tuple.ObjectId == "public" {
+		return zanzigo.EmptyTuple, nil
+	}
+	return viewer(req.Tuple.ObjectId, user), nil
+}
+
+func TestInterceptor(t *testing.T) {
+	interceptor := authz.NewInterceptor(&checker{}, principal, callTuple)
+	unary := interceptor.WrapUnary(func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		allowed, err := authz.Check(ctx, viewer("readme", "alice"))
+		require.NoError(t, err)
+		require.True(t, allowed)
+		return connect.NewResponse(&v1.ReadResponse{}), nil
+	})
+
+	ctx := context.WithValue(context.Background(), userKey{}, "alice")
+	_, err := unary(ctx, connect.NewRequest(&v1.ReadRequest{Tuple: &v1.Tuple{ObjectId: "readme"}}))
+	require.NoError(t, err)
+	_, err = unary(ctx, connect.NewRequest(&v1.ReadRequest{Tuple: &v1.Tuple{ObjectId: "roadmap"}}))
+	require.Equal(t, connect.CodePermissionDenied, connect.CodeOf(err))
+	_, err = unary(ctx, connect.NewRequest(&v1.WriteRequest{}))
+	require.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+	_, err = unary(context.Background(), connect.NewRequest(&v1.ReadRequest{Tuple: &v1.Tuple{ObjectId: "readme"}}))
+	require.Equal(t, connect.CodeUnauthenticated, connect.CodeOf(err))
+	_, err = unary(context.Background(), connect.NewRequest(&v1.ReadRequest{Tuple: &v1.Tuple{ObjectId: "public"}}))
+	require.NoError(t, err)
+}
+
+func TestGRPCInterceptor(t *testing.T) {
+	// The principal is taken from the incoming metadata as set by an authentication interceptor
+	fromMetadata := func(ctx context.Context) (string, bool) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		users := md.Get("x-user")
+		return strings.Join(users, ""), len(users) > 0
+	}
+	interceptor := authz.NewUnaryServerInterceptor(&checker{}, fromMetadata, callTuple, authz.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	handler := func(ctx context.Context, req any) (any, error) { return &v1.ReadResponse{}, nil }
+	info := &grpc.UnaryServerInfo{FullMethod: "/zanzigo.v1.ZanzigoService/Read"}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-user", "alice"))
+	_, err := interceptor(ctx, &v1.ReadRequest{Tuple: &v1.Tuple{ObjectId: "readme"}}, info, handler)
+	require.NoError(t, err)
+	_, err = interceptor(ctx, &v1.ReadRequest{Tuple: &v1.Tuple{ObjectId: "broken"}}, info, handler)
+	require.Equal(t, codes.Internal, status.Code(err))
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-user", "bob"))
+	_, err = interceptor(ctx, &v1.ReadRequest{Tuple: &v1.Tuple{ObjectId: "readme"}}, info, handler)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,61 @@
+package authz
+
+import (
+	"context"
+	"errors"
+
+	"connectrpc.com/connect"
+)
+
+type connectInterceptor[P any] struct {
+	opts      config
+	checker   Checker
+	principal PrincipalFunc[P]
+	tuple     CallTupleFunc[P]
+}
+
+// NewInterceptor returns a Connect interceptor for handlers, which only passes calls on, if the tuple returned by tuple is allowed.
+// It applies to all protocols served by Connect handlers, i.e. Connect, gRPC and gRPC-Web.
+// Calls without principal, which have to be checked, fail with connect.CodeUnauthenticated, denied calls with connect.CodePermissionDenied.
+func NewInterceptor[P any](checker Checker, principal PrincipalFunc[P], tuple CallTupleFunc[P], options ...Option) connect.Interceptor {
+	return &connectInterceptor[P]{newConfig(options), checker, principal, tuple}
+}
+
+func (i *connectInterceptor[P]) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		ctx, err := authorizeCall(ctx, &i.opts, i.checker, i.principal, i.tuple, Call{req.Spec().Procedure, req.Header(), req.Any()})
+		if err != nil {
+			return nil, toConnectError(err)
+		}
+		return next(ctx, req)
+	}
+}
+
+func (i *connectInterceptor[P]) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *connectInterceptor[P]) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		ctx, err := authorizeCall(ctx, &i.opts, i.checker, i.principal, i.tuple, Call{conn.Spec().Procedure, conn.RequestHeader(), nil})
+		if err != nil {
+			return toConnectError(err)
+		}
+		return next(ctx, conn)
+	}
+}
+
+func toConnectError(err error) error {
+	switch {
+	case errors.Is(err, errUnauthenticated):
+		return connect.NewError(connect.CodeUnauthenticated, err)
+	case errors.Is(err, errDenied):
+		return connect.NewError(connect.CodePermissionDenied, err)
+	case errors.Is(err, errCheckFailed):
+		return connect.NewError(connect.CodeInternal, err)
+	}
+	return connect.NewError(connect.CodeInvalidArgument, err)
+}
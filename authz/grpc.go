@@ -0,0 +1,70 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// NewUnaryServerInterceptor is the equivalent of [NewInterceptor] for servers using google.golang.org/grpc.
+// The header of the [Call] contains the incoming metadata.
+func NewUnaryServerInterceptor[P any](checker Checker, principal PrincipalFunc[P], tuple CallTupleFunc[P], options ...Option) grpc.UnaryServerInterceptor {
+	opts := newConfig(options)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authorizeCall(ctx, &opts, checker, principal, tuple, Call{info.FullMethod, incomingHeader(ctx), req})
+		if err != nil {
+			return nil, toStatusError(err)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// NewStreamServerInterceptor is the equivalent of [NewInterceptor] for streams of servers using google.golang.org/grpc.
+func NewStreamServerInterceptor[P any](checker Checker, principal PrincipalFunc[P], tuple CallTupleFunc[P], options ...Option) grpc.StreamServerInterceptor {
+	opts := newConfig(options)
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorizeCall(stream.Context(), &opts, checker, principal, tuple, Call{info.FullMethod, incomingHeader(stream.Context()), nil})
+		if err != nil {
+			return toStatusError(err)
+		}
+		return handler(srv, &serverStream{stream, ctx})
+	}
+}
+
+// serverStream replaces the context of the stream with the one caching decisions.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func incomingHeader(ctx context.Context) http.Header {
+	header := http.Header{}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	return header
+}
+
+func toStatusError(err error) error {
+	switch {
+	case errors.Is(err, errUnauthenticated):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, errDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, errCheckFailed):
+		return status.Error(codes.Internal, err.Error())
+	}
+	return status.Error(codes.InvalidArgument, err.Error())
+}
@@ -0,0 +1,45 @@
+package authz
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/trevex/zanzigo"
+)
+
+// RequestTupleFunc returns the tuple to check before r is handled. If it returns [zanzigo.EmptyTuple], the request is not checked,
+// e.g. for public routes. Requests without principal are passed the zero value of P and are only handled, if no tuple is returned.
+// Errors reject the request with 400 Bad Request.
+type RequestTupleFunc[P any] func(r *http.Request, principal P) (zanzigo.Tuple, error)
+
+// NewMiddleware returns middleware, which only passes requests on to the next handler, if the tuple returned by tuple is allowed.
+// Requests without principal, which have to be checked, are rejected with 401 Unauthorized, denied requests with 403 Forbidden.
+func NewMiddleware[P any](checker Checker, principal PrincipalFunc[P], tuple RequestTupleFunc[P], options ...Option) func(http.Handler) http.Handler {
+	opts := newConfig(options)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(NewContext(r.Context(), checker))
+			p, ok := principal(r.Context())
+			t, err := tuple(r, p)
+			if !ok && (err != nil || t != zanzigo.EmptyTuple) {
+				http.Error(w, "unauthenticated", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if t != zanzigo.EmptyTuple {
+				err = authorize(r.Context(), &opts, t)
+			}
+			switch {
+			case errors.Is(err, errDenied):
+				http.Error(w, "forbidden", http.StatusForbidden)
+			case err != nil:
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
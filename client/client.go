@@ -0,0 +1,254 @@
+// Package client provides a [Client] of the zanzigo server, which hides the API-types, pagination and retries.
+// The same interface is implemented on top of an embedded [zanzigo.Resolver], so applications can switch between both:
+//
+//	c := client.New("https://zanzigo.example.com", client.WithToken(token))
+//	allowed, err := c.Check(ctx, zanzigo.TupleString("doc:readme#viewer@user:alice"))
+//
+//	it := c.List(ctx, zanzigo.Tuple{ObjectType: "doc", ObjectID: "readme"})
+//	for it.Next() {
+//		fmt.Println(it.Tuple().ToString())
+//	}
+//	err = it.Err()
+package client
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/trevex/zanzigo"
+
+	"connectrpc.com/connect"
+	"github.com/samber/lo"
+)
+
+// Returned by the client of [NewLocal], if a tuple is not valid for the model. The server rejects invalid tuples with connect.CodeInvalidArgument.
+var ErrInvalidTuple = zanzigo.ErrInvalidTuple
+
+// Client offers the operations applications use to check and manage tuples.
+// Errors of the server are returned as [*connect.Error], except for Delete, which returns [zanzigo.ErrNotFound], if the tuple does not exist.
+type Client interface {
+	// Check returns whether t is allowed, conditional results are not allowed.
+	Check(ctx context.Context, t zanzigo.Tuple, options ...CheckOption) (bool, error)
+	CheckWithResult(ctx context.Context, t zanzigo.Tuple, options ...CheckOption) (zanzigo.CheckResult, error)
+	// Write writes the tuples in batches (see [WithBatchSize]), each batch atomically. Existing tuples are updated.
+	Write(ctx context.Context, tuples ...zanzigo.Tuple) error
+	Delete(ctx context.Context, t zanzigo.Tuple) error
+	// List returns an iterator over all tuples matching the set fields of filter, pages are fetched as needed.
+	List(ctx context.Context, filter zanzigo.Tuple) *Iterator
+}
+
+const (
+	defaultTimeout    = 10 * time.Second
+	defaultMaxRetries = 3
+	defaultBackoff    = 100 * time.Millisecond
+	defaultMaxBackoff = 2 * time.Second
+	defaultBatchSize  = 1000
+	defaultPageSize   = 100
+)
+
+type Option interface {
+	do(*config)
+}
+
+type config struct {
+	httpClient      connect.HTTPClient
+	clientOptions   []connect.ClientOption
+	token           string
+	store           string
+	timeout         time.Duration
+	maxRetries      int
+	backoff         time.Duration
+	maxBackoff      time.Duration
+	batchSize       int
+	pageSize        int
+	resolverOptions []zanzigo.ResolverOption
+}
+
+type functionAdapter func(*config)
+
+func (fn functionAdapter) do(c *config) {
+	fn(c)
+}
+
+func newConfig(options []Option) config {
+	c := config{
+		httpClient: http.DefaultClient,
+		timeout:    defaultTimeout,
+		maxRetries: defaultMaxRetries,
+		backoff:    defaultBackoff,
+		maxBackoff: defaultMaxBackoff,
+		batchSize:  defaultBatchSize,
+		pageSize:   defaultPageSize,
+	}
+	lo.ForEach(options, func(o Option, _ int) { o.do(&c) })
+	c.batchSize, c.pageSize = max(c.batchSize, 1), max(c.pageSize, 1)
+	return c
+}
+
+// WithHTTPClient sets the HTTP client used to connect to the server, e.g. to configure TLS. Defaults to [http.DefaultClient].
+func WithHTTPClient(httpClient connect.HTTPClient) Option {
+	return functionAdapter(func(c *config) { c.httpClient = httpClient })
+}
+
+// WithClientOptions passes options to the underlying Connect client, e.g. connect.WithGRPC() to use the gRPC protocol.
+func WithClientOptions(options ...connect.ClientOption) Option {
+	return functionAdapter(func(c *config) { c.clientOptions = append(c.clientOptions, options...) })
+}
+
+// WithToken sends the bearer token with all requests.
+func WithToken(token string) Option {
+	return functionAdapter(func(c *config) { c.token = token })
+}
+
+// WithStore scopes all operations to the store with the specified ID instead of the default store.
+func WithStore(id string) Option {
+	return functionAdapter(func(c *config) { c.store = id })
+}
+
+// WithTimeout sets the deadline of each attempt of a request, 0 disables it. Defaults to 10s.
+// Deadlines of the context passed to a method apply as well.
+func WithTimeout(timeout time.Duration) Option {
+	return functionAdapter(func(c *config) { c.timeout = timeout })
+}
+
+// WithRetries sets how often requests failing with connect.CodeUnavailable are retried, 0 disables retries. Defaults to 3.
+// The backoff between attempts starts at initialBackoff and is doubled up to maxBackoff, defaults are 100ms and 2s.
+func WithRetries(maxRetries int, initialBackoff, maxBackoff time.Duration) Option {
+	return functionAdapter(func(c *config) {
+		c.maxRetries, c.backoff, c.maxBackoff = maxRetries, initialBackoff, maxBackoff
+	})
+}
+
+// WithBatchSize sets the maximum number of tuples written at once by Write. Defaults to 1000.
+func WithBatchSize(size int) Option {
+	return functionAdapter(func(c *config) { c.batchSize = size })
+}
+
+// WithPageSize sets the number of tuples fetched at once by iterators returned by List. Defaults to 100.
+func WithPageSize(size int) Option {
+	return functionAdapter(func(c *config) { c.pageSize = size })
+}
+
+// WithResolverOptions passes options to the resolver created by [NewLocal].
+func WithResolverOptions(options ...zanzigo.ResolverOption) Option {
+	return functionAdapter(func(c *config) { c.resolverOptions = append(c.resolverOptions, options...) })
+}
+
+// withTimeout returns the context of a single attempt of a request.
+func (c *config) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// retry calls fn until it succeeds, fails with another code than connect.CodeUnavailable or all retries are used.
+func (c *config) retry(ctx context.Context, fn func(ctx context.Context) error) error {
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := c.withTimeout(ctx)
+		err := fn(attemptCtx)
+		cancel()
+		if err == nil || connect.CodeOf(err) != connect.CodeUnavailable || attempt >= c.maxRetries {
+			return err
+		}
+		// Jitter avoids clients retrying in lockstep after an outage
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, c.maxBackoff)
+	}
+}
+
+type CheckOption interface {
+	do(*checkConfig)
+}
+
+type checkConfig struct {
+	context          map[string]any
+	contextualTuples []zanzigo.Tuple
+}
+
+type checkFunctionAdapter func(*checkConfig)
+
+func (fn checkFunctionAdapter) do(c *checkConfig) {
+	fn(c)
+}
+
+// WithRequestContext passes the context conditions of conditional tuples are evaluated with (see [zanzigo.WithRequestContext]).
+func WithRequestContext(context map[string]any) CheckOption {
+	return checkFunctionAdapter(func(c *checkConfig) { c.context = context })
+}
+
+// WithContextualTuples considers the tuples as if they were stored, but only for this check (see [zanzigo.WithContextualTuples]).
+func WithContextualTuples(tuples ...zanzigo.Tuple) CheckOption {
+	return checkFunctionAdapter(func(c *checkConfig) { c.contextualTuples = append(c.contextualTuples, tuples...) })
+}
+
+func newCheckConfig(options []CheckOption) checkConfig {
+	c := checkConfig{}
+	lo.ForEach(options, func(o CheckOption, _ int) { o.do(&c) })
+	return c
+}
+
+// Iterator iterates over the tuples returned by List and fetches the next page once the current one is exhausted:
+//
+//	for it.Next() {
+//		t := it.Tuple()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type Iterator struct {
+	ctx   context.Context
+	fetch func(ctx context.Context) (tuples []zanzigo.Tuple, last bool, err error)
+	page  []zanzigo.Tuple
+	index int
+	last  bool
+	err   error
+}
+
+// Next advances the iterator to the next tuple and returns false once all tuples were returned or an error occurred.
+func (it *Iterator) Next() bool {
+	it.index++
+	for it.index >= len(it.page) {
+		if it.last || it.err != nil {
+			return false
+		}
+		it.page, it.last, it.err = it.fetch(it.ctx)
+		it.index = 0
+		if it.err != nil {
+			it.page = nil
+			return false
+		}
+	}
+	return true
+}
+
+// Tuple returns the current tuple, Next has to be called first.
+func (it *Iterator) Tuple() zanzigo.Tuple {
+	return it.page[it.index]
+}
+
+// Err returns the error, which stopped the iteration, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// All returns all remaining tuples.
+func (it *Iterator) All() ([]zanzigo.Tuple, error) {
+	tuples := []zanzigo.Tuple{}
+	for it.Next() {
+		tuples = append(tuples, it.Tuple())
+	}
+	return tuples, it.Err()
+}
+
+func newIterator(ctx context.Context, fetch func(ctx context.Context) ([]zanzigo.Tuple, bool, error)) *Iterator {
+	// The index starts before the first tuple of the empty page, so the first call of Next fetches a page
+	return &Iterator{ctx: ctx, fetch: fetch, index: -1}
+}
@@ -0,0 +1,140 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/trevex/zanzigo"
+	v1connect "github.com/trevex/zanzigo/api/zanzigo/v1/zanzigov1connect"
+	"github.com/trevex/zanzigo/client"
+	"github.com/trevex/zanzigo/server"
+	"github.com/trevex/zanzigo/storage/sqlite3"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/require"
+)
+
+var definition = zanzigo.ModelDefinition{
+	Objects: zanzigo.ObjectMap{
+		"user":  zanzigo.RelationMap{},
+		"group": zanzigo.RelationMap{"member": zanzigo.Rule{}},
+		"doc": zanzigo.RelationMap{
+			"editor": zanzigo.Rule{},
+			"viewer": zanzigo.AnyOf(zanzigo.Rule{}, zanzigo.Rule{InheritIf: "editor"}),
+		},
+	},
+	Conditions: zanzigo.ConditionMap{
+		"in_network": {Expression: "inCIDR(ip, cidr)", Parameters: map[string]zanzigo.ConditionParameterType{"ip": "string", "cidr": "string"}},
+	},
+}
+
+func newStorage(t *testing.T) zanzigo.Storage {
+	file := filepath.Join(t.TempDir(), "test.db")
+	require.NoError(t, sqlite3.RunMigrations(file))
+	storage, err := sqlite3.NewSQLite3Storage(file)
+	require.NoError(t, err)
+	t.Cleanup(func() { storage.Close() })
+	return storage
+}
+
+// newServer serves the ZanzigoService, the first failures unary requests fail with connect.CodeUnavailable.
+func newServer(t *testing.T, failures int32) *httptest.Server {
+	stores, err := server.NewStoreRegistry(newStorage(t), definition, 16)
+	require.NoError(t, err)
+	interceptor := connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+			if atomic.AddInt32(&failures, -1) >= 0 {
+				return nil, connect.NewError(connect.CodeUnavailable, errors.New("unavailable"))
+			}
+			return next(ctx, req)
+		}
+	})
+	mux := http.NewServeMux()
+	handler := server.NewZanzigoServiceHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), stores)
+	mux.Handle(v1connect.NewZanzigoServiceHandler(handler, connect.WithInterceptors(interceptor)))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClients(t *testing.T) {
+	model, err := zanzigo.NewModelFromDefinition(definition)
+	require.NoError(t, err)
+	local, err := client.NewLocal(model, newStorage(t), 16, client.WithPageSize(2), client.WithBatchSize(2))
+	require.NoError(t, err)
+	clients := map[string]client.Client{
+		"remote": client.New(newServer(t, 0).URL, client.WithPageSize(2), client.WithBatchSize(2)),
+		"local":  local,
+	}
+
+	for name, c := range clients {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			conditional := zanzigo.TupleString("doc:roadmap#viewer@user:bob")
+			conditional.Condition = &zanzigo.ConditionRef{Name: "in_network", Context: map[string]any{"cidr": "10.0.0.0/8"}}
+			tuples := []zanzigo.Tuple{
+				zanzigo.TupleString("group:eng#member@user:alice"),
+				zanzigo.TupleString("doc:readme#editor@group:eng#member"),
+				conditional,
+			}
+			for i := 0; i < 4; i++ {
+				tuples = append(tuples, zanzigo.TupleString(fmt.Sprintf("doc:doc%d#viewer@user:carol", i)))
+			}
+			require.NoError(t, c.Write(ctx, tuples...))
+			require.NoError(t, c.Write(ctx, zanzigo.TupleString("doc:readme#viewer@user:dave")))
+
+			allowed, err := c.Check(ctx, zanzigo.TupleString("doc:readme#viewer@user:alice"))
+			require.NoError(t, err)
+			require.True(t, allowed)
+			allowed, err = c.Check(ctx, zanzigo.TupleString("doc:readme#viewer@user:bob"))
+			require.NoError(t, err)
+			require.False(t, allowed)
+			allowed, err = c.Check(ctx, zanzigo.TupleString("doc:readme#viewer@user:bob"), client.WithContextualTuples(zanzigo.TupleString("group:eng#member@user:bob")))
+			require.NoError(t, err)
+			require.True(t, allowed)
+			result, err := c.CheckWithResult(ctx, zanzigo.TupleString("doc:roadmap#viewer@user:bob"))
+			require.NoError(t, err)
+			require.Equal(t, zanzigo.CheckResultConditional, result)
+			allowed, err = c.Check(ctx, zanzigo.TupleString("doc:roadmap#viewer@user:bob"), client.WithRequestContext(map[string]any{"ip": "10.1.2.3"}))
+			require.NoError(t, err)
+			require.True(t, allowed)
+
+			// Four tuples are listed in two pages and an empty last page
+			listed, err := c.List(ctx, zanzigo.Tuple{SubjectType: "user", SubjectID: "carol"}).All()
+			require.NoError(t, err)
+			require.Len(t, listed, 4)
+			listed, err = c.List(ctx, zanzigo.Tuple{ObjectType: "doc", ObjectID: "roadmap"}).All()
+			require.NoError(t, err)
+			require.Equal(t, []zanzigo.Tuple{conditional}, listed)
+
+			require.NoError(t, c.Delete(ctx, zanzigo.TupleString("doc:readme#viewer@user:dave")))
+			require.ErrorIs(t, c.Delete(ctx, zanzigo.TupleString("doc:readme#viewer@user:dave")), zanzigo.ErrNotFound)
+			require.Error(t, c.Write(ctx, zanzigo.TupleString("doc:readme#owner@user:dave")))
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	c := client.New(newServer(t, 2).URL, client.WithRetries(2, time.Millisecond, 5*time.Millisecond))
+	_, err := c.Check(ctx, zanzigo.TupleString("doc:readme#viewer@user:alice"))
+	require.NoError(t, err)
+
+	c = client.New(newServer(t, 2).URL, client.WithRetries(1, time.Millisecond, 5*time.Millisecond))
+	_, err = c.Check(ctx, zanzigo.TupleString("doc:readme#viewer@user:alice"))
+	require.Equal(t, connect.CodeUnavailable, connect.CodeOf(err))
+
+	// Other errors are not retried
+	it := client.New(newServer(t, 0).URL, client.WithStore("unknown")).List(ctx, zanzigo.EmptyTuple)
+	require.False(t, it.Next())
+	require.Equal(t, connect.CodeNotFound, connect.CodeOf(it.Err()))
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/trevex/zanzigo"
+)
+
+type localClient struct {
+	config
+	model    *zanzigo.Model
+	storage  zanzigo.Storage
+	resolver *zanzigo.Resolver
+}
+
+// NewLocal returns a [Client] using an embedded [zanzigo.Resolver] on top of storage, e.g. for tests or applications
+// not running a separate server. Tuples are validated against the model like the server does, retries do not apply.
+func NewLocal(model *zanzigo.Model, storage zanzigo.Storage, maxDepth int, options ...Option) (Client, error) {
+	c := &localClient{config: newConfig(options), model: model, storage: storage}
+	if c.store != "" {
+		if err := zanzigo.ValidateStoreID(c.store); err != nil {
+			return nil, err
+		}
+		c.storage = storage.ForStore(c.store)
+	}
+	resolver, err := zanzigo.NewResolver(model, c.storage, maxDepth, c.resolverOptions...)
+	if err != nil {
+		return nil, err
+	}
+	c.resolver = resolver
+	return c, nil
+}
+
+func (c *localClient) Check(ctx context.Context, t zanzigo.Tuple, options ...CheckOption) (bool, error) {
+	result, err := c.CheckWithResult(ctx, t, options...)
+	return result == zanzigo.CheckResultAllowed, err
+}
+
+func (c *localClient) CheckWithResult(ctx context.Context, t zanzigo.Tuple, options ...CheckOption) (zanzigo.CheckResult, error) {
+	opts := newCheckConfig(options)
+	if err := c.validate(append([]zanzigo.Tuple{t}, opts.contextualTuples...)); err != nil {
+		return zanzigo.CheckResultDenied, err
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return c.resolver.CheckWithResult(ctx, t, zanzigo.WithRequestContext(opts.context), zanzigo.WithContextualTuples(opts.contextualTuples...))
+}
+
+func (c *localClient) Write(ctx context.Context, tuples ...zanzigo.Tuple) error {
+	if err := c.validate(tuples); err != nil {
+		return err
+	}
+	for len(tuples) > 0 {
+		batch := tuples[:min(c.batchSize, len(tuples))]
+		tuples = tuples[len(batch):]
+		ctx, cancel := c.withTimeout(ctx)
+		err := zanzigo.WriteBatch(ctx, c.storage, batch)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *localClient) Delete(ctx context.Context, t zanzigo.Tuple) error {
+	if err := c.validate([]zanzigo.Tuple{t}); err != nil {
+		return err
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return c.storage.Delete(ctx, t)
+}
+
+func (c *localClient) List(ctx context.Context, filter zanzigo.Tuple) *Iterator {
+	pagination := zanzigo.Pagination{Cursor: c.storage.CursorStart(), Limit: c.pageSize}
+	return newIterator(ctx, func(ctx context.Context) ([]zanzigo.Tuple, bool, error) {
+		ctx, cancel := c.withTimeout(ctx)
+		defer cancel()
+		tuples, cursor, err := c.storage.List(ctx, filter, pagination)
+		if err != nil {
+			return nil, false, err
+		}
+		pagination.Cursor = cursor
+		return tuples, len(tuples) < pagination.Limit, nil
+	})
+}
+
+func (c *localClient) validate(tuples []zanzigo.Tuple) error {
+	for _, t := range tuples {
+		if !c.model.IsValid(t) {
+			return fmt.Errorf("%w: %s", ErrInvalidTuple, t.ToString())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/trevex/zanzigo"
+	v1 "github.com/trevex/zanzigo/api/zanzigo/v1"
+	v1connect "github.com/trevex/zanzigo/api/zanzigo/v1/zanzigov1connect"
+	"github.com/trevex/zanzigo/internal/convert"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type remoteClient struct {
+	config
+	service v1connect.ZanzigoServiceClient
+}
+
+// New returns a [Client] of the server at address, e.g. "https://zanzigo.example.com".
+// Requests failing with connect.CodeUnavailable are retried (see [WithRetries]), which is safe, as all requests are idempotent.
+func New(address string, options ...Option) Client {
+	c := &remoteClient{config: newConfig(options)}
+	clientOptions := c.clientOptions
+	if c.token != "" {
+		clientOptions = append(clientOptions, connect.WithInterceptors(NewTokenInterceptor(c.token)))
+	}
+	c.service = v1connect.NewZanzigoServiceClient(c.httpClient, strings.TrimSuffix(address, "/"), clientOptions...)
+	return c
+}
+
+func (c *remoteClient) Check(ctx context.Context, t zanzigo.Tuple, options ...CheckOption) (bool, error) {
+	result, err := c.CheckWithResult(ctx, t, options...)
+	return result == zanzigo.CheckResultAllowed, err
+}
+
+func (c *remoteClient) CheckWithResult(ctx context.Context, t zanzigo.Tuple, options ...CheckOption) (zanzigo.CheckResult, error) {
+	opts := newCheckConfig(options)
+	req := &v1.CheckRequest{
+		Tuple:            convert.ToProtobufTuple(&t),
+		ContextualTuples: convert.ToProtobufTuples(opts.contextualTuples),
+		StoreId:          c.store,
+	}
+	if opts.context != nil {
+		requestContext, err := structpb.NewStruct(opts.context)
+		if err != nil {
+			return zanzigo.CheckResultDenied, fmt.Errorf("invalid request context: %w", err)
+		}
+		req.Context = requestContext
+	}
+
+	var resp *connect.Response[v1.CheckResponse]
+	err := c.retry(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.service.Check(ctx, connect.NewRequest(req))
+		return err
+	})
+	switch {
+	case err != nil:
+		return zanzigo.CheckResultDenied, err
+	case resp.Msg.Result:
+		return zanzigo.CheckResultAllowed, nil
+	case resp.Msg.Conditional:
+		return zanzigo.CheckResultConditional, nil
+	}
+	return zanzigo.CheckResultDenied, nil
+}
+
+// Write uses the Write-RPC for a single tuple and the ImportTuples-RPC with a single message per batch otherwise,
+// so every batch is retried on its own.
+func (c *remoteClient) Write(ctx context.Context, tuples ...zanzigo.Tuple) error {
+	if len(tuples) == 1 {
+		return c.retry(ctx, func(ctx context.Context) error {
+			_, err := c.service.Write(ctx, connect.NewRequest(&v1.WriteRequest{Tuple: convert.ToProtobufTuple(&tuples[0]), StoreId: c.store}))
+			return err
+		})
+	}
+	for len(tuples) > 0 {
+		batch := tuples[:min(c.batchSize, len(tuples))]
+		tuples = tuples[len(batch):]
+		err := c.retry(ctx, func(ctx context.Context) error {
+			stream := c.service.ImportTuples(ctx)
+			if err := stream.Send(&v1.ImportTuplesRequest{Tuples: convert.ToProtobufTuples(batch), StoreId: c.store}); err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+			// The actual error is returned by CloseAndReceive, if Send failed with io.EOF
+			_, err := stream.CloseAndReceive()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *remoteClient) Delete(ctx context.Context, t zanzigo.Tuple) error {
+	err := c.retry(ctx, func(ctx context.Context) error {
+		_, err := c.service.Delete(ctx, connect.NewRequest(&v1.DeleteRequest{Tuple: convert.ToProtobufTuple(&t), StoreId: c.store}))
+		return err
+	})
+	if connect.CodeOf(err) == connect.CodeNotFound {
+		return fmt.Errorf("%w: %w", zanzigo.ErrNotFound, err)
+	}
+	return err
+}
+
+func (c *remoteClient) List(ctx context.Context, filter zanzigo.Tuple) *Iterator {
+	req := &v1.ListRequest{
+		Filter:     convert.ToProtobufTuple(&filter),
+		Pagination: &v1.Pagination{Limit: uint32(c.pageSize)},
+		StoreId:    c.store,
+	}
+	return newIterator(ctx, func(ctx context.Context) ([]zanzigo.Tuple, bool, error) {
+		var resp *connect.Response[v1.ListResponse]
+		err := c.retry(ctx, func(ctx context.Context) (err error) {
+			resp, err = c.service.List(ctx, connect.NewRequest(req))
+			return err
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		// The cursor is empty once the last page was returned
+		req.Pagination.Cursor = resp.Msg.Cursor
+		return convert.ToZanzigoTuples(resp.Msg.Tuples), resp.Msg.Cursor == "", nil
+	})
+}
+
+// NewTokenInterceptor returns an interceptor sending the bearer token with unary and streaming requests,
+// e.g. to authenticate clients created using zanzigov1connect directly.
+func NewTokenInterceptor(token string) connect.Interceptor {
+	return tokenInterceptor(token)
+}
+
+type tokenInterceptor string
+
+func (i tokenInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		req.Header().Set("Authorization", "Bearer "+string(i))
+		return next(ctx, req)
+	}
+}
+
+func (i tokenInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		conn := next(ctx, spec)
+		conn.RequestHeader().Set("Authorization", "Bearer "+string(i))
+		return conn
+	}
+}
+
+func (i tokenInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
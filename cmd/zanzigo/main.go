@@ -20,7 +20,8 @@ func main() {
 	mlog := log.WithGroup("main")
 
 	undo, err := maxprocs.Set(maxprocs.Logger(func(format string, a ...any) {
-		log.Info(fmt.Sprintf(format, a...))
+		// Logged at debug level, as the logs are written to stdout, which is also used by commands like export
+		log.Debug(fmt.Sprintf(format, a...))
 	}))
 	defer undo()
 	if err != nil {
@@ -40,6 +41,11 @@ func main() {
 
 	// Add all sub-commands
 	rootCmd.AddCommand(server.NewServerCmd(log.WithGroup("server")))
+	rootCmd.AddCommand(server.NewMigrateCmd(log.WithGroup("migrate")))
+	rootCmd.AddCommand(server.NewModelCmd(log.WithGroup("model")))
+	rootCmd.AddCommand(server.NewClientCmds()...)
+	rootCmd.AddCommand(server.NewTransferCmds()...)
+	rootCmd.AddCommand(server.NewConfigCmd())
 
 	// Make sure to cancel the context if a signal was received
 	sigs := make(chan os.Signal, 1)
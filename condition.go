@@ -0,0 +1,306 @@
+package zanzigo
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter"
+)
+
+var (
+	// Returned if a condition of the model can not be compiled or a tuple references an unknown condition.
+	ErrInvalidCondition = errors.New("invalid condition")
+	// Returned if a value of the context can not be converted to the type of the respective parameter.
+	ErrInvalidConditionContext = errors.New("invalid condition context")
+)
+
+// ConditionParameterType is the type of a parameter of a [Condition].
+// Values of the context are converted to the declared type before the condition is evaluated,
+// so values decoded from JSON, e.g. numbers as float64 or timestamps as strings, can be used as is.
+type ConditionParameterType string
+
+const (
+	ConditionParameterString    ConditionParameterType = "string"
+	ConditionParameterInt       ConditionParameterType = "int"
+	ConditionParameterUint      ConditionParameterType = "uint"
+	ConditionParameterDouble    ConditionParameterType = "double"
+	ConditionParameterBool      ConditionParameterType = "bool"
+	ConditionParameterBytes     ConditionParameterType = "bytes"     // base64-encoded, if a string is supplied
+	ConditionParameterTimestamp ConditionParameterType = "timestamp" // RFC 3339, if a string is supplied
+	ConditionParameterDuration  ConditionParameterType = "duration"  // as understood by time.ParseDuration, if a string is supplied
+	ConditionParameterList      ConditionParameterType = "list"
+	ConditionParameterMap       ConditionParameterType = "map"
+	ConditionParameterAny       ConditionParameterType = "any"
+)
+
+// A Condition is a named [CEL]-expression, which needs to evaluate to true for a conditional [Tuple] to apply.
+// The parameters of the expression are supplied by the context stored with the tuple and the context supplied
+// with a check, e.g. the IP address of the request. If both supply the same parameter, the stored context wins.
+//
+// Besides the standard library of CEL, the function `inCIDR(ip, cidr)` is available to check IP addresses against ranges.
+//
+// [CEL]: https://github.com/google/cel-spec
+type Condition struct {
+	Expression string                            `json:"expression"`
+	Parameters map[string]ConditionParameterType `json:"parameters,omitempty"`
+}
+
+// ConditionMap maps condition-names to conditions.
+type ConditionMap map[string]Condition
+
+// A ConditionRef is stored with a [Tuple] to make it conditional.
+type ConditionRef struct {
+	// Name of the [Condition] in the [Model].
+	Name string `json:"name"`
+	// Context of the tuple, e.g. an embargo date, which is merged with the context of the check.
+	Context map[string]any `json:"context,omitempty"`
+}
+
+// CheckResult is the tri-state result of [Resolver.CheckWithResult].
+type CheckResult int
+
+const (
+	// No relationship exists, which grants access.
+	CheckResultDenied CheckResult = iota
+	// A relationship exists, which grants access.
+	CheckResultAllowed
+	// Access would only be granted through conditional relationships, for which parameters were missing in the context.
+	CheckResultConditional
+)
+
+func (r CheckResult) String() string {
+	switch r {
+	case CheckResultAllowed:
+		return "allowed"
+	case CheckResultConditional:
+		return "conditional"
+	default:
+		return "denied"
+	}
+}
+
+type compiledCondition struct {
+	program    cel.Program
+	parameters map[string]ConditionParameterType
+}
+
+type conditionMap map[string]*compiledCondition
+
+func compileConditions(conditions ConditionMap) (conditionMap, error) {
+	compiled := conditionMap{}
+	for name, condition := range conditions {
+		c, err := compileCondition(condition)
+		if err != nil {
+			return nil, fmt.Errorf("%w: condition '%s': %v", ErrInvalidCondition, name, err)
+		}
+		compiled[name] = c
+	}
+	return compiled, nil
+}
+
+func compileCondition(condition Condition) (*compiledCondition, error) {
+	options := []cel.EnvOption{inCIDRFunction}
+	for name, typ := range condition.Parameters {
+		celType, err := celTypeFor(typ)
+		if err != nil {
+			return nil, fmt.Errorf("parameter '%s': %w", name, err)
+		}
+		options = append(options, cel.Variable(name, celType))
+	}
+	env, err := cel.NewEnv(options...)
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(condition.Expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("expression has to evaluate to bool, but evaluates to %s", ast.OutputType())
+	}
+	program, err := env.Program(ast, cel.EvalOptions(cel.OptPartialEval))
+	if err != nil {
+		return nil, err
+	}
+	return &compiledCondition{program, condition.Parameters}, nil
+}
+
+// evaluate returns whether the condition is met using the stored and request context.
+// If parameters required to decide are missing, [CheckResultConditional] is returned.
+func (c *compiledCondition) evaluate(stored, request map[string]any) (CheckResult, error) {
+	vars := map[string]any{}
+	missing := []*interpreter.AttributePattern{}
+	for name, typ := range c.parameters {
+		value, ok := stored[name]
+		if !ok {
+			value, ok = request[name]
+		}
+		if !ok {
+			missing = append(missing, cel.AttributePattern(name))
+			continue
+		}
+		converted, err := convertConditionParameter(typ, value)
+		if err != nil {
+			return CheckResultDenied, fmt.Errorf("%w: parameter '%s': %v", ErrInvalidConditionContext, name, err)
+		}
+		vars[name] = converted
+	}
+	activation, err := cel.PartialVars(vars, missing...)
+	if err != nil {
+		return CheckResultDenied, err
+	}
+	out, _, err := c.program.Eval(activation)
+	if err != nil {
+		return CheckResultDenied, err
+	}
+	if types.IsUnknown(out) {
+		return CheckResultConditional, nil
+	}
+	if out == types.True {
+		return CheckResultAllowed, nil
+	}
+	return CheckResultDenied, nil
+}
+
+func celTypeFor(typ ConditionParameterType) (*cel.Type, error) {
+	switch typ {
+	case ConditionParameterString:
+		return cel.StringType, nil
+	case ConditionParameterInt:
+		return cel.IntType, nil
+	case ConditionParameterUint:
+		return cel.UintType, nil
+	case ConditionParameterDouble:
+		return cel.DoubleType, nil
+	case ConditionParameterBool:
+		return cel.BoolType, nil
+	case ConditionParameterBytes:
+		return cel.BytesType, nil
+	case ConditionParameterTimestamp:
+		return cel.TimestampType, nil
+	case ConditionParameterDuration:
+		return cel.DurationType, nil
+	case ConditionParameterList:
+		return cel.ListType(cel.DynType), nil
+	case ConditionParameterMap:
+		return cel.MapType(cel.StringType, cel.DynType), nil
+	case ConditionParameterAny:
+		return cel.DynType, nil
+	default:
+		return nil, fmt.Errorf("unknown parameter type '%s'", typ)
+	}
+}
+
+func convertConditionParameter(typ ConditionParameterType, value any) (any, error) {
+	switch typ {
+	case ConditionParameterInt:
+		switch v := value.(type) {
+		case int:
+			return int64(v), nil
+		case int32:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case float64:
+			if v != math.Trunc(v) || v < math.MinInt64 || v > math.MaxInt64 {
+				return nil, fmt.Errorf("%v is not an integer", v)
+			}
+			return int64(v), nil
+		}
+	case ConditionParameterUint:
+		switch v := value.(type) {
+		case uint:
+			return uint64(v), nil
+		case uint32:
+			return uint64(v), nil
+		case uint64:
+			return v, nil
+		case int:
+			if v >= 0 {
+				return uint64(v), nil
+			}
+		case int64:
+			if v >= 0 {
+				return uint64(v), nil
+			}
+		case float64:
+			if v == math.Trunc(v) && v >= 0 && v <= math.MaxUint64 {
+				return uint64(v), nil
+			}
+		}
+	case ConditionParameterDouble:
+		switch v := value.(type) {
+		case float32:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		}
+	case ConditionParameterBytes:
+		switch v := value.(type) {
+		case []byte:
+			return v, nil
+		case string:
+			return base64.StdEncoding.DecodeString(v)
+		}
+	case ConditionParameterTimestamp:
+		switch v := value.(type) {
+		case time.Time:
+			return v, nil
+		case string:
+			return time.Parse(time.RFC3339Nano, v)
+		}
+	case ConditionParameterDuration:
+		switch v := value.(type) {
+		case time.Duration:
+			return v, nil
+		case string:
+			return time.ParseDuration(v)
+		}
+	case ConditionParameterString:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case ConditionParameterBool:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	case ConditionParameterList:
+		if v, ok := value.([]any); ok {
+			return v, nil
+		}
+	case ConditionParameterMap:
+		if v, ok := value.(map[string]any); ok {
+			return v, nil
+		}
+	case ConditionParameterAny:
+		return value, nil
+	}
+	return nil, fmt.Errorf("unable to convert %T to %s", value, typ)
+}
+
+var inCIDRFunction = cel.Function("inCIDR",
+	cel.Overload("inCIDR_string_string", []*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+		cel.BinaryBinding(func(ip, cidr ref.Val) ref.Val {
+			addr, err := netip.ParseAddr(ip.Value().(string))
+			if err != nil {
+				return types.NewErr("inCIDR: %v", err)
+			}
+			prefix, err := netip.ParsePrefix(cidr.Value().(string))
+			if err != nil {
+				return types.NewErr("inCIDR: %v", err)
+			}
+			return types.Bool(prefix.Contains(addr.Unmap()))
+		}),
+	),
+)
@@ -0,0 +1,94 @@
+package zanzigo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCondition(t *testing.T) {
+	conditions, err := compileConditions(ConditionMap{
+		"before": {
+			Expression: "now < embargo",
+			Parameters: map[string]ConditionParameterType{
+				"now":     ConditionParameterTimestamp,
+				"embargo": ConditionParameterTimestamp,
+			},
+		},
+		"in_network_or_admin": {
+			Expression: "admin || inCIDR(ip, cidr)",
+			Parameters: map[string]ConditionParameterType{
+				"admin": ConditionParameterBool,
+				"ip":    ConditionParameterString,
+				"cidr":  ConditionParameterString,
+			},
+		},
+		"max_count": {
+			Expression: "count <= max",
+			Parameters: map[string]ConditionParameterType{
+				"count": ConditionParameterInt,
+				"max":   ConditionParameterInt,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	stored := map[string]any{"embargo": "2030-01-01T00:00:00Z"}
+	result, err := conditions["before"].evaluate(stored, map[string]any{"now": time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+	require.Equal(t, CheckResultAllowed, result)
+	result, err = conditions["before"].evaluate(stored, map[string]any{"now": "2031-01-01T00:00:00Z"})
+	require.NoError(t, err)
+	require.Equal(t, CheckResultDenied, result)
+	result, err = conditions["before"].evaluate(stored, nil)
+	require.NoError(t, err)
+	require.Equal(t, CheckResultConditional, result)
+	// The stored context takes precedence
+	result, err = conditions["before"].evaluate(stored, map[string]any{"now": "2029-01-01T00:00:00Z", "embargo": "2040-01-01T00:00:00Z"})
+	require.NoError(t, err)
+	require.Equal(t, CheckResultAllowed, result)
+
+	// Missing parameters are irrelevant if the result is already known
+	stored = map[string]any{"cidr": "10.0.0.0/8"}
+	result, err = conditions["in_network_or_admin"].evaluate(stored, map[string]any{"admin": true})
+	require.NoError(t, err)
+	require.Equal(t, CheckResultAllowed, result)
+	result, err = conditions["in_network_or_admin"].evaluate(stored, map[string]any{"admin": false})
+	require.NoError(t, err)
+	require.Equal(t, CheckResultConditional, result)
+	result, err = conditions["in_network_or_admin"].evaluate(stored, map[string]any{"admin": false, "ip": "::ffff:10.0.0.1"})
+	require.NoError(t, err)
+	require.Equal(t, CheckResultAllowed, result)
+
+	// Numbers decoded from JSON are converted
+	result, err = conditions["max_count"].evaluate(map[string]any{"max": float64(3)}, map[string]any{"count": 2})
+	require.NoError(t, err)
+	require.Equal(t, CheckResultAllowed, result)
+	_, err = conditions["max_count"].evaluate(map[string]any{"max": 2.5}, map[string]any{"count": 2})
+	require.ErrorIs(t, err, ErrInvalidConditionContext)
+}
+
+func TestConditionCompilation(t *testing.T) {
+	invalid := []Condition{
+		{Expression: "undeclared > 1"},
+		{Expression: "x + 1", Parameters: map[string]ConditionParameterType{"x": ConditionParameterInt}},
+		{Expression: "x", Parameters: map[string]ConditionParameterType{"x": "ipaddress"}},
+	}
+	for _, condition := range invalid {
+		_, err := compileConditions(ConditionMap{"invalid": condition})
+		require.ErrorIs(t, err, ErrInvalidCondition, condition.Expression)
+	}
+
+	model, err := NewModel(ObjectMap{
+		"user": RelationMap{},
+		"doc":  RelationMap{"viewer": Rule{}},
+	}, WithConditions(ConditionMap{"always": {Expression: "true"}}))
+	require.NoError(t, err)
+
+	tuple := TupleString("doc:mydoc#viewer@user:myuser")
+	tuple.Condition = &ConditionRef{Name: "always"}
+	require.True(t, model.IsValid(tuple))
+	tuple.Condition = &ConditionRef{Name: "unknown"}
+	require.False(t, model.IsValid(tuple))
+}
@@ -0,0 +1,110 @@
+package zanzigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Number of tuples listed at once while expanding.
+const expandPageSize = 1000
+
+// ExpandNode is a node of the tree returned by [Resolver.Expand].
+type ExpandNode struct {
+	// The expanded relation of the object, the subject-fields are empty.
+	Userset Tuple `json:"userset"`
+	// Tuples of the object granting the relation, which either reference subjects directly,
+	// usersets or objects the relation is inherited from.
+	Tuples []Tuple `json:"tuples"`
+	// Expansions of the usersets and objects referenced by Tuples.
+	Children []*ExpandNode `json:"children,omitempty"`
+}
+
+// Expand returns the tree of all tuples granting the relation of the object specified by the object-fields of t,
+// e.g. to show who has access to a document and why. Usersets and objects the relation is inherited from are expanded
+// recursively, but every userset at most once. Conditions of conditional tuples are not evaluated.
+func (r *Resolver) Expand(ctx context.Context, t Tuple) (*ExpandNode, error) {
+	if _, ok := r.rules[t.ObjectType][t.ObjectRelation]; !ok {
+		return nil, fmt.Errorf("failed to find %s > %s in query map", t.ObjectType, t.ObjectRelation)
+	}
+	return r.expand(ctx, Tuple{ObjectType: t.ObjectType, ObjectID: t.ObjectID, ObjectRelation: t.ObjectRelation}, 0, map[Tuple]bool{})
+}
+
+func (r *Resolver) expand(ctx context.Context, userset Tuple, depth int, visited map[Tuple]bool) (*ExpandNode, error) {
+	if depth > r.maxDepth {
+		return nil, errors.New("max depth exceeded")
+	}
+	visited[userset] = true
+	node := &ExpandNode{Userset: userset, Tuples: []Tuple{}}
+	seen := map[string]bool{}
+	children := []Tuple{}
+	add := func(filter Tuple, inherited []string) error {
+		tuples, err := listAll(ctx, r.storage, filter)
+		if err != nil {
+			return err
+		}
+		for _, t := range tuples {
+			if !seen[t.ToString()] {
+				seen[t.ToString()] = true
+				node.Tuples = append(node.Tuples, t)
+			}
+			if t.SubjectRelation != "" {
+				children = append(children, Tuple{ObjectType: t.SubjectType, ObjectID: t.SubjectID, ObjectRelation: t.SubjectRelation})
+			}
+			for _, relation := range inherited {
+				children = append(children, Tuple{ObjectType: t.SubjectType, ObjectID: t.SubjectID, ObjectRelation: relation})
+			}
+		}
+		return nil
+	}
+
+	listed := map[string]bool{}
+	for _, rule := range r.rules[userset.ObjectType][userset.ObjectRelation] {
+		for _, relation := range rule.Relations {
+			filter := Tuple{ObjectType: userset.ObjectType, ObjectID: userset.ObjectID, ObjectRelation: relation}
+			if rule.Kind == KindIndirect {
+				filter.SubjectType = rule.Subject
+				if err := add(filter, rule.WithRelationToSubject); err != nil {
+					return nil, err
+				}
+			} else if !listed[relation] {
+				// Direct and direct userset rules share their relations, so they are only listed once
+				listed[relation] = true
+				if err := add(filter, nil); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	for _, child := range children {
+		if visited[child] {
+			continue
+		}
+		if _, ok := r.rules[child.ObjectType][child.ObjectRelation]; !ok {
+			return nil, fmt.Errorf("failed to find %s > %s in query map", child.ObjectType, child.ObjectRelation)
+		}
+		expanded, err := r.expand(ctx, child, depth+1, visited)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, expanded)
+	}
+	return node, nil
+}
+
+func listAll(ctx context.Context, storage Storage, filter Tuple) ([]Tuple, error) {
+	all := []Tuple{}
+	cursor := storage.CursorStart()
+	for {
+		tuples, next, err := storage.List(ctx, filter, Pagination{Limit: expandPageSize, Cursor: cursor})
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, tuples...)
+		if len(tuples) < expandPageSize {
+			return all, nil
+		}
+		cursor = next
+	}
+}
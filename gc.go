@@ -0,0 +1,42 @@
+package zanzigo
+
+import (
+	"context"
+	"time"
+)
+
+// A GarbageCollector periodically removes expired tuples of all stores from a [Storage]-implementation.
+type GarbageCollector struct {
+	storage  Storage
+	interval time.Duration
+	// Called after every collection with the number of removed tuples or the error that occurred.
+	OnCollect func(removed int, err error)
+}
+
+// NewGarbageCollector creates a [GarbageCollector] removing expired tuples from storage every interval.
+func NewGarbageCollector(storage Storage, interval time.Duration) *GarbageCollector {
+	return &GarbageCollector{storage: storage, interval: interval}
+}
+
+// Collect removes all tuples that are expired at the time of calling.
+func (gc *GarbageCollector) Collect(ctx context.Context) (int, error) {
+	removed, err := gc.storage.DeleteExpired(ctx, time.Now())
+	if gc.OnCollect != nil {
+		gc.OnCollect(removed, err)
+	}
+	return removed, err
+}
+
+// Run blocks and collects garbage every interval until ctx is cancelled.
+func (gc *GarbageCollector) Run(ctx context.Context) {
+	ticker := time.NewTicker(gc.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, _ = gc.Collect(ctx)
+		}
+	}
+}
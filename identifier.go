@@ -0,0 +1,80 @@
+package zanzigo
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var (
+	// Returned by [IdentifierRules.Validate] if a field of a tuple violates the rules.
+	ErrInvalidIdentifier = errors.New("invalid identifier")
+)
+
+// IdentifierRules restrict the syntax of the identifiers used in a [Tuple].
+// A nil pattern or a maximum length of zero does not restrict the respective identifiers,
+// so the zero value accepts any non-empty identifier.
+type IdentifierRules struct {
+	// Pattern object- and subject-types have to match.
+	TypePattern *regexp.Regexp
+	// Pattern object- and subject-ids have to match.
+	IDPattern *regexp.Regexp
+	// Pattern object- and subject-relations have to match.
+	RelationPattern *regexp.Regexp
+	// Maximum length in bytes of object- and subject-types.
+	MaxTypeLength int
+	// Maximum length in bytes of object- and subject-ids.
+	MaxIDLength int
+	// Maximum length in bytes of object- and subject-relations.
+	MaxRelationLength int
+}
+
+// DefaultIdentifierRules only allow identifiers that can be safely represented in Zanzibar-format (see [ParseTuple])
+// and fit into the columns of every storage-implementation.
+var DefaultIdentifierRules = IdentifierRules{
+	TypePattern:       regexp.MustCompile(`^[a-z][a-z0-9_]*$`),
+	IDPattern:         regexp.MustCompile(`^[a-zA-Z0-9/_|\-=+.]+$`),
+	RelationPattern:   regexp.MustCompile(`^[a-z][a-z0-9_]*$`),
+	MaxTypeLength:     64,
+	MaxIDLength:       255,
+	MaxRelationLength: 64,
+}
+
+// Validate checks all identifiers of the [Tuple] t and returns an error wrapping [ErrInvalidIdentifier]
+// for the first identifier violating the rules. Only the subject relation is allowed to be empty.
+func (r *IdentifierRules) Validate(t Tuple) error {
+	if err := validateIdentifier("object_type", t.ObjectType, r.TypePattern, r.MaxTypeLength); err != nil {
+		return err
+	}
+	if err := validateIdentifier("object_id", t.ObjectID, r.IDPattern, r.MaxIDLength); err != nil {
+		return err
+	}
+	if err := validateIdentifier("object_relation", t.ObjectRelation, r.RelationPattern, r.MaxRelationLength); err != nil {
+		return err
+	}
+	if err := validateIdentifier("subject_type", t.SubjectType, r.TypePattern, r.MaxTypeLength); err != nil {
+		return err
+	}
+	if err := validateIdentifier("subject_id", t.SubjectID, r.IDPattern, r.MaxIDLength); err != nil {
+		return err
+	}
+	if t.SubjectRelation != "" {
+		if err := validateIdentifier("subject_relation", t.SubjectRelation, r.RelationPattern, r.MaxRelationLength); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateIdentifier(field, value string, pattern *regexp.Regexp, maxLength int) error {
+	if value == "" {
+		return fmt.Errorf("%w: %s is empty", ErrInvalidIdentifier, field)
+	}
+	if maxLength > 0 && len(value) > maxLength {
+		return fmt.Errorf("%w: %s exceeds maximum length of %d", ErrInvalidIdentifier, field, maxLength)
+	}
+	if pattern != nil && !pattern.MatchString(value) {
+		return fmt.Errorf("%w: %s '%s' does not match '%s'", ErrInvalidIdentifier, field, value, pattern.String())
+	}
+	return nil
+}
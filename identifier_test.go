@@ -0,0 +1,38 @@
+package zanzigo
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentifierRules(t *testing.T) {
+	rules := DefaultIdentifierRules
+
+	require.NoError(t, rules.Validate(TupleString("doc:my-doc.v2#viewer@user:a/b_c")))
+	require.NoError(t, rules.Validate(TupleString("doc:mydoc#viewer@group:mygroup#member")))
+
+	invalid := []Tuple{
+		{ObjectType: "Doc", ObjectID: "mydoc", ObjectRelation: "viewer", SubjectType: "user", SubjectID: "myuser"},
+		{ObjectType: "doc", ObjectID: "my doc", ObjectRelation: "viewer", SubjectType: "user", SubjectID: "myuser"},
+		{ObjectType: "doc", ObjectID: "mydoc", ObjectRelation: "viewer", SubjectType: "user", SubjectID: "a@b"},
+		{ObjectType: "doc", ObjectID: "mydoc", ObjectRelation: "viewer", SubjectType: "user", SubjectID: ""},
+		{ObjectType: "doc", ObjectID: strings.Repeat("a", 256), ObjectRelation: "viewer", SubjectType: "user", SubjectID: "myuser"},
+		{ObjectType: "doc", ObjectID: "mydoc", ObjectRelation: "viewer", SubjectType: "group", SubjectID: "mygroup", SubjectRelation: "Member"},
+	}
+	for _, tuple := range invalid {
+		require.ErrorIs(t, rules.Validate(tuple), ErrInvalidIdentifier, tuple.ToString())
+	}
+
+	// The zero value only requires identifiers to be non-empty
+	rules = IdentifierRules{}
+	require.NoError(t, rules.Validate(Tuple{ObjectType: "Doc", ObjectID: "a b@c", ObjectRelation: "viewer", SubjectType: "user", SubjectID: strings.Repeat("a", 1024)}))
+	require.Error(t, rules.Validate(Tuple{ObjectType: "doc", ObjectID: "mydoc", ObjectRelation: "viewer", SubjectType: "user"}))
+
+	rules = IdentifierRules{IDPattern: regexp.MustCompile(`^[0-9]+$`), MaxIDLength: 3}
+	require.NoError(t, rules.Validate(TupleString("doc:123#viewer@user:1")))
+	require.ErrorContains(t, rules.Validate(TupleString("doc:1234#viewer@user:1")), "object_id exceeds maximum length of 3")
+	require.ErrorContains(t, rules.Validate(TupleString("doc:123#viewer@user:x")), "subject_id 'x' does not match")
+}
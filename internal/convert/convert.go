@@ -0,0 +1,71 @@
+// The convert-package converts tuples between their representation in the zanzigo-package and the API,
+// so the server and the client-package share the conversions.
+package convert
+
+import (
+	"github.com/trevex/zanzigo"
+	v1 "github.com/trevex/zanzigo/api/zanzigo/v1"
+
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func ToZanzigoTuple(t *v1.Tuple) zanzigo.Tuple {
+	tuple := zanzigo.Tuple{
+		ObjectType:      t.ObjectType,
+		ObjectID:        t.ObjectId,
+		ObjectRelation:  t.ObjectRelation,
+		SubjectType:     t.SubjectType,
+		SubjectID:       t.SubjectId,
+		SubjectRelation: t.SubjectRelation,
+	}
+	if t.ExpiresAt != nil {
+		expiresAt := t.ExpiresAt.AsTime()
+		tuple.ExpiresAt = &expiresAt
+	}
+	if t.Condition != nil {
+		tuple.Condition = &zanzigo.ConditionRef{Name: t.Condition.Name}
+		if t.Condition.Context != nil {
+			tuple.Condition.Context = t.Condition.Context.AsMap()
+		}
+	}
+	return tuple
+}
+
+func ToZanzigoTuples(ps []*v1.Tuple) []zanzigo.Tuple {
+	ts := make([]zanzigo.Tuple, 0, len(ps))
+	for _, p := range ps {
+		ts = append(ts, ToZanzigoTuple(p))
+	}
+	return ts
+}
+
+func ToProtobufTuple(t *zanzigo.Tuple) *v1.Tuple {
+	tuple := &v1.Tuple{
+		ObjectType:      t.ObjectType,
+		ObjectId:        t.ObjectID,
+		ObjectRelation:  t.ObjectRelation,
+		SubjectType:     t.SubjectType,
+		SubjectId:       t.SubjectID,
+		SubjectRelation: t.SubjectRelation,
+	}
+	if t.ExpiresAt != nil {
+		tuple.ExpiresAt = timestamppb.New(*t.ExpiresAt)
+	}
+	if t.Condition != nil {
+		tuple.Condition = &v1.Condition{Name: t.Condition.Name}
+		if t.Condition.Context != nil {
+			// The context was decoded from JSON, so it is representable as struct
+			tuple.Condition.Context, _ = structpb.NewStruct(t.Condition.Context)
+		}
+	}
+	return tuple
+}
+
+func ToProtobufTuples(ts []zanzigo.Tuple) []*v1.Tuple {
+	ps := make([]*v1.Tuple, 0, len(ts))
+	for _, t := range ts {
+		ps = append(ps, ToProtobufTuple(&t))
+	}
+	return ps
+}
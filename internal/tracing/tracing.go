@@ -0,0 +1,41 @@
+// The tracing-package provides the OpenTelemetry tracer shared by the resolver and the storage-implementations.
+// Spans are recorded using the global TracerProvider, so they are no-ops unless the application configures one.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var Tracer = otel.Tracer("github.com/trevex/zanzigo")
+
+// StartQueryChecks starts the span of a Storage.QueryChecks-call of the specified database system, e.g. "postgresql".
+func StartQueryChecks(ctx context.Context, system string, checks int) (context.Context, trace.Span) {
+	return Tracer.Start(ctx, "Storage.QueryChecks", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", system),
+		attribute.Int("zanzigo.checks", checks),
+	))
+}
+
+// SetFingerprint adds the fingerprint of query to the span of ctx, which identifies queries generated for the same rulesets
+// without recording the potentially long query itself.
+func SetFingerprint(ctx context.Context, query string) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(query))
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("zanzigo.query.fingerprint", fmt.Sprintf("%016x", h.Sum64())))
+}
+
+// End records the error, if any, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
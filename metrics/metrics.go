@@ -0,0 +1,86 @@
+// The metrics-package instruments the [zanzigo.Resolver] and [zanzigo.Storage]-implementations using Prometheus.
+package metrics
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/trevex/zanzigo"
+)
+
+const namespace = "zanzigo"
+
+// Metrics holds the collectors recording checks and storage operations.
+type Metrics struct {
+	checkDuration   *prometheus.HistogramVec
+	checkDepth      *prometheus.HistogramVec
+	checkQueries    *prometheus.HistogramVec
+	checkRows       *prometheus.HistogramVec
+	storageDuration *prometheus.HistogramVec
+	storageErrors   *prometheus.CounterVec
+}
+
+// New creates the collectors and registers them with registerer.
+// Use [Metrics.ObserveCheck] with [zanzigo.WithCheckObserver] to record checks and [Metrics.WrapStorage] to record storage operations.
+func New(registerer prometheus.Registerer) (*Metrics, error) {
+	checkLabels := []string{"object_type", "relation"}
+	m := &Metrics{
+		checkDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "check_duration_seconds",
+			Help:      "Duration of checks by object-type, relation and result.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, append(checkLabels, "result")),
+		checkDepth: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "check_depth",
+			Help:      "Depth reached while traversing the authorization-model during checks.",
+			Buckets:   prometheus.LinearBuckets(1, 1, 16),
+		}, checkLabels),
+		checkQueries: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "check_queries",
+			Help:      "Number of QueryChecks-calls per check.",
+			Buckets:   prometheus.LinearBuckets(1, 1, 16),
+		}, checkLabels),
+		checkRows: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "check_rows",
+			Help:      "Number of tuples returned by QueryChecks-calls per check.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+		}, checkLabels),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_duration_seconds",
+			Help:      "Duration of storage operations.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16),
+		}, []string{"operation"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_errors_total",
+			Help:      "Number of failed storage operations, not counting tuples or stores not found or already existing.",
+		}, []string{"operation"}),
+	}
+	for _, c := range []prometheus.Collector{m.checkDuration, m.checkDepth, m.checkQueries, m.checkRows, m.storageDuration, m.storageErrors} {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ObserveCheck records a completed check.
+func (m *Metrics) ObserveCheck(stats zanzigo.CheckStats) {
+	result := stats.Result.String()
+	if stats.Err != nil {
+		result = "error"
+	}
+	m.checkDuration.WithLabelValues(stats.Tuple.ObjectType, stats.Tuple.ObjectRelation, result).Observe(stats.Duration.Seconds())
+	m.checkDepth.WithLabelValues(stats.Tuple.ObjectType, stats.Tuple.ObjectRelation).Observe(float64(stats.Depth))
+	m.checkQueries.WithLabelValues(stats.Tuple.ObjectType, stats.Tuple.ObjectRelation).Observe(float64(stats.Queries))
+	m.checkRows.WithLabelValues(stats.Tuple.ObjectType, stats.Tuple.ObjectRelation).Observe(float64(stats.Rows))
+}
+
+func isStorageError(err error) bool {
+	return err != nil && !errors.Is(err, zanzigo.ErrNotFound) && !errors.Is(err, zanzigo.ErrAlreadyExists)
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"github.com/trevex/zanzigo"
+	testsuite "github.com/trevex/zanzigo/storage"
+	"github.com/trevex/zanzigo/storage/sqlite3"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "test.db")
+	require.NoError(t, sqlite3.RunMigrations(file))
+	sqliteStorage, err := sqlite3.NewSQLite3Storage(file)
+	require.NoError(t, err)
+	defer sqliteStorage.Close()
+
+	registry := prometheus.NewRegistry()
+	m, err := New(registry)
+	require.NoError(t, err)
+	registry.MustRegister(NewPoolCollector(sqliteStorage))
+	storage := m.WrapStorage(sqliteStorage)
+	require.NoError(t, testsuite.Load(ctx, storage))
+
+	resolver, err := zanzigo.NewResolver(testsuite.Model, storage, 16, zanzigo.WithCheckObserver(m.ObserveCheck))
+	require.NoError(t, err)
+	// 'myuser' is a member of a group, which is a viewer of the parent folder of 'mydoc'
+	allowed, err := resolver.Check(ctx, zanzigo.TupleString("doc:mydoc#viewer@user:myuser"))
+	require.NoError(t, err)
+	require.True(t, allowed)
+	allowed, err = resolver.Check(ctx, zanzigo.TupleString("doc:mydoc#viewer@user:unknown"))
+	require.NoError(t, err)
+	require.False(t, allowed)
+
+	require.Equal(t, uint64(1), histogramOf(t, m.checkDuration.WithLabelValues("doc", "viewer", "allowed")).GetSampleCount())
+	require.Equal(t, 2, testutil.CollectAndCount(m.checkDuration))
+	// Both checks traverse doc > folder > group
+	depth := histogramOf(t, m.checkDepth.WithLabelValues("doc", "viewer"))
+	require.Equal(t, uint64(2), depth.GetSampleCount())
+	require.Equal(t, float64(6), depth.GetSampleSum())
+
+	// Tuples not found are not considered errors
+	_, err = storage.Read(ctx, zanzigo.TupleString("doc:mydoc#viewer@user:unknown"))
+	require.ErrorIs(t, err, zanzigo.ErrNotFound)
+	require.Equal(t, 0, testutil.CollectAndCount(m.storageErrors))
+	require.Equal(t, uint64(5), histogramOf(t, m.storageDuration.WithLabelValues("write")).GetSampleCount())
+
+	// Views of other stores are recorded as well
+	_, err = storage.ForStore("other").ListStores(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), histogramOf(t, m.storageDuration.WithLabelValues("list_stores")).GetSampleCount())
+
+	require.Equal(t, 6, testutil.CollectAndCount(NewPoolCollector(sqliteStorage)))
+	stats := sqliteStorage.PoolStats()
+	require.Zero(t, stats.AcquiredConns)
+	require.Positive(t, stats.AcquireCount)
+}
+
+func histogramOf(t *testing.T, observer prometheus.Observer) *dto.Histogram {
+	metric := &dto.Metric{}
+	require.NoError(t, observer.(prometheus.Histogram).Write(metric))
+	return metric.GetHistogram()
+}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/trevex/zanzigo"
+)
+
+type storage struct {
+	storage zanzigo.Storage
+	metrics *Metrics
+}
+
+// WrapStorage returns a [zanzigo.Storage] recording the duration and errors of all operations of s.
+// Views returned by ForStore are recorded as well.
+func (m *Metrics) WrapStorage(s zanzigo.Storage) zanzigo.Storage {
+	return &storage{s, m}
+}
+
+func (s *storage) observe(operation string, start time.Time, err error) {
+	s.metrics.storageDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if isStorageError(err) {
+		s.metrics.storageErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+func (s *storage) Write(ctx context.Context, t zanzigo.Tuple) error {
+	start := time.Now()
+	err := s.storage.Write(ctx, t)
+	s.observe("write", start, err)
+	return err
+}
+
+func (s *storage) WriteBatch(ctx context.Context, tuples []zanzigo.Tuple) error {
+	start := time.Now()
+	err := zanzigo.WriteBatch(ctx, s.storage, tuples)
+	s.observe("write_batch", start, err)
+	return err
+}
+
+func (s *storage) Read(ctx context.Context, t zanzigo.Tuple) (uuid.UUID, error) {
+	start := time.Now()
+	id, err := s.storage.Read(ctx, t)
+	s.observe("read", start, err)
+	return id, err
+}
+
+func (s *storage) Delete(ctx context.Context, t zanzigo.Tuple) error {
+	start := time.Now()
+	err := s.storage.Delete(ctx, t)
+	s.observe("delete", start, err)
+	return err
+}
+
+func (s *storage) CursorStart() zanzigo.Cursor {
+	return s.storage.CursorStart()
+}
+
+func (s *storage) List(ctx context.Context, f zanzigo.Tuple, p zanzigo.Pagination) ([]zanzigo.Tuple, zanzigo.Cursor, error) {
+	start := time.Now()
+	tuples, cursor, err := s.storage.List(ctx, f, p)
+	s.observe("list", start, err)
+	return tuples, cursor, err
+}
+
+func (s *storage) PrepareRuleset(object, relation string, ruleset []zanzigo.InferredRule) (zanzigo.Userdata, error) {
+	start := time.Now()
+	userdata, err := s.storage.PrepareRuleset(object, relation, ruleset)
+	s.observe("prepare_ruleset", start, err)
+	return userdata, err
+}
+
+func (s *storage) PrepareModel(rules zanzigo.InferredRuleMap) (zanzigo.UserdataMap, error) {
+	start := time.Now()
+	userdata, err := zanzigo.PrepareModel(s.storage, rules)
+	s.observe("prepare_model", start, err)
+	return userdata, err
+}
+
+func (s *storage) QueryChecks(ctx context.Context, checks []zanzigo.Check) ([]zanzigo.MarkedTuple, error) {
+	start := time.Now()
+	tuples, err := s.storage.QueryChecks(ctx, checks)
+	s.observe("query_checks", start, err)
+	return tuples, err
+}
+
+func (s *storage) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	start := time.Now()
+	removed, err := s.storage.DeleteExpired(ctx, before)
+	s.observe("delete_expired", start, err)
+	return removed, err
+}
+
+func (s *storage) ForStore(id string) zanzigo.Storage {
+	return &storage{s.storage.ForStore(id), s.metrics}
+}
+
+func (s *storage) CreateStore(ctx context.Context, store zanzigo.Store) error {
+	start := time.Now()
+	err := s.storage.CreateStore(ctx, store)
+	s.observe("create_store", start, err)
+	return err
+}
+
+func (s *storage) ListStores(ctx context.Context) ([]zanzigo.Store, error) {
+	start := time.Now()
+	stores, err := s.storage.ListStores(ctx)
+	s.observe("list_stores", start, err)
+	return stores, err
+}
+
+func (s *storage) DeleteStore(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.storage.DeleteStore(ctx, id)
+	s.observe("delete_store", start, err)
+	return err
+}
+
+func (s *storage) Close() error {
+	return s.storage.Close()
+}
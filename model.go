@@ -2,10 +2,13 @@ package zanzigo
 
 import (
 	"cmp"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"slices"
 	"strings"
+
+	"github.com/samber/lo"
 )
 
 const (
@@ -18,6 +21,8 @@ var (
 	ErrTypeUnknown = errors.New("Unknown type used in tuple")
 	// TODO: doc
 	ErrRelationUnknown = errors.New("Unknown relation used in tuple")
+	// Returned by [Resolver.CheckWithResult], if a tuple is not valid for the model, see [Model.IsValid].
+	ErrInvalidTuple = errors.New("invalid tuple")
 )
 
 // A [Rule] is associated with a relationship of an authorization [Model] and defines when the requirement of the relationship is met.
@@ -88,23 +93,86 @@ type RelationMap map[string]Rule
 
 type validationMap map[string]map[string]struct{}
 
+// ModelDefinition is the serializable definition of a [Model], e.g. as used by model files.
+type ModelDefinition struct {
+	Objects    ObjectMap    `json:"objects"`
+	Conditions ConditionMap `json:"conditions,omitempty"`
+}
+
+// ParseModelDefinition decodes a JSON-encoded [ModelDefinition].
+// For compatibility, the JSON may also contain the [ObjectMap] directly, which is assumed unless
+// the top-level keys are "objects" and optionally "conditions".
+func ParseModelDefinition(data []byte) (ModelDefinition, error) {
+	definition := ModelDefinition{}
+	keys := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return definition, err
+	}
+	_, hasObjects := keys["objects"]
+	delete(keys, "objects")
+	delete(keys, "conditions")
+	if !hasObjects || len(keys) > 0 {
+		err := json.Unmarshal(data, &definition.Objects)
+		return definition, err
+	}
+	err := json.Unmarshal(data, &definition)
+	return definition, err
+}
+
+// NewModelFromDefinition creates a [Model] with the objects and conditions of the [ModelDefinition].
+func NewModelFromDefinition(definition ModelDefinition) (*Model, error) {
+	return NewModel(definition.Objects, WithConditions(definition.Conditions))
+}
+
 // A Model is the authorization model created from an [ObjectMap].
 // During creation the model-definition provided by an [ObjectMap] is computed
 // into a lower-lever ruleset of [InferredRule]s.
 type Model struct {
 	InferredRules InferredRuleMap
-	validations   validationMap
+	// Conditions tuples of this model can reference, see [WithConditions].
+	Conditions  ConditionMap
+	validations validationMap
+	conditions  conditionMap
+}
+
+type ModelOption interface {
+	do(*modelConfig)
+}
+
+type modelConfig struct {
+	conditions ConditionMap
+}
+
+type modelFunctionAdapter func(*modelConfig)
+
+func (fn modelFunctionAdapter) do(c *modelConfig) {
+	fn(c)
+}
+
+// WithConditions adds named conditions to the model, which can be referenced by conditional tuples.
+// The conditions are compiled when the model is created, so invalid expressions are detected early.
+func WithConditions(conditions ConditionMap) ModelOption {
+	return modelFunctionAdapter(func(c *modelConfig) { c.conditions = conditions })
 }
 
 // NewModel checks the [ObjectMap] for correctness and will infer the rules and
 // prepare them for check-resolution.
-func NewModel(objects ObjectMap) (*Model, error) {
+func NewModel(objects ObjectMap, options ...ModelOption) (*Model, error) {
+	opts := modelConfig{conditions: ConditionMap{}}
+	lo.ForEach(options, func(o ModelOption, _ int) { o.do(&opts) })
+
 	if err := validateObjects(objects); err != nil {
 		return nil, err
 	}
+	conditions, err := compileConditions(opts.conditions)
+	if err != nil {
+		return nil, err
+	}
 	return &Model{
 		InferredRules: inferRules(objects),
+		Conditions:    opts.conditions,
 		validations:   validations(objects),
+		conditions:    conditions,
 	}, nil
 }
 
@@ -138,6 +206,11 @@ func (m *Model) IsValid(t Tuple) bool {
 			return false
 		}
 	}
+	if t.Condition != nil {
+		if _, ok := m.conditions[t.Condition.Name]; !ok {
+			return false
+		}
+	}
 	return true
 }
 
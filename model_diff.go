@@ -0,0 +1,225 @@
+package zanzigo
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+var (
+	// Returned by [CheckModelChange], if tuples in the storage are invalid according to the new model.
+	ErrIncompatibleModel = errors.New("incompatible model")
+)
+
+// ChangeKind describes how a type, relation or condition changed between two models.
+type ChangeKind string
+
+const (
+	ChangeAddedType         ChangeKind = "added type"
+	ChangeRemovedType       ChangeKind = "removed type"
+	ChangeAddedRelation     ChangeKind = "added relation"
+	ChangeRemovedRelation   ChangeKind = "removed relation"
+	ChangeModifiedRelation  ChangeKind = "modified relation"
+	ChangeAddedCondition    ChangeKind = "added condition"
+	ChangeRemovedCondition  ChangeKind = "removed condition"
+	ChangeModifiedCondition ChangeKind = "modified condition"
+)
+
+// A ModelChange is a single difference between two models.
+// Changes are breaking, if tuples valid according to the old model might be invalid according to the new one,
+// i.e. types, relations or conditions were removed. Modified relations change who is granted access,
+// but all tuples stay valid.
+type ModelChange struct {
+	Kind ChangeKind
+	// The object-type, which is empty for changes of conditions.
+	Object string
+	// The relation, which is empty for changes of types or conditions.
+	Relation string
+	// The condition, which is empty for changes of types or relations.
+	Condition string
+	Breaking  bool
+}
+
+func (c ModelChange) String() string {
+	subject := c.Object
+	switch {
+	case c.Condition != "":
+		subject = c.Condition
+	case c.Relation != "":
+		subject = c.Object + "#" + c.Relation
+	}
+	if c.Breaking {
+		return fmt.Sprintf("%s %s (breaking)", c.Kind, subject)
+	}
+	return fmt.Sprintf("%s %s", c.Kind, subject)
+}
+
+// DiffObjectMaps compares the objects of two models and returns the changes sorted by object-type and relation.
+func DiffObjectMaps(old, new ObjectMap) []ModelChange {
+	changes := []ModelChange{}
+	for object, oldRelations := range old {
+		newRelations, ok := new[object]
+		if !ok {
+			changes = append(changes, ModelChange{Kind: ChangeRemovedType, Object: object, Breaking: true})
+			continue
+		}
+		for relation, oldRule := range oldRelations {
+			newRule, ok := newRelations[relation]
+			if !ok {
+				changes = append(changes, ModelChange{Kind: ChangeRemovedRelation, Object: object, Relation: relation, Breaking: true})
+			} else if !reflect.DeepEqual(normalizeRule(oldRule), normalizeRule(newRule)) {
+				changes = append(changes, ModelChange{Kind: ChangeModifiedRelation, Object: object, Relation: relation})
+			}
+		}
+		for relation := range newRelations {
+			if _, ok := oldRelations[relation]; !ok {
+				changes = append(changes, ModelChange{Kind: ChangeAddedRelation, Object: object, Relation: relation})
+			}
+		}
+	}
+	for object := range new {
+		if _, ok := old[object]; !ok {
+			changes = append(changes, ModelChange{Kind: ChangeAddedType, Object: object})
+		}
+	}
+	sortChanges(changes)
+	return changes
+}
+
+// DiffModelDefinitions compares the objects and conditions of two model definitions.
+func DiffModelDefinitions(old, new ModelDefinition) []ModelChange {
+	changes := DiffObjectMaps(old.Objects, new.Objects)
+	for name, oldCondition := range old.Conditions {
+		newCondition, ok := new.Conditions[name]
+		if !ok {
+			changes = append(changes, ModelChange{Kind: ChangeRemovedCondition, Condition: name, Breaking: true})
+		} else if !reflect.DeepEqual(oldCondition, newCondition) {
+			changes = append(changes, ModelChange{Kind: ChangeModifiedCondition, Condition: name})
+		}
+	}
+	for name := range new.Conditions {
+		if _, ok := old.Conditions[name]; !ok {
+			changes = append(changes, ModelChange{Kind: ChangeAddedCondition, Condition: name})
+		}
+	}
+	sortChanges(changes)
+	return changes
+}
+
+// Nil and empty subrules are equivalent, the rule itself is not modified.
+func normalizeRule(rule Rule) Rule {
+	if len(rule.Rules) == 0 {
+		rule.Rules = nil
+		return rule
+	}
+	rules := make([]Rule, 0, len(rule.Rules))
+	for _, subrule := range rule.Rules {
+		rules = append(rules, normalizeRule(subrule))
+	}
+	rule.Rules = rules
+	return rule
+}
+
+func sortChanges(changes []ModelChange) {
+	slices.SortFunc(changes, func(a, b ModelChange) int {
+		if c := cmp.Compare(a.Condition, b.Condition); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Object, b.Object); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Relation, b.Relation); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Kind, b.Kind)
+	})
+}
+
+// A ModelConflict is a breaking change, for which tuples exist in the storage.
+type ModelConflict struct {
+	Change ModelChange
+	// A tuple, which is invalid according to the new model.
+	Tuple Tuple
+}
+
+func (c ModelConflict) String() string {
+	return fmt.Sprintf("%s is still used by %s", c.Change, c.Tuple.ToString())
+}
+
+// FindConflicts queries the storage for tuples affected by the breaking changes.
+// Removed types and relations are looked up directly, while removed conditions require scanning all tuples.
+func FindConflicts(ctx context.Context, storage Storage, changes []ModelChange) ([]ModelConflict, error) {
+	conflicts := []ModelConflict{}
+	removedConditions := map[string]ModelChange{}
+	for _, change := range changes {
+		filters := []Tuple{}
+		switch change.Kind {
+		case ChangeRemovedType:
+			filters = append(filters, Tuple{ObjectType: change.Object}, Tuple{SubjectType: change.Object})
+		case ChangeRemovedRelation:
+			filters = append(filters,
+				Tuple{ObjectType: change.Object, ObjectRelation: change.Relation},
+				Tuple{SubjectType: change.Object, SubjectRelation: change.Relation},
+			)
+		case ChangeRemovedCondition:
+			removedConditions[change.Condition] = change
+		}
+		for _, filter := range filters {
+			tuples, _, err := storage.List(ctx, filter, Pagination{Limit: 1, Cursor: storage.CursorStart()})
+			if err != nil {
+				return nil, err
+			}
+			if len(tuples) > 0 {
+				conflicts = append(conflicts, ModelConflict{change, tuples[0]})
+				break
+			}
+		}
+	}
+	if len(removedConditions) == 0 {
+		return conflicts, nil
+	}
+
+	const pageSize = 1000
+	cursor := storage.CursorStart()
+	for {
+		tuples, next, err := storage.List(ctx, Tuple{}, Pagination{Limit: pageSize, Cursor: cursor})
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tuples {
+			if t.Condition == nil {
+				continue
+			}
+			if change, ok := removedConditions[t.Condition.Name]; ok {
+				conflicts = append(conflicts, ModelConflict{change, t})
+				delete(removedConditions, t.Condition.Name)
+			}
+		}
+		if len(tuples) < pageSize || len(removedConditions) == 0 {
+			return conflicts, nil
+		}
+		cursor = next
+	}
+}
+
+// CheckModelChange returns an error wrapping [ErrIncompatibleModel], if the storage contains tuples,
+// which are invalid according to the new model, e.g. tuples of removed relations.
+// Breaking changes without affected tuples are considered compatible.
+func CheckModelChange(ctx context.Context, storage Storage, old, new ModelDefinition) error {
+	conflicts, err := FindConflicts(ctx, storage, DiffModelDefinitions(old, new))
+	if err != nil {
+		return err
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	messages := make([]string, 0, len(conflicts))
+	for _, conflict := range conflicts {
+		messages = append(messages, conflict.String())
+	}
+	return fmt.Errorf("%w: %s", ErrIncompatibleModel, strings.Join(messages, "; "))
+}
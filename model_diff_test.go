@@ -0,0 +1,100 @@
+package zanzigo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/trevex/zanzigo"
+)
+
+// Lists the tuples matching the non-empty fields of the filter, which is sufficient to find conflicts.
+type listStorage struct {
+	zanzigo.Storage
+	tuples []zanzigo.Tuple
+}
+
+func (s *listStorage) CursorStart() zanzigo.Cursor {
+	return nil
+}
+
+func (s *listStorage) List(ctx context.Context, f zanzigo.Tuple, p zanzigo.Pagination) ([]zanzigo.Tuple, zanzigo.Cursor, error) {
+	matches := func(filter, value string) bool {
+		return filter == "" || filter == value
+	}
+	tuples := []zanzigo.Tuple{}
+	for _, t := range s.tuples {
+		if matches(f.ObjectType, t.ObjectType) && matches(f.ObjectRelation, t.ObjectRelation) &&
+			matches(f.SubjectType, t.SubjectType) && matches(f.SubjectRelation, t.SubjectRelation) && len(tuples) < p.Limit {
+			tuples = append(tuples, t)
+		}
+	}
+	return tuples, nil, nil
+}
+
+func TestDiffModelDefinitions(t *testing.T) {
+	old := zanzigo.ModelDefinition{
+		Objects: zanzigo.ObjectMap{
+			"user":  zanzigo.RelationMap{},
+			"group": zanzigo.RelationMap{"member": zanzigo.Rule{}},
+			"doc": zanzigo.RelationMap{
+				"owner":  zanzigo.Rule{},
+				"editor": zanzigo.Rule{InheritIf: "owner"},
+				"viewer": zanzigo.AnyOf(zanzigo.Rule{InheritIf: "editor"}),
+			},
+		},
+		Conditions: zanzigo.ConditionMap{
+			"before": {Expression: "now < embargo"},
+			"admin":  {Expression: "admin"},
+		},
+	}
+	new := zanzigo.ModelDefinition{
+		Objects: zanzigo.ObjectMap{
+			"user":   zanzigo.RelationMap{},
+			"folder": zanzigo.RelationMap{"owner": zanzigo.Rule{}},
+			"doc": zanzigo.RelationMap{
+				"owner":     zanzigo.Rule{},
+				"viewer":    zanzigo.AnyOf(zanzigo.Rule{InheritIf: "owner"}),
+				"commenter": zanzigo.Rule{},
+			},
+		},
+		Conditions: zanzigo.ConditionMap{
+			"before": {Expression: "now <= embargo"},
+			"ip":     {Expression: "inCIDR(ip, cidr)"},
+		},
+	}
+	require.Equal(t, []zanzigo.ModelChange{
+		{Kind: zanzigo.ChangeAddedRelation, Object: "doc", Relation: "commenter"},
+		{Kind: zanzigo.ChangeRemovedRelation, Object: "doc", Relation: "editor", Breaking: true},
+		{Kind: zanzigo.ChangeModifiedRelation, Object: "doc", Relation: "viewer"},
+		{Kind: zanzigo.ChangeAddedType, Object: "folder"},
+		{Kind: zanzigo.ChangeRemovedType, Object: "group", Breaking: true},
+		{Kind: zanzigo.ChangeRemovedCondition, Condition: "admin", Breaking: true},
+		{Kind: zanzigo.ChangeModifiedCondition, Condition: "before"},
+		{Kind: zanzigo.ChangeAddedCondition, Condition: "ip"},
+	}, zanzigo.DiffModelDefinitions(old, new))
+	require.Equal(t, "removed relation doc#editor (breaking)", zanzigo.DiffObjectMaps(old.Objects, new.Objects)[1].String())
+
+	// Nil and empty subrules are no change
+	require.Empty(t, zanzigo.DiffObjectMaps(
+		zanzigo.ObjectMap{"doc": zanzigo.RelationMap{"owner": zanzigo.Rule{}}},
+		zanzigo.ObjectMap{"doc": zanzigo.RelationMap{"owner": zanzigo.Rule{Rules: []zanzigo.Rule{}}}},
+	))
+
+	ctx := context.Background()
+	storage := &listStorage{tuples: []zanzigo.Tuple{zanzigo.TupleString("doc:mydoc#owner@user:myuser")}}
+	require.NoError(t, zanzigo.CheckModelChange(ctx, storage, old, new))
+
+	// Usersets of removed relations are conflicts as well
+	member := zanzigo.TupleString("doc:mydoc#viewer@group:mygroup#member")
+	admin := zanzigo.TupleString("doc:mydoc#owner@user:admin")
+	admin.Condition = &zanzigo.ConditionRef{Name: "admin"}
+	storage.tuples = append(storage.tuples, member, admin)
+	conflicts, err := zanzigo.FindConflicts(ctx, storage, zanzigo.DiffModelDefinitions(old, new))
+	require.NoError(t, err)
+	require.Equal(t, []zanzigo.ModelConflict{
+		{Change: zanzigo.ModelChange{Kind: zanzigo.ChangeRemovedType, Object: "group", Breaking: true}, Tuple: member},
+		{Change: zanzigo.ModelChange{Kind: zanzigo.ChangeRemovedCondition, Condition: "admin", Breaking: true}, Tuple: admin},
+	}, conflicts)
+	require.ErrorIs(t, zanzigo.CheckModelChange(ctx, storage, old, new), zanzigo.ErrIncompatibleModel)
+}
@@ -0,0 +1,289 @@
+package zanzigo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// Returned by [RenderGraph], if the format is unknown or the highlighted relation does not exist.
+var ErrInvalidGraph = errors.New("invalid graph")
+
+// GraphFormat is the output format of [RenderGraph].
+type GraphFormat string
+
+const (
+	// Graphviz DOT, e.g. to be rendered using `dot -Tsvg`.
+	GraphFormatDOT GraphFormat = "dot"
+	// Mermaid flowchart, e.g. to be embedded in Markdown.
+	GraphFormatMermaid GraphFormat = "mermaid"
+)
+
+type GraphOption interface {
+	do(*graphConfig)
+}
+
+type graphConfig struct {
+	inferred          bool
+	highlightObject   string
+	highlightRelation string
+}
+
+type graphFunctionAdapter func(*graphConfig)
+
+func (fn graphFunctionAdapter) do(c *graphConfig) {
+	fn(c)
+}
+
+// WithInferredRules renders the edges of the [InferredRuleMap] computed from the objects instead of the rules,
+// which shows every relation a relation is inherited from directly instead of the chain of rules.
+func WithInferredRules() GraphOption {
+	return graphFunctionAdapter(func(c *graphConfig) { c.inferred = true })
+}
+
+// WithHighlight highlights the relation of the object-type and all relations and edges it is inherited from,
+// i.e. all paths a check of the relation can traverse.
+func WithHighlight(object, relation string) GraphOption {
+	return graphFunctionAdapter(func(c *graphConfig) {
+		c.highlightObject, c.highlightRelation = object, relation
+	})
+}
+
+// A graphNode is a relation of an object-type or the object-type itself, if it has no relations.
+type graphNode struct {
+	Object   string
+	Relation string
+}
+
+// A graphEdge states that To is inherited from From. Via is set, if the relation From has to exist to an object,
+// which is related to the object of To by the relation Via, i.e. a tuple-to-userset rule.
+type graphEdge struct {
+	From graphNode
+	To   graphNode
+	Via  string
+}
+
+func (e graphEdge) label() string {
+	if e.Via != "" {
+		return e.From.Relation + " of " + e.Via
+	}
+	return e.From.Relation
+}
+
+// RenderGraph writes the types, relations and the edges between relations defined by the objects as graph.
+// Edges point from a relation to the relations inheriting it, e.g. from editor to viewer.
+// Edges of tuple-to-userset rules (see [Rule.OfType]) are dashed and labeled with the relation to the other object.
+func RenderGraph(w io.Writer, objects ObjectMap, format GraphFormat, options ...GraphOption) error {
+	opts := graphConfig{}
+	lo.ForEach(options, func(o GraphOption, _ int) { o.do(&opts) })
+
+	types := lo.Keys(objects)
+	slices.Sort(types)
+	nodes := []graphNode{}
+	for _, object := range types {
+		relations := lo.Keys(objects[object])
+		slices.Sort(relations)
+		if len(relations) == 0 {
+			nodes = append(nodes, graphNode{Object: object})
+		}
+		for _, relation := range relations {
+			nodes = append(nodes, graphNode{object, relation})
+		}
+	}
+
+	edges := []graphEdge{}
+	if opts.inferred {
+		edges = inferredGraphEdges(types, inferRules(objects))
+	} else {
+		for _, node := range nodes {
+			if node.Relation != "" {
+				edges = appendRuleEdges(edges, node, objects[node.Object][node.Relation])
+			}
+		}
+	}
+	edges = lo.Uniq(edges)
+
+	highlighted := map[graphNode]bool{}
+	if opts.highlightObject != "" || opts.highlightRelation != "" {
+		target := graphNode{opts.highlightObject, opts.highlightRelation}
+		if _, ok := objects[target.Object][target.Relation]; !ok {
+			return fmt.Errorf("%w: relation %s#%s does not exist", ErrInvalidGraph, target.Object, target.Relation)
+		}
+		highlighted = ancestors(target, edges)
+	}
+	// An edge is highlighted, if it leads to a highlighted node from another highlighted node
+	isHighlighted := func(e graphEdge) bool { return highlighted[e.From] && highlighted[e.To] }
+
+	buf := bufio.NewWriter(w)
+	switch format {
+	case GraphFormatDOT:
+		writeDOT(buf, types, nodes, edges, highlighted, isHighlighted)
+	case GraphFormatMermaid:
+		writeMermaid(buf, types, nodes, edges, highlighted, isHighlighted)
+	default:
+		return fmt.Errorf("%w: unknown format '%s', use '%s' or '%s'", ErrInvalidGraph, format, GraphFormatDOT, GraphFormatMermaid)
+	}
+	return buf.Flush()
+}
+
+func appendRuleEdges(edges []graphEdge, node graphNode, rule Rule) []graphEdge {
+	switch {
+	case rule.InheritIf == anyOfPlaceholder:
+		for _, subrule := range rule.Rules {
+			edges = appendRuleEdges(edges, node, subrule)
+		}
+	case rule.OfType != "":
+		edges = append(edges, graphEdge{graphNode{rule.OfType, rule.InheritIf}, node, rule.WithRelation})
+	case rule.InheritIf != "":
+		edges = append(edges, graphEdge{graphNode{node.Object, rule.InheritIf}, node, ""})
+	}
+	return edges
+}
+
+func inferredGraphEdges(types []string, rules InferredRuleMap) []graphEdge {
+	edges := []graphEdge{}
+	for _, object := range types {
+		relations := lo.Keys(rules[object])
+		slices.Sort(relations)
+		for _, relation := range relations {
+			node := graphNode{object, relation}
+			for _, rule := range rules[object][relation] {
+				switch rule.Kind {
+				case KindDirect, KindDirectUserset:
+					for _, r := range rule.Relations {
+						if r != relation {
+							edges = append(edges, graphEdge{graphNode{object, r}, node, ""})
+						}
+					}
+				case KindIndirect:
+					for _, via := range rule.Relations {
+						for _, r := range rule.WithRelationToSubject {
+							edges = append(edges, graphEdge{graphNode{rule.Subject, r}, node, via})
+						}
+					}
+				}
+			}
+		}
+	}
+	return edges
+}
+
+// ancestors returns the node and all nodes with a path to it.
+func ancestors(node graphNode, edges []graphEdge) map[graphNode]bool {
+	visited := map[graphNode]bool{node: true}
+	queue := []graphNode{node}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, e := range edges {
+			if e.To == current && !visited[e.From] {
+				visited[e.From] = true
+				queue = append(queue, e.From)
+			}
+		}
+	}
+	return visited
+}
+
+const highlightColor = "#d62728"
+
+func dotID(n graphNode) string {
+	if n.Relation == "" {
+		return fmt.Sprintf("%q", n.Object)
+	}
+	return fmt.Sprintf("%q", n.Object+"#"+n.Relation)
+}
+
+func writeDOT(w io.Writer, types []string, nodes []graphNode, edges []graphEdge, highlighted map[graphNode]bool, isHighlighted func(graphEdge) bool) {
+	fmt.Fprintln(w, "digraph model {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box, style=rounded];")
+	for _, object := range types {
+		fmt.Fprintf(w, "  subgraph %q {\n", "cluster_"+object)
+		fmt.Fprintf(w, "    label=%q;\n", object)
+		for _, n := range nodes {
+			if n.Object != object {
+				continue
+			}
+			label := n.Relation
+			if label == "" {
+				label = n.Object
+			}
+			attributes := fmt.Sprintf("label=%q", label)
+			if highlighted[n] {
+				attributes += fmt.Sprintf(", color=%q, penwidth=2", highlightColor)
+			}
+			fmt.Fprintf(w, "    %s [%s];\n", dotID(n), attributes)
+		}
+		fmt.Fprintln(w, "  }")
+	}
+	for _, e := range edges {
+		attributes := fmt.Sprintf("label=%q", e.label())
+		if e.Via != "" {
+			attributes += ", style=dashed"
+		}
+		if isHighlighted(e) {
+			attributes += fmt.Sprintf(", color=%q, penwidth=2", highlightColor)
+		}
+		fmt.Fprintf(w, "  %s -> %s [%s];\n", dotID(e.From), dotID(e.To), attributes)
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// mermaidID returns an identifier only consisting of characters Mermaid accepts, the prefix avoids keywords like 'end'.
+func mermaidID(prefix string, parts ...string) string {
+	return prefix + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.Join(parts, "__"))
+}
+
+func writeMermaid(w io.Writer, types []string, nodes []graphNode, edges []graphEdge, highlighted map[graphNode]bool, isHighlighted func(graphEdge) bool) {
+	nodeID := func(n graphNode) string {
+		if n.Relation == "" {
+			return mermaidID("n_", n.Object)
+		}
+		return mermaidID("n_", n.Object, n.Relation)
+	}
+	fmt.Fprintln(w, "flowchart LR")
+	for _, object := range types {
+		fmt.Fprintf(w, "  subgraph %s[\"%s\"]\n", mermaidID("t_", object), object)
+		for _, n := range nodes {
+			if n.Object != object {
+				continue
+			}
+			label := n.Relation
+			if label == "" {
+				label = n.Object
+			}
+			fmt.Fprintf(w, "    %s[\"%s\"]\n", nodeID(n), label)
+		}
+		fmt.Fprintln(w, "  end")
+	}
+	highlightedEdges := []string{}
+	for i, e := range edges {
+		arrow := "-->"
+		if e.Via != "" {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(w, "  %s %s|\"%s\"| %s\n", nodeID(e.From), arrow, e.label(), nodeID(e.To))
+		if isHighlighted(e) {
+			highlightedEdges = append(highlightedEdges, fmt.Sprint(i))
+		}
+	}
+	for _, n := range nodes {
+		if highlighted[n] {
+			fmt.Fprintf(w, "  style %s stroke:%s,stroke-width:3px\n", nodeID(n), highlightColor)
+		}
+	}
+	if len(highlightedEdges) > 0 {
+		fmt.Fprintf(w, "  linkStyle %s stroke:%s,stroke-width:3px\n", strings.Join(highlightedEdges, ","), highlightColor)
+	}
+}
@@ -0,0 +1,59 @@
+package zanzigo_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/trevex/zanzigo"
+)
+
+func TestRenderGraph(t *testing.T) {
+	objects := zanzigo.ObjectMap{
+		"user": zanzigo.RelationMap{},
+		"folder": zanzigo.RelationMap{
+			"owner":  zanzigo.Rule{},
+			"viewer": zanzigo.Rule{InheritIf: "owner"},
+		},
+		"doc": zanzigo.RelationMap{
+			"parent": zanzigo.Rule{},
+			"owner":  zanzigo.Rule{},
+			"editor": zanzigo.Rule{InheritIf: "owner"},
+			"viewer": zanzigo.AnyOf(
+				zanzigo.Rule{InheritIf: "editor"},
+				zanzigo.Rule{InheritIf: "viewer", OfType: "folder", WithRelation: "parent"},
+			),
+		},
+	}
+
+	out := &strings.Builder{}
+	require.NoError(t, zanzigo.RenderGraph(out, objects, zanzigo.GraphFormatDOT, zanzigo.WithHighlight("doc", "editor")))
+	dot := out.String()
+	require.True(t, strings.HasPrefix(dot, "digraph model {\n"))
+	require.Contains(t, dot, `"user" [label="user"];`)
+	require.Contains(t, dot, `"doc#editor" -> "doc#viewer" [label="editor"];`)
+	require.Contains(t, dot, `"folder#viewer" -> "doc#viewer" [label="viewer of parent", style=dashed];`)
+	// Only the highlighted relation and the relations it is inherited from are highlighted
+	require.Contains(t, dot, `"doc#owner" -> "doc#editor" [label="owner", color="#d62728", penwidth=2];`)
+	require.Contains(t, dot, `"doc#editor" [label="editor", color="#d62728", penwidth=2];`)
+	require.Contains(t, dot, `"doc#viewer" [label="viewer"];`)
+
+	// The inferred rules flatten the chain of rules within an object-type
+	out.Reset()
+	require.NoError(t, zanzigo.RenderGraph(out, objects, zanzigo.GraphFormatDOT, zanzigo.WithInferredRules()))
+	require.Contains(t, out.String(), `"doc#owner" -> "doc#viewer" [label="owner"];`)
+	require.Contains(t, out.String(), `"folder#viewer" -> "doc#viewer" [label="viewer of parent", style=dashed];`)
+
+	out.Reset()
+	require.NoError(t, zanzigo.RenderGraph(out, objects, zanzigo.GraphFormatMermaid, zanzigo.WithHighlight("doc", "viewer")))
+	mermaid := out.String()
+	require.True(t, strings.HasPrefix(mermaid, "flowchart LR\n"))
+	require.Contains(t, mermaid, "  subgraph t_doc[\"doc\"]\n")
+	require.Contains(t, mermaid, "    n_user[\"user\"]\n")
+	require.Contains(t, mermaid, `n_folder__viewer -.->|"viewer of parent"| n_doc__viewer`)
+	require.Contains(t, mermaid, "style n_folder__owner stroke:#d62728,stroke-width:3px")
+	require.Contains(t, mermaid, "linkStyle 0,1,2,3 stroke:#d62728,stroke-width:3px")
+
+	require.ErrorIs(t, zanzigo.RenderGraph(out, objects, "svg"), zanzigo.ErrInvalidGraph)
+	require.ErrorIs(t, zanzigo.RenderGraph(out, objects, zanzigo.GraphFormatDOT, zanzigo.WithHighlight("doc", "unknown")), zanzigo.ErrInvalidGraph)
+}
@@ -72,3 +72,36 @@ func TestModel(t *testing.T) {
 		t.Fatalf("Expected ruleset %v, but got %v instead", expected, ruleset)
 	}
 }
+
+func TestParseModelDefinition(t *testing.T) {
+	// Model files may contain the objects directly
+	definition, err := zanzigo.ParseModelDefinition([]byte(`{"user": {}, "doc": {"viewer": {}}}`))
+	require.NoError(t, err)
+	require.Equal(t, zanzigo.ModelDefinition{Objects: zanzigo.ObjectMap{
+		"user": zanzigo.RelationMap{},
+		"doc":  zanzigo.RelationMap{"viewer": zanzigo.Rule{}},
+	}}, definition)
+
+	// An object type called "objects" is not mistaken for the wrapped format
+	definition, err = zanzigo.ParseModelDefinition([]byte(`{"objects": {"owner": {}}, "user": {}}`))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(definition.Objects))
+
+	definition, err = zanzigo.ParseModelDefinition([]byte(`{"objects": {"user": {}}, "conditions": {"always": {"expression": "true"}}}`))
+	require.NoError(t, err)
+	require.Equal(t, zanzigo.ObjectMap{"user": zanzigo.RelationMap{}}, definition.Objects)
+	require.Equal(t, "true", definition.Conditions["always"].Expression)
+	_, err = zanzigo.NewModelFromDefinition(definition)
+	require.NoError(t, err)
+
+	_, err = zanzigo.ParseModelDefinition([]byte(`[]`))
+	require.Error(t, err)
+}
+
+func TestValidateStoreID(t *testing.T) {
+	require.NoError(t, zanzigo.ValidateStoreID(zanzigo.DefaultStore))
+	require.NoError(t, zanzigo.ValidateStoreID("tenant_42"))
+	for _, id := range []string{"", "Tenant", "42tenant", "tenant-42", "t'; DROP TABLE tuples; --", "abcdefghijklmnopqrstuvwxyz0123456"} {
+		require.ErrorIs(t, zanzigo.ValidateStoreID(id), zanzigo.ErrInvalidIdentifier, id)
+	}
+}
@@ -0,0 +1,369 @@
+// Package modeltest runs assertions against an authorization model, so models can be tested in CI like code.
+//
+// A test file is YAML and contains the model (inline or as path relative to the file), tuples shared by all tests
+// and the tests with their own tuples, expected check results and expected lookups:
+//
+//	model: model.json
+//	tuples:
+//	  - group:eng#member@user:alice
+//	tests:
+//	  - name: members of a group with access can view
+//	    tuples:
+//	      - doc:readme#viewer@group:eng#member
+//	      - tuple: doc:roadmap#viewer@user:bob
+//	        condition: {name: in_network, context: {cidr: 10.0.0.0/8}}
+//	    checks:
+//	      - tuple: doc:readme#viewer@user:alice
+//	        expected: true
+//	      - tuple: doc:roadmap#viewer@user:bob
+//	        context: {ip: 192.168.0.1}
+//	        expected: false
+//	    lookups:
+//	      - object_type: doc
+//	        relation: viewer
+//	        subject: user:alice
+//	        expected: [doc:readme]
+//
+// Every test runs in its own store of the storage, so tests do not affect each other.
+package modeltest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/trevex/zanzigo"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidFile is returned, if a test file can not be parsed.
+var ErrInvalidFile = errors.New("invalid test file")
+
+// File is a parsed test file.
+type File struct {
+	Model  zanzigo.ModelDefinition
+	Tuples []zanzigo.Tuple
+	Tests  []Test
+}
+
+type Test struct {
+	Name string
+	// Tuples written in addition to the tuples of the file.
+	Tuples  []zanzigo.Tuple
+	Checks  []CheckAssertion
+	Lookups []LookupAssertion
+}
+
+// CheckAssertion expects the check of Tuple to be allowed or not.
+type CheckAssertion struct {
+	Tuple zanzigo.Tuple
+	// Parameters for conditions of conditional tuples.
+	Context  map[string]any
+	Expected bool
+}
+
+// LookupAssertion expects Subject to have Relation to exactly the Expected objects of ObjectType, e.g. ["doc:readme"].
+type LookupAssertion struct {
+	ObjectType string
+	Relation   string
+	Subject    string
+	Context    map[string]any
+	Expected   []string
+}
+
+type fileYAML struct {
+	Model  yaml.Node   `yaml:"model"`
+	Tuples []tupleYAML `yaml:"tuples"`
+	Tests  []struct {
+		Name   string      `yaml:"name"`
+		Tuples []tupleYAML `yaml:"tuples"`
+		Checks []struct {
+			Tuple    string         `yaml:"tuple"`
+			Context  map[string]any `yaml:"context"`
+			Expected *bool          `yaml:"expected"`
+		} `yaml:"checks"`
+		Lookups []struct {
+			ObjectType string         `yaml:"object_type"`
+			Relation   string         `yaml:"relation"`
+			Subject    string         `yaml:"subject"`
+			Context    map[string]any `yaml:"context"`
+			Expected   []string       `yaml:"expected"`
+		} `yaml:"lookups"`
+	} `yaml:"tests"`
+}
+
+// A tuple is either specified as string or as mapping, if it has a condition or expiration.
+type tupleYAML struct {
+	Tuple     string     `yaml:"tuple"`
+	ExpiresAt *time.Time `yaml:"expires_at"`
+	Condition *struct {
+		Name    string         `yaml:"name"`
+		Context map[string]any `yaml:"context"`
+	} `yaml:"condition"`
+}
+
+func (t *tupleYAML) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&t.Tuple)
+	}
+	type plain tupleYAML
+	return node.Decode((*plain)(t))
+}
+
+func (t *tupleYAML) toTuple() (zanzigo.Tuple, error) {
+	tuple, err := zanzigo.ParseTuple(t.Tuple)
+	if err != nil {
+		return tuple, err
+	}
+	tuple.ExpiresAt = t.ExpiresAt
+	if t.Condition != nil {
+		tuple.Condition = &zanzigo.ConditionRef{Name: t.Condition.Name, Context: t.Condition.Context}
+	}
+	return tuple, nil
+}
+
+func toTuples(ts []tupleYAML) ([]zanzigo.Tuple, error) {
+	tuples := make([]zanzigo.Tuple, 0, len(ts))
+	for _, t := range ts {
+		tuple, err := t.toTuple()
+		if err != nil {
+			return nil, err
+		}
+		tuples = append(tuples, tuple)
+	}
+	return tuples, nil
+}
+
+// ReadFile reads and parses the test file, a model specified as path is resolved relative to the file.
+func ReadFile(filename string) (*File, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, filepath.Dir(filename))
+}
+
+// Parse parses the YAML of a test file, a model specified as path is resolved relative to dir.
+func Parse(data []byte, dir string) (*File, error) {
+	raw := fileYAML{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidFile, err)
+	}
+	file := &File{}
+	var err error
+	if file.Model, err = parseModel(&raw.Model, dir); err != nil {
+		return nil, fmt.Errorf("%w: model: %w", ErrInvalidFile, err)
+	}
+	if file.Tuples, err = toTuples(raw.Tuples); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidFile, err)
+	}
+	for i, rawTest := range raw.Tests {
+		test := Test{Name: rawTest.Name}
+		if test.Name == "" {
+			test.Name = fmt.Sprintf("test %d", i+1)
+		}
+		if test.Tuples, err = toTuples(rawTest.Tuples); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidFile, test.Name, err)
+		}
+		for _, check := range rawTest.Checks {
+			tuple, err := zanzigo.ParseTuple(check.Tuple)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", ErrInvalidFile, test.Name, err)
+			}
+			if check.Expected == nil {
+				return nil, fmt.Errorf("%w: %s: missing expected result of check '%s'", ErrInvalidFile, test.Name, check.Tuple)
+			}
+			test.Checks = append(test.Checks, CheckAssertion{tuple, check.Context, *check.Expected})
+		}
+		for _, lookup := range rawTest.Lookups {
+			if lookup.ObjectType == "" || lookup.Relation == "" || lookup.Subject == "" {
+				return nil, fmt.Errorf("%w: %s: lookups require object_type, relation and subject", ErrInvalidFile, test.Name)
+			}
+			test.Lookups = append(test.Lookups, LookupAssertion{lookup.ObjectType, lookup.Relation, lookup.Subject, lookup.Context, lookup.Expected})
+		}
+		file.Tests = append(file.Tests, test)
+	}
+	return file, nil
+}
+
+// parseModel either loads the model from the path or converts the inline model to JSON to parse it like a model file.
+func parseModel(node *yaml.Node, dir string) (zanzigo.ModelDefinition, error) {
+	var data []byte
+	switch node.Kind {
+	case 0:
+		return zanzigo.ModelDefinition{}, errors.New("missing")
+	case yaml.ScalarNode:
+		path := node.Value
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return zanzigo.ModelDefinition{}, err
+		}
+	default:
+		var inline any
+		if err := node.Decode(&inline); err != nil {
+			return zanzigo.ModelDefinition{}, err
+		}
+		var err error
+		if data, err = json.Marshal(inline); err != nil {
+			return zanzigo.ModelDefinition{}, err
+		}
+	}
+	return zanzigo.ParseModelDefinition(data)
+}
+
+// Failure describes a failed assertion.
+type Failure struct {
+	Test string
+	// Describes the assertion, e.g. "check doc:readme#viewer@user:alice".
+	Assertion string
+	Expected  string
+	Actual    string
+	// The traversal of the failed check, empty for lookups.
+	Trace []zanzigo.CheckTraceStep
+}
+
+func (f *Failure) String() string {
+	return fmt.Sprintf("%s: %s: expected %s, got %s", f.Test, f.Assertion, f.Expected, f.Actual)
+}
+
+// Result summarizes the run of a test file.
+type Result struct {
+	Tests      int
+	Assertions int
+	Failures   []Failure
+}
+
+// Run writes the tuples of every test to a separate store of the storage and evaluates the assertions of the test.
+// The stores are named 'modeltest_<index>', replaced if they exist and deleted after their test.
+// Failed assertions are returned as part of the result, errors are only returned if a test could not be run,
+// e.g. because a tuple is not valid according to the model.
+func Run(ctx context.Context, storage zanzigo.Storage, file *File, maxDepth int) (*Result, error) {
+	model, err := zanzigo.NewModelFromDefinition(file.Model)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{}
+	for i, test := range file.Tests {
+		if err := runTest(ctx, storage, fmt.Sprintf("modeltest_%d", i), file, model, test, maxDepth, result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func runTest(ctx context.Context, storage zanzigo.Storage, id string, file *File, model *zanzigo.Model, test Test, maxDepth int, result *Result) (err error) {
+	// Deleting the store also removes tuples left behind by interrupted runs, so it is created first, if it does not exist
+	store := zanzigo.Store{ID: id, Model: file.Model, CreatedAt: time.Now()}
+	if err := storage.CreateStore(ctx, store); err != nil && !errors.Is(err, zanzigo.ErrAlreadyExists) {
+		return err
+	}
+	if err := storage.DeleteStore(ctx, id); err != nil {
+		return err
+	}
+	if err := storage.CreateStore(ctx, store); err != nil {
+		return err
+	}
+	defer func() {
+		if deleteErr := storage.DeleteStore(ctx, id); err == nil {
+			err = deleteErr
+		}
+	}()
+
+	scoped := storage.ForStore(id)
+	tuples := append(slices.Clone(file.Tuples), test.Tuples...)
+	for _, t := range tuples {
+		if !model.IsValid(t) {
+			return fmt.Errorf("%s: invalid tuple: %s", test.Name, t.ToString())
+		}
+	}
+	if err := zanzigo.WriteBatch(ctx, scoped, tuples); err != nil {
+		return err
+	}
+	resolver, err := zanzigo.NewResolver(model, scoped, maxDepth)
+	if err != nil {
+		return err
+	}
+
+	result.Tests++
+	for _, check := range test.Checks {
+		result.Assertions++
+		trace := []zanzigo.CheckTraceStep{}
+		allowed, err := resolver.Check(ctx, check.Tuple, zanzigo.WithRequestContext(check.Context), zanzigo.WithCheckTrace(&trace))
+		if err != nil {
+			return fmt.Errorf("%s: check %s: %w", test.Name, check.Tuple.ToString(), err)
+		}
+		if allowed != check.Expected {
+			result.Failures = append(result.Failures, Failure{
+				test.Name, "check " + check.Tuple.ToString(), fmt.Sprint(check.Expected), fmt.Sprint(allowed), trace,
+			})
+		}
+	}
+	for _, lookup := range test.Lookups {
+		result.Assertions++
+		objects, err := lookupObjects(ctx, resolver, tuples, lookup)
+		if err != nil {
+			return fmt.Errorf("%s: lookup %s#%s@%s: %w", test.Name, lookup.ObjectType, lookup.Relation, lookup.Subject, err)
+		}
+		expected := slices.Clone(lookup.Expected)
+		slices.Sort(expected)
+		if !slices.Equal(objects, expected) {
+			result.Failures = append(result.Failures, Failure{
+				Test:      test.Name,
+				Assertion: fmt.Sprintf("lookup %s#%s@%s", lookup.ObjectType, lookup.Relation, lookup.Subject),
+				Expected:  "[" + strings.Join(expected, " ") + "]",
+				Actual:    "[" + strings.Join(objects, " ") + "]",
+			})
+		}
+	}
+	return nil
+}
+
+// lookupObjects returns the sorted objects the subject has the relation to. As the store only contains the tuples of the test,
+// checking every object of the type referenced by any tuple finds all objects.
+func lookupObjects(ctx context.Context, resolver *zanzigo.Resolver, tuples []zanzigo.Tuple, lookup LookupAssertion) ([]string, error) {
+	subject, err := parseSubject(lookup.Subject)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []string{}
+	for _, t := range tuples {
+		if t.ObjectType == lookup.ObjectType {
+			candidates = append(candidates, t.ObjectID)
+		}
+		if t.SubjectType == lookup.ObjectType {
+			candidates = append(candidates, t.SubjectID)
+		}
+	}
+	slices.Sort(candidates)
+	objects := []string{}
+	for _, id := range slices.Compact(candidates) {
+		subject.ObjectType, subject.ObjectID, subject.ObjectRelation = lookup.ObjectType, id, lookup.Relation
+		allowed, err := resolver.Check(ctx, subject, zanzigo.WithRequestContext(lookup.Context))
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			objects = append(objects, lookup.ObjectType+":"+id)
+		}
+	}
+	return objects, nil
+}
+
+// parseSubject parses a subject in the form 'type:id' or 'type:id#relation' into a tuple.
+func parseSubject(s string) (zanzigo.Tuple, error) {
+	// Reuse the parser of tuples by prepending a placeholder object
+	t, err := zanzigo.ParseTuple("placeholder:placeholder#placeholder@" + s)
+	if err != nil {
+		return t, fmt.Errorf("malformed subject '%s'", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,128 @@
+package modeltest_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/trevex/zanzigo"
+	"github.com/trevex/zanzigo/modeltest"
+	"github.com/trevex/zanzigo/storage/sqlite3"
+)
+
+const testFile = `
+model: model.json
+tuples:
+  - group:eng#member@user:alice
+  - folder:docs#viewer@user:carol
+tests:
+  - name: group members
+    tuples:
+      - doc:readme#viewer@group:eng#member
+      - doc:readme#parent@folder:docs
+      - tuple: doc:roadmap#viewer@user:bob
+        condition: {name: in_network, context: {cidr: 10.0.0.0/8}}
+    checks:
+      - tuple: doc:readme#viewer@user:alice
+        expected: true
+      - tuple: doc:readme#viewer@user:carol
+        expected: true
+      - tuple: doc:roadmap#viewer@user:bob
+        context: {ip: 10.1.2.3}
+        expected: true
+      - tuple: doc:roadmap#viewer@user:bob
+        context: {ip: 192.168.0.1}
+        expected: false
+    lookups:
+      - object_type: doc
+        relation: viewer
+        subject: user:alice
+        expected: [doc:readme]
+  - name: wrong expectations
+    checks:
+      - tuple: doc:readme#viewer@user:alice
+        expected: true
+    lookups:
+      - object_type: group
+        relation: member
+        subject: user:alice
+        expected: []
+`
+
+const modelFile = `{
+  "objects": {
+    "user": {},
+    "group": {"member": {}},
+    "folder": {"viewer": {}},
+    "doc": {
+      "parent": {},
+      "viewer": {"inheritIf": "anyOf", "rules": [{}, {"inheritIf": "viewer", "ofType": "folder", "withRelation": "parent"}]}
+    }
+  },
+  "conditions": {"in_network": {"expression": "inCIDR(ip, cidr)", "parameters": {"ip": "string", "cidr": "string"}}}
+}`
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "model.json"), []byte(modelFile), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "model_test.yaml"), []byte(testFile), 0o600))
+	file, err := modeltest.ReadFile(filepath.Join(dir, "model_test.yaml"))
+	require.NoError(t, err)
+	require.Len(t, file.Tests, 2)
+	require.Equal(t, "in_network", file.Tests[0].Tuples[2].Condition.Name)
+
+	dbFile := filepath.Join(dir, "test.db")
+	require.NoError(t, sqlite3.RunMigrations(dbFile))
+	storage, err := sqlite3.NewSQLite3Storage(dbFile)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	// Tuples left behind in the stores of the tests, e.g. by interrupted runs, are removed
+	ctx := context.Background()
+	require.NoError(t, storage.ForStore("modeltest_0").Write(ctx, zanzigo.TupleString("doc:readme#viewer@user:alice")))
+
+	result, err := modeltest.Run(ctx, storage, file, 16)
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Tests)
+	require.Equal(t, 7, result.Assertions)
+	// The tuples of a test are not visible to other tests
+	require.Len(t, result.Failures, 2)
+	failure := result.Failures[0]
+	require.Equal(t, "wrong expectations: check doc:readme#viewer@user:alice: expected true, got false", failure.String())
+	require.NotEmpty(t, failure.Trace)
+	require.Equal(t, zanzigo.TupleString("doc:readme#viewer@user:alice"), failure.Trace[0].Checks[0])
+	require.Equal(t, "[group:eng]", result.Failures[1].Actual)
+
+	// The stores of the tests are deleted afterwards
+	stores, err := storage.ListStores(ctx)
+	require.NoError(t, err)
+	require.Empty(t, stores)
+	tuples, _, err := storage.ForStore("modeltest_0").List(ctx, zanzigo.Tuple{}, zanzigo.Pagination{Cursor: storage.CursorStart(), Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, tuples)
+}
+
+func TestParse(t *testing.T) {
+	file, err := modeltest.Parse([]byte(`
+model:
+  user: {}
+  doc: {viewer: {}}
+tests:
+  - checks: [{tuple: "doc:readme#viewer@user:alice", expected: false}]
+`), "")
+	require.NoError(t, err)
+	require.Contains(t, file.Model.Objects, "doc")
+	require.Equal(t, "test 1", file.Tests[0].Name)
+
+	for _, invalid := range []string{
+		`tests: []`,
+		`{model: {user: {}}, tests: [{checks: [{tuple: "doc:readme#viewer@user:alice"}]}]}`,
+		`{model: {user: {}}, tuples: [doc:readme]}`,
+		`{model: {user: {}}, tests: [{lookups: [{object_type: doc}]}]}`,
+	} {
+		_, err := modeltest.Parse([]byte(invalid), "")
+		require.ErrorIs(t, err, modeltest.ErrInvalidFile, invalid)
+	}
+}
@@ -4,6 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/trevex/zanzigo/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // A map of object-types to relations to Userdata.
@@ -11,10 +18,13 @@ type UserdataMap map[string]map[string]Userdata
 
 // A Resolver uses a [Model] and [Storage]-implementation to execute relationship checks.
 type Resolver struct {
-	storage  Storage
-	userdata UserdataMap
-	rules    InferredRuleMap
-	maxDepth int
+	model      *Model
+	storage    Storage
+	userdata   UserdataMap
+	rules      InferredRuleMap
+	conditions conditionMap
+	maxDepth   int
+	observer   func(CheckStats)
 }
 
 // NewResolver creates a new resolver for the particular [Model] using the designated [Storage]-implementation.
@@ -24,42 +34,198 @@ type Resolver struct {
 // When Check is called the [Userdata] is passed on to the [Storage]-implementation as part of the [Check].
 //
 // maxDepth limits the depth of the traversal of the authorization-model during checks.
-func NewResolver(model *Model, storage Storage, maxDepth int) (*Resolver, error) {
-	userdata, err := prepareUserdataForRules(storage, model.InferredRules)
+func NewResolver(model *Model, storage Storage, maxDepth int, options ...ResolverOption) (*Resolver, error) {
+	opts := resolverConfig{}
+	lo.ForEach(options, func(o ResolverOption, _ int) { o.do(&opts) })
+
+	userdata, err := PrepareModel(storage, model.InferredRules)
 	return &Resolver{
-		storage, userdata, model.InferredRules, maxDepth,
+		model, storage, userdata, model.InferredRules, model.conditions, maxDepth, opts.observer,
 	}, err
 }
 
+type ResolverOption interface {
+	do(*resolverConfig)
+}
+
+type resolverConfig struct {
+	observer func(CheckStats)
+}
+
+type resolverFunctionAdapter func(*resolverConfig)
+
+func (fn resolverFunctionAdapter) do(c *resolverConfig) {
+	fn(c)
+}
+
+// WithCheckObserver calls observer after every check of a relation defined by the model with statistics about the traversal,
+// e.g. to record metrics (see the metrics-package).
+func WithCheckObserver(observer func(CheckStats)) ResolverOption {
+	return resolverFunctionAdapter(func(c *resolverConfig) { c.observer = observer })
+}
+
+// CheckStats describes a completed check.
+type CheckStats struct {
+	// The checked tuple.
+	Tuple    Tuple
+	Result   CheckResult
+	Err      error
+	Duration time.Duration
+	// The depth reached while traversing the authorization-model.
+	Depth int
+	// The number of calls to Storage.QueryChecks and the number of marked tuples they returned.
+	Queries int
+	Rows    int
+}
+
+type CheckOption interface {
+	do(*checkConfig)
+}
+
+type checkConfig struct {
+	context          map[string]any
+	contextualTuples []Tuple
+	trace            *[]CheckTraceStep
+	stats            CheckStats
+}
+
+type checkFunctionAdapter func(*checkConfig)
+
+func (fn checkFunctionAdapter) do(c *checkConfig) {
+	fn(c)
+}
+
+// WithRequestContext supplies parameters to the conditions of conditional tuples encountered during the check,
+// e.g. the IP address of the request.
+func WithRequestContext(context map[string]any) CheckOption {
+	return checkFunctionAdapter(func(c *checkConfig) { c.context = context })
+}
+
+// WithContextualTuples adds tuples to the check, which are treated as if they were stored, but are not persisted,
+// e.g. to run "what-if" checks or to include relationships managed by another system.
+func WithContextualTuples(tuples ...Tuple) CheckOption {
+	return checkFunctionAdapter(func(c *checkConfig) { c.contextualTuples = append(c.contextualTuples, tuples...) })
+}
+
+// CheckTraceStep describes a single depth of the traversal of a check.
+type CheckTraceStep struct {
+	Depth int
+	// The relationships checked at this depth.
+	Checks []Tuple
+	// The tuples found by the checks, which either grant access or lead to the checks of the next depth.
+	Matches []Tuple
+}
+
+// WithCheckTrace appends a step to trace for every depth traversed by the check, e.g. to explain its result.
+func WithCheckTrace(trace *[]CheckTraceStep) CheckOption {
+	return checkFunctionAdapter(func(c *checkConfig) { c.trace = trace })
+}
+
 // Checks whether the relationship stated by [Tuple] t is true.
-func (r *Resolver) Check(ctx context.Context, t Tuple) (bool, error) {
-	// TODO: check if tuple is valid!? Does relation exist!
+// If the relationship depends on conditions, for which parameters are missing, false is returned.
+// Use [Resolver.CheckWithResult] to distinguish missing parameters from denied access.
+func (r *Resolver) Check(ctx context.Context, t Tuple, options ...CheckOption) (bool, error) {
+	result, err := r.CheckWithResult(ctx, t, options...)
+	return result == CheckResultAllowed, err
+}
+
+// CheckWithResult checks whether the relationship stated by [Tuple] t is true and returns [CheckResultConditional],
+// if access would only be granted by conditional tuples, for which parameters were missing in the context.
+// If t or a contextual tuple is not valid for the model, an error wrapping [ErrInvalidTuple] is returned.
+func (r *Resolver) CheckWithResult(ctx context.Context, t Tuple, options ...CheckOption) (result CheckResult, err error) {
+	opts := checkConfig{}
+	lo.ForEach(options, func(o CheckOption, _ int) { o.do(&opts) })
+
+	for _, tuple := range append([]Tuple{t}, opts.contextualTuples...) {
+		if !r.model.IsValid(tuple) {
+			return CheckResultDenied, fmt.Errorf("%w: %s", ErrInvalidTuple, tuple.ToString())
+		}
+	}
 	ruleset, ok := r.rules[t.ObjectType][t.ObjectRelation]
 	if !ok {
-		return false, fmt.Errorf("failed to find %s > %s in query map", t.ObjectType, t.ObjectRelation)
+		return CheckResultDenied, fmt.Errorf("failed to find %s > %s in query map", t.ObjectType, t.ObjectRelation)
 	}
 	// needs to exist, otherwise `NewResolver` would have failed
 	userdata := r.userdata[t.ObjectType][t.ObjectRelation]
+
+	// Only checks of known relations are observed, so labels of metrics are bound by the model
+	if r.observer != nil {
+		start := time.Now()
+		defer func() {
+			opts.stats.Tuple = t
+			opts.stats.Result = result
+			opts.stats.Err = err
+			opts.stats.Duration = time.Since(start)
+			r.observer(opts.stats)
+		}()
+	}
 	depth := 0 // We start from zero and dive "upwards"
-	return r.check(ctx, []Check{{
+	return r.check(ctx, &opts, []Check{{
 		Tuple:    t,
 		Ruleset:  ruleset,
 		Userdata: userdata,
-	}}, depth)
+	}}, depth, CheckResultDenied)
 }
 
-func (r *Resolver) check(ctx context.Context, checks []Check, depth int) (bool, error) {
+// The result is passed on to subsequent depths, so we can return [CheckResultConditional]
+// if a conditional tuple was skipped due to missing parameters and no other path grants access.
+func (r *Resolver) check(ctx context.Context, opts *checkConfig, checks []Check, depth int, result CheckResult) (CheckResult, error) {
 	if len(checks) == 0 {
-		return false, nil
+		return result, nil
 	}
 	if depth > r.maxDepth {
-		return false, errors.New("max depth exceeded")
+		return CheckResultDenied, errors.New("max depth exceeded")
 	}
 	depth += 1
 
+	nextChecks, result, err := r.checkDepth(ctx, opts, checks, depth, result)
+	if err != nil {
+		return CheckResultDenied, err
+	}
+	if result == CheckResultAllowed {
+		return result, nil
+	}
+	return r.check(ctx, opts, nextChecks, depth, result)
+}
+
+// checkDepth queries the checks of a single depth and returns the checks of the next depth.
+// Every depth is traced separately, so the spans of subsequent depths are siblings instead of being nested.
+func (r *Resolver) checkDepth(ctx context.Context, opts *checkConfig, checks []Check, depth int, result CheckResult) (_ []Check, _ CheckResult, err error) {
+	ctx, span := tracing.Tracer.Start(ctx, "Resolver.check", trace.WithAttributes(
+		attribute.Int("zanzigo.depth", depth),
+		attribute.Int("zanzigo.checks", len(checks)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	if len(opts.contextualTuples) > 0 {
+		for i := range checks {
+			checks[i].Contextual = true
+		}
+	}
 	markedTuples, err := r.storage.QueryChecks(ctx, checks)
+	opts.stats.Depth = depth
+	opts.stats.Queries += 1
+	opts.stats.Rows += len(markedTuples)
+	span.SetAttributes(attribute.Int("zanzigo.rows", len(markedTuples)))
 	if err != nil {
-		return false, err
+		return nil, CheckResultDenied, err
+	}
+	if len(opts.contextualTuples) > 0 {
+		markedTuples = append(markedTuples, matchContextualTuples(checks, opts.contextualTuples)...)
+		// Restore the order by rule index, so we can still exit early
+		slices.SortStableFunc(markedTuples, func(a, b MarkedTuple) int {
+			return a.RuleIndex - b.RuleIndex
+		})
+	}
+	if opts.trace != nil {
+		step := CheckTraceStep{Depth: depth, Checks: make([]Tuple, 0, len(checks)), Matches: make([]Tuple, 0, len(markedTuples))}
+		for _, check := range checks {
+			step.Checks = append(step.Checks, check.Tuple)
+		}
+		for _, mt := range markedTuples {
+			step.Matches = append(step.Matches, mt.Tuple)
+		}
+		*opts.trace = append(*opts.trace, step)
 	}
 
 	// TODO: resolver should support caching:
@@ -71,15 +237,27 @@ func (r *Resolver) check(ctx context.Context, checks []Check, depth int) (bool,
 	// Returned marked tuples are ordered by .RuleIndex and rules are ordered with directs first,
 	// so we can exit early if we find a direct relationship before continuing to subsequent checks.
 	for _, mt := range markedTuples {
+		if mt.Condition != nil {
+			met, err := r.evaluateCondition(mt.Condition, opts.context)
+			if err != nil {
+				return nil, CheckResultDenied, err
+			}
+			if met == CheckResultConditional {
+				result = CheckResultConditional
+			}
+			if met != CheckResultAllowed {
+				continue
+			}
+		}
 		check := checks[mt.CheckIndex]
 		rule := check.Ruleset[mt.RuleIndex]
 		switch rule.Kind {
 		case KindDirect:
-			return true, nil
+			return nil, CheckResultAllowed, nil
 		case KindDirectUserset:
 			ruleset, ok := r.rules[mt.SubjectType][mt.SubjectRelation]
 			if !ok {
-				return false, fmt.Errorf("failed to find %s > %s in query map", mt.SubjectType, mt.SubjectRelation)
+				return nil, CheckResultDenied, fmt.Errorf("failed to find %s > %s in query map", mt.SubjectType, mt.SubjectRelation)
 			}
 			userdata := r.userdata[mt.SubjectType][mt.SubjectRelation]
 			nextChecks = append(nextChecks, Check{
@@ -99,7 +277,7 @@ func (r *Resolver) check(ctx context.Context, checks []Check, depth int) (bool,
 			for _, relation := range relations {
 				ruleset, ok := r.rules[mt.SubjectType][relation]
 				if !ok {
-					return false, fmt.Errorf("failed to find %s > %s in query map", mt.SubjectType, relation)
+					return nil, CheckResultDenied, fmt.Errorf("failed to find %s > %s in query map", mt.SubjectType, relation)
 				}
 				userdata := r.userdata[mt.SubjectType][relation]
 				nextChecks = append(nextChecks, Check{
@@ -120,25 +298,48 @@ func (r *Resolver) check(ctx context.Context, checks []Check, depth int) (bool,
 		}
 	}
 
-	return r.check(ctx, nextChecks, depth)
+	return nextChecks, result, nil
 }
 
-// Returns an inferred ruleset for the given object-type and relation.
-func (r *Resolver) RulesetFor(object, relation string) []InferredRule {
-	return r.rules[object][relation]
-}
-
-func prepareUserdataForRules(storage Storage, inferredRules InferredRuleMap) (UserdataMap, error) {
-	userdata := UserdataMap{}
-	for object, relations := range inferredRules {
-		userdata[object] = map[string]Userdata{}
-		for relation, rules := range relations {
-			var err error
-			userdata[object][relation], err = storage.PrepareRuleset(object, relation, rules)
-			if err != nil {
-				return nil, err
+// matchContextualTuples marks the contextual tuples matching the checks in the same way Storage.QueryChecks does.
+func matchContextualTuples(checks []Check, tuples []Tuple) []MarkedTuple {
+	now := time.Now()
+	marked := []MarkedTuple{}
+	for i, check := range checks {
+		for j, rule := range check.Ruleset {
+			for _, t := range tuples {
+				if t.IsExpired(now) || t.ObjectType != rule.Object || t.ObjectID != check.Tuple.ObjectID || !slices.Contains(rule.Relations, t.ObjectRelation) {
+					continue
+				}
+				var matches bool
+				switch rule.Kind {
+				case KindDirect:
+					matches = t.SubjectType == check.Tuple.SubjectType && t.SubjectID == check.Tuple.SubjectID && t.SubjectRelation == check.Tuple.SubjectRelation
+				case KindDirectUserset:
+					matches = t.SubjectRelation != ""
+				case KindIndirect:
+					matches = t.SubjectType == rule.Subject
+				default:
+					panic("unreachable")
+				}
+				if matches {
+					marked = append(marked, MarkedTuple{Tuple: t, CheckIndex: i, RuleIndex: j})
+				}
 			}
 		}
 	}
-	return userdata, nil
+	return marked
+}
+
+func (r *Resolver) evaluateCondition(ref *ConditionRef, context map[string]any) (CheckResult, error) {
+	condition, ok := r.conditions[ref.Name]
+	if !ok {
+		return CheckResultDenied, fmt.Errorf("%w: tuple references unknown condition '%s'", ErrInvalidCondition, ref.Name)
+	}
+	return condition.evaluate(ref.Context, context)
+}
+
+// Returns an inferred ruleset for the given object-type and relation.
+func (r *Resolver) RulesetFor(object, relation string) []InferredRule {
+	return r.rules[object][relation]
 }
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	v1connect "github.com/trevex/zanzigo/api/zanzigo/v1/zanzigov1connect"
+
+	"connectrpc.com/connect"
+)
+
+var (
+	// Returned by an [Authenticator] if the request carries credentials it is responsible for, but they are invalid.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// A Permission is required to call a procedure. Procedures of the ZanzigoService reading tuples require [PermissionRead],
+// writing tuples requires [PermissionWrite] and managing stores requires [PermissionAdmin].
+type Permission string
+
+const (
+	PermissionRead  Permission = "read"
+	PermissionWrite Permission = "write"
+	PermissionAdmin Permission = "admin"
+)
+
+// Procedures not listed require PermissionAdmin, so new procedures are denied unless explicitly added.
+var procedurePermissions = map[string]Permission{
+	v1connect.ZanzigoServiceCheckProcedure:        PermissionRead,
+	v1connect.ZanzigoServiceListProcedure:         PermissionRead,
+	v1connect.ZanzigoServiceReadProcedure:         PermissionRead,
+	v1connect.ZanzigoServiceExportTuplesProcedure: PermissionRead,
+	v1connect.ZanzigoServiceWriteProcedure:        PermissionWrite,
+	v1connect.ZanzigoServiceDeleteProcedure:       PermissionWrite,
+	v1connect.ZanzigoServiceImportTuplesProcedure: PermissionWrite,
+}
+
+func permissionFor(procedure string) Permission {
+	if permission, ok := procedurePermissions[procedure]; ok {
+		return permission
+	}
+	return PermissionAdmin
+}
+
+// An Identity is the authenticated caller of a procedure.
+type Identity struct {
+	Name        string       `json:"name"`
+	Permissions []Permission `json:"permissions"`
+}
+
+func (i *Identity) HasPermission(p Permission) bool {
+	return slices.Contains(i.Permissions, p)
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the identity authenticated by the interceptor created by [NewAuthInterceptor], if any.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok
+}
+
+// An Authenticator establishes the identity of the caller from the request.
+// If the request does not carry credentials the authenticator is responsible for, nil is returned without error,
+// so the next authenticator can be tried. If the credentials are invalid, an error wrapping [ErrInvalidCredentials] is returned.
+type Authenticator interface {
+	Authenticate(ctx context.Context, header http.Header) (*Identity, error)
+}
+
+type authInterceptor struct {
+	authenticators []Authenticator
+}
+
+// NewAuthInterceptor creates an interceptor, which rejects requests unless one of the authenticators establishes the identity of the caller
+// and the identity has the permission required by the procedure.
+func NewAuthInterceptor(authenticators ...Authenticator) connect.Interceptor {
+	return &authInterceptor{authenticators}
+}
+
+func (i *authInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		ctx, err := i.authorize(ctx, req.Spec().Procedure, req.Header())
+		if err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+func (i *authInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *authInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		ctx, err := i.authorize(ctx, conn.Spec().Procedure, conn.RequestHeader())
+		if err != nil {
+			return err
+		}
+		return next(ctx, conn)
+	}
+}
+
+func (i *authInterceptor) authorize(ctx context.Context, procedure string, header http.Header) (context.Context, error) {
+	identity, err := authenticate(ctx, i.authenticators, header)
+	if err != nil {
+		return ctx, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	permission := permissionFor(procedure)
+	if !identity.HasPermission(permission) {
+		return ctx, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("'%s' lacks permission '%s' required for %s", identity.Name, permission, procedure))
+	}
+	return context.WithValue(ctx, identityKey{}, identity), nil
+}
+
+// Returns the identity established by the first authenticator responsible for the credentials of the request.
+func authenticate(ctx context.Context, authenticators []Authenticator, header http.Header) (*Identity, error) {
+	for _, authenticator := range authenticators {
+		identity, err := authenticator.Authenticate(ctx, header)
+		if err != nil || identity != nil {
+			return identity, err
+		}
+	}
+	return nil, fmt.Errorf("missing credentials")
+}
+
+// Returns the token of the Authorization-header using the bearer scheme.
+func bearerToken(header http.Header) (string, bool) {
+	scheme, token, ok := strings.Cut(header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+func loadIdentities[T any](filename string) ([]T, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	identities := []T{}
+	if err := json.Unmarshal(data, &identities); err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %w", filename, err)
+	}
+	return identities, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRESHARED KEYS
+///////////////////////////////////////////////////////////////////////////////
+
+type presharedKey struct {
+	Identity
+	Key string `json:"key"`
+}
+
+type presharedKeyAuthenticator struct {
+	keys []presharedKey
+}
+
+// NewPresharedKeyAuthenticator authenticates requests using bearer tokens listed in a JSON file, e.g.
+//
+//	[{"name": "ci", "key": "secret", "permissions": ["read", "write"]}]
+func NewPresharedKeyAuthenticator(filename string) (Authenticator, error) {
+	keys, err := loadIdentities[presharedKey](filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.Key == "" {
+			return nil, fmt.Errorf("preshared key of '%s' is empty", key.Name)
+		}
+	}
+	return &presharedKeyAuthenticator{keys}, nil
+}
+
+// Unknown tokens are not considered invalid, as they might be JWTs verified by another authenticator.
+func (a *presharedKeyAuthenticator) Authenticate(ctx context.Context, header http.Header) (*Identity, error) {
+	token, ok := bearerToken(header)
+	if !ok {
+		return nil, nil
+	}
+	for _, key := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(key.Key)) == 1 {
+			return &key.Identity, nil
+		}
+	}
+	return nil, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// CLIENT CERTIFICATES
+///////////////////////////////////////////////////////////////////////////////
+
+type tlsStateKey struct{}
+
+// withTLSState makes the TLS connection state of the request available to authenticators.
+func withTLSState(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			r = r.WithContext(context.WithValue(r.Context(), tlsStateKey{}, r.TLS))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type clientCertificateAuthenticator struct {
+	identities map[string]Identity
+}
+
+// NewClientCertificateAuthenticator authenticates requests using the verified client certificate of mutual TLS.
+// The identities are listed in a JSON file and matched against the URI-, DNS-SANs and common name of the certificate, e.g.
+//
+//	[{"name": "spiffe://cluster.local/ns/default/sa/api", "permissions": ["read"]}]
+func NewClientCertificateAuthenticator(filename string) (Authenticator, error) {
+	identities, err := loadIdentities[Identity](filename)
+	if err != nil {
+		return nil, err
+	}
+	a := &clientCertificateAuthenticator{map[string]Identity{}}
+	for _, identity := range identities {
+		a.identities[identity.Name] = identity
+	}
+	return a, nil
+}
+
+func (a *clientCertificateAuthenticator) Authenticate(ctx context.Context, header http.Header) (*Identity, error) {
+	state, ok := ctx.Value(tlsStateKey{}).(*tls.ConnectionState)
+	// Only chains verified against the client CA are considered
+	if !ok || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+	cert := state.VerifiedChains[0][0]
+	names := make([]string, 0, len(cert.URIs)+len(cert.DNSNames)+1)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.Subject.CommonName)
+	for _, name := range names {
+		if identity, ok := a.identities[name]; ok {
+			return &identity, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no identity for client certificate '%s'", ErrInvalidCredentials, cert.Subject.String())
+}
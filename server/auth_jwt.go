@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/samber/lo"
+)
+
+const (
+	// Keys of an issuer are refetched at most once per interval, when a token references an unknown key
+	jwksRefreshInterval = time.Minute
+	// Tolerated clock skew when validating the time-based claims
+	jwtLeeway = 30 * time.Second
+)
+
+var jwtSignatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+type JWTOption interface {
+	do(*jwtConfig)
+}
+
+type jwtConfig struct {
+	issuer      string
+	audience    string
+	scopePrefix string
+	httpClient  *http.Client
+}
+
+type jwtFunctionAdapter func(*jwtConfig)
+
+func (fn jwtFunctionAdapter) do(c *jwtConfig) {
+	fn(c)
+}
+
+// WithIssuer requires the issuer-claim to match. If the keys are not loaded from a file,
+// they are discovered using the OpenID Connect configuration of the issuer.
+func WithIssuer(issuer string) JWTOption {
+	return jwtFunctionAdapter(func(c *jwtConfig) { c.issuer = issuer })
+}
+
+// WithAudience requires the audience-claim to contain the audience.
+func WithAudience(audience string) JWTOption {
+	return jwtFunctionAdapter(func(c *jwtConfig) { c.audience = audience })
+}
+
+// WithScopePrefix sets the prefix of scopes granting permissions, by default "zanzigo:", e.g. the scope "zanzigo:read" grants [PermissionRead].
+func WithScopePrefix(prefix string) JWTOption {
+	return jwtFunctionAdapter(func(c *jwtConfig) { c.scopePrefix = prefix })
+}
+
+// WithHTTPClient sets the client used to fetch the keys of the issuer.
+func WithHTTPClient(client *http.Client) JWTOption {
+	return jwtFunctionAdapter(func(c *jwtConfig) { c.httpClient = client })
+}
+
+type jwtAuthenticator struct {
+	jwtConfig
+	jwksURL string
+
+	mu          sync.Mutex
+	keys        *jose.JSONWebKeySet
+	lastRefresh time.Time
+}
+
+// NewJWTAuthenticator authenticates requests using bearer tokens signed by keys of the JSON Web Key Set in the specified file.
+// If jwksFile is empty, the keys are fetched from the issuer specified using [WithIssuer].
+// The subject-claim is used as name of the identity and permissions are granted by the "scope"- or "scp"-claim.
+func NewJWTAuthenticator(ctx context.Context, jwksFile string, options ...JWTOption) (Authenticator, error) {
+	a := &jwtAuthenticator{jwtConfig: jwtConfig{scopePrefix: "zanzigo:", httpClient: http.DefaultClient}}
+	lo.ForEach(options, func(o JWTOption, _ int) { o.do(&a.jwtConfig) })
+
+	if jwksFile != "" {
+		data, err := os.ReadFile(jwksFile)
+		if err != nil {
+			return nil, err
+		}
+		a.keys = &jose.JSONWebKeySet{}
+		if err := json.Unmarshal(data, a.keys); err != nil {
+			return nil, fmt.Errorf("failed to parse '%s': %w", jwksFile, err)
+		}
+		return a, nil
+	}
+
+	if a.issuer == "" {
+		return nil, fmt.Errorf("either a JWKS file or an issuer is required")
+	}
+	discovery := struct {
+		JWKSURI string `json:"jwks_uri"`
+	}{}
+	if err := a.fetchJSON(ctx, strings.TrimSuffix(a.issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("failed to discover keys of issuer '%s': %w", a.issuer, err)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("issuer '%s' does not advertise jwks_uri", a.issuer)
+	}
+	a.jwksURL = discovery.JWKSURI
+	if _, err := a.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *jwtAuthenticator) fetchJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// refreshKeys fetches the keys of the issuer, unless they were fetched recently.
+func (a *jwtAuthenticator) refreshKeys(ctx context.Context) (*jose.JSONWebKeySet, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.jwksURL == "" || time.Since(a.lastRefresh) < jwksRefreshInterval {
+		return a.keys, nil
+	}
+	a.lastRefresh = time.Now()
+	keys := &jose.JSONWebKeySet{}
+	if err := a.fetchJSON(ctx, a.jwksURL, keys); err != nil {
+		return a.keys, fmt.Errorf("failed to fetch keys: %w", err)
+	}
+	a.keys = keys
+	return keys, nil
+}
+
+func (a *jwtAuthenticator) key(ctx context.Context, kid string) (*jose.JSONWebKey, error) {
+	a.mu.Lock()
+	keys := a.keys
+	a.mu.Unlock()
+	if found := keys.Key(kid); len(found) > 0 {
+		return &found[0], nil
+	}
+	// The issuer might have rotated its keys
+	keys, err := a.refreshKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if found := keys.Key(kid); len(found) > 0 {
+		return &found[0], nil
+	}
+	return nil, fmt.Errorf("unknown key '%s'", kid)
+}
+
+func (a *jwtAuthenticator) Authenticate(ctx context.Context, header http.Header) (*Identity, error) {
+	token, ok := bearerToken(header)
+	// Other bearer tokens, e.g. preshared keys, are not in compact serialization
+	if !ok || strings.Count(token, ".") != 2 {
+		return nil, nil
+	}
+	parsed, err := jwt.ParseSigned(token, jwtSignatureAlgorithms)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	key, err := a.key(ctx, parsed.Headers[0].KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	claims := jwt.Claims{}
+	scopes := struct {
+		Scope string          `json:"scope"`
+		Scp   json.RawMessage `json:"scp"`
+	}{}
+	if err := parsed.Claims(key.Public(), &claims, &scopes); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	expected := jwt.Expected{Issuer: a.issuer}
+	if a.audience != "" {
+		expected.AnyAudience = jwt.Audience{a.audience}
+	}
+	if err := claims.ValidateWithLeeway(expected, jwtLeeway); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	identity := &Identity{Name: claims.Subject}
+	for _, scope := range parseScopes(scopes.Scope, scopes.Scp) {
+		if permission, ok := strings.CutPrefix(scope, a.scopePrefix); ok {
+			identity.Permissions = append(identity.Permissions, Permission(permission))
+		}
+	}
+	return identity, nil
+}
+
+// Scopes are either a space-separated string (RFC 8693) or, e.g. by Azure AD and Okta, a list or string in "scp".
+func parseScopes(scope string, scp json.RawMessage) []string {
+	scopes := strings.Fields(scope)
+	if len(scp) > 0 {
+		list := []string{}
+		if err := json.Unmarshal(scp, &list); err == nil {
+			scopes = append(scopes, list...)
+		} else if err := json.Unmarshal(scp, &scope); err == nil {
+			scopes = append(scopes, strings.Fields(scope)...)
+		}
+	}
+	return scopes
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1connect "github.com/trevex/zanzigo/api/zanzigo/v1/zanzigov1connect"
+
+	"connectrpc.com/connect"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name string, v any) string {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	filename := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(filename, data, 0o600))
+	return filename
+}
+
+func bearer(token string) http.Header {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	return header
+}
+
+func requireCode(t *testing.T, code connect.Code, err error) {
+	t.Helper()
+	require.Error(t, err)
+	require.Equal(t, code, connect.CodeOf(err))
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	psk, err := NewPresharedKeyAuthenticator(writeFile(t, "psk.json", []map[string]any{
+		{"name": "reader", "key": "readkey", "permissions": []string{"read"}},
+		{"name": "writer", "key": "writekey", "permissions": []string{"read", "write"}},
+	}))
+	require.NoError(t, err)
+	interceptor := &authInterceptor{[]Authenticator{psk}}
+	ctx := context.Background()
+
+	_, err = interceptor.authorize(ctx, v1connect.ZanzigoServiceCheckProcedure, http.Header{})
+	requireCode(t, connect.CodeUnauthenticated, err)
+	_, err = interceptor.authorize(ctx, v1connect.ZanzigoServiceCheckProcedure, bearer("unknown"))
+	requireCode(t, connect.CodeUnauthenticated, err)
+
+	// Reads and writes are authorized separately
+	authorized, err := interceptor.authorize(ctx, v1connect.ZanzigoServiceCheckProcedure, bearer("readkey"))
+	require.NoError(t, err)
+	identity, ok := IdentityFromContext(authorized)
+	require.True(t, ok)
+	require.Equal(t, "reader", identity.Name)
+	_, err = interceptor.authorize(ctx, v1connect.ZanzigoServiceWriteProcedure, bearer("readkey"))
+	requireCode(t, connect.CodePermissionDenied, err)
+	_, err = interceptor.authorize(ctx, v1connect.ZanzigoServiceWriteProcedure, bearer("writekey"))
+	require.NoError(t, err)
+
+	// Managing stores requires the admin permission
+	_, err = interceptor.authorize(ctx, v1connect.StoreServiceCreateStoreProcedure, bearer("writekey"))
+	requireCode(t, connect.CodePermissionDenied, err)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	jwks := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: privateKey.Public(), KeyID: "mykey", Algorithm: string(jose.ES256), Use: "sig"}}}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: privateKey}, (&jose.SignerOptions{}).WithHeader("kid", "mykey"))
+	require.NoError(t, err)
+
+	// The issuer serves its keys using OpenID Connect discovery
+	mux := http.NewServeMux()
+	issuer := httptest.NewServer(mux)
+	defer issuer.Close()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": issuer.URL, "jwks_uri": issuer.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jwks)
+	})
+
+	sign := func(claims jwt.Claims, scope any) string {
+		token, err := jwt.Signed(signer).Claims(claims).Claims(map[string]any{"scope": scope}).Serialize()
+		require.NoError(t, err)
+		return token
+	}
+	now := time.Now()
+	valid := jwt.Claims{Subject: "myservice", Issuer: issuer.URL, Audience: jwt.Audience{"zanzigo"}, Expiry: jwt.NewNumericDate(now.Add(time.Hour))}
+
+	ctx := context.Background()
+	// Keys are either loaded from a file or discovered using the issuer
+	for _, name := range []string{"file", "issuer"} {
+		t.Run(name, func(t *testing.T) {
+			jwksFile := ""
+			if name == "file" {
+				jwksFile = writeFile(t, "jwks.json", jwks)
+			}
+			a, err := NewJWTAuthenticator(ctx, jwksFile, WithIssuer(issuer.URL), WithAudience("zanzigo"))
+			require.NoError(t, err)
+
+			identity, err := a.Authenticate(ctx, bearer(sign(valid, "openid zanzigo:read")))
+			require.NoError(t, err)
+			require.Equal(t, &Identity{Name: "myservice", Permissions: []Permission{PermissionRead}}, identity)
+
+			// Tokens not looking like JWTs are left to other authenticators
+			identity, err = a.Authenticate(ctx, bearer("readkey"))
+			require.NoError(t, err)
+			require.Nil(t, identity)
+
+			expired := valid
+			expired.Expiry = jwt.NewNumericDate(now.Add(-time.Hour))
+			_, err = a.Authenticate(ctx, bearer(sign(expired, "zanzigo:read")))
+			require.ErrorIs(t, err, ErrInvalidCredentials)
+
+			otherAudience := valid
+			otherAudience.Audience = jwt.Audience{"other"}
+			_, err = a.Authenticate(ctx, bearer(sign(otherAudience, "zanzigo:read")))
+			require.ErrorIs(t, err, ErrInvalidCredentials)
+
+			// Signatures of unknown keys are rejected
+			otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			require.NoError(t, err)
+			otherSigner, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: otherKey}, (&jose.SignerOptions{}).WithHeader("kid", "mykey"))
+			require.NoError(t, err)
+			forged, err := jwt.Signed(otherSigner).Claims(valid).Serialize()
+			require.NoError(t, err)
+			_, err = a.Authenticate(ctx, bearer(forged))
+			require.ErrorIs(t, err, ErrInvalidCredentials)
+		})
+	}
+
+	require.Equal(t, []string{"a", "b", "c"}, parseScopes("a", json.RawMessage(`["b", "c"]`)))
+	require.Equal(t, []string{"b", "c"}, parseScopes("", json.RawMessage(`"b c"`)))
+}
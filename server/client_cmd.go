@@ -0,0 +1,417 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/trevex/zanzigo"
+	v1 "github.com/trevex/zanzigo/api/zanzigo/v1"
+	v1connect "github.com/trevex/zanzigo/api/zanzigo/v1/zanzigov1connect"
+	"github.com/trevex/zanzigo/client"
+	"github.com/trevex/zanzigo/internal/convert"
+
+	"connectrpc.com/connect"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// NewClientCmds returns the commands talking to a running server: check, write, delete, read and list.
+// Tuples are specified in Zanzibar-format, e.g. 'doc:mydoc#viewer@user:myuser'.
+func NewClientCmds() []*cobra.Command {
+	return []*cobra.Command{newCheckCmd(), newWriteCmd(), newDeleteCmd(), newReadCmd(), newListCmd()}
+}
+
+// Used by commands sending single requests, if --timeout is not specified.
+const defaultRequestTimeout = 10 * time.Second
+
+type clientFlags struct {
+	address  string
+	store    string
+	output   string
+	protocol string
+	token    string
+	caFile   string
+	certFile string
+	keyFile  string
+	timeout  time.Duration
+}
+
+// newClientFlags registers the flags to connect to the server, timeout is the default timeout of requests (0 means none).
+func newClientFlags(flags *pflag.FlagSet, timeout time.Duration) *clientFlags {
+	f := &clientFlags{}
+	flags.StringVar(&f.address, "address", "http://localhost:4000", "URL of the server, use https:// to connect using TLS")
+	flags.StringVar(&f.store, "store", "", "store the request applies to, the default store is used if empty")
+	flags.StringVar(&f.protocol, "protocol", "connect", "protocol used to talk to the server ('connect', 'grpc' or 'grpcweb')")
+	flags.StringVar(&f.token, "token", os.Getenv("ZANZIGO_TOKEN"), "bearer token sent to authenticate, defaults to $ZANZIGO_TOKEN")
+	flags.StringVar(&f.caFile, "ca", "", "PEM-encoded CA certificates the server certificate is verified against, the system pool is used if empty")
+	flags.StringVar(&f.certFile, "cert", "", "PEM-encoded client certificate for mutual TLS")
+	flags.StringVar(&f.keyFile, "key", "", "PEM-encoded private key of the client certificate")
+	flags.DurationVar(&f.timeout, "timeout", timeout, "timeout of each request, 0 means none")
+	return f
+}
+
+// addOutputFlag registers the output flag for commands printing responses.
+func (f *clientFlags) addOutputFlag(flags *pflag.FlagSet) {
+	flags.StringVarP(&f.output, "output", "o", "table", "output format ('table' or 'json')")
+}
+
+// Client creates a client of the ZanzigoService using the configured protocol and credentials.
+func (f *clientFlags) Client() (v1connect.ZanzigoServiceClient, error) {
+	if f.output != "" && f.output != "table" && f.output != "json" {
+		return nil, fmt.Errorf("unknown output format '%s', use 'table' or 'json'", f.output)
+	}
+	options := []connect.ClientOption{}
+	switch f.protocol {
+	case "connect":
+	case "grpc":
+		options = append(options, connect.WithGRPC())
+	case "grpcweb":
+		options = append(options, connect.WithGRPCWeb())
+	default:
+		return nil, fmt.Errorf("unknown protocol '%s', use 'connect', 'grpc' or 'grpcweb'", f.protocol)
+	}
+	if f.token != "" {
+		options = append(options, connect.WithInterceptors(client.NewTokenInterceptor(f.token)))
+	}
+	httpClient, err := f.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	return v1connect.NewZanzigoServiceClient(httpClient, strings.TrimSuffix(f.address, "/"), options...), nil
+}
+
+func (f *clientFlags) httpClient() (*http.Client, error) {
+	if !strings.HasPrefix(f.address, "https://") {
+		if f.protocol != "grpc" {
+			return &http.Client{Timeout: f.timeout}, nil
+		}
+		// gRPC requires HTTP/2, which is served without TLS by the plaintext server (h2c)
+		return &http.Client{Timeout: f.timeout, Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}}, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if f.caFile != "" {
+		data, err := os.ReadFile(f.caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in '%s'", f.caFile)
+		}
+	}
+	if f.certFile != "" || f.keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{Timeout: f.timeout, Transport: &http.Transport{TLSClientConfig: config, ForceAttemptHTTP2: true}}, nil
+}
+
+// printJSON writes the message as a single line of JSON using the field names of the API.
+// Unset fields are included, so the output always has the same structure.
+func printJSON(w io.Writer, m proto.Message) error {
+	data, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+func parseTuples(args []string) ([]*v1.Tuple, error) {
+	tuples := make([]*v1.Tuple, 0, len(args))
+	for _, arg := range args {
+		t, err := zanzigo.ParseTuple(arg)
+		if err != nil {
+			return nil, err
+		}
+		tuples = append(tuples, convert.ToProtobufTuple(&t))
+	}
+	return tuples, nil
+}
+
+// parseFilter returns the filter of the --object, --relation and --subject flags.
+func parseFilter(object, relation, subject string) *v1.Tuple {
+	filter := &v1.Tuple{ObjectRelation: relation}
+	filter.ObjectType, filter.ObjectId, _ = strings.Cut(object, ":")
+	subject, filter.SubjectRelation, _ = strings.Cut(subject, "#")
+	filter.SubjectType, filter.SubjectId, _ = strings.Cut(subject, ":")
+	return filter
+}
+
+func tupleString(t *v1.Tuple) string {
+	tuple := convert.ToZanzigoTuple(t)
+	return tuple.ToString()
+}
+
+func parseStruct(flag, data string) (*structpb.Struct, error) {
+	if data == "" {
+		return nil, nil
+	}
+	values := map[string]any{}
+	if err := json.Unmarshal([]byte(data), &values); err != nil {
+		return nil, fmt.Errorf("--%s is not a JSON object: %w", flag, err)
+	}
+	return structpb.NewStruct(values)
+}
+
+func newCheckCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "check [flags] [tuple]",
+		Short: "Check whether the subject of the tuple has the relation to the object",
+		Args:  cobra.ExactArgs(1),
+	}
+	var (
+		context          string
+		contextualTuples []string
+	)
+	flags := cmd.Flags()
+	flags.StringVar(&context, "context", "", "JSON object with the parameters of conditions, e.g. '{\"ip\": \"10.0.0.1\"}'")
+	flags.StringArrayVar(&contextualTuples, "contextual-tuple", nil, "tuple treated as if it was stored for this check, can be repeated")
+	client := newClientFlags(flags, defaultRequestTimeout)
+	client.addOutputFlag(flags)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		c, err := client.Client()
+		if err != nil {
+			return err
+		}
+		tuples, err := parseTuples(args)
+		if err != nil {
+			return err
+		}
+		contextual, err := parseTuples(contextualTuples)
+		if err != nil {
+			return err
+		}
+		req := &v1.CheckRequest{Tuple: tuples[0], ContextualTuples: contextual, StoreId: client.store}
+		if req.Context, err = parseStruct("context", context); err != nil {
+			return err
+		}
+		resp, err := c.Check(cmd.Context(), connect.NewRequest(req))
+		if err != nil {
+			return err
+		}
+
+		if client.output == "json" {
+			return printJSON(cmd.OutOrStdout(), resp.Msg)
+		}
+		switch {
+		case resp.Msg.Result:
+			fmt.Fprintln(cmd.OutOrStdout(), "allowed")
+		case resp.Msg.Conditional:
+			fmt.Fprintln(cmd.OutOrStdout(), "conditional (parameters missing in --context)")
+		default:
+			fmt.Fprintln(cmd.OutOrStdout(), "denied")
+		}
+		return nil
+	}
+	return cmd
+}
+
+func newWriteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "write [flags] [tuple...]",
+		Short: "Write tuples, existing tuples are updated",
+		Args:  cobra.MinimumNArgs(1),
+	}
+	var (
+		ttl              time.Duration
+		condition        string
+		conditionContext string
+	)
+	flags := cmd.Flags()
+	flags.DurationVar(&ttl, "ttl", 0, "duration after which the tuples expire, 0 means never")
+	flags.StringVar(&condition, "condition", "", "name of the condition of the model the tuples only apply under")
+	flags.StringVar(&conditionContext, "condition-context", "", "JSON object with parameters of the condition stored with the tuples")
+	client := newClientFlags(flags, defaultRequestTimeout)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		c, err := client.Client()
+		if err != nil {
+			return err
+		}
+		tuples, err := parseTuples(args)
+		if err != nil {
+			return err
+		}
+		if conditionContext != "" && condition == "" {
+			return fmt.Errorf("--condition-context requires --condition")
+		}
+		context, err := parseStruct("condition-context", conditionContext)
+		if err != nil {
+			return err
+		}
+		for _, t := range tuples {
+			if ttl > 0 {
+				t.ExpiresAt = timestamppb.New(time.Now().Add(ttl))
+			}
+			if condition != "" {
+				t.Condition = &v1.Condition{Name: condition, Context: context}
+			}
+			if _, err := c.Write(cmd.Context(), connect.NewRequest(&v1.WriteRequest{Tuple: t, StoreId: client.store})); err != nil {
+				return fmt.Errorf("failed to write '%s': %w", tupleString(t), err)
+			}
+		}
+		return nil
+	}
+	return cmd
+}
+
+func newDeleteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete [flags] [tuple...]",
+		Short: "Delete tuples",
+		Args:  cobra.MinimumNArgs(1),
+	}
+	ignoreMissing := false
+	flags := cmd.Flags()
+	flags.BoolVar(&ignoreMissing, "ignore-missing", false, "do not fail if a tuple does not exist")
+	client := newClientFlags(flags, defaultRequestTimeout)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		c, err := client.Client()
+		if err != nil {
+			return err
+		}
+		tuples, err := parseTuples(args)
+		if err != nil {
+			return err
+		}
+		for _, t := range tuples {
+			_, err := c.Delete(cmd.Context(), connect.NewRequest(&v1.DeleteRequest{Tuple: t, StoreId: client.store}))
+			if err != nil && !(ignoreMissing && connect.CodeOf(err) == connect.CodeNotFound) {
+				return fmt.Errorf("failed to delete '%s': %w", tupleString(t), err)
+			}
+		}
+		return nil
+	}
+	return cmd
+}
+
+func newReadCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "read [flags] [tuple]",
+		Short: "Read the UUID of a tuple, fails if the tuple does not exist",
+		Args:  cobra.ExactArgs(1),
+	}
+	client := newClientFlags(cmd.Flags(), defaultRequestTimeout)
+	client.addOutputFlag(cmd.Flags())
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		c, err := client.Client()
+		if err != nil {
+			return err
+		}
+		tuples, err := parseTuples(args)
+		if err != nil {
+			return err
+		}
+		resp, err := c.Read(cmd.Context(), connect.NewRequest(&v1.ReadRequest{Tuple: tuples[0], StoreId: client.store}))
+		if err != nil {
+			return err
+		}
+		if client.output == "json" {
+			return printJSON(cmd.OutOrStdout(), resp.Msg)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), resp.Msg.Uuid)
+		return nil
+	}
+	return cmd
+}
+
+func newListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list [flags]",
+		Short: "List tuples matching the filter, all pages are fetched unless --max is set",
+		Args:  cobra.NoArgs,
+	}
+	var (
+		object   string
+		relation string
+		subject  string
+		pageSize uint32
+		max      int
+	)
+	flags := cmd.Flags()
+	flags.StringVar(&object, "object", "", "filter by object-type or object in the form 'type:id'")
+	flags.StringVar(&relation, "relation", "", "filter by relation of the object")
+	flags.StringVar(&subject, "subject", "", "filter by subject-type, subject in the form 'type:id' or userset in the form 'type:id#relation'")
+	flags.Uint32Var(&pageSize, "page-size", 100, "number of tuples requested at once")
+	flags.IntVar(&max, "max", 0, "maximum number of tuples listed, 0 lists all")
+	client := newClientFlags(flags, defaultRequestTimeout)
+	client.addOutputFlag(flags)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		c, err := client.Client()
+		if err != nil {
+			return err
+		}
+		filter := parseFilter(object, relation, subject)
+
+		out := cmd.OutOrStdout()
+		var table *tabwriter.Writer
+		if client.output == "table" {
+			table = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+			defer table.Flush()
+			fmt.Fprintln(table, "TUPLE\tEXPIRES AT\tCONDITION")
+		}
+		listed := 0
+		pagination := &v1.Pagination{Limit: pageSize}
+		for {
+			if max > 0 && max-listed < int(pageSize) {
+				pagination.Limit = uint32(max - listed)
+			}
+			resp, err := c.List(cmd.Context(), connect.NewRequest(&v1.ListRequest{Filter: filter, Pagination: pagination, StoreId: client.store}))
+			if err != nil {
+				return err
+			}
+			for _, t := range resp.Msg.Tuples {
+				if table == nil {
+					if err := printJSON(out, t); err != nil {
+						return err
+					}
+					continue
+				}
+				tuple := convert.ToZanzigoTuple(t)
+				expiresAt, condition := "", ""
+				if tuple.ExpiresAt != nil {
+					expiresAt = tuple.ExpiresAt.Format(time.RFC3339)
+				}
+				if tuple.Condition != nil {
+					condition = tuple.Condition.Name
+				}
+				fmt.Fprintf(table, "%s\t%s\t%s\n", tuple.ToString(), expiresAt, condition)
+			}
+			listed += len(resp.Msg.Tuples)
+			if resp.Msg.Cursor == "" || (max > 0 && listed >= max) {
+				return nil
+			}
+			pagination.Cursor = resp.Msg.Cursor
+		}
+	}
+	return cmd
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/trevex/zanzigo"
+	v1connect "github.com/trevex/zanzigo/api/zanzigo/v1/zanzigov1connect"
+	"github.com/trevex/zanzigo/storage/sqlite3"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCmds(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.db")
+	require.NoError(t, sqlite3.RunMigrations(file))
+	storage, err := sqlite3.NewSQLite3Storage(file)
+	require.NoError(t, err)
+	defer storage.Close()
+	stores, err := NewStoreRegistry(storage, zanzigo.ModelDefinition{Objects: zanzigo.ObjectMap{
+		"user":  zanzigo.RelationMap{},
+		"group": zanzigo.RelationMap{"member": zanzigo.Rule{}},
+		"doc":   zanzigo.RelationMap{"viewer": zanzigo.Rule{}},
+	}}, 16)
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	mux.Handle(v1connect.NewZanzigoServiceHandler(NewZanzigoServiceHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), stores)))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	run := func(args ...string) (string, error) {
+		t.Helper()
+		root := &cobra.Command{Use: "zanzigo", SilenceUsage: true, SilenceErrors: true}
+		root.AddCommand(NewClientCmds()...)
+		out := &bytes.Buffer{}
+		root.SetOut(out)
+		root.SetArgs(append(args, "--address", server.URL))
+		err := root.ExecuteContext(context.Background())
+		return out.String(), err
+	}
+
+	_, err = run("write", "doc:mydoc#viewer@user:myuser", "doc:otherdoc#viewer@group:mygroup#member", "doc:thirddoc#viewer@user:myuser")
+	require.NoError(t, err)
+	_, err = run("write", "doc:mydoc#unknown@user:myuser")
+	require.Error(t, err)
+
+	out, err := run("check", "doc:mydoc#viewer@user:myuser")
+	require.NoError(t, err)
+	require.Equal(t, "allowed\n", out)
+	out, err = run("check", "doc:mydoc#viewer@user:otheruser", "-o", "json")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"result": false, "conditional": false}`, out)
+
+	// All pages are listed
+	out, err = run("list", "--object", "doc", "--page-size", "1")
+	require.NoError(t, err)
+	require.Equal(t, 4, strings.Count(out, "\n"))
+	require.Contains(t, out, "doc:otherdoc#viewer@group:mygroup#member")
+	out, err = run("list", "--subject", "user:myuser", "--page-size", "1", "-o", "json")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 2)
+	listed := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &listed))
+	require.Equal(t, "myuser", listed["subjectId"])
+	out, err = run("list", "--max", "1")
+	require.NoError(t, err)
+	require.Equal(t, 2, strings.Count(out, "\n"))
+
+	_, err = run("delete", "doc:mydoc#viewer@user:myuser")
+	require.NoError(t, err)
+	_, err = run("read", "doc:mydoc#viewer@user:myuser")
+	require.Error(t, err)
+	_, err = run("delete", "doc:mydoc#viewer@user:myuser")
+	require.Error(t, err)
+	_, err = run("delete", "--ignore-missing", "doc:mydoc#viewer@user:myuser")
+	require.NoError(t, err)
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFlag = "config"
+	// Prefix of the environment variables setting flags, e.g. ZANZIGO_POSTGRES_URL sets --postgres-url.
+	envPrefix = "ZANZIGO_"
+)
+
+func newConfigFlag(flags *pflag.FlagSet) {
+	flags.String(configFlag, "", "YAML file setting flags by name, e.g. 'postgres-url: ...' or nested 'postgres: {url: ...}', "+
+		"flags take precedence over "+envPrefix+"* environment variables, which take precedence over the file")
+}
+
+// withConfig adds --config to the command and applies the config file and environment variables before it runs,
+// so commands sharing flags with the server, e.g. the storage flags, are configured the same way.
+func withConfig(cmd *cobra.Command) {
+	newConfigFlag(cmd.Flags())
+	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		return applyConfig(cmd.Flags())
+	}
+}
+
+// envName returns the environment variable of the flag, e.g. ZANZIGO_MAX_DEPTH for --max-depth.
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// applyConfig sets all flags, which were not set on the command line, from their environment variable or the config file,
+// which is set using --config or its environment variable. Keys of the config file, which are neither flags of the command nor the server,
+// are rejected, so the file of the server can be shared with other commands, e.g. migrate.
+func applyConfig(flags *pflag.FlagSet) error {
+	file := flags.Lookup(configFlag)
+	if value, ok := os.LookupEnv(envName(configFlag)); ok && !file.Changed {
+		if err := flags.Set(configFlag, value); err != nil {
+			return err
+		}
+	}
+	values := map[string]any{}
+	if filename := file.Value.String(); filename != "" {
+		var err error
+		if values, err = readConfigFile(filename); err != nil {
+			return err
+		}
+	}
+
+	errs := []error{}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	serverFlags := pflag.NewFlagSet("server", pflag.ContinueOnError)
+	newServerFlags(serverFlags)
+	for _, key := range keys {
+		if (flags.Lookup(key) == nil && serverFlags.Lookup(key) == nil) || key == configFlag {
+			errs = append(errs, fmt.Errorf("unknown key '%s' in config file", key))
+		}
+	}
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Changed || flag.Name == configFlag {
+			return
+		}
+		if value, ok := os.LookupEnv(envName(flag.Name)); ok {
+			if err := flags.Set(flag.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid $%s: %w", envName(flag.Name), err))
+			}
+		} else if value, ok := values[flag.Name]; ok {
+			if err := setFromConfig(flags, flag, value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid '%s' in config file: %w", flag.Name, err))
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// readConfigFile returns the values of the config file by flag name, nested keys are joined using '-'.
+func readConfigFile(filename string) (map[string]any, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]any{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("malformed config file '%s': %w", filename, err)
+	}
+	values := map[string]any{}
+	var flatten func(prefix string, m map[string]any)
+	flatten = func(prefix string, m map[string]any) {
+		for key, value := range m {
+			if nested, ok := value.(map[string]any); ok {
+				flatten(prefix+key+"-", nested)
+			} else {
+				values[prefix+key] = value
+			}
+		}
+	}
+	flatten("", raw)
+	return values, nil
+}
+
+func setFromConfig(flags *pflag.FlagSet, flag *pflag.Flag, value any) error {
+	list, ok := value.([]any)
+	if !ok {
+		return flags.Set(flag.Name, fmt.Sprint(value))
+	}
+	slice, ok := flag.Value.(pflag.SliceValue)
+	if !ok {
+		return fmt.Errorf("expected a single value, got a list")
+	}
+	values := make([]string, 0, len(list))
+	for _, v := range list {
+		values = append(values, fmt.Sprint(v))
+	}
+	if err := slice.Replace(values); err != nil {
+		return err
+	}
+	flag.Changed = true
+	return nil
+}
+
+// NewConfigCmd returns the config command, whose validate subcommand checks the configuration of the server before deploying it.
+func NewConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the configuration of the server",
+	}
+
+	validateCmd := &cobra.Command{
+		Use:   "validate [flags] [model-file]",
+		Short: "Validate the configuration of the server from flags, environment variables and config file",
+		Long: "Validate the configuration of the server, e.g. the model file, storage selection, authentication and TLS, " +
+			"without connecting to the storage. Accepts the same flags, " + envPrefix + "* environment variables and config file as the server.",
+	}
+	f := newServerFlags(validateCmd.Flags())
+	validateCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		err := applyConfig(cmd.Flags())
+		err = errors.Join(err, f.Validate(cmd.Context(), args))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), "configuration is valid")
+		return nil
+	}
+	cmd.AddCommand(validateCmd)
+	return cmd
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/trevex/zanzigo"
+	"github.com/trevex/zanzigo/storage/sqlite3"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyConfig(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+max-depth: 8
+port: 5000
+postgres:
+  url: postgres://file
+gc-interval: 5m
+`), 0o600))
+
+	flags := pflag.NewFlagSet("server", pflag.ContinueOnError)
+	f := newServerFlags(flags)
+	var slice []string
+	flags.StringSliceVar(&slice, "slice", nil, "")
+	t.Setenv("ZANZIGO_CONFIG", configFile)
+	t.Setenv("ZANZIGO_PORT", "6000")
+	t.Setenv("ZANZIGO_POSTGRES_URL", "postgres://env")
+	require.NoError(t, flags.Parse([]string{"--postgres-url", "postgres://flag"}))
+	require.NoError(t, applyConfig(flags))
+	require.Equal(t, 8, f.maxDepth)
+	require.Equal(t, 6000, f.port)
+	require.Equal(t, "postgres://flag", flags.Lookup("postgres-url").Value.String())
+	require.Equal(t, "5m0s", f.gcInterval.String())
+	require.Equal(t, 16, newServerFlags(pflag.NewFlagSet("defaults", pflag.ContinueOnError)).maxDepth)
+
+	// Lists set slice flags, all problems are reported at once
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+slice: [a, b]
+unknown: true
+tls: {port: [1, 2]}
+`), 0o600))
+	t.Setenv("ZANZIGO_MAX_DEPTH", "deep")
+	flags = pflag.NewFlagSet("server", pflag.ContinueOnError)
+	newServerFlags(flags)
+	flags.StringSliceVar(&slice, "slice", nil, "")
+	err := applyConfig(flags)
+	require.ErrorContains(t, err, "unknown key 'unknown' in config file")
+	require.ErrorContains(t, err, "invalid 'tls-port' in config file: expected a single value")
+	require.ErrorContains(t, err, "invalid $ZANZIGO_MAX_DEPTH")
+	require.Equal(t, []string{"a", "b"}, slice)
+}
+
+func TestConfigStorageCmds(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.yaml")
+	configDB, envDB := filepath.Join(dir, "config.db"), filepath.Join(dir, "env.db")
+	// Flags only known to the server are accepted, so the config file can be shared
+	require.NoError(t, os.WriteFile(configFile, []byte("port: 5000\nsqlite: {file: "+configDB+"}\n"), 0o600))
+	t.Setenv("ZANZIGO_CONFIG", configFile)
+
+	run := func(cmd *cobra.Command, args ...string) (string, error) {
+		out := &bytes.Buffer{}
+		cmd.SetOut(out)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs(args)
+		err := cmd.ExecuteContext(ctx)
+		return out.String(), err
+	}
+	_, err := run(NewMigrateCmd(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	require.NoError(t, err)
+	require.FileExists(t, configDB)
+
+	t.Setenv("ZANZIGO_SQLITE_FILE", envDB)
+	_, err = run(NewMigrateCmd(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	require.NoError(t, err)
+	storage, err := sqlite3.NewSQLite3Storage(envDB)
+	require.NoError(t, err)
+	require.NoError(t, storage.Write(ctx, zanzigo.TupleString("doc:readme#viewer@user:alice")))
+	require.NoError(t, storage.Close())
+	out, err := run(newExportCmd(), "--format", "text")
+	require.NoError(t, err)
+	require.Equal(t, "doc:readme#viewer@user:alice\n", out)
+
+	require.NoError(t, os.WriteFile(configFile, []byte("unknown: true\n"), 0o600))
+	_, err = run(NewMigrateCmd(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	require.ErrorContains(t, err, "unknown key 'unknown' in config file")
+}
+
+func TestConfigValidateCmd(t *testing.T) {
+	dir := t.TempDir()
+	modelFile := filepath.Join(dir, "model.json")
+	require.NoError(t, os.WriteFile(modelFile, []byte(`{"user": {}, "doc": {"viewer": {}}}`), 0o600))
+
+	run := func(args ...string) (string, error) {
+		cmd := NewConfigCmd()
+		out := &bytes.Buffer{}
+		cmd.SetOut(out)
+		cmd.SetErr(out)
+		cmd.SetArgs(append([]string{"validate"}, args...))
+		err := cmd.ExecuteContext(context.Background())
+		return out.String(), err
+	}
+
+	t.Setenv("ZANZIGO_MODEL_FILE", modelFile)
+	out, err := run("--sqlite-file", filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	require.Equal(t, "configuration is valid\n", out)
+
+	_, err = run("--tls-cert", "cert.pem", "--postgres-url", "postgres://", "--mysql-dsn", "mysql", "--max-depth", "0", filepath.Join(dir, "missing.json"))
+	require.ErrorContains(t, err, "invalid model file")
+	require.ErrorContains(t, err, "--max-depth has to be positive")
+	require.ErrorContains(t, err, "both --tls-cert and --tls-key are required")
+	require.ErrorContains(t, err, "multiple storage backends configured")
+}
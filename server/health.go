@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/trevex/zanzigo"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+	"connectrpc.com/grpcreflect"
+)
+
+// Probes of the storage are aborted after the timeout, so a hanging database is reported as not ready.
+const readinessTimeout = 2 * time.Second
+
+var (
+	errNotReady = errors.New("not ready")
+)
+
+// Health reports the server as ready once SetReady was called and as long as the storage is reachable.
+// It implements [grpchealth.Checker] and serves the HTTP probes /healthz and /readyz.
+type Health struct {
+	storage  zanzigo.Storage
+	services []string
+	ready    atomic.Bool
+}
+
+// NewHealth creates a Health of the storage and the specified services, which is not ready until SetReady is called.
+func NewHealth(storage zanzigo.Storage, services ...string) *Health {
+	return &Health{storage: storage, services: services}
+}
+
+// SetReady should be called after migrations ran and all resolvers are prepared, and with false once the server shuts down.
+func (h *Health) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+// Ready returns an error, if the server is not ready to handle requests.
+func (h *Health) Ready(ctx context.Context) error {
+	if !h.ready.Load() {
+		return errNotReady
+	}
+	if pinger, ok := h.storage.(zanzigo.Pinger); ok {
+		ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+		defer cancel()
+		if err := pinger.Ping(ctx); err != nil {
+			return fmt.Errorf("storage unreachable: %w", err)
+		}
+	}
+	return nil
+}
+
+// Check implements [grpchealth.Checker], the empty service refers to the server as a whole.
+func (h *Health) Check(ctx context.Context, req *grpchealth.CheckRequest) (*grpchealth.CheckResponse, error) {
+	if req.Service != "" && !slices.Contains(h.services, req.Service) {
+		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("unknown service '%s'", req.Service))
+	}
+	if err := h.Ready(ctx); err != nil {
+		return &grpchealth.CheckResponse{Status: grpchealth.StatusNotServing}, nil
+	}
+	return &grpchealth.CheckResponse{Status: grpchealth.StatusServing}, nil
+}
+
+// Register adds the gRPC health and reflection services as well as the HTTP probes to the mux.
+// Liveness (/healthz) only requires the process to respond, while readiness (/readyz) uses Ready.
+func (h *Health) Register(mux *http.ServeMux) {
+	mux.Handle(grpchealth.NewHandler(h))
+	reflector := grpcreflect.NewStaticReflector(append(slices.Clone(h.services), grpchealth.HealthV1ServiceName)...)
+	mux.Handle(grpcreflect.NewHandlerV1(reflector))
+	mux.Handle(grpcreflect.NewHandlerV1Alpha(reflector))
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := h.Ready(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok\n"))
+	})
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/trevex/zanzigo"
+	v1connect "github.com/trevex/zanzigo/api/zanzigo/v1/zanzigov1connect"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+	"connectrpc.com/grpcreflect"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type pingStorage struct {
+	zanzigo.Storage
+	err error
+}
+
+func (s *pingStorage) Ping(ctx context.Context) error {
+	return s.err
+}
+
+func TestHealth(t *testing.T) {
+	ctx := context.Background()
+	storage := &pingStorage{}
+	health := NewHealth(storage, v1connect.ZanzigoServiceName)
+	mux := http.NewServeMux()
+	health.Register(mux)
+	// Reflection uses bidirectional streaming, which requires HTTP/2
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	requireProbe := func(path string, status int) {
+		t.Helper()
+		resp, err := server.Client().Get(server.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, status, resp.StatusCode)
+	}
+	requireStatus := func(status grpchealth.Status) {
+		t.Helper()
+		resp, err := health.Check(ctx, &grpchealth.CheckRequest{Service: v1connect.ZanzigoServiceName})
+		require.NoError(t, err)
+		require.Equal(t, status, resp.Status)
+	}
+
+	// The server is alive, but not ready before the startup completed
+	requireProbe("/healthz", http.StatusOK)
+	requireProbe("/readyz", http.StatusServiceUnavailable)
+	requireStatus(grpchealth.StatusNotServing)
+
+	health.SetReady(true)
+	requireProbe("/readyz", http.StatusOK)
+	requireStatus(grpchealth.StatusServing)
+
+	// Unreachable storage makes the server unready, but it is still alive
+	storage.err = errors.New("connection refused")
+	requireProbe("/healthz", http.StatusOK)
+	requireProbe("/readyz", http.StatusServiceUnavailable)
+	requireStatus(grpchealth.StatusNotServing)
+
+	_, err := health.Check(ctx, &grpchealth.CheckRequest{Service: "unknown.Service"})
+	require.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+
+	stream := grpcreflect.NewClient(server.Client(), server.URL, connect.WithGRPC()).NewStream(ctx)
+	services, err := stream.ListServices()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []protoreflect.FullName{v1connect.ZanzigoServiceName, grpchealth.HealthV1ServiceName}, services)
+	_, err = stream.Close()
+	require.NoError(t, err)
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type metricsInterceptor struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewMetricsInterceptor creates an interceptor counting requests by procedure and code and recording their duration.
+func NewMetricsInterceptor(registerer prometheus.Registerer) (connect.Interceptor, error) {
+	i := &metricsInterceptor{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "zanzigo",
+			Name:      "rpc_requests_total",
+			Help:      "Number of handled requests by procedure and code.",
+		}, []string{"procedure", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "zanzigo",
+			Name:      "rpc_duration_seconds",
+			Help:      "Duration of handled requests by procedure.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"procedure"}),
+	}
+	for _, c := range []prometheus.Collector{i.requests, i.duration} {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return i, nil
+}
+
+func (i *metricsInterceptor) observe(procedure string, start time.Time, err error) {
+	code := "ok"
+	if err != nil {
+		code = connect.CodeOf(err).String()
+	}
+	i.requests.WithLabelValues(procedure, code).Inc()
+	i.duration.WithLabelValues(procedure).Observe(time.Since(start).Seconds())
+}
+
+func (i *metricsInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		start := time.Now()
+		resp, err := next(ctx, req)
+		i.observe(req.Spec().Procedure, start, err)
+		return resp, err
+	}
+}
+
+func (i *metricsInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *metricsInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		start := time.Now()
+		err := next(ctx, conn)
+		i.observe(conn.Spec().Procedure, start, err)
+		return err
+	}
+}
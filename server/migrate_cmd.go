@@ -0,0 +1,33 @@
+package server
+
+import (
+	"log/slog"
+
+	"github.com/spf13/cobra"
+)
+
+// NewMigrateCmd returns a command, which runs the migrations of the selected storage backend and exits.
+// This is useful if migrations should not be run by the server on startup, e.g. to upgrade the key format of pebble databases.
+func NewMigrateCmd(log *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate [flags]",
+		Short: "Run the migrations of the configured storage backend",
+	}
+
+	backends := newStorageBackendSet(cmd.Flags())
+	withConfig(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		backend, err := backends.Backend()
+		if err != nil {
+			return err
+		}
+		if err := backend.RunMigrations(); err != nil {
+			return err
+		}
+		log.Info("migrations completed")
+		return nil
+	}
+
+	return cmd
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/trevex/zanzigo"
+	"github.com/trevex/zanzigo/modeltest"
+	"github.com/trevex/zanzigo/storage/sqlite3"
+
+	"github.com/spf13/cobra"
+)
+
+// NewModelCmd returns a command grouping the subcommands operating on model files.
+func NewModelCmd(log *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "model",
+		Short: "Inspect model files",
+	}
+	cmd.AddCommand(newModelDiffCmd(log))
+	cmd.AddCommand(newModelTestCmd())
+	cmd.AddCommand(newModelGraphCmd())
+	return cmd
+}
+
+// newModelDiffCmd returns a command, which prints the changes between two model files and fails,
+// if the storage contains tuples invalid according to the new model. This allows to verify a model before the
+// server reloads it, e.g. as part of a deployment pipeline.
+func newModelDiffCmd(log *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff [flags] [old-model-file] [new-model-file]",
+		Short: "Print the changes between two models and check the storage for tuples affected by breaking changes",
+		Args:  cobra.ExactArgs(2),
+	}
+
+	store := ""
+	offline := false
+	flags := cmd.Flags()
+	flags.StringVar(&store, "store", zanzigo.DefaultStore, "store whose tuples are checked for conflicts")
+	flags.BoolVar(&offline, "offline", false, "do not query the storage, every breaking change is considered a conflict")
+	backends := newStorageBackendSet(flags)
+	withConfig(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		old, _, err := loadModel(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid model file '%s': %w", args[0], err)
+		}
+		new, _, err := loadModel(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid model file '%s': %w", args[1], err)
+		}
+
+		changes := zanzigo.DiffModelDefinitions(old, new)
+		out := cmd.OutOrStdout()
+		if len(changes) == 0 {
+			fmt.Fprintln(out, "no changes")
+			return nil
+		}
+		breaking := 0
+		for _, change := range changes {
+			fmt.Fprintln(out, change)
+			if change.Breaking {
+				breaking++
+			}
+		}
+		if breaking == 0 {
+			return nil
+		}
+		if offline {
+			return fmt.Errorf("%w: %d breaking changes", zanzigo.ErrIncompatibleModel, breaking)
+		}
+
+		backend, err := backends.Backend()
+		if err != nil {
+			return err
+		}
+		storage, err := backend.NewStorage()
+		if err != nil {
+			return err
+		}
+		defer storage.Close()
+		conflicts, err := zanzigo.FindConflicts(cmd.Context(), storage.ForStore(store), changes)
+		if err != nil {
+			return err
+		}
+		for _, conflict := range conflicts {
+			fmt.Fprintln(out, "conflict:", conflict)
+		}
+		if len(conflicts) > 0 {
+			return fmt.Errorf("%w: %d breaking changes affect stored tuples", zanzigo.ErrIncompatibleModel, len(conflicts))
+		}
+		log.Info("breaking changes do not affect stored tuples", slog.Int("breaking", breaking))
+		return nil
+	}
+
+	return cmd
+}
+
+// newModelTestCmd returns a command running the assertions of test files (see the modeltest-package) against an ephemeral
+// SQLite3 storage, which is removed afterwards. Failed checks are printed with the traversal of the check.
+func newModelTestCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test [flags] [test-file...]",
+		Short: "Run the assertions of test files against their model",
+		Args:  cobra.MinimumNArgs(1),
+	}
+	maxDepth := 0
+	cmd.Flags().IntVar(&maxDepth, "max-depth", 16, "maximum depth to traverse relationships")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		// Failed assertions are no usage error
+		cmd.SilenceUsage = true
+		dir, err := os.MkdirTemp("", "zanzigo-model-test-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		out := cmd.OutOrStdout()
+		assertions, failures := 0, 0
+		for i, filename := range args {
+			file, err := modeltest.ReadFile(filename)
+			if err != nil {
+				return fmt.Errorf("%s: %w", filename, err)
+			}
+			// Every file has its own database, so the stores of the tests do not collide
+			dbFile := filepath.Join(dir, fmt.Sprintf("%d.db", i))
+			if err := sqlite3.RunMigrations(dbFile); err != nil {
+				return err
+			}
+			storage, err := sqlite3.NewSQLite3Storage(dbFile)
+			if err != nil {
+				return err
+			}
+			result, err := modeltest.Run(cmd.Context(), storage, file, maxDepth)
+			storage.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", filename, err)
+			}
+
+			assertions += result.Assertions
+			failures += len(result.Failures)
+			for _, failure := range result.Failures {
+				fmt.Fprintf(out, "FAIL %s: %s\n", filename, failure.String())
+				for _, step := range failure.Trace {
+					for _, t := range step.Checks {
+						fmt.Fprintf(out, "    depth %d: checked %s\n", step.Depth, t.ToString())
+					}
+					for _, t := range step.Matches {
+						condition := ""
+						if t.Condition != nil {
+							condition = fmt.Sprintf(" (condition %s)", t.Condition.Name)
+						}
+						fmt.Fprintf(out, "    depth %d: found %s%s\n", step.Depth, t.ToString(), condition)
+					}
+				}
+			}
+			if len(result.Failures) == 0 {
+				fmt.Fprintf(out, "ok   %s (%d tests, %d assertions)\n", filename, result.Tests, result.Assertions)
+			}
+		}
+		if failures > 0 {
+			return fmt.Errorf("%d of %d assertions failed", failures, assertions)
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+// newModelGraphCmd returns a command rendering the types and relations of a model file as graph.
+func newModelGraphCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "graph [flags] [model-file]",
+		Short: "Render the types and relations of a model as Graphviz DOT or Mermaid graph",
+		Args:  cobra.ExactArgs(1),
+	}
+	var (
+		format    string
+		inferred  bool
+		highlight string
+	)
+	flags := cmd.Flags()
+	flags.StringVar(&format, "format", string(zanzigo.GraphFormatDOT), fmt.Sprintf("output format ('%s' or '%s')", zanzigo.GraphFormatDOT, zanzigo.GraphFormatMermaid))
+	flags.BoolVar(&inferred, "inferred", false, "render the inferred rules used by checks instead of the rules of the model")
+	flags.StringVar(&highlight, "highlight", "", "relation in the form 'type#relation' to highlight with all relations it is inherited from")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		definition, _, err := loadModel(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid model file '%s': %w", args[0], err)
+		}
+		options := []zanzigo.GraphOption{}
+		if inferred {
+			options = append(options, zanzigo.WithInferredRules())
+		}
+		if highlight != "" {
+			object, relation, ok := strings.Cut(highlight, "#")
+			if !ok {
+				return fmt.Errorf("--highlight requires the form 'type#relation', got '%s'", highlight)
+			}
+			options = append(options, zanzigo.WithHighlight(object, relation))
+		}
+		return zanzigo.RenderGraph(cmd.OutOrStdout(), definition.Objects, zanzigo.GraphFormat(format), options...)
+	}
+
+	return cmd
+}
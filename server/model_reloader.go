@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/trevex/zanzigo"
+)
+
+// ModelReloader keeps the [StoreRegistry] up to date: the model file is reloaded into the default store whenever its content changes
+// and the models of persisted stores are synchronized, so changes by other server instances are picked up.
+// Invalid models are logged and never replace a working model.
+type ModelReloader struct {
+	log      *slog.Logger
+	filename string
+	stores   *StoreRegistry
+	data     []byte
+}
+
+// NewModelReloader creates a reloader of the model file, data is the content the default store was created from.
+func NewModelReloader(log *slog.Logger, filename string, data []byte, stores *StoreRegistry) *ModelReloader {
+	return &ModelReloader{log, filename, stores, data}
+}
+
+// Reload checks the model file and the persisted stores for changes once.
+func (r *ModelReloader) Reload(ctx context.Context) error {
+	return errors.Join(r.reloadFile(ctx), r.stores.Load(ctx))
+}
+
+func (r *ModelReloader) reloadFile(ctx context.Context) error {
+	data, err := os.ReadFile(r.filename)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(data, r.data) {
+		return nil
+	}
+	// The content is remembered even if invalid, so the error is only reported once per change
+	r.data = data
+	definition, err := zanzigo.ParseModelDefinition(data)
+	if err != nil {
+		return fmt.Errorf("invalid model file '%s': %w", r.filename, err)
+	}
+	if err := r.stores.SetModel(ctx, zanzigo.DefaultStore, definition); err != nil {
+		return fmt.Errorf("invalid model file '%s': %w", r.filename, err)
+	}
+	r.log.Info("reloaded model file", slog.String("file", r.filename))
+	return nil
+}
+
+// Run reloads at every interval until the context is cancelled.
+func (r *ModelReloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Reload(ctx); err != nil {
+				r.log.Error("failed to reload models", slog.Any("error", err))
+			}
+		}
+	}
+}
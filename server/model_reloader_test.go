@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/trevex/zanzigo"
+	"github.com/trevex/zanzigo/storage/sqlite3"
+
+	"github.com/stretchr/testify/require"
+)
+
+// preparingStorage counts the rulesets prepared for all stores.
+type preparingStorage struct {
+	zanzigo.Storage
+	prepared *int
+}
+
+func (s preparingStorage) PrepareRuleset(object, relation string, ruleset []zanzigo.InferredRule) (zanzigo.Userdata, error) {
+	*s.prepared++
+	return s.Storage.PrepareRuleset(object, relation, ruleset)
+}
+
+func (s preparingStorage) ForStore(id string) zanzigo.Storage {
+	return preparingStorage{s.Storage.ForStore(id), s.prepared}
+}
+
+func TestModelReloader(t *testing.T) {
+	ctx := context.Background()
+	dbFile := filepath.Join(t.TempDir(), "test.db")
+	require.NoError(t, sqlite3.RunMigrations(dbFile))
+	sqlite, err := sqlite3.NewSQLite3Storage(dbFile)
+	require.NoError(t, err)
+	defer sqlite.Close()
+	prepared := 0
+	storage := preparingStorage{sqlite, &prepared}
+	require.NoError(t, storage.Write(ctx, zanzigo.TupleString("doc:mydoc#owner@user:myuser")))
+
+	modelFile := filepath.Join(t.TempDir(), "model.json")
+	writeModel := func(data string) {
+		require.NoError(t, os.WriteFile(modelFile, []byte(data), 0o600))
+	}
+	writeModel(`{"user": {}, "doc": {"owner": {}}}`)
+	definition, data, err := loadModel(modelFile)
+	require.NoError(t, err)
+	stores, err := NewStoreRegistry(storage, definition, 16)
+	require.NoError(t, err)
+	reloader := NewModelReloader(slog.New(slog.NewTextHandler(io.Discard, nil)), modelFile, data, stores)
+
+	check := func(store *registeredStore, tuple string) (bool, error) {
+		return store.resolver.Check(ctx, zanzigo.TupleString(tuple))
+	}
+	previous, err := stores.get(zanzigo.DefaultStore)
+	require.NoError(t, err)
+	_, err = check(previous, "doc:mydoc#viewer@user:myuser")
+	require.Error(t, err)
+
+	// The new model is used by subsequent requests, while requests in flight keep using the previous one
+	writeModel(`{"user": {}, "doc": {"owner": {}, "viewer": {"inheritIf": "owner"}}}`)
+	require.NoError(t, reloader.Reload(ctx))
+	current, err := stores.get(zanzigo.DefaultStore)
+	require.NoError(t, err)
+	allowed, err := check(current, "doc:mydoc#viewer@user:myuser")
+	require.NoError(t, err)
+	require.True(t, allowed)
+	allowed, err = check(previous, "doc:mydoc#owner@user:myuser")
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	// Invalid models are reported and the working model is kept
+	writeModel(`{"user": {}, "doc": {"viewer": {"inheritIf": "unknown"}}}`)
+	require.Error(t, reloader.Reload(ctx))
+	unchanged, err := stores.get(zanzigo.DefaultStore)
+	require.NoError(t, err)
+	require.Same(t, current, unchanged)
+	require.NoError(t, reloader.Reload(ctx))
+
+	// Removing a relation, which is still used by tuples, is blocked before the storage is prepared for the model
+	writeModel(`{"user": {}, "doc": {"viewer": {}}}`)
+	before := prepared
+	require.ErrorIs(t, reloader.Reload(ctx), zanzigo.ErrIncompatibleModel)
+	require.Equal(t, before, prepared)
+	unchanged, err = stores.get(zanzigo.DefaultStore)
+	require.NoError(t, err)
+	require.Same(t, current, unchanged)
+
+	// Stores created and deleted by other server instances are synchronized
+	_, err = stores.get("other")
+	require.ErrorIs(t, err, ErrStoreNotFound)
+	definition, err = zanzigo.ParseModelDefinition([]byte(`{"user": {}, "team": {"member": {}}}`))
+	require.NoError(t, err)
+	require.NoError(t, storage.CreateStore(ctx, zanzigo.Store{ID: "other", Model: definition, CreatedAt: time.Now()}))
+	require.NoError(t, reloader.Reload(ctx))
+	other, err := stores.get("other")
+	require.NoError(t, err)
+	// Unchanged models are not prepared again
+	require.NoError(t, reloader.Reload(ctx))
+	unchanged, err = stores.get("other")
+	require.NoError(t, err)
+	require.Same(t, other, unchanged)
+
+	require.NoError(t, storage.DeleteStore(ctx, "other"))
+	require.NoError(t, reloader.Reload(ctx))
+	_, err = stores.get("other")
+	require.ErrorIs(t, err, ErrStoreNotFound)
+}
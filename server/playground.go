@@ -0,0 +1,318 @@
+package server
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/trevex/zanzigo"
+	"github.com/trevex/zanzigo/storage/pebble"
+	"github.com/trevex/zanzigo/tupleio"
+)
+
+//go:embed playground
+var playgroundAssets embed.FS
+
+const (
+	// Limits of a single run of the playground, as it is not authenticated.
+	playgroundMaxRequestSize = 1 << 20
+	playgroundMaxTuples      = 10000
+	playgroundMaxQueries     = 100
+	playgroundTimeout        = 10 * time.Second
+)
+
+type playgroundHandler struct {
+	log            *slog.Logger
+	stores         *StoreRegistry
+	authenticators []Authenticator
+	assets         http.Handler
+}
+
+// NewPlaygroundHandler returns a handler serving the web UI of the playground and its API, which expects to be mounted
+// with its prefix stripped. Every run creates a sandboxed in-memory storage with the tuples of the request,
+// so the playground never reads or writes the tuples of the stores. The model of the default store is the initial model of the UI.
+// If authenticators are specified, the model is only served to identities with [PermissionAdmin], as the models of stores are listed by StoreService.
+func NewPlaygroundHandler(log *slog.Logger, stores *StoreRegistry, authenticators ...Authenticator) http.Handler {
+	assets, err := fs.Sub(playgroundAssets, "playground")
+	if err != nil {
+		panic(err) // the directory is embedded, so this is unreachable
+	}
+	h := &playgroundHandler{log, stores, authenticators, http.FileServer(http.FS(assets))}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/model", h.model)
+	mux.HandleFunc("/api/run", h.run)
+	mux.Handle("/", h.assets)
+	return mux
+}
+
+func (h *playgroundHandler) model(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if len(h.authenticators) > 0 {
+		identity, err := authenticate(r.Context(), h.authenticators, r.Header)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if !identity.HasPermission(PermissionAdmin) {
+			http.Error(w, fmt.Sprintf("'%s' lacks permission '%s'", identity.Name, PermissionAdmin), http.StatusForbidden)
+			return
+		}
+	}
+	store, err := h.stores.get(zanzigo.DefaultStore)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writePlaygroundJSON(w, http.StatusOK, store.definition)
+}
+
+type playgroundRequest struct {
+	Model zanzigo.ModelDefinition `json:"model"`
+	// One tuple per line, either in the notation of zanzigo.TupleString or as JSON-encoded zanzigo.Tuple, e.g. for conditions.
+	Tuples string `json:"tuples"`
+	Checks []struct {
+		Tuple   string         `json:"tuple"`
+		Context map[string]any `json:"context"`
+	} `json:"checks"`
+	// Usersets in the form 'type:id#relation'.
+	Expands []string `json:"expands"`
+}
+
+type playgroundTraceStep struct {
+	Depth   int      `json:"depth"`
+	Checks  []string `json:"checks"`
+	Matches []string `json:"matches"`
+}
+
+type playgroundCheck struct {
+	Tuple  string                `json:"tuple"`
+	Result string                `json:"result,omitempty"`
+	Error  string                `json:"error,omitempty"`
+	Trace  []playgroundTraceStep `json:"trace,omitempty"`
+}
+
+type playgroundExpandNode struct {
+	Userset  string                  `json:"userset"`
+	Tuples   []string                `json:"tuples"`
+	Children []*playgroundExpandNode `json:"children,omitempty"`
+}
+
+type playgroundExpand struct {
+	Userset string                `json:"userset"`
+	Error   string                `json:"error,omitempty"`
+	Tree    *playgroundExpandNode `json:"tree,omitempty"`
+}
+
+type playgroundInferredRule struct {
+	Kind                  string   `json:"kind"`
+	Relations             []string `json:"relations"`
+	Subject               string   `json:"subject,omitempty"`
+	WithRelationToSubject []string `json:"with_relation_to_subject,omitempty"`
+}
+
+type playgroundResponse struct {
+	InferredRules map[string]map[string][]playgroundInferredRule `json:"inferred_rules"`
+	Tuples        int                                            `json:"tuples"`
+	Checks        []playgroundCheck                              `json:"checks"`
+	Expands       []playgroundExpand                             `json:"expands"`
+}
+
+// run creates the model and a sandboxed storage with the tuples of the request and runs its checks and expands.
+// Invalid models and tuples are rejected, while errors of individual checks and expands are part of the response.
+func (h *playgroundHandler) run(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	req := playgroundRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, playgroundMaxRequestSize)).Decode(&req); err != nil {
+		writePlaygroundError(w, http.StatusBadRequest, fmt.Errorf("malformed request: %w", err))
+		return
+	}
+	if len(req.Checks)+len(req.Expands) > playgroundMaxQueries {
+		writePlaygroundError(w, http.StatusBadRequest, fmt.Errorf("at most %d checks and expands are allowed", playgroundMaxQueries))
+		return
+	}
+	model, err := zanzigo.NewModelFromDefinition(req.Model)
+	if err != nil {
+		writePlaygroundError(w, http.StatusBadRequest, fmt.Errorf("invalid model: %w", err))
+		return
+	}
+	tuples, err := parsePlaygroundTuples(req.Tuples, model)
+	if err != nil {
+		writePlaygroundError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), playgroundTimeout)
+	defer cancel()
+	storage, err := pebble.NewPebbleStorage("playground", pebble.WithInMemory(), pebble.WithoutSync())
+	if err != nil {
+		h.log.Error("failed to create playground storage", slog.Any("error", err))
+		writePlaygroundError(w, http.StatusInternalServerError, errors.New("failed to create storage"))
+		return
+	}
+	defer storage.Close()
+	if err := zanzigo.WriteBatch(ctx, storage, tuples); err != nil {
+		h.log.Error("failed to write playground tuples", slog.Any("error", err))
+		writePlaygroundError(w, http.StatusInternalServerError, errors.New("failed to write tuples"))
+		return
+	}
+	resolver, err := zanzigo.NewResolver(model, storage, h.stores.maxDepth)
+	if err != nil {
+		writePlaygroundError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := playgroundResponse{
+		InferredRules: toPlaygroundInferredRules(model.InferredRules),
+		Tuples:        len(tuples),
+		Checks:        []playgroundCheck{},
+		Expands:       []playgroundExpand{},
+	}
+	for _, c := range req.Checks {
+		check := playgroundCheck{Tuple: c.Tuple}
+		tuple, err := zanzigo.ParseTuple(c.Tuple)
+		if err == nil {
+			trace := []zanzigo.CheckTraceStep{}
+			var result zanzigo.CheckResult
+			result, err = resolver.CheckWithResult(ctx, tuple, zanzigo.WithRequestContext(c.Context), zanzigo.WithCheckTrace(&trace))
+			check.Result = result.String()
+			check.Trace = toPlaygroundTrace(trace)
+		}
+		if err != nil {
+			check.Result, check.Error = "", err.Error()
+		}
+		resp.Checks = append(resp.Checks, check)
+	}
+	for _, userset := range req.Expands {
+		expand := playgroundExpand{Userset: userset}
+		tuple, err := parseUserset(userset)
+		var tree *zanzigo.ExpandNode
+		if err == nil {
+			tree, err = resolver.Expand(ctx, tuple)
+		}
+		if err != nil {
+			expand.Error = err.Error()
+		} else {
+			expand.Tree = toPlaygroundExpandNode(tree)
+		}
+		resp.Expands = append(resp.Expands, expand)
+	}
+	writePlaygroundJSON(w, http.StatusOK, resp)
+}
+
+func parsePlaygroundTuples(text string, model *zanzigo.Model) ([]zanzigo.Tuple, error) {
+	tuples := []zanzigo.Tuple{}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var tuple zanzigo.Tuple
+		var err error
+		if strings.HasPrefix(line, "{") {
+			err = json.Unmarshal([]byte(line), &tuple)
+		} else {
+			tuple, err = zanzigo.ParseTuple(line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %w", tupleio.ErrMalformedInput, i+1, err)
+		}
+		if !model.IsValid(tuple) {
+			return nil, fmt.Errorf("line %d: invalid tuple: %s", i+1, tuple.ToString())
+		}
+		tuples = append(tuples, tuple)
+		if len(tuples) > playgroundMaxTuples {
+			return nil, fmt.Errorf("at most %d tuples are allowed", playgroundMaxTuples)
+		}
+	}
+	return tuples, nil
+}
+
+// parseUserset parses a userset in the form 'type:id#relation' into the object-fields of a tuple.
+func parseUserset(s string) (zanzigo.Tuple, error) {
+	// Reuse the parser of tuples by appending a placeholder subject
+	t, err := zanzigo.ParseTuple(strings.TrimSpace(s) + "@placeholder:placeholder")
+	if err != nil {
+		return t, fmt.Errorf("malformed userset '%s', expected 'type:id#relation'", s)
+	}
+	return zanzigo.Tuple{ObjectType: t.ObjectType, ObjectID: t.ObjectID, ObjectRelation: t.ObjectRelation}, nil
+}
+
+func playgroundTupleString(t zanzigo.Tuple) string {
+	s := t.ToString()
+	if t.Condition != nil {
+		s += " (condition " + t.Condition.Name + ")"
+	}
+	return s
+}
+
+func toPlaygroundTrace(trace []zanzigo.CheckTraceStep) []playgroundTraceStep {
+	steps := make([]playgroundTraceStep, 0, len(trace))
+	for _, step := range trace {
+		s := playgroundTraceStep{Depth: step.Depth, Checks: []string{}, Matches: []string{}}
+		for _, t := range step.Checks {
+			s.Checks = append(s.Checks, t.ToString())
+		}
+		for _, t := range step.Matches {
+			s.Matches = append(s.Matches, playgroundTupleString(t))
+		}
+		steps = append(steps, s)
+	}
+	return steps
+}
+
+func toPlaygroundExpandNode(node *zanzigo.ExpandNode) *playgroundExpandNode {
+	n := &playgroundExpandNode{
+		Userset: fmt.Sprintf("%s:%s#%s", node.Userset.ObjectType, node.Userset.ObjectID, node.Userset.ObjectRelation),
+		Tuples:  []string{},
+	}
+	for _, t := range node.Tuples {
+		n.Tuples = append(n.Tuples, playgroundTupleString(t))
+	}
+	for _, child := range node.Children {
+		n.Children = append(n.Children, toPlaygroundExpandNode(child))
+	}
+	return n
+}
+
+func toPlaygroundInferredRules(rules zanzigo.InferredRuleMap) map[string]map[string][]playgroundInferredRule {
+	kinds := map[zanzigo.Kind]string{
+		zanzigo.KindDirect:        "direct",
+		zanzigo.KindDirectUserset: "direct userset",
+		zanzigo.KindIndirect:      "indirect",
+	}
+	result := map[string]map[string][]playgroundInferredRule{}
+	for object, relations := range rules {
+		result[object] = map[string][]playgroundInferredRule{}
+		for relation, ruleset := range relations {
+			converted := []playgroundInferredRule{}
+			for _, rule := range ruleset {
+				converted = append(converted, playgroundInferredRule{kinds[rule.Kind], rule.Relations, rule.Subject, rule.WithRelationToSubject})
+			}
+			result[object][relation] = converted
+		}
+	}
+	return result
+}
+
+func writePlaygroundError(w http.ResponseWriter, code int, err error) {
+	writePlaygroundJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func writePlaygroundJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
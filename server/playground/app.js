@@ -0,0 +1,119 @@
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+
+function element(tag, className, text) {
+  const e = document.createElement(tag);
+  if (className) e.className = className;
+  if (text !== undefined) e.textContent = text;
+  return e;
+}
+
+function lines(text) {
+  return text.split("\n").map((l) => l.trim()).filter((l) => l !== "" && !l.startsWith("#"));
+}
+
+// A check is a tuple optionally followed by its context as JSON.
+function parseCheck(line) {
+  const i = line.indexOf("{");
+  if (i < 0) return { tuple: line };
+  return { tuple: line.slice(0, i).trim(), context: JSON.parse(line.slice(i)) };
+}
+
+function renderTree(node) {
+  const item = element("li", "", node.userset);
+  const children = element("ul", "tree");
+  for (const t of node.tuples) children.appendChild(element("li", "", t));
+  for (const child of node.children || []) children.appendChild(renderTree(child));
+  item.appendChild(children);
+  return item;
+}
+
+function renderResults(resp) {
+  const results = $("results");
+  results.replaceChildren(element("p", "hint", `${resp.tuples} tuples written.`));
+  for (const check of resp.checks) {
+    const div = element("div", "result");
+    const title = element("div");
+    title.appendChild(element("code", "", check.tuple + ": "));
+    if (check.error) title.appendChild(element("span", "error", check.error));
+    else title.appendChild(element("strong", check.result, check.result));
+    div.appendChild(title);
+    if (check.trace && check.trace.length > 0) {
+      const trace = check.trace.map((s) => {
+        const matches = s.matches.length > 0 ? ` => ${s.matches.join(", ")}` : "";
+        return `${"  ".repeat(s.depth)}${s.checks.join(", ")}${matches}`;
+      });
+      div.appendChild(element("pre", "", trace.join("\n")));
+    }
+    results.appendChild(div);
+  }
+  for (const expand of resp.expands) {
+    const div = element("div", "result");
+    div.appendChild(element("code", "", "expand " + expand.userset));
+    if (expand.error) div.appendChild(element("div", "error", expand.error));
+    else {
+      const tree = element("ul", "tree");
+      tree.appendChild(renderTree(expand.tree));
+      div.appendChild(tree);
+    }
+    results.appendChild(div);
+  }
+
+  const rules = $("rules");
+  rules.replaceChildren();
+  for (const object of Object.keys(resp.inferred_rules).sort()) {
+    for (const relation of Object.keys(resp.inferred_rules[object]).sort()) {
+      const text = resp.inferred_rules[object][relation].map((r) => {
+        if (r.kind === "indirect") {
+          return `${r.with_relation_to_subject.join(" | ")} of ${r.subject} via ${r.relations.join(" | ")}`;
+        }
+        return `${r.kind}: ${r.relations.join(" | ")}`;
+      });
+      const div = element("div", "result");
+      div.appendChild(element("code", "", `${object}#${relation}`));
+      div.appendChild(element("pre", "", text.join("\n")));
+      rules.appendChild(div);
+    }
+  }
+}
+
+function showError(message) {
+  $("error").textContent = message;
+  $("error").hidden = false;
+}
+
+async function run() {
+  $("error").hidden = true;
+  let request;
+  try {
+    request = {
+      model: JSON.parse($("model").value),
+      tuples: $("tuples").value,
+      checks: lines($("checks").value).map(parseCheck),
+      expands: lines($("expands").value),
+    };
+  } catch (err) {
+    showError(`Invalid input: ${err.message}`);
+    return;
+  }
+  const resp = await fetch("api/run", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(request),
+  });
+  const body = await resp.json();
+  if (!resp.ok) {
+    showError(body.error);
+    return;
+  }
+  renderResults(body);
+}
+
+async function init() {
+  const resp = await fetch("api/model");
+  if (resp.ok) $("model").value = JSON.stringify(await resp.json(), null, 2);
+  $("run").addEventListener("click", () => run().catch((err) => showError(err.message)));
+}
+
+init().catch((err) => showError(err.message));
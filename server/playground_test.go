@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/trevex/zanzigo"
+	"github.com/trevex/zanzigo/storage/sqlite3"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlayground(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.db")
+	require.NoError(t, sqlite3.RunMigrations(file))
+	storage, err := sqlite3.NewSQLite3Storage(file)
+	require.NoError(t, err)
+	defer storage.Close()
+	definition := zanzigo.ModelDefinition{Objects: zanzigo.ObjectMap{
+		"user":  zanzigo.RelationMap{},
+		"group": zanzigo.RelationMap{"member": zanzigo.Rule{}},
+		"doc": zanzigo.RelationMap{
+			"editor": zanzigo.Rule{},
+			"viewer": zanzigo.Rule{InheritIf: "editor"},
+		},
+	}}
+	stores, err := NewStoreRegistry(storage, definition, 16)
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	mux.Handle("/playground/", http.StripPrefix("/playground", NewPlaygroundHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), stores)))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/playground/")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, string(body), "app.js")
+
+	resp, err = http.Get(server.URL + "/playground/api/model")
+	require.NoError(t, err)
+	model := zanzigo.ModelDefinition{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&model))
+	resp.Body.Close()
+	require.Equal(t, definition.Objects, model.Objects)
+
+	run := func(request map[string]any) (int, map[string]any) {
+		t.Helper()
+		request["model"] = definition
+		data, err := json.Marshal(request)
+		require.NoError(t, err)
+		resp, err := http.Post(server.URL+"/playground/api/run", "application/json", strings.NewReader(string(data)))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		result := map[string]any{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return resp.StatusCode, result
+	}
+
+	code, result := run(map[string]any{
+		"tuples":  "doc:readme#editor@group:eng#member\n\ngroup:eng#member@user:alice",
+		"checks":  []map[string]any{{"tuple": "doc:readme#viewer@user:alice"}, {"tuple": "doc:readme#viewer@user:bob"}, {"tuple": "doc:readme#owner@user:bob"}},
+		"expands": []string{"doc:readme#viewer", "doc:readme"},
+	})
+	require.Equal(t, http.StatusOK, code)
+	require.EqualValues(t, 2, result["tuples"])
+	checks := result["checks"].([]any)
+	require.Equal(t, "allowed", checks[0].(map[string]any)["result"])
+	require.NotEmpty(t, checks[0].(map[string]any)["trace"])
+	require.Equal(t, "denied", checks[1].(map[string]any)["result"])
+	require.Contains(t, checks[2].(map[string]any)["error"], "invalid tuple")
+	expands := result["expands"].([]any)
+	tree := expands[0].(map[string]any)["tree"].(map[string]any)
+	require.Equal(t, []any{"doc:readme#editor@group:eng#member"}, tree["tuples"])
+	require.Equal(t, "group:eng#member", tree["children"].([]any)[0].(map[string]any)["userset"])
+	require.Contains(t, expands[1].(map[string]any)["error"], "malformed userset")
+	require.Contains(t, result["inferred_rules"], "doc")
+
+	code, result = run(map[string]any{"tuples": "doc:readme#owner@user:alice"})
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Contains(t, result["error"], "line 1: invalid tuple")
+
+	// The tuples of the playground are never written to the storage
+	tuples, _, err := storage.List(context.Background(), zanzigo.Tuple{ObjectType: "doc"}, zanzigo.Pagination{Limit: 10, Cursor: storage.CursorStart()})
+	require.NoError(t, err)
+	require.Empty(t, tuples)
+
+	// If authentication is configured, the model of the default store is only served to admins
+	psk, err := NewPresharedKeyAuthenticator(writeFile(t, "psk.json", []map[string]any{
+		{"name": "reader", "key": "readkey", "permissions": []string{"read"}},
+		{"name": "admin", "key": "adminkey", "permissions": []string{"admin"}},
+	}))
+	require.NoError(t, err)
+	handler := NewPlaygroundHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), stores, psk)
+	getModel := func(header http.Header) int {
+		r := httptest.NewRequest(http.MethodGet, "/api/model", nil)
+		r.Header = header
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	require.Equal(t, http.StatusUnauthorized, getModel(http.Header{}))
+	require.Equal(t, http.StatusForbidden, getModel(bearer("readkey")))
+	require.Equal(t, http.StatusOK, getModel(bearer("adminkey")))
+}
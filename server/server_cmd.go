@@ -2,21 +2,27 @@ package server
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"regexp"
 	"time"
 
+	"connectrpc.com/connect"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/trevex/zanzigo"
 	"github.com/trevex/zanzigo/api/zanzigo/v1/zanzigov1connect"
-	"github.com/trevex/zanzigo/storage/postgres"
-	"github.com/trevex/zanzigo/storage/sqlite3"
+	"github.com/trevex/zanzigo/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 )
@@ -26,118 +32,452 @@ func NewServerCmd(log *slog.Logger) *cobra.Command {
 		Use: "server [flags] [model-file]",
 		// TODO: properly document
 	}
+	f := newServerFlags(cmd.Flags())
 
-	var (
-		port          int
-		sqliteFile    string
-		postgresURL   string
-		useFunctions  bool
-		runMigrations bool
-		maxDepth      int
-	)
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
 
-	flags := cmd.Flags()
-	flags.IntVar(&port, "port", 4000, "port the server is listening on")
-	flags.StringVar(&sqliteFile, "sqlite-file", "./zanzigo.db", "sqlite database file (will be ignored if --postgres-url is set)")
-	flags.StringVar(&postgresURL, "postgres-url", "", "postgres database to connect to")
-	flags.BoolVar(&useFunctions, "use-functions", false, "postgres-specific flag enable the use of function to run checks via functions")
-	flags.BoolVar(&runMigrations, "run-migrations", true, "run database migrations on the configured database")
-	flags.IntVar(&maxDepth, "max-depth", 16, "maximum depth to traverse relationships")
+		if err := applyConfig(cmd.Flags()); err != nil {
+			return err
+		}
+		modelFile, err := f.ModelFile(args)
+		if err != nil {
+			return err
+		}
 
-	cmd.RunE = func(cmd *cobra.Command, args []string) error {
-		ctx := cmd.Context()
+		definition, modelData, err := loadModel(modelFile)
+		if err != nil {
+			return err
+		}
 
-		if len(args) != 1 {
-			return fmt.Errorf("model-file required as first argument")
+		rules, err := f.identifierRules.Rules()
+		if err != nil {
+			return err
 		}
 
-		model, err := loadModel(args[0])
+		authenticators, err := f.auth.Authenticators(ctx)
+		if err != nil {
+			return err
+		}
+		tracerProvider, err := f.tracing.TracerProvider(ctx)
 		if err != nil {
 			return err
 		}
+		if tracerProvider != nil {
+			defer func() {
+				ctxShutdown, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancelShutdown()
+				if err := tracerProvider.Shutdown(ctxShutdown); err != nil {
+					log.Error("failed to flush traces", slog.Any("error", err))
+				}
+			}()
+			otel.SetTracerProvider(tracerProvider)
+		}
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
 
-		if runMigrations {
-			if postgresURL != "" {
-				err = postgres.RunMigrations(postgresURL)
-			} else {
-				err = sqlite3.RunMigrations(sqliteFile)
-			}
+		registry := prometheus.NewRegistry()
+		interceptors := []connect.Interceptor{}
+		if tracerProvider != nil {
+			interceptors = append(interceptors, NewTracingInterceptor())
+		}
+		if f.enableMetrics {
+			registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+			// Added first, so requests rejected by the authentication are counted as well
+			interceptor, err := NewMetricsInterceptor(registry)
 			if err != nil {
 				return err
 			}
+			interceptors = append(interceptors, interceptor)
+		}
+		if len(authenticators) > 0 {
+			interceptors = append(interceptors, NewAuthInterceptor(authenticators...))
+		} else {
+			log.Warn("authentication is disabled, every client is allowed to read and write tuples")
+		}
+		handlerOptions := []connect.HandlerOption{connect.WithInterceptors(interceptors...)}
+
+		reloader, err := f.tls.Reloader()
+		if err != nil {
+			return err
+		}
+		if reloader == nil && !f.plaintext {
+			return fmt.Errorf("--plaintext=false requires --tls-cert and --tls-key")
+		}
+
+		backend, err := f.backends.Backend()
+		if err != nil {
+			return err
 		}
 
-		var storage zanzigo.Storage
-		if postgresURL != "" {
-			options := []postgres.PostgresOption{}
-			if useFunctions {
-				options = append(options, postgres.UseFunctions())
+		if f.runMigrations {
+			if err := backend.RunMigrations(); err != nil {
+				return err
 			}
-			storage, err = postgres.NewPostgresStorage(postgresURL, options...)
-		} else {
-			storage, err = sqlite3.NewSQLite3Storage(sqliteFile)
 		}
+
+		storage, err := backend.NewStorage()
 		if err != nil {
 			return err
 		}
+		defer storage.Close()
+		health := NewHealth(storage, zanzigov1connect.ZanzigoServiceName, zanzigov1connect.StoreServiceName)
 
-		resolver, err := zanzigo.NewResolver(model, storage, maxDepth)
+		resolverOptions := []zanzigo.ResolverOption{}
+		if f.enableMetrics {
+			if provider, ok := storage.(zanzigo.PoolStatsProvider); ok {
+				registry.MustRegister(metrics.NewPoolCollector(provider))
+			}
+			m, err := metrics.New(registry)
+			if err != nil {
+				return err
+			}
+			storage = m.WrapStorage(storage)
+			resolverOptions = append(resolverOptions, zanzigo.WithCheckObserver(m.ObserveCheck))
+		}
+
+		// The model file defines the default store, all other stores are loaded from the storage
+		stores, err := NewStoreRegistry(storage, definition, f.maxDepth, resolverOptions...)
 		if err != nil {
 			return err
 		}
+		if err := stores.Load(ctx); err != nil {
+			return err
+		}
+
+		if f.modelReloadInterval > 0 {
+			reloader := NewModelReloader(log.WithGroup("reloader"), modelFile, modelData, stores)
+			go reloader.Run(ctx, f.modelReloadInterval)
+		}
+
+		if f.gcInterval > 0 {
+			gc := zanzigo.NewGarbageCollector(storage, f.gcInterval)
+			gc.OnCollect = func(removed int, err error) {
+				if err != nil {
+					log.Error("error removing expired tuples", slog.Any("error", err))
+				} else if removed > 0 {
+					log.Info("removed expired tuples", slog.Int("removed", removed))
+				}
+			}
+			go gc.Run(ctx)
+		}
 
 		mux := http.NewServeMux()
-		mux.Handle(zanzigov1connect.NewZanzigoServiceHandler(NewZanzigoServiceHandler(log.WithGroup("handler"), model, storage, resolver)))
-		server := http.Server{
-			Addr:    fmt.Sprintf(":%d", port),
-			Handler: h2c.NewHandler(mux, &http2.Server{}),
-			BaseContext: func(l net.Listener) context.Context {
-				return ctx
-			},
-		}
-
-		// Start HTTP server at :4000.
-		log.Info(fmt.Sprintf("started server on 0.0.0.0:%d, http://localhost:%d", port, port))
-		go func() {
-			err := server.ListenAndServe()
-			if errors.Is(err, http.ErrServerClosed) {
-				log.Info("server gracefully closed")
-			} else if err != nil {
-				log.Error("error listening on server", slog.Any("error", err))
+		mux.Handle(zanzigov1connect.NewZanzigoServiceHandler(NewZanzigoServiceHandler(log.WithGroup("handler"), stores, WithIdentifierRules(rules)), handlerOptions...))
+		mux.Handle(zanzigov1connect.NewStoreServiceHandler(NewStoreServiceHandler(log.WithGroup("stores"), stores), handlerOptions...))
+		health.Register(mux)
+		if f.enableMetrics {
+			mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		}
+		if f.playground {
+			mux.Handle("/playground/", http.StripPrefix("/playground", NewPlaygroundHandler(log.WithGroup("playground"), stores, authenticators...)))
+		}
+		handler := withTLSState(mux)
+		baseContext := func(l net.Listener) context.Context {
+			return ctx
+		}
+		servers := []*http.Server{}
+		listenErrs := make(chan error, 2)
+		serve := func(server *http.Server, listen func() error) {
+			servers = append(servers, server)
+			go func() {
+				err := listen()
+				if errors.Is(err, http.ErrServerClosed) {
+					log.Info("server gracefully closed", slog.String("addr", server.Addr))
+				} else if err != nil {
+					listenErrs <- fmt.Errorf("error listening on %s: %w", server.Addr, err)
+					cancel()
+				}
+			}()
+		}
+
+		// Plaintext and TLS can be served side by side, e.g. while clients are migrated to TLS
+		if f.plaintext {
+			server := &http.Server{
+				Addr:        fmt.Sprintf(":%d", f.port),
+				Handler:     h2c.NewHandler(handler, &http2.Server{}),
+				BaseContext: baseContext,
+			}
+			log.Info(fmt.Sprintf("started server on 0.0.0.0:%d, http://localhost:%d", f.port, f.port))
+			serve(server, server.ListenAndServe)
+		}
+		if reloader != nil {
+			go reloader.Run(ctx, f.tls.reloadInterval, func(err error) {
+				log.Error("failed to reload certificates", slog.Any("error", err))
+			})
+			server := &http.Server{
+				Addr:        fmt.Sprintf(":%d", f.tls.port),
+				Handler:     handler,
+				TLSConfig:   reloader.TLSConfig(),
+				BaseContext: baseContext,
 			}
-		}()
+			log.Info(fmt.Sprintf("started TLS server on 0.0.0.0:%d, https://localhost:%d", f.tls.port, f.tls.port))
+			serve(server, func() error { return server.ListenAndServeTLS("", "") })
+		}
+
+		// Migrations ran and the resolvers of all stores are prepared at this point
+		health.SetReady(true)
 
 		<-ctx.Done()
-		ctxShutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer func() {
-			cancel()
-		}()
+		health.SetReady(false)
+		ctxShutdown, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelShutdown()
 
-		if err := server.Shutdown(ctxShutdown); err != nil {
-			log.Error("error on server shutdown", slog.Any("error", err))
+		for _, server := range servers {
+			if err := server.Shutdown(ctxShutdown); err != nil {
+				log.Error("error on server shutdown", slog.Any("error", err))
+				return err
+			}
+		}
+		select {
+		case err := <-listenErrs:
 			return err
+		default:
+			return nil
 		}
-		return nil
 	}
 
 	return cmd
 }
 
-func loadModel(filename string) (*zanzigo.Model, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
+// serverFlags are the flags of the server, which are shared with the command validating its configuration.
+type serverFlags struct {
+	port                int
+	runMigrations       bool
+	maxDepth            int
+	gcInterval          time.Duration
+	plaintext           bool
+	enableMetrics       bool
+	playground          bool
+	modelFile           string
+	modelReloadInterval time.Duration
+
+	identifierRules *identifierRulesFlags
+	auth            *authFlags
+	tls             *tlsFlags
+	tracing         *tracingFlags
+	backends        *storageBackendSet
+}
+
+func newServerFlags(flags *pflag.FlagSet) *serverFlags {
+	f := &serverFlags{}
+	newConfigFlag(flags)
+	flags.StringVar(&f.modelFile, "model-file", "", "model file, alternatively passed as first argument")
+	flags.IntVar(&f.port, "port", 4000, "port the plaintext server is listening on")
+	flags.BoolVar(&f.plaintext, "plaintext", true, "serve plaintext on --port, can be disabled once all clients use TLS")
+	flags.BoolVar(&f.runMigrations, "run-migrations", true, "run database migrations on the configured database")
+	flags.IntVar(&f.maxDepth, "max-depth", 16, "maximum depth to traverse relationships")
+	flags.DurationVar(&f.modelReloadInterval, "model-reload-interval", 30*time.Second, "interval to check the model file and the models of stores for changes, 0 disables reloading")
+	flags.BoolVar(&f.enableMetrics, "metrics", true, "serve Prometheus metrics on /metrics")
+	flags.BoolVar(&f.playground, "playground", false, "serve the interactive model playground on /playground/, it never accesses stored tuples and only the initial model of the default store requires authentication, if configured")
+	flags.DurationVar(&f.gcInterval, "gc-interval", time.Minute, "interval to remove expired tuples from the storage, 0 disables garbage collection")
+	f.identifierRules = newIdentifierRulesFlags(flags)
+	f.auth = newAuthFlags(flags)
+	f.tls = newTLSFlags(flags)
+	f.tracing = newTracingFlags(flags)
+	f.backends = newStorageBackendSet(flags)
+	return f
+}
+
+// ModelFile returns the model file passed as argument or using --model-file.
+func (f *serverFlags) ModelFile(args []string) (string, error) {
+	switch {
+	case len(args) > 1:
+		return "", fmt.Errorf("only the model-file is accepted as argument")
+	case len(args) == 1:
+		return args[0], nil
+	case f.modelFile != "":
+		return f.modelFile, nil
 	}
-	data, err := io.ReadAll(file)
-	if err != nil {
-		return nil, err
+	return "", fmt.Errorf("model-file required as first argument or using --model-file")
+}
+
+// Validate checks the configuration without connecting to the storage or listening, all problems found are returned joined.
+func (f *serverFlags) Validate(ctx context.Context, args []string) error {
+	errs := []error{}
+	if modelFile, err := f.ModelFile(args); err != nil {
+		errs = append(errs, err)
+	} else if _, _, err := loadModel(modelFile); err != nil {
+		errs = append(errs, fmt.Errorf("invalid model file '%s': %w", modelFile, err))
 	}
+	if f.maxDepth <= 0 {
+		errs = append(errs, fmt.Errorf("--max-depth has to be positive"))
+	}
+	if _, err := f.identifierRules.Rules(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := f.auth.Authenticators(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("invalid authentication: %w", err))
+	}
+	if tracerProvider, err := f.tracing.TracerProvider(ctx); err != nil {
+		errs = append(errs, err)
+	} else if tracerProvider != nil {
+		_ = tracerProvider.Shutdown(ctx)
+	}
+	if reloader, err := f.tls.Reloader(); err != nil {
+		errs = append(errs, fmt.Errorf("invalid TLS: %w", err))
+	} else if reloader == nil && !f.plaintext {
+		errs = append(errs, fmt.Errorf("--plaintext=false requires --tls-cert and --tls-key"))
+	}
+	if _, err := f.backends.Backend(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
 
-	objects := zanzigo.ObjectMap{}
-	err = json.Unmarshal(data, &objects)
+type identifierRulesFlags struct {
+	typePattern       string
+	idPattern         string
+	relationPattern   string
+	maxTypeLength     int
+	maxIDLength       int
+	maxRelationLength int
+}
+
+func newIdentifierRulesFlags(flags *pflag.FlagSet) *identifierRulesFlags {
+	f := &identifierRulesFlags{}
+	defaults := zanzigo.DefaultIdentifierRules
+	flags.StringVar(&f.typePattern, "identifier-type-pattern", defaults.TypePattern.String(), "regular expression object- and subject-types of written tuples have to match (empty to disable)")
+	flags.StringVar(&f.idPattern, "identifier-id-pattern", defaults.IDPattern.String(), "regular expression object- and subject-ids of written tuples have to match (empty to disable)")
+	flags.StringVar(&f.relationPattern, "identifier-relation-pattern", defaults.RelationPattern.String(), "regular expression relations of written tuples have to match (empty to disable)")
+	flags.IntVar(&f.maxTypeLength, "identifier-max-type-length", defaults.MaxTypeLength, "maximum length of object- and subject-types of written tuples (zero to disable)")
+	flags.IntVar(&f.maxIDLength, "identifier-max-id-length", defaults.MaxIDLength, "maximum length of object- and subject-ids of written tuples (zero to disable)")
+	flags.IntVar(&f.maxRelationLength, "identifier-max-relation-length", defaults.MaxRelationLength, "maximum length of relations of written tuples (zero to disable)")
+	return f
+}
+
+func (f *identifierRulesFlags) Rules() (zanzigo.IdentifierRules, error) {
+	rules := zanzigo.IdentifierRules{
+		MaxTypeLength:     f.maxTypeLength,
+		MaxIDLength:       f.maxIDLength,
+		MaxRelationLength: f.maxRelationLength,
+	}
+	var err error
+	if rules.TypePattern, err = compilePattern("identifier-type-pattern", f.typePattern); err != nil {
+		return rules, err
+	}
+	if rules.IDPattern, err = compilePattern("identifier-id-pattern", f.idPattern); err != nil {
+		return rules, err
+	}
+	if rules.RelationPattern, err = compilePattern("identifier-relation-pattern", f.relationPattern); err != nil {
+		return rules, err
+	}
+	return rules, nil
+}
+
+func compilePattern(flag, pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid --%s: %w", flag, err)
 	}
+	return re, nil
+}
+
+type authFlags struct {
+	pskFile            string
+	jwksFile           string
+	jwtIssuer          string
+	jwtAudience        string
+	jwtScopePrefix     string
+	clientIdentityFile string
+}
 
-	return zanzigo.NewModel(objects)
+func newAuthFlags(flags *pflag.FlagSet) *authFlags {
+	f := &authFlags{}
+	flags.StringVar(&f.pskFile, "auth-psk-file", "", "JSON file listing preshared keys accepted as bearer tokens and their permissions")
+	flags.StringVar(&f.jwksFile, "auth-jwks-file", "", "JSON Web Key Set file used to verify JWTs passed as bearer tokens")
+	flags.StringVar(&f.jwtIssuer, "auth-jwt-issuer", "", "required issuer of JWTs, keys are discovered using OpenID Connect unless --auth-jwks-file is set")
+	flags.StringVar(&f.jwtAudience, "auth-jwt-audience", "", "required audience of JWTs")
+	flags.StringVar(&f.jwtScopePrefix, "auth-jwt-scope-prefix", "zanzigo:", "prefix of JWT scopes granting permissions, e.g. 'zanzigo:read'")
+	flags.StringVar(&f.clientIdentityFile, "auth-client-identity-file", "", "JSON file listing identities of client certificates and their permissions")
+	return f
+}
+
+// Authenticators returns the configured authenticators, if none are configured, authentication is disabled.
+func (f *authFlags) Authenticators(ctx context.Context) ([]Authenticator, error) {
+	authenticators := []Authenticator{}
+	if f.pskFile != "" {
+		a, err := NewPresharedKeyAuthenticator(f.pskFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, a)
+	}
+	if f.jwksFile != "" || f.jwtIssuer != "" {
+		a, err := NewJWTAuthenticator(ctx, f.jwksFile, WithIssuer(f.jwtIssuer), WithAudience(f.jwtAudience), WithScopePrefix(f.jwtScopePrefix))
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, a)
+	}
+	if f.clientIdentityFile != "" {
+		a, err := NewClientCertificateAuthenticator(f.clientIdentityFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, a)
+	}
+	return authenticators, nil
+}
+
+type tlsFlags struct {
+	certFile       string
+	keyFile        string
+	clientCAFile   string
+	clientAuth     string
+	port           int
+	reloadInterval time.Duration
+}
+
+func newTLSFlags(flags *pflag.FlagSet) *tlsFlags {
+	f := &tlsFlags{}
+	flags.StringVar(&f.certFile, "tls-cert", "", "PEM-encoded certificate, enables the TLS server on --tls-port")
+	flags.StringVar(&f.keyFile, "tls-key", "", "PEM-encoded private key of the certificate")
+	flags.StringVar(&f.clientCAFile, "client-ca", "", "PEM-encoded CA certificates client certificates are verified against, enables mutual TLS")
+	flags.StringVar(&f.clientAuth, "client-auth", "require", "whether client certificates are required ('require') or only verified if presented ('verify-if-given')")
+	flags.IntVar(&f.port, "tls-port", 4443, "port the TLS server is listening on")
+	flags.DurationVar(&f.reloadInterval, "tls-reload-interval", 30*time.Second, "interval to check certificates for changes")
+	return f
+}
+
+// Reloader returns the certificate reloader, if TLS is configured.
+func (f *tlsFlags) Reloader() (*CertificateReloader, error) {
+	if f.certFile == "" && f.keyFile == "" {
+		if f.clientCAFile != "" {
+			return nil, fmt.Errorf("--client-ca requires --tls-cert and --tls-key")
+		}
+		return nil, nil
+	}
+	if f.certFile == "" || f.keyFile == "" {
+		return nil, fmt.Errorf("both --tls-cert and --tls-key are required")
+	}
+	if f.reloadInterval <= 0 {
+		return nil, fmt.Errorf("--tls-reload-interval has to be positive")
+	}
+	clientAuth := tls.RequireAndVerifyClientCert
+	switch f.clientAuth {
+	case "require":
+	case "verify-if-given":
+		clientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("invalid --client-auth '%s'", f.clientAuth)
+	}
+	return NewCertificateReloader(f.certFile, f.keyFile, f.clientCAFile, clientAuth)
+}
+
+// loadModel returns the validated model definition and the content of the model file, so the reloader can detect changes.
+func loadModel(filename string) (zanzigo.ModelDefinition, []byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return zanzigo.ModelDefinition{}, nil, err
+	}
+	definition, err := zanzigo.ParseModelDefinition(data)
+	if err != nil {
+		return definition, nil, err
+	}
+	_, err = zanzigo.NewModelFromDefinition(definition)
+	return definition, data, err
 }
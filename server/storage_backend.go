@@ -0,0 +1,259 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/trevex/zanzigo"
+	"github.com/trevex/zanzigo/storage/mysql"
+	"github.com/trevex/zanzigo/storage/pebble"
+	"github.com/trevex/zanzigo/storage/postgres"
+	"github.com/trevex/zanzigo/storage/sqlite3"
+)
+
+// A StorageBackend makes a [zanzigo.Storage]-implementation available to the server-command.
+// Backends are registered using [RegisterStorageBackend] and contribute their own flags.
+type StorageBackend interface {
+	// AddFlags registers the backend-specific flags.
+	AddFlags(flags *pflag.FlagSet)
+	// Configured returns true if the backend-specific flags were set, so the backend can be
+	// selected automatically when --storage is not specified.
+	Configured() bool
+	// RunMigrations prepares the underlying database, e.g. runs schema migrations.
+	RunMigrations() error
+	// NewStorage creates the storage-implementation using the configured flags.
+	NewStorage() (zanzigo.Storage, error)
+}
+
+type storageBackendEntry struct {
+	name   string
+	create func() StorageBackend
+}
+
+var registeredStorageBackends = []storageBackendEntry{}
+
+const defaultStorageBackend = "sqlite3"
+
+// RegisterStorageBackend registers an additional storage-backend under the specified name.
+// Every instance of the server-command calls create to obtain a fresh [StorageBackend],
+// so flags can be bound to the returned instance.
+// Registering a name twice panics.
+func RegisterStorageBackend(name string, create func() StorageBackend) {
+	for _, b := range registeredStorageBackends {
+		if b.name == name {
+			panic(fmt.Sprintf("storage backend '%s' already registered", name))
+		}
+	}
+	registeredStorageBackends = append(registeredStorageBackends, storageBackendEntry{name, create})
+}
+
+func init() {
+	RegisterStorageBackend("sqlite3", func() StorageBackend { return &sqlite3Backend{} })
+	RegisterStorageBackend("postgres", func() StorageBackend { return &postgresBackend{} })
+	RegisterStorageBackend("mysql", func() StorageBackend { return &mysqlBackend{} })
+	RegisterStorageBackend("pebble", func() StorageBackend { return &pebbleBackend{} })
+}
+
+// storageBackendSet holds an instance of every registered backend for a single command.
+type storageBackendSet struct {
+	names    []string
+	backends map[string]StorageBackend
+	selected string
+}
+
+// newStorageBackendSet instantiates all registered backends and adds their flags as well as --storage.
+func newStorageBackendSet(flags *pflag.FlagSet) *storageBackendSet {
+	set := &storageBackendSet{
+		names:    make([]string, 0, len(registeredStorageBackends)),
+		backends: map[string]StorageBackend{},
+	}
+	for _, entry := range registeredStorageBackends {
+		backend := entry.create()
+		backend.AddFlags(flags)
+		set.backends[entry.name] = backend
+		set.names = append(set.names, entry.name)
+	}
+	flags.StringVar(&set.selected, "storage", "", fmt.Sprintf("storage backend to use (one of: %s), if unset the backend is inferred from the specified flags", strings.Join(set.names, ", ")))
+	return set
+}
+
+// Backend returns the explicitly selected backend or the single backend that was configured via flags.
+// If no backend was configured, the default backend is used.
+func (set *storageBackendSet) Backend() (StorageBackend, error) {
+	if set.selected != "" {
+		backend, ok := set.backends[set.selected]
+		if !ok {
+			return nil, fmt.Errorf("unknown storage backend '%s', available: %s", set.selected, strings.Join(set.names, ", "))
+		}
+		return backend, nil
+	}
+	configured := []string{}
+	for _, name := range set.names {
+		if set.backends[name].Configured() {
+			configured = append(configured, name)
+		}
+	}
+	switch len(configured) {
+	case 0:
+		return set.backends[defaultStorageBackend], nil
+	case 1:
+		return set.backends[configured[0]], nil
+	default:
+		return nil, fmt.Errorf("multiple storage backends configured (%s), use --storage to select one", strings.Join(configured, ", "))
+	}
+}
+
+type sqlite3Backend struct {
+	file        string
+	poolSize    int
+	wal         bool
+	busyTimeout time.Duration
+	synchronous string
+}
+
+func (b *sqlite3Backend) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&b.file, "sqlite-file", "./zanzigo.db", "sqlite database file (used if no other storage backend is configured)")
+	flags.IntVar(&b.poolSize, "sqlite-pool-size", 0, "number of sqlite connections (max(4, number of CPUs) if zero)")
+	flags.BoolVar(&b.wal, "sqlite-wal", true, "switch the sqlite database to write-ahead logging")
+	flags.DurationVar(&b.busyTimeout, "sqlite-busy-timeout", 0, "how long to wait for locks held by other connections (waits until the request is done if zero)")
+	flags.StringVar(&b.synchronous, "sqlite-synchronous", "", "sqlite synchronous level, one of OFF, NORMAL, FULL or EXTRA (sqlite's default if unset)")
+}
+
+func (b *sqlite3Backend) Configured() bool {
+	return false // sqlite3 is the default, so other backends take precedence
+}
+
+func (b *sqlite3Backend) RunMigrations() error {
+	return sqlite3.RunMigrations(b.file)
+}
+
+func (b *sqlite3Backend) NewStorage() (zanzigo.Storage, error) {
+	options := []sqlite3.SQLite3Option{}
+	if b.poolSize > 0 {
+		options = append(options, sqlite3.WithPoolSize(b.poolSize))
+	}
+	if !b.wal {
+		options = append(options, sqlite3.WithoutWAL())
+	}
+	if b.busyTimeout > 0 {
+		options = append(options, sqlite3.WithBusyTimeout(b.busyTimeout))
+	}
+	if b.synchronous != "" {
+		options = append(options, sqlite3.WithSynchronous(b.synchronous))
+	}
+	return sqlite3.NewSQLite3Storage(b.file, options...)
+}
+
+type postgresBackend struct {
+	url               string
+	useFunctions      bool
+	functionRetention time.Duration
+	maxConns          int32
+	minConns          int32
+	statementTimeout  time.Duration
+	applicationName   string
+}
+
+func (b *postgresBackend) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&b.url, "postgres-url", "", "postgres database to connect to")
+	flags.BoolVar(&b.useFunctions, "use-functions", false, "postgres-specific flag enable the use of function to run checks via functions")
+	flags.DurationVar(&b.functionRetention, "postgres-function-retention", 24*time.Hour, "keep functions of other revisions of the model for the duration after they were last prepared, before they are dropped")
+	flags.Int32Var(&b.maxConns, "postgres-max-conns", 0, "maximum number of postgres connections (pool_max_conns of the URL or max(4, number of CPUs) if zero)")
+	flags.Int32Var(&b.minConns, "postgres-min-conns", 0, "number of postgres connections kept open while idle")
+	flags.DurationVar(&b.statementTimeout, "postgres-statement-timeout", 0, "abort postgres statements running longer than the timeout (disabled if zero)")
+	flags.StringVar(&b.applicationName, "postgres-application-name", "zanzigo", "application_name reported to postgres")
+}
+
+func (b *postgresBackend) Configured() bool {
+	return b.url != ""
+}
+
+func (b *postgresBackend) RunMigrations() error {
+	return postgres.RunMigrations(b.url)
+}
+
+func (b *postgresBackend) NewStorage() (zanzigo.Storage, error) {
+	options := []postgres.PostgresOption{}
+	if b.useFunctions {
+		options = append(options, postgres.UseFunctions(), postgres.WithFunctionRetention(b.functionRetention))
+	}
+	if b.maxConns > 0 {
+		options = append(options, postgres.WithMaxConns(b.maxConns))
+	}
+	if b.minConns > 0 {
+		options = append(options, postgres.WithMinConns(b.minConns))
+	}
+	if b.statementTimeout > 0 {
+		options = append(options, postgres.WithStatementTimeout(b.statementTimeout))
+	}
+	if b.applicationName != "" {
+		options = append(options, postgres.WithApplicationName(b.applicationName))
+	}
+	return postgres.NewPostgresStorage(b.url, options...)
+}
+
+type mysqlBackend struct {
+	dsn string
+}
+
+func (b *mysqlBackend) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&b.dsn, "mysql-dsn", "", "mysql or mariadb database to connect to, e.g. 'user:password@tcp(127.0.0.1:3306)/zanzigo'")
+}
+
+func (b *mysqlBackend) Configured() bool {
+	return b.dsn != ""
+}
+
+func (b *mysqlBackend) RunMigrations() error {
+	return mysql.RunMigrations(b.dsn)
+}
+
+func (b *mysqlBackend) NewStorage() (zanzigo.Storage, error) {
+	return mysql.NewMySQLStorage(b.dsn)
+}
+
+type pebbleBackend struct {
+	dir       string
+	cacheSize int64
+	sync      bool
+}
+
+func (b *pebbleBackend) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&b.dir, "pebble-dir", "", "directory of the embedded pebble key-value store")
+	flags.Int64Var(&b.cacheSize, "pebble-cache-size", 0, "size of the pebble block cache in bytes (pebble's default is used if zero)")
+	flags.BoolVar(&b.sync, "pebble-sync", true, "sync writes to disk before acknowledging them")
+}
+
+func (b *pebbleBackend) Configured() bool {
+	return b.dir != ""
+}
+
+func (b *pebbleBackend) RunMigrations() error {
+	if b.dir == "" {
+		return fmt.Errorf("--pebble-dir is required for the pebble storage backend")
+	}
+	// Pebble has no schema, but the key format might need to be upgraded
+	report, err := pebble.Migrate(b.dir)
+	if len(report.Skipped) > 0 {
+		slog.Default().Warn("skipped undecodable keys while migrating, they are kept in the backup",
+			slog.String("backup", b.dir+".bak"), slog.Int("skipped", len(report.Skipped)), slog.Any("keys", report.Skipped))
+	}
+	return err
+}
+
+func (b *pebbleBackend) NewStorage() (zanzigo.Storage, error) {
+	if b.dir == "" {
+		return nil, fmt.Errorf("--pebble-dir is required for the pebble storage backend")
+	}
+	options := []pebble.PebbleOption{}
+	if b.cacheSize > 0 {
+		options = append(options, pebble.WithCacheSize(b.cacheSize))
+	}
+	if !b.sync {
+		options = append(options, pebble.WithoutSync())
+	}
+	return pebble.NewPebbleStorage(b.dir, options...)
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/trevex/zanzigo"
+)
+
+var (
+	// Returned if a request references a store that is not registered.
+	ErrStoreNotFound = errors.New("store not found")
+	// Returned when attempting to delete the default store, which is defined by the model file.
+	ErrDefaultStore = errors.New("the default store can not be deleted")
+)
+
+// StoreRegistry keeps the model and resolver of every store in memory, so requests can be routed without querying the storage.
+// The default store is defined by the model file and not persisted, all other stores are persisted using the storage.
+//
+// Models can be replaced while serving requests: the new resolver is prepared before it is swapped in atomically,
+// so requests in flight finish using the previous resolver.
+type StoreRegistry struct {
+	storage  zanzigo.Storage
+	maxDepth int
+	options  []zanzigo.ResolverOption
+	// Serializes changes, so preparing resolvers does not block requests holding mu
+	updateMu sync.Mutex
+	mu       sync.RWMutex
+	stores   map[string]*registeredStore
+}
+
+type registeredStore struct {
+	model      *zanzigo.Model
+	definition zanzigo.ModelDefinition
+	storage    zanzigo.Storage
+	resolver   *zanzigo.Resolver
+	// JSON of the model definition of persisted stores to detect changes
+	fingerprint []byte
+}
+
+// NewStoreRegistry creates a registry, which only contains the default store using the specified model.
+// Persisted stores are registered by calling Load. The options are used to create the resolvers of all stores.
+func NewStoreRegistry(storage zanzigo.Storage, definition zanzigo.ModelDefinition, maxDepth int, options ...zanzigo.ResolverOption) (*StoreRegistry, error) {
+	r := &StoreRegistry{storage: storage, maxDepth: maxDepth, options: options, stores: map[string]*registeredStore{}}
+	model, err := zanzigo.NewModelFromDefinition(definition)
+	if err != nil {
+		return nil, err
+	}
+	store, err := r.newStore(zanzigo.DefaultStore, model, definition, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.stores[zanzigo.DefaultStore] = store
+	return r, nil
+}
+
+// Load synchronizes the registry with the stores persisted in the storage: new stores are registered, stores with a changed model are replaced
+// and stores deleted, e.g. through another server instance, are removed. It can be called periodically to pick up changes.
+// Stores with an invalid model are skipped and keep their previous model, the errors are returned joined.
+func (r *StoreRegistry) Load(ctx context.Context) error {
+	r.updateMu.Lock()
+	defer r.updateMu.Unlock()
+
+	stores, err := r.storage.ListStores(ctx)
+	if err != nil {
+		return err
+	}
+	persisted := map[string]bool{}
+	errs := []error{}
+	for _, s := range stores {
+		persisted[s.ID] = true
+		fingerprint, err := json.Marshal(s.Model)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid model of store '%s': %w", s.ID, err))
+			continue
+		}
+		r.mu.RLock()
+		current, ok := r.stores[s.ID]
+		r.mu.RUnlock()
+		if ok && bytes.Equal(current.fingerprint, fingerprint) {
+			continue
+		}
+		model, err := zanzigo.NewModelFromDefinition(s.Model)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid model of store '%s': %w", s.ID, err))
+			continue
+		}
+		store, err := r.newStore(s.ID, model, s.Model, fingerprint)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid model of store '%s': %w", s.ID, err))
+			continue
+		}
+		r.mu.Lock()
+		r.stores[s.ID] = store
+		r.mu.Unlock()
+	}
+
+	r.mu.Lock()
+	for id := range r.stores {
+		if id != zanzigo.DefaultStore && !persisted[id] {
+			delete(r.stores, id)
+		}
+	}
+	r.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// SetModel prepares a resolver for the model and swaps it in for the store. As the default store is not persisted, this is how its model is reloaded.
+// If the model is invalid or the store still contains tuples of removed types, relations or conditions, the store is left unchanged
+// and the error wraps [zanzigo.ErrIncompatibleModel] in the latter case. Both is checked before the resolver is prepared,
+// as preparing it might change the storage, e.g. create database functions.
+func (r *StoreRegistry) SetModel(ctx context.Context, id string, definition zanzigo.ModelDefinition) error {
+	r.updateMu.Lock()
+	defer r.updateMu.Unlock()
+
+	r.mu.RLock()
+	current, ok := r.stores[id]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrStoreNotFound, id)
+	}
+	model, err := zanzigo.NewModelFromDefinition(definition)
+	if err != nil {
+		return err
+	}
+	if err := zanzigo.CheckModelChange(ctx, current.storage, current.definition, definition); err != nil {
+		return err
+	}
+	store, err := r.newStore(id, model, definition, current.fingerprint)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.stores[id] = store
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *StoreRegistry) newStore(id string, model *zanzigo.Model, definition zanzigo.ModelDefinition, fingerprint []byte) (*registeredStore, error) {
+	storage := r.storage.ForStore(id)
+	resolver, err := zanzigo.NewResolver(model, storage, r.maxDepth, r.options...)
+	if err != nil {
+		return nil, err
+	}
+	return &registeredStore{model, definition, storage, resolver, fingerprint}, nil
+}
+
+// get returns the store with the specified ID, an empty ID refers to the default store.
+func (r *StoreRegistry) get(id string) (*registeredStore, error) {
+	if id == "" {
+		id = zanzigo.DefaultStore
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	store, ok := r.stores[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrStoreNotFound, id)
+	}
+	return store, nil
+}
+
+// Create validates the model, persists the store and registers it.
+func (r *StoreRegistry) Create(ctx context.Context, id string, definition zanzigo.ModelDefinition) (zanzigo.Store, error) {
+	store := zanzigo.Store{ID: id, Model: definition, CreatedAt: time.Now().UTC()}
+	if err := zanzigo.ValidateStoreID(id); err != nil {
+		return store, err
+	}
+	fingerprint, err := json.Marshal(definition)
+	if err != nil {
+		return store, err
+	}
+
+	r.updateMu.Lock()
+	defer r.updateMu.Unlock()
+	if _, err := r.get(id); err == nil {
+		return store, zanzigo.ErrAlreadyExists
+	}
+	model, err := zanzigo.NewModelFromDefinition(definition)
+	if err != nil {
+		return store, err
+	}
+	registered, err := r.newStore(id, model, definition, fingerprint)
+	if err != nil {
+		return store, err
+	}
+	if err := r.storage.CreateStore(ctx, store); err != nil {
+		return store, err
+	}
+	r.mu.Lock()
+	r.stores[id] = registered
+	r.mu.Unlock()
+	return store, nil
+}
+
+// List returns all persisted stores, so the default store is not included.
+func (r *StoreRegistry) List(ctx context.Context) ([]zanzigo.Store, error) {
+	return r.storage.ListStores(ctx)
+}
+
+// Delete removes the store and all its tuples.
+func (r *StoreRegistry) Delete(ctx context.Context, id string) error {
+	if id == zanzigo.DefaultStore {
+		return ErrDefaultStore
+	}
+	r.updateMu.Lock()
+	defer r.updateMu.Unlock()
+	if err := r.storage.DeleteStore(ctx, id); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	delete(r.stores, id)
+	r.mu.Unlock()
+	return nil
+}
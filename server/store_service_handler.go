@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/trevex/zanzigo"
+	v1 "github.com/trevex/zanzigo/api/zanzigo/v1"
+	v1connect "github.com/trevex/zanzigo/api/zanzigo/v1/zanzigov1connect"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type storeServiceHandler struct {
+	log    *slog.Logger
+	stores *StoreRegistry
+}
+
+func NewStoreServiceHandler(log *slog.Logger, stores *StoreRegistry) v1connect.StoreServiceHandler {
+	return &storeServiceHandler{log, stores}
+}
+
+func (h *storeServiceHandler) CreateStore(ctx context.Context, req *connect.Request[v1.CreateStoreRequest]) (*connect.Response[v1.CreateStoreResponse], error) {
+	if req.Msg.Model == nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing model"))
+	}
+	// The model is converted to JSON, so it is parsed exactly as model files
+	data, err := json.Marshal(req.Msg.Model.AsMap())
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	definition, err := zanzigo.ParseModelDefinition(data)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	store, err := h.stores.Create(ctx, req.Msg.StoreId, definition)
+	if errors.Is(err, zanzigo.ErrAlreadyExists) {
+		return nil, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("store '%s' already exists", req.Msg.StoreId))
+	} else if errors.Is(err, zanzigo.ErrInvalidIdentifier) || errors.Is(err, zanzigo.ErrInvalidCondition) {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	} else if err != nil {
+		h.log.Error("failed to create store", slog.String("store", req.Msg.StoreId), slog.Any("error", err))
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to create store"))
+	}
+
+	protoStore, err := toProtobufStore(store)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+	return connect.NewResponse(&v1.CreateStoreResponse{Store: protoStore}), nil
+}
+
+func (h *storeServiceHandler) ListStores(ctx context.Context, req *connect.Request[v1.ListStoresRequest]) (*connect.Response[v1.ListStoresResponse], error) {
+	stores, err := h.stores.List(ctx)
+	if err != nil {
+		h.log.Error("failed to list stores", slog.Any("error", err))
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to list stores"))
+	}
+
+	protoStores := make([]*v1.Store, 0, len(stores))
+	for _, store := range stores {
+		protoStore, err := toProtobufStore(store)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInternal, err)
+		}
+		protoStores = append(protoStores, protoStore)
+	}
+	return connect.NewResponse(&v1.ListStoresResponse{Stores: protoStores}), nil
+}
+
+func (h *storeServiceHandler) DeleteStore(ctx context.Context, req *connect.Request[v1.DeleteStoreRequest]) (*connect.Response[v1.DeleteStoreResponse], error) {
+	err := h.stores.Delete(ctx, req.Msg.StoreId)
+	if errors.Is(err, ErrDefaultStore) {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, err)
+	} else if errors.Is(err, zanzigo.ErrNotFound) {
+		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("store '%s' not found", req.Msg.StoreId))
+	} else if err != nil {
+		h.log.Error("failed to delete store", slog.String("store", req.Msg.StoreId), slog.Any("error", err))
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to delete store"))
+	}
+	return connect.NewResponse(&v1.DeleteStoreResponse{}), nil
+}
+
+func toProtobufStore(s zanzigo.Store) (*v1.Store, error) {
+	// Struct can only be created from JSON-like maps, so the model is converted using its JSON representation
+	data, err := json.Marshal(s.Model)
+	if err != nil {
+		return nil, err
+	}
+	model := &structpb.Struct{}
+	if err := model.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return &v1.Store{
+		Id:        s.ID,
+		Model:     model,
+		CreatedAt: timestamppb.New(s.CreatedAt),
+	}, nil
+}
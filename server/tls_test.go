@@ -0,0 +1,132 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, key.Public(), signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCertificate{cert, key}
+}
+
+func (c *testCertificate) write(t *testing.T, certFile, keyFile string) {
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600))
+	if keyFile != "" {
+		der, err := x509.MarshalECPrivateKey(c.key)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600))
+	}
+}
+
+func TestCertificateReloader(t *testing.T) {
+	ca := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ca"}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil)
+	newServerCert := func() *testCertificate {
+		return newTestCertificate(t, &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("127.0.0.1")}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, ca)
+	}
+	clientCert := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "api"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, ca)
+
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	serverCert := newServerCert()
+	serverCert.write(t, certFile, keyFile)
+	ca.write(t, caFile, "")
+
+	reloader, err := NewCertificateReloader(certFile, keyFile, caFile, tls.RequireAndVerifyClientCert)
+	require.NoError(t, err)
+	reloaded, err := reloader.Reload()
+	require.NoError(t, err)
+	require.False(t, reloaded)
+
+	// The client certificate is authenticated using the verified chain
+	authenticator, err := NewClientCertificateAuthenticator(writeFile(t, "identities.json", []map[string]any{
+		{"name": "api", "permissions": []string{"read"}},
+	}))
+	require.NoError(t, err)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", reloader.TLSConfig())
+	require.NoError(t, err)
+	server := &http.Server{Handler: withTLSState(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := authenticator.Authenticate(r.Context(), r.Header)
+		if err != nil || identity == nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(identity.Name))
+	}))}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	request := func(certificates ...tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certificates}}}
+		defer client.CloseIdleConnections()
+		return client.Get("https://" + listener.Addr().String())
+	}
+	clientKeyPair := tls.Certificate{Certificate: [][]byte{clientCert.cert.Raw}, PrivateKey: clientCert.key}
+
+	resp, err := request(clientKeyPair)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, serverCert.cert.SerialNumber, resp.TLS.PeerCertificates[0].SerialNumber)
+
+	// Clients without certificate are rejected during the handshake
+	_, err = request()
+	require.Error(t, err)
+
+	// Rotated certificates are served to new connections
+	rotatedCert := newServerCert()
+	rotatedCert.write(t, certFile, keyFile)
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	reloaded, err = reloader.Reload()
+	require.NoError(t, err)
+	require.True(t, reloaded)
+	resp, err = request(clientKeyPair)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, rotatedCert.cert.SerialNumber, resp.TLS.PeerCertificates[0].SerialNumber)
+
+	// Invalid files do not replace the working configuration
+	require.NoError(t, os.WriteFile(keyFile, []byte("invalid"), 0o600))
+	_, err = reloader.Reload()
+	require.Error(t, err)
+	resp, err = request(clientKeyPair)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, rotatedCert.cert.SerialNumber, resp.TLS.PeerCertificates[0].SerialNumber)
+}
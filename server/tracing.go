@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"connectrpc.com/connect"
+	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracingInterceptor struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// NewTracingInterceptor creates an interceptor starting a span for every request using the global TracerProvider.
+// The trace context of the caller is extracted from the request headers using the global propagator.
+func NewTracingInterceptor() connect.Interceptor {
+	return &tracingInterceptor{otel.Tracer("github.com/trevex/zanzigo/server"), otel.GetTextMapPropagator()}
+}
+
+func (i *tracingInterceptor) start(ctx context.Context, spec connect.Spec, header http.Header) (context.Context, trace.Span) {
+	ctx = i.propagator.Extract(ctx, propagation.HeaderCarrier(header))
+	name := strings.TrimPrefix(spec.Procedure, "/")
+	service, method, _ := strings.Cut(name, "/")
+	return i.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("rpc.system", "connect_rpc"),
+		attribute.String("rpc.service", service),
+		attribute.String("rpc.method", method),
+	))
+}
+
+func (i *tracingInterceptor) end(span trace.Span, err error) {
+	if err != nil {
+		span.SetAttributes(attribute.String("rpc.connect_rpc.error_code", connect.CodeOf(err).String()))
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (i *tracingInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		ctx, span := i.start(ctx, req.Spec(), req.Header())
+		resp, err := next(ctx, req)
+		i.end(span, err)
+		return resp, err
+	}
+}
+
+func (i *tracingInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *tracingInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		ctx, span := i.start(ctx, conn.Spec(), conn.RequestHeader())
+		err := next(ctx, conn)
+		i.end(span, err)
+		return err
+	}
+}
+
+type tracingFlags struct {
+	exporter    string
+	endpoint    string
+	insecure    bool
+	sampleRatio float64
+}
+
+func newTracingFlags(flags *pflag.FlagSet) *tracingFlags {
+	f := &tracingFlags{}
+	flags.StringVar(&f.exporter, "trace-exporter", "", "exporter of OpenTelemetry traces (one of: otlp, stdout), if unset tracing is disabled")
+	flags.StringVar(&f.endpoint, "trace-endpoint", "", "OTLP/HTTP endpoint traces are exported to, e.g. 'localhost:4318' (defaults to OTEL_EXPORTER_OTLP_ENDPOINT)")
+	flags.BoolVar(&f.insecure, "trace-insecure", false, "export traces to the OTLP endpoint without TLS")
+	flags.Float64Var(&f.sampleRatio, "trace-sample-ratio", 1, "ratio of traces sampled, unless the caller already decided")
+	return f
+}
+
+// TracerProvider returns the provider exporting spans as configured, if tracing is disabled nil is returned.
+func (f *tracingFlags) TracerProvider(ctx context.Context) (*sdktrace.TracerProvider, error) {
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	if f.sampleRatio < 0 || f.sampleRatio > 1 {
+		return nil, fmt.Errorf("--trace-sample-ratio has to be between 0 and 1")
+	}
+	switch f.exporter {
+	case "":
+		return nil, nil
+	case "otlp":
+		options := []otlptracehttp.Option{}
+		if strings.Contains(f.endpoint, "://") {
+			options = append(options, otlptracehttp.WithEndpointURL(f.endpoint))
+		} else if f.endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(f.endpoint))
+		}
+		if f.insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+	default:
+		return nil, fmt.Errorf("invalid --trace-exporter '%s'", f.exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The service name can be overridden using OTEL_SERVICE_NAME
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "zanzigo")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(f.sampleRatio))),
+	), nil
+}
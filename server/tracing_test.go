@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/trevex/zanzigo"
+	v1 "github.com/trevex/zanzigo/api/zanzigo/v1"
+	v1connect "github.com/trevex/zanzigo/api/zanzigo/v1/zanzigov1connect"
+	"github.com/trevex/zanzigo/storage/sqlite3"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Receives spans exported using OTLP/HTTP like a local collector.
+type testCollector struct {
+	mu    sync.Mutex
+	spans []*tracev1.Span
+}
+
+func (c *testCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req := &collectortrace.ExportTraceServiceRequest{}
+	if err := proto.Unmarshal(data, req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	for _, resourceSpans := range req.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			c.spans = append(c.spans, scopeSpans.Spans...)
+		}
+	}
+	c.mu.Unlock()
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write([]byte{})
+}
+
+func (c *testCollector) span(name string) *tracev1.Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, span := range c.spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func attributeOf(span *tracev1.Span, key string) *commonv1.AnyValue {
+	for _, attr := range span.Attributes {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	ctx := context.Background()
+	collector := &testCollector{}
+	collectorServer := httptest.NewServer(collector)
+	defer collectorServer.Close()
+
+	flags := &tracingFlags{exporter: "otlp", endpoint: collectorServer.URL, insecure: true, sampleRatio: 1}
+	tracerProvider, err := flags.TracerProvider(ctx)
+	require.NoError(t, err)
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	file := filepath.Join(t.TempDir(), "test.db")
+	require.NoError(t, sqlite3.RunMigrations(file))
+	storage, err := sqlite3.NewSQLite3Storage(file)
+	require.NoError(t, err)
+	defer storage.Close()
+	stores, err := NewStoreRegistry(storage, zanzigo.ModelDefinition{Objects: zanzigo.ObjectMap{
+		"user": zanzigo.RelationMap{},
+		"doc":  zanzigo.RelationMap{"viewer": zanzigo.Rule{}},
+	}}, 16)
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.Handle(v1connect.NewZanzigoServiceHandler(
+		NewZanzigoServiceHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), stores),
+		connect.WithInterceptors(NewTracingInterceptor()),
+	))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// The trace context of the caller is continued
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	client := v1connect.NewZanzigoServiceClient(server.Client(), server.URL)
+	req := connect.NewRequest(&v1.CheckRequest{Tuple: &v1.Tuple{
+		ObjectType: "doc", ObjectId: "mydoc", ObjectRelation: "viewer", SubjectType: "user", SubjectId: "myuser",
+	}})
+	req.Header().Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	_, err = client.Check(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, tracerProvider.Shutdown(ctx))
+
+	rpc := collector.span("zanzigo.v1.ZanzigoService/Check")
+	require.NotNil(t, rpc)
+	require.Equal(t, traceID, hex.EncodeToString(rpc.TraceId))
+	check := collector.span("Resolver.check")
+	require.NotNil(t, check)
+	require.Equal(t, rpc.SpanId, check.ParentSpanId)
+	require.Equal(t, int64(1), attributeOf(check, "zanzigo.depth").GetIntValue())
+	query := collector.span("Storage.QueryChecks")
+	require.NotNil(t, query)
+	require.Equal(t, check.SpanId, query.ParentSpanId)
+	require.Equal(t, "sqlite", attributeOf(query, "db.system").GetStringValue())
+	require.Len(t, attributeOf(query, "zanzigo.query.fingerprint").GetStringValue(), 16)
+}
@@ -0,0 +1,270 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/trevex/zanzigo"
+	v1 "github.com/trevex/zanzigo/api/zanzigo/v1"
+	"github.com/trevex/zanzigo/internal/convert"
+	"github.com/trevex/zanzigo/tupleio"
+
+	"connectrpc.com/connect"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// NewTransferCmds returns the commands to export and import tuples, e.g. for backups or to seed environments.
+// Both either operate on a storage directly or talk to a running server, if --remote is set.
+// Progress is reported on stderr, so the tuples can be written to stdout.
+func NewTransferCmds() []*cobra.Command {
+	return []*cobra.Command{newExportCmd(), newImportCmd()}
+}
+
+// transferFlags are shared by the import and export command.
+type transferFlags struct {
+	file      string
+	format    string
+	batchSize int
+	remote    bool
+	client    *clientFlags
+	backends  *storageBackendSet
+}
+
+func newTransferFlags(flags *pflag.FlagSet, fileUsage string) *transferFlags {
+	f := &transferFlags{}
+	flags.StringVarP(&f.file, "file", "f", "-", fileUsage)
+	flags.StringVar(&f.format, "format", "", fmt.Sprintf("format of the tuples ('%s', '%s' or '%s'), inferred from the extension of --file if empty", tupleio.FormatNDJSON, tupleio.FormatCSV, tupleio.FormatText))
+	flags.IntVar(&f.batchSize, "batch-size", tupleio.DefaultBatchSize, "number of tuples transferred at once")
+	flags.BoolVar(&f.remote, "remote", false, "transfer the tuples via the API of the server at --address instead of the storage")
+	f.client = newClientFlags(flags, 0)
+	f.backends = newStorageBackendSet(flags)
+	return f
+}
+
+func (f *transferFlags) Format() (tupleio.Format, error) {
+	if f.file == "-" {
+		return tupleio.ParseFormat(f.format, "")
+	}
+	return tupleio.ParseFormat(f.format, f.file)
+}
+
+// Storage creates the storage scoped to the store specified by --store.
+func (f *transferFlags) Storage() (zanzigo.Storage, func() error, error) {
+	store := f.client.store
+	if store == "" {
+		store = zanzigo.DefaultStore
+	}
+	if err := zanzigo.ValidateStoreID(store); err != nil {
+		return nil, nil, err
+	}
+	backend, err := f.backends.Backend()
+	if err != nil {
+		return nil, nil, err
+	}
+	storage, err := backend.NewStorage()
+	if err != nil {
+		return nil, nil, err
+	}
+	return storage.ForStore(store), storage.Close, nil
+}
+
+// progressReporter returns a function printing the number of transferred tuples at most once per second.
+func progressReporter(w io.Writer, verb string) func(int) {
+	last := time.Now()
+	return func(count int) {
+		if time.Since(last) >= time.Second {
+			fmt.Fprintf(w, "%s %d tuples\n", verb, count)
+			last = time.Now()
+		}
+	}
+}
+
+func newExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export [flags]",
+		Short: "Export all tuples matching the filter",
+		Args:  cobra.NoArgs,
+	}
+	var (
+		object   string
+		relation string
+		subject  string
+	)
+	flags := cmd.Flags()
+	flags.StringVar(&object, "object", "", "filter by object-type or object in the form 'type:id'")
+	flags.StringVar(&relation, "relation", "", "filter by relation of the object")
+	flags.StringVar(&subject, "subject", "", "filter by subject-type, subject in the form 'type:id' or userset in the form 'type:id#relation'")
+	transfer := newTransferFlags(flags, "file the tuples are written to, '-' writes to stdout")
+	withConfig(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) (err error) {
+		format, err := transfer.Format()
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		if transfer.file != "-" {
+			// The tuples are written to a temporary file, so a failed export does not leave a truncated file behind
+			file, createErr := os.CreateTemp(filepath.Dir(transfer.file), "."+filepath.Base(transfer.file)+".*")
+			if createErr != nil {
+				return createErr
+			}
+			defer func() {
+				if closeErr := file.Close(); err == nil {
+					err = closeErr
+				}
+				if err == nil {
+					err = os.Rename(file.Name(), transfer.file)
+				}
+				if err != nil {
+					_ = os.Remove(file.Name())
+				}
+			}()
+			out = file
+		}
+		enc, err := tupleio.NewEncoder(out, format)
+		if err != nil {
+			return err
+		}
+		filter := parseFilter(object, relation, subject)
+		progress := progressReporter(cmd.ErrOrStderr(), "exported")
+
+		count := 0
+		if transfer.remote {
+			c, err := transfer.client.Client()
+			if err != nil {
+				return err
+			}
+			stream, err := c.ExportTuples(cmd.Context(), connect.NewRequest(&v1.ExportTuplesRequest{
+				Filter: filter, StoreId: transfer.client.store, BatchSize: uint32(transfer.batchSize),
+			}))
+			if err != nil {
+				return err
+			}
+			defer stream.Close()
+			for stream.Receive() {
+				for _, t := range stream.Msg().Tuples {
+					if err := enc.Encode(convert.ToZanzigoTuple(t)); err != nil {
+						return err
+					}
+				}
+				count += len(stream.Msg().Tuples)
+				progress(count)
+			}
+			if err := stream.Err(); err != nil {
+				return err
+			}
+			if err := enc.Flush(); err != nil {
+				return err
+			}
+		} else {
+			storage, closeStorage, err := transfer.Storage()
+			if err != nil {
+				return err
+			}
+			defer closeStorage()
+			count, err = tupleio.Export(cmd.Context(), storage, convert.ToZanzigoTuple(filter), enc, tupleio.WithBatchSize(transfer.batchSize), tupleio.WithProgress(progress))
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "exported %d tuples\n", count)
+		return nil
+	}
+	return cmd
+}
+
+func newImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import [flags]",
+		Short: "Import tuples, existing tuples are updated",
+		Long: "Import tuples, existing tuples are updated. Each batch is written atomically, " +
+			"so an interrupted import can be repeated.",
+		Args: cobra.NoArgs,
+	}
+	modelFile := ""
+	flags := cmd.Flags()
+	flags.StringVar(&modelFile, "model", "", "model file the tuples are validated against before writing them to the storage, the server always validates them")
+	transfer := newTransferFlags(flags, "file the tuples are read from, '-' reads from stdin")
+	withConfig(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		format, err := transfer.Format()
+		if err != nil {
+			return err
+		}
+		in := cmd.InOrStdin()
+		if transfer.file != "-" {
+			file, err := os.Open(transfer.file)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			in = file
+		}
+		dec, err := tupleio.NewDecoder(in, format)
+		if err != nil {
+			return err
+		}
+		options := []tupleio.Option{
+			tupleio.WithBatchSize(transfer.batchSize),
+			tupleio.WithProgress(progressReporter(cmd.ErrOrStderr(), "imported")),
+		}
+		if modelFile != "" {
+			definition, _, err := loadModel(modelFile)
+			if err != nil {
+				return fmt.Errorf("invalid model file '%s': %w", modelFile, err)
+			}
+			model, err := zanzigo.NewModelFromDefinition(definition)
+			if err != nil {
+				return err
+			}
+			options = append(options, tupleio.WithValidator(func(t zanzigo.Tuple) error {
+				if !model.IsValid(t) {
+					return fmt.Errorf("invalid tuple: %s", t.ToString())
+				}
+				return nil
+			}))
+		}
+
+		count := 0
+		if transfer.remote {
+			c, err := transfer.client.Client()
+			if err != nil {
+				return err
+			}
+			stream := c.ImportTuples(cmd.Context())
+			_, err = tupleio.ImportFunc(dec, func(tuples []zanzigo.Tuple) error {
+				return stream.Send(&v1.ImportTuplesRequest{Tuples: convert.ToProtobufTuples(tuples), StoreId: transfer.client.store})
+			}, options...)
+			// Send returns io.EOF if the server failed, the actual error is returned by CloseAndReceive
+			if err != nil && !errors.Is(err, io.EOF) {
+				_, _ = stream.CloseAndReceive()
+				return err
+			}
+			resp, err := stream.CloseAndReceive()
+			if err != nil {
+				return err
+			}
+			count = int(resp.Msg.Imported)
+		} else {
+			storage, closeStorage, err := transfer.Storage()
+			if err != nil {
+				return err
+			}
+			defer closeStorage()
+			count, err = tupleio.Import(cmd.Context(), storage, dec, options...)
+			if err != nil {
+				return fmt.Errorf("failed after importing %d tuples: %w", count, err)
+			}
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "imported %d tuples\n", count)
+		return nil
+	}
+	return cmd
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/trevex/zanzigo"
+	v1connect "github.com/trevex/zanzigo/api/zanzigo/v1/zanzigov1connect"
+	"github.com/trevex/zanzigo/storage/sqlite3"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferCmds(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "test.db")
+	require.NoError(t, sqlite3.RunMigrations(file))
+	storage, err := sqlite3.NewSQLite3Storage(file)
+	require.NoError(t, err)
+	defer storage.Close()
+	definition := zanzigo.ModelDefinition{Objects: zanzigo.ObjectMap{
+		"user":  zanzigo.RelationMap{},
+		"group": zanzigo.RelationMap{"member": zanzigo.Rule{}},
+		"doc":   zanzigo.RelationMap{"viewer": zanzigo.Rule{}},
+	}}
+	stores, err := NewStoreRegistry(storage, definition, 16)
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	mux.Handle(v1connect.NewZanzigoServiceHandler(NewZanzigoServiceHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), stores)))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	run := func(stdin string, args ...string) (string, error) {
+		t.Helper()
+		root := &cobra.Command{Use: "zanzigo", SilenceUsage: true, SilenceErrors: true}
+		root.AddCommand(NewTransferCmds()...)
+		out := &bytes.Buffer{}
+		root.SetOut(out)
+		root.SetErr(io.Discard)
+		root.SetIn(strings.NewReader(stdin))
+		root.SetArgs(append(args, "--address", server.URL, "--sqlite-file", file))
+		err := root.ExecuteContext(context.Background())
+		return out.String(), err
+	}
+
+	modelFile := filepath.Join(dir, "model.json")
+	require.NoError(t, os.WriteFile(modelFile, []byte(`{"objects": {"user": {}, "doc": {"viewer": {}}}}`), 0o600))
+	_, err = run("doc:a#viewer@user:myuser\ndoc:b#viewer@group:mygroup#member\n", "import", "--format", "text", "--model", modelFile)
+	require.ErrorContains(t, err, "invalid tuple")
+	_, err = run("doc:a#viewer@user:myuser\ndoc:b#viewer@user:myuser\n", "import", "--format", "text", "--model", modelFile)
+	require.NoError(t, err)
+
+	// The server validates the imported tuples
+	_, err = run("doc:c#unknown@user:myuser\n", "import", "--format", "text", "--remote")
+	require.Error(t, err)
+	_, err = run("doc:c#viewer@group:mygroup#member\n", "import", "--format", "text", "--remote", "--batch-size", "1")
+	require.NoError(t, err)
+
+	backup := filepath.Join(dir, "backup.csv")
+	_, err = run("", "export", "--file", backup)
+	require.NoError(t, err)
+	data, err := os.ReadFile(backup)
+	require.NoError(t, err)
+	require.Equal(t, 4, strings.Count(string(data), "\n"))
+	// A failed export leaves an existing file untouched
+	_, err = run("", "export", "--file", backup, "--remote", "--store", "unknown")
+	require.Error(t, err)
+	failed, err := os.ReadFile(backup)
+	require.NoError(t, err)
+	require.Equal(t, data, failed)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.False(t, strings.HasPrefix(entry.Name(), ".backup.csv"), "temporary file %s was not removed", entry.Name())
+	}
+
+	out, err := run("", "export", "--remote", "--format", "text", "--subject", "user:myuser", "--batch-size", "1")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"doc:a#viewer@user:myuser", "doc:b#viewer@user:myuser"}, strings.Fields(out))
+
+	// Importing the backup into another store restores all tuples
+	require.NoError(t, storage.CreateStore(context.Background(), zanzigo.Store{ID: "restored"}))
+	_, err = run("", "import", "--file", backup, "--store", "restored")
+	require.NoError(t, err)
+	out, err = run("", "export", "--store", "restored")
+	require.NoError(t, err)
+	require.Equal(t, 3, strings.Count(out, "\n"))
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -9,28 +10,62 @@ import (
 	"github.com/trevex/zanzigo"
 	v1 "github.com/trevex/zanzigo/api/zanzigo/v1"
 	v1connect "github.com/trevex/zanzigo/api/zanzigo/v1/zanzigov1connect"
+	"github.com/trevex/zanzigo/internal/convert"
+	"github.com/trevex/zanzigo/tupleio"
 
 	"connectrpc.com/connect"
+	"github.com/samber/lo"
 )
 
+// Used by List, if the request does not specify a limit.
+const defaultListLimit = 100
+
+type HandlerOption interface {
+	do(*handlerConfig)
+}
+
+type handlerConfig struct {
+	identifierRules zanzigo.IdentifierRules
+}
+
+type handlerFunctionAdapter func(*handlerConfig)
+
+func (fn handlerFunctionAdapter) do(c *handlerConfig) {
+	fn(c)
+}
+
+// WithIdentifierRules enforces the [zanzigo.IdentifierRules] for all tuples written.
+// By default identifiers are only required to be non-empty.
+func WithIdentifierRules(rules zanzigo.IdentifierRules) HandlerOption {
+	return handlerFunctionAdapter(func(c *handlerConfig) { c.identifierRules = rules })
+}
+
 type zanzigoServiceHandler struct {
-	log      *slog.Logger
-	model    *zanzigo.Model
-	storage  zanzigo.Storage
-	resolver *zanzigo.Resolver
+	log             *slog.Logger
+	stores          *StoreRegistry
+	identifierRules zanzigo.IdentifierRules
 }
 
-func NewZanzigoServiceHandler(log *slog.Logger, model *zanzigo.Model, storage zanzigo.Storage, resolver *zanzigo.Resolver) v1connect.ZanzigoServiceHandler {
-	return &zanzigoServiceHandler{log, model, storage, resolver}
+func NewZanzigoServiceHandler(log *slog.Logger, stores *StoreRegistry, options ...HandlerOption) v1connect.ZanzigoServiceHandler {
+	opts := handlerConfig{}
+	lo.ForEach(options, func(o HandlerOption, _ int) { o.do(&opts) })
+	return &zanzigoServiceHandler{log, stores, opts.identifierRules}
 }
 
 func (h *zanzigoServiceHandler) Write(ctx context.Context, req *connect.Request[v1.WriteRequest]) (*connect.Response[v1.WriteResponse], error) {
-	tuple, err := h.isTupleValid(req.Msg.Tuple)
+	store, err := h.store(req.Msg.StoreId)
+	if err != nil {
+		return nil, err
+	}
+	tuple, err := store.isTupleValid(req.Msg.Tuple)
 	if err != nil {
 		return nil, err
 	}
+	if err := h.identifierRules.Validate(tuple); err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
 
-	err = h.storage.Write(ctx, tuple)
+	err = store.storage.Write(ctx, tuple)
 	if err != nil {
 		// TODO: what if already exists? let's properly catch that error!
 		h.log.Error("failed to write tuple", slog.Any("tuple", tuple), slog.Any("error", err))
@@ -41,12 +76,16 @@ func (h *zanzigoServiceHandler) Write(ctx context.Context, req *connect.Request[
 }
 
 func (h *zanzigoServiceHandler) Read(ctx context.Context, req *connect.Request[v1.ReadRequest]) (*connect.Response[v1.ReadResponse], error) {
-	tuple, err := h.isTupleValid(req.Msg.Tuple)
+	store, err := h.store(req.Msg.StoreId)
+	if err != nil {
+		return nil, err
+	}
+	tuple, err := store.isTupleValid(req.Msg.Tuple)
 	if err != nil {
 		return nil, err
 	}
 
-	uuid, err := h.storage.Read(ctx, tuple)
+	uuid, err := store.storage.Read(ctx, tuple)
 	if errors.Is(err, zanzigo.ErrNotFound) {
 		return nil, connect.NewError(connect.CodeDataLoss, fmt.Errorf("tuple not found"))
 	} else if err != nil {
@@ -59,88 +98,191 @@ func (h *zanzigoServiceHandler) Read(ctx context.Context, req *connect.Request[v
 	}), nil
 }
 
-func (h *zanzigoServiceHandler) Check(ctx context.Context, req *connect.Request[v1.CheckRequest]) (*connect.Response[v1.CheckResponse], error) {
-	tuple, err := h.isTupleValid(req.Msg.Tuple)
+func (h *zanzigoServiceHandler) Delete(ctx context.Context, req *connect.Request[v1.DeleteRequest]) (*connect.Response[v1.DeleteResponse], error) {
+	store, err := h.store(req.Msg.StoreId)
+	if err != nil {
+		return nil, err
+	}
+	tuple, err := store.isTupleValid(req.Msg.Tuple)
 	if err != nil {
 		return nil, err
 	}
 
-	result, err := h.resolver.Check(ctx, tuple)
+	err = store.storage.Delete(ctx, tuple)
+	if errors.Is(err, zanzigo.ErrNotFound) {
+		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("tuple not found"))
+	} else if err != nil {
+		h.log.Error("failed to delete tuple", slog.Any("tuple", tuple), slog.Any("error", err))
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed deleting tuple"))
+	}
+
+	return connect.NewResponse(&v1.DeleteResponse{}), nil
+}
+
+func (h *zanzigoServiceHandler) Check(ctx context.Context, req *connect.Request[v1.CheckRequest]) (*connect.Response[v1.CheckResponse], error) {
+	store, err := h.store(req.Msg.StoreId)
+	if err != nil {
+		return nil, err
+	}
+	tuple, err := store.isTupleValid(req.Msg.Tuple)
 	if err != nil {
+		return nil, err
+	}
+
+	options := []zanzigo.CheckOption{}
+	if req.Msg.Context != nil {
+		options = append(options, zanzigo.WithRequestContext(req.Msg.Context.AsMap()))
+	}
+	if len(req.Msg.ContextualTuples) > 0 {
+		contextualTuples := make([]zanzigo.Tuple, 0, len(req.Msg.ContextualTuples))
+		for _, t := range req.Msg.ContextualTuples {
+			contextualTuple, err := store.isTupleValid(t)
+			if err != nil {
+				return nil, err
+			}
+			contextualTuples = append(contextualTuples, contextualTuple)
+		}
+		options = append(options, zanzigo.WithContextualTuples(contextualTuples...))
+	}
+	result, err := store.resolver.CheckWithResult(ctx, tuple, options...)
+	if errors.Is(err, zanzigo.ErrInvalidConditionContext) || errors.Is(err, zanzigo.ErrInvalidTuple) {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	} else if err != nil {
 		h.log.Error("failed to check tuple", slog.Any("tuple", tuple), slog.Any("error", err))
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to check tuple"))
 	}
 
 	return connect.NewResponse(&v1.CheckResponse{
-		Result: result,
+		Result:      result == zanzigo.CheckResultAllowed,
+		Conditional: result == zanzigo.CheckResultConditional,
 	}), nil
 }
 
 func (h *zanzigoServiceHandler) List(ctx context.Context, req *connect.Request[v1.ListRequest]) (*connect.Response[v1.ListResponse], error) {
-	filter := toZanzigoTuple(req.Msg.Filter) // TODO: filter tuple can be partially validated
-	pagination, err := toZanzigoPagination(req.Msg.Pagination)
+	store, err := h.store(req.Msg.StoreId)
+	if err != nil {
+		return nil, err
+	}
+	filter := zanzigo.EmptyTuple
+	if req.Msg.Filter != nil {
+		filter = convert.ToZanzigoTuple(req.Msg.Filter) // TODO: filter tuple can be partially validated
+	}
+	pagination, err := toZanzigoPagination(req.Msg.Pagination, store.storage.CursorStart())
 	if err != nil {
-		h.log.Debug("failed to parse cursor", slog.String("cursor", req.Msg.Pagination.Cursor))
+		h.log.Debug("failed to parse cursor", slog.String("cursor", req.Msg.GetPagination().GetCursor()))
 		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("malformed cursor"))
 	}
 
-	tuples, cursor, err := h.storage.List(ctx, filter, pagination)
+	tuples, cursor, err := store.storage.List(ctx, filter, pagination)
 	if err != nil {
 		h.log.Error("failed to list tuples", slog.Any("error", err))
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to list tuples"))
 	}
 
 	return connect.NewResponse(&v1.ListResponse{
-		Tuples: toProtobufTuples(tuples),
-		Cursor: string(cursor),
+		Tuples: convert.ToProtobufTuples(tuples),
+		Cursor: toProtobufCursor(cursor, len(tuples) < pagination.Limit),
 	}), nil
 }
 
-func (h *zanzigoServiceHandler) isTupleValid(t *v1.Tuple) (zanzigo.Tuple, error) {
-	if t == nil {
-		return zanzigo.EmptyTuple, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing tuple"))
+func (h *zanzigoServiceHandler) ImportTuples(ctx context.Context, stream *connect.ClientStream[v1.ImportTuplesRequest]) (*connect.Response[v1.ImportTuplesResponse], error) {
+	var store *registeredStore
+	imported := uint64(0)
+	for stream.Receive() {
+		if store == nil {
+			var err error
+			if store, err = h.store(stream.Msg().StoreId); err != nil {
+				return nil, err
+			}
+		}
+		tuples := make([]zanzigo.Tuple, 0, len(stream.Msg().Tuples))
+		for _, t := range stream.Msg().Tuples {
+			tuple, err := store.isTupleValid(t)
+			if err != nil {
+				return nil, err
+			}
+			if err := h.identifierRules.Validate(tuple); err != nil {
+				return nil, connect.NewError(connect.CodeInvalidArgument, err)
+			}
+			tuples = append(tuples, tuple)
+		}
+		if err := zanzigo.WriteBatch(ctx, store.storage, tuples); err != nil {
+			h.log.Error("failed to import tuples", slog.Int("tuples", len(tuples)), slog.Any("error", err))
+			return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed importing tuples after %d were imported", imported))
+		}
+		imported += uint64(len(tuples))
 	}
-	tuple := toZanzigoTuple(t)
-	if !h.model.IsValid(tuple) {
-		return zanzigo.EmptyTuple, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid tuple: %v", tuple))
+	if err := stream.Err(); err != nil {
+		return nil, err
 	}
-	return tuple, nil
+
+	return connect.NewResponse(&v1.ImportTuplesResponse{Imported: imported}), nil
 }
 
-func toZanzigoTuple(t *v1.Tuple) zanzigo.Tuple {
-	return zanzigo.Tuple{
-		ObjectType:      t.ObjectType,
-		ObjectID:        t.ObjectId,
-		ObjectRelation:  t.ObjectRelation,
-		SubjectType:     t.SubjectType,
-		SubjectID:       t.SubjectId,
-		SubjectRelation: t.SubjectRelation,
+func (h *zanzigoServiceHandler) ExportTuples(ctx context.Context, req *connect.Request[v1.ExportTuplesRequest], stream *connect.ServerStream[v1.ExportTuplesResponse]) error {
+	store, err := h.store(req.Msg.StoreId)
+	if err != nil {
+		return err
 	}
+	filter := zanzigo.EmptyTuple
+	if req.Msg.Filter != nil {
+		filter = convert.ToZanzigoTuple(req.Msg.Filter)
+	}
+	batchSize := tupleio.DefaultBatchSize
+	if req.Msg.BatchSize > 0 {
+		batchSize = int(req.Msg.BatchSize)
+	}
+
+	err = tupleio.ForEachPage(ctx, store.storage, filter, batchSize, func(tuples []zanzigo.Tuple) error {
+		return stream.Send(&v1.ExportTuplesResponse{Tuples: convert.ToProtobufTuples(tuples)})
+	})
+	if err != nil {
+		h.log.Error("failed to export tuples", slog.Any("error", err))
+		return connect.NewError(connect.CodeInternal, fmt.Errorf("failed exporting tuples"))
+	}
+	return nil
 }
 
-func toProtobufTuple(t *zanzigo.Tuple) v1.Tuple {
-	return v1.Tuple{
-		ObjectType:      t.ObjectType,
-		ObjectId:        t.ObjectID,
-		ObjectRelation:  t.ObjectRelation,
-		SubjectType:     t.SubjectType,
-		SubjectId:       t.SubjectID,
-		SubjectRelation: t.SubjectRelation,
+func (h *zanzigoServiceHandler) store(id string) (*registeredStore, error) {
+	store, err := h.stores.get(id)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeNotFound, err)
 	}
+	return store, nil
 }
 
-func toProtobufTuples(ts []zanzigo.Tuple) []*v1.Tuple {
-	ps := make([]*v1.Tuple, 0, len(ts))
-	for _, t := range ts {
-		p := toProtobufTuple(&t)
-		ps = append(ps, &p)
+func (s *registeredStore) isTupleValid(t *v1.Tuple) (zanzigo.Tuple, error) {
+	if t == nil {
+		return zanzigo.EmptyTuple, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing tuple"))
 	}
-	return ps
+	tuple := convert.ToZanzigoTuple(t)
+	if !s.model.IsValid(tuple) {
+		return zanzigo.EmptyTuple, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid tuple: %s", tuple.ToString()))
+	}
+	return tuple, nil
 }
 
-func toZanzigoPagination(p *v1.Pagination) (zanzigo.Pagination, error) {
-	return zanzigo.Pagination{
-		Cursor: []byte(p.Cursor),
-		Limit:  int(p.Limit),
-	}, nil
+// toZanzigoPagination decodes the opaque cursor of the API, an empty cursor starts at the beginning.
+func toZanzigoPagination(p *v1.Pagination, start zanzigo.Cursor) (zanzigo.Pagination, error) {
+	pagination := zanzigo.Pagination{Cursor: start, Limit: defaultListLimit}
+	if p.GetLimit() > 0 {
+		pagination.Limit = int(p.GetLimit())
+	}
+	if p.GetCursor() != "" {
+		cursor, err := base64.RawURLEncoding.DecodeString(p.GetCursor())
+		if err != nil {
+			return pagination, err
+		}
+		pagination.Cursor = cursor
+	}
+	return pagination, nil
+}
+
+// toProtobufCursor encodes the cursor of the storage, so it can be passed as string.
+// Once the last page was returned, the cursor is empty.
+func toProtobufCursor(cursor zanzigo.Cursor, last bool) string {
+	if last {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(cursor)
 }
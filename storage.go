@@ -3,6 +3,7 @@ package zanzigo
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
 )
@@ -10,6 +11,8 @@ import (
 var (
 	// Returned by Storage-implementation for example if a given Read did not return a result.
 	ErrNotFound = errors.New("not found")
+	// Returned by Storage-implementation if a store to be created already exists.
+	ErrAlreadyExists = errors.New("already exists")
 )
 
 // Marker interface for Userdata returned by a storage-implementation.
@@ -23,6 +26,9 @@ type Check struct {
 	Tuple    Tuple
 	Userdata Userdata
 	Ruleset  []InferredRule
+	// Set if the resolver merges contextual tuples with the returned tuples, so storage-implementations
+	// resolving checks themselves, e.g. using database functions, have to return the tuples matching the ruleset instead.
+	Contextual bool
 }
 
 // A tuple with additional information which [Check] and which [InferredRule] from the [Check] resulted in this tuple.
@@ -42,12 +48,16 @@ type Pagination struct {
 
 // Storage provides simple CRUD operations for persistence as well as more complex methods
 // required to permission checks as performant as possible.
+// All tuple-related methods except DeleteExpired operate on a single store, which is [DefaultStore] unless scoped using ForStore.
 type Storage interface {
 	// Creates the [Tuple] t or errors, if creations fails.
+	// If the tuple already exists, its expiration is updated to the one of t.
 	Write(ctx context.Context, t Tuple) error
 	// Reads the specified [Tuple]. As all fields need to be known to read it, the UUID is returned.
-	// If the tuple was not found, [ErrNotFound] is returned.
+	// If the tuple was not found or expired, [ErrNotFound] is returned.
 	Read(ctx context.Context, t Tuple) (uuid.UUID, error)
+	// Deletes the specified [Tuple] regardless of its expiration. If the tuple does not exist, [ErrNotFound] is returned.
+	Delete(ctx context.Context, t Tuple) error
 
 	CursorStart() Cursor
 	List(ctx context.Context, f Tuple, p Pagination) ([]Tuple, Cursor, error)
@@ -61,5 +71,85 @@ type Storage interface {
 	// This allows returning as soon as possible by minimizing the rules to be checked for matches.
 	QueryChecks(ctx context.Context, checks []Check) ([]MarkedTuple, error)
 
+	// DeleteExpired physically removes all tuples of all stores, which expired before the specified time.
+	// Expired tuples are already ignored by all other methods, so this is only required to reclaim space.
+	// As it is not scoped to a store, it should only be called on the root storage, e.g. by a [GarbageCollector].
+	// Returns the number of removed tuples.
+	DeleteExpired(ctx context.Context, before time.Time) (int, error)
+
+	// ForStore returns a view of the storage scoped to the store with the specified ID, which has to be valid (see [ValidateStoreID]).
+	// The view shares all resources with the original storage, so it does not need to be closed.
+	ForStore(id string) Storage
+	// CreateStore persists the store, which does not scope the storage to it. Returns [ErrAlreadyExists], if the store exists.
+	CreateStore(ctx context.Context, store Store) error
+	// ListStores returns all persisted stores.
+	ListStores(ctx context.Context) ([]Store, error)
+	// DeleteStore removes the store and all its tuples. Returns [ErrNotFound], if the store does not exist.
+	DeleteStore(ctx context.Context, id string) error
+
 	Close() error
 }
+
+// PoolStats describes the connection pool of a [Storage]-implementation.
+type PoolStats struct {
+	MaxConns             int
+	AcquiredConns        int
+	IdleConns            int
+	AcquireCount         int64
+	AcquireDuration      time.Duration
+	CanceledAcquireCount int64
+}
+
+// PoolStatsProvider is implemented by [Storage]-implementations using a connection pool.
+type PoolStatsProvider interface {
+	PoolStats() PoolStats
+}
+
+// Pinger is implemented by [Storage]-implementations connecting to a database, e.g. to check its availability for readiness probes.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// BulkWriter is implemented by [Storage]-implementations, which write many tuples more efficiently at once than one at a time.
+// As with Write, existing tuples are updated. Either all tuples of the batch are written or none.
+type BulkWriter interface {
+	WriteBatch(ctx context.Context, tuples []Tuple) error
+}
+
+// WriteBatch writes the tuples using [BulkWriter], if implemented by the storage, or one at a time otherwise.
+func WriteBatch(ctx context.Context, storage Storage, tuples []Tuple) error {
+	if writer, ok := storage.(BulkWriter); ok {
+		return writer.WriteBatch(ctx, tuples)
+	}
+	for _, t := range tuples {
+		if err := storage.Write(ctx, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ModelPreparer is implemented by [Storage]-implementations, which prepare the rulesets of a model together instead of using PrepareRuleset,
+// e.g. because the prepared database objects reference each other and have to be separated from those of other models.
+type ModelPreparer interface {
+	PrepareModel(rules InferredRuleMap) (UserdataMap, error)
+}
+
+// PrepareModel prepares all rulesets using [ModelPreparer], if implemented by the storage, or one ruleset at a time using PrepareRuleset otherwise.
+func PrepareModel(storage Storage, rules InferredRuleMap) (UserdataMap, error) {
+	if preparer, ok := storage.(ModelPreparer); ok {
+		return preparer.PrepareModel(rules)
+	}
+	userdata := UserdataMap{}
+	for object, relations := range rules {
+		userdata[object] = map[string]Userdata{}
+		for relation, ruleset := range relations {
+			var err error
+			userdata[object][relation], err = storage.PrepareRuleset(object, relation, ruleset)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return userdata, nil
+}
@@ -0,0 +1,20 @@
+-- Column sizes are chosen so the primary key stays below InnoDB's limit of 3072 bytes for utf8mb4.
+-- A binary collation is used to compare identifiers case-sensitively as the other storage-implementations do.
+CREATE TABLE tuples (
+    uuid BINARY(16) NOT NULL,
+    object_type VARCHAR(64) NOT NULL,
+    object_id VARCHAR(255) NOT NULL,
+    object_relation VARCHAR(64) NOT NULL,
+    subject_type VARCHAR(64) NOT NULL,
+    subject_id VARCHAR(255) NOT NULL,
+    subject_relation VARCHAR(64) NOT NULL,
+    PRIMARY KEY (object_type, object_id, object_relation, subject_type, subject_id, subject_relation),
+    UNIQUE KEY idx_tuples_uuid (uuid),
+    -- MySQL and MariaDB do not support partial indices, so instead of filtering on `subject_relation <> ''`,
+    -- subject_relation is appended to the index to allow range scans for usersets.
+    KEY idx_tuples_for_usersets (object_type, object_id, object_relation, subject_relation),
+    -- For indirect relationships the subject_type is known, but the relations vary.
+    KEY idx_tuples_for_indirect (object_type, object_id, subject_type, object_relation),
+    -- Listing by object is covered by the primary key, so only listing by subject needs an index.
+    KEY idx_tuples_for_list_sub_rel (subject_type, subject_id, subject_relation)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
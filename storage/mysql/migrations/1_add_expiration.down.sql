@@ -0,0 +1,2 @@
+DROP INDEX idx_tuples_for_expiration ON tuples;
+ALTER TABLE tuples DROP COLUMN expires_at;
@@ -0,0 +1,3 @@
+-- Expirations are stored in UTC, the storage-implementation sets the session time zone accordingly.
+ALTER TABLE tuples ADD COLUMN expires_at DATETIME(6) NULL;
+CREATE INDEX idx_tuples_for_expiration ON tuples (expires_at);
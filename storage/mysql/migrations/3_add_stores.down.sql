@@ -0,0 +1,15 @@
+DELETE FROM tuples WHERE store_id <> 'default';
+
+DROP INDEX idx_tuples_for_usersets ON tuples;
+DROP INDEX idx_tuples_for_indirect ON tuples;
+DROP INDEX idx_tuples_for_list_sub_rel ON tuples;
+CREATE INDEX idx_tuples_for_usersets ON tuples (object_type, object_id, object_relation, subject_relation);
+CREATE INDEX idx_tuples_for_indirect ON tuples (object_type, object_id, subject_type, object_relation);
+CREATE INDEX idx_tuples_for_list_sub_rel ON tuples (subject_type, subject_id, subject_relation);
+
+ALTER TABLE tuples DROP PRIMARY KEY, ADD PRIMARY KEY (object_type, object_id, object_relation, subject_type, subject_id, subject_relation);
+ALTER TABLE tuples DROP COLUMN store_id;
+ALTER TABLE tuples MODIFY object_id VARCHAR(255) NOT NULL;
+ALTER TABLE tuples MODIFY subject_id VARCHAR(255) NOT NULL;
+
+DROP TABLE stores;
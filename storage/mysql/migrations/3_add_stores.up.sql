@@ -0,0 +1,21 @@
+-- Stores isolate tuples and have their own model, tuples written before belong to the default store.
+CREATE TABLE stores (
+    id VARCHAR(32) NOT NULL PRIMARY KEY,
+    model JSON NOT NULL,
+    created_at DATETIME(6) NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+-- Adding the store to the primary key would exceed InnoDB's limit of 3072 bytes, so the IDs are stored as binary strings.
+-- Their maximum length is specified in bytes by the identifier rules anyways and comparisons were already case-sensitive.
+ALTER TABLE tuples MODIFY object_id VARBINARY(255) NOT NULL;
+ALTER TABLE tuples MODIFY subject_id VARBINARY(255) NOT NULL;
+ALTER TABLE tuples ADD COLUMN store_id VARCHAR(32) NOT NULL DEFAULT 'default';
+ALTER TABLE tuples DROP PRIMARY KEY, ADD PRIMARY KEY (store_id, object_type, object_id, object_relation, subject_type, subject_id, subject_relation);
+
+-- All queries are scoped to a store, so the indices are prefixed by the store as well
+DROP INDEX idx_tuples_for_usersets ON tuples;
+DROP INDEX idx_tuples_for_indirect ON tuples;
+DROP INDEX idx_tuples_for_list_sub_rel ON tuples;
+CREATE INDEX idx_tuples_for_usersets ON tuples (store_id, object_type, object_id, object_relation, subject_relation);
+CREATE INDEX idx_tuples_for_indirect ON tuples (store_id, object_type, object_id, subject_type, object_relation);
+CREATE INDEX idx_tuples_for_list_sub_rel ON tuples (store_id, subject_type, subject_id, subject_relation);
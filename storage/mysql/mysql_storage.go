@@ -0,0 +1,397 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/trevex/zanzigo"
+	"github.com/trevex/zanzigo/internal/tracing"
+	"github.com/trevex/zanzigo/storage/postgres"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/gofrs/uuid/v5"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mysql"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+//go:embed migrations/*.sql
+var fs embed.FS
+
+// Condition excluding expired tuples, the same condition is used by [postgres.SelectQueryFor].
+// Expirations are stored in UTC, while CURRENT_TIMESTAMP depends on the time zone of the session.
+const notExpired = "(expires_at IS NULL OR expires_at > UTC_TIMESTAMP(6))"
+
+// RunMigrations expects a DSN as understood by go-sql-driver/mysql, e.g. 'user:password@tcp(127.0.0.1:3306)/zanzigo'.
+func RunMigrations(dsn string) error {
+	driver, err := iofs.New(fs, "migrations")
+	if err != nil {
+		return err
+	}
+	migrations, err := migrate.NewWithSourceInstance("iofs", driver, "mysql://"+dsn)
+	if err != nil {
+		return err
+	}
+	err = migrations.Up()
+	if err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+	return nil
+}
+
+type MySQLStorage struct {
+	db    *sql.DB
+	store string
+}
+
+func NewMySQLStorage(dsn string) (*MySQLStorage, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	// Expirations are stored in UTC regardless of the time zone of the session
+	cfg.Loc = time.UTC
+	cfg.ParseTime = true
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	return &MySQLStorage{db, zanzigo.DefaultStore}, nil
+}
+
+func (s *MySQLStorage) Close() error {
+	return s.db.Close()
+}
+
+func (s *MySQLStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+const writeQuery = "INSERT INTO tuples (uuid, store_id, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, expires_at, condition_name, condition_context) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE expires_at=VALUES(expires_at), condition_name=VALUES(condition_name), condition_context=VALUES(condition_context)"
+
+func (s *MySQLStorage) Write(ctx context.Context, t zanzigo.Tuple) error {
+	args, err := s.writeArgs(t)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, writeQuery, args...)
+	return err
+}
+
+// WriteBatch writes all tuples in a single transaction using a prepared statement.
+func (s *MySQLStorage) WriteBatch(ctx context.Context, tuples []zanzigo.Tuple) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, writeQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, t := range tuples {
+		args, err := s.writeArgs(t)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *MySQLStorage) writeArgs(t zanzigo.Tuple) ([]any, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+	var expiresAt sql.NullTime
+	if t.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: t.ExpiresAt.UTC(), Valid: true}
+	}
+	conditionName, conditionContext, err := fromConditionRef(t.Condition)
+	if err != nil {
+		return nil, err
+	}
+	return []any{id.Bytes(), s.store, t.ObjectType, t.ObjectID, t.ObjectRelation, t.SubjectType, t.SubjectID, t.SubjectRelation, expiresAt, conditionName, conditionContext}, nil
+}
+
+func (s *MySQLStorage) Read(ctx context.Context, t zanzigo.Tuple) (uuid.UUID, error) {
+	id := []byte{}
+	err := s.db.QueryRowContext(ctx, "SELECT uuid FROM tuples WHERE store_id=? AND object_type=? AND object_id=? AND object_relation=? AND subject_type=? AND subject_id=? AND subject_relation=? AND "+notExpired, s.store, t.ObjectType, t.ObjectID, t.ObjectRelation, t.SubjectType, t.SubjectID, t.SubjectRelation).
+		Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.UUID{}, zanzigo.ErrNotFound
+	} else if err != nil {
+		return uuid.UUID{}, err
+	}
+	return uuid.FromBytes(id)
+}
+
+func (s *MySQLStorage) Delete(ctx context.Context, t zanzigo.Tuple) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM tuples WHERE store_id=? AND object_type=? AND object_id=? AND object_relation=? AND subject_type=? AND subject_id=? AND subject_relation=?", s.store, t.ObjectType, t.ObjectID, t.ObjectRelation, t.SubjectType, t.SubjectID, t.SubjectRelation)
+	if err != nil {
+		return err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return zanzigo.ErrNotFound
+	}
+	return nil
+}
+
+func (s *MySQLStorage) CursorStart() zanzigo.Cursor {
+	return uuid.Must(uuid.FromString("ffffffff-ffff-ffff-ffff-ffffffffffff")).Bytes()
+}
+
+func (s *MySQLStorage) List(ctx context.Context, t zanzigo.Tuple, p zanzigo.Pagination) ([]zanzigo.Tuple, zanzigo.Cursor, error) {
+	args := []any{s.store}
+	whereClauses := "store_id=? AND "
+	if t.ObjectType != "" {
+		args = append(args, t.ObjectType)
+		whereClauses += "object_type=? AND "
+	}
+	if t.ObjectID != "" {
+		args = append(args, t.ObjectID)
+		whereClauses += "object_id=? AND "
+	}
+	if t.ObjectRelation != "" {
+		args = append(args, t.ObjectRelation)
+		whereClauses += "object_relation=? AND "
+	}
+	if t.SubjectType != "" {
+		args = append(args, t.SubjectType)
+		whereClauses += "subject_type=? AND "
+	}
+	if t.SubjectID != "" {
+		args = append(args, t.SubjectID)
+		whereClauses += "subject_id=? AND "
+	}
+	if t.SubjectRelation != "" {
+		args = append(args, t.SubjectRelation)
+		whereClauses += "subject_relation=? AND "
+	}
+
+	cursor, err := uuid.FromBytes(p.Cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	args = append(args, cursor.Bytes())
+	whereClauses += "uuid<? AND " + notExpired
+
+	args = append(args, p.Limit)
+	limit := "LIMIT ?"
+
+	rows, err := s.db.QueryContext(ctx, "SELECT uuid, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, expires_at, condition_name, condition_context FROM tuples WHERE "+whereClauses+" ORDER BY uuid DESC "+limit, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	tuples := make([]zanzigo.Tuple, 0, p.Limit)
+	id := []byte{}
+	for rows.Next() {
+		var t zanzigo.Tuple
+		var expiresAt sql.NullTime
+		var conditionName string
+		var conditionContext []byte
+		err := rows.Scan(&id, &t.ObjectType, &t.ObjectID, &t.ObjectRelation, &t.SubjectType, &t.SubjectID, &t.SubjectRelation, &expiresAt, &conditionName, &conditionContext)
+		if err != nil {
+			return nil, nil, err
+		}
+		if expiresAt.Valid {
+			t.ExpiresAt = &expiresAt.Time
+		}
+		t.Condition, err = toConditionRef(conditionName, conditionContext)
+		if err != nil {
+			return nil, nil, err
+		}
+		tuples = append(tuples, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(tuples) > 0 {
+		cursor, err = uuid.FromBytes(id)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// We use UUIDv7 stored as BINARY(16), so byte-wise comparison keeps the ordering sequential
+	return tuples, cursor.Bytes(), nil
+}
+
+// Unconditional tuples are stored with an empty condition name, the context is stored as JSON.
+// The context is passed as string, as MySQL rejects JSON in binary strings.
+func fromConditionRef(c *zanzigo.ConditionRef) (string, sql.NullString, error) {
+	if c == nil {
+		return "", sql.NullString{}, nil
+	}
+	if c.Context == nil {
+		return c.Name, sql.NullString{}, nil
+	}
+	context, err := json.Marshal(c.Context)
+	return c.Name, sql.NullString{String: string(context), Valid: true}, err
+}
+
+func toConditionRef(name string, context []byte) (*zanzigo.ConditionRef, error) {
+	if name == "" {
+		return nil, nil
+	}
+	c := &zanzigo.ConditionRef{Name: name}
+	if len(context) > 0 {
+		if err := json.Unmarshal(context, &c.Context); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (s *MySQLStorage) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM tuples WHERE expires_at IS NOT NULL AND expires_at <= ?", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	removed, err := result.RowsAffected()
+	return int(removed), err
+}
+
+func (s *MySQLStorage) ForStore(id string) zanzigo.Storage {
+	return &MySQLStorage{s.db, id}
+}
+
+func (s *MySQLStorage) CreateStore(ctx context.Context, store zanzigo.Store) error {
+	model, err := json.Marshal(store.Model)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(ctx, "INSERT IGNORE INTO stores (id, model, created_at) VALUES (?, ?, ?)", store.ID, string(model), store.CreatedAt.UTC())
+	if err != nil {
+		return err
+	}
+	if inserted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if inserted == 0 {
+		return zanzigo.ErrAlreadyExists
+	}
+	return nil
+}
+
+func (s *MySQLStorage) ListStores(ctx context.Context) ([]zanzigo.Store, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, model, created_at FROM stores ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stores := []zanzigo.Store{}
+	for rows.Next() {
+		store := zanzigo.Store{}
+		var model []byte
+		if err := rows.Scan(&store.ID, &model, &store.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(model, &store.Model); err != nil {
+			return nil, err
+		}
+		stores = append(stores, store)
+	}
+	return stores, rows.Err()
+}
+
+func (s *MySQLStorage) DeleteStore(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM stores WHERE id=?", id)
+	if err != nil {
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return zanzigo.ErrNotFound
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM tuples WHERE store_id=?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *MySQLStorage) PrepareRuleset(object, relation string, ruleset []zanzigo.InferredRule) (zanzigo.Userdata, error) {
+	// The queries are mostly portable, but we omit the brackets to stay compatible with older MariaDB releases.
+	return postgres.SelectQueryFor(postgres.DialectMySQL, s.store, ruleset, false, "?")
+}
+
+func (s *MySQLStorage) QueryChecks(ctx context.Context, checks []zanzigo.Check) (_ []zanzigo.MarkedTuple, err error) {
+	ctx, span := tracing.StartQueryChecks(ctx, "mysql", len(checks))
+	defer func() { tracing.End(span, err) }()
+
+	// TODO: current implementation could be more memory efficient by using buffer
+	args := make([]any, 0, len(checks)*6)
+	queries := make([]string, 0, len(checks))
+
+	// We iterate over all check and combine all the queries
+	for i, check := range checks {
+		query, ok := check.Userdata.(string)
+		if !ok {
+			panic("malformed query data")
+		}
+		for _, rule := range check.Ruleset {
+			switch rule.Kind {
+			case zanzigo.KindDirect:
+				args = append(args, check.Tuple.ObjectID, check.Tuple.SubjectType, check.Tuple.SubjectID, check.Tuple.SubjectRelation)
+			case zanzigo.KindDirectUserset:
+				args = append(args, check.Tuple.ObjectID)
+			case zanzigo.KindIndirect:
+				args = append(args, check.Tuple.ObjectID)
+			default:
+				panic("unreachable")
+			}
+		}
+		queries = append(queries, fmt.Sprintf("SELECT %d AS check_index", i)+", rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, condition_name, condition_context FROM ("+query+fmt.Sprintf(") AS cr%d", i))
+	}
+
+	// Join all queries with UNION ALL and ORDER BY rule index
+	fullQuery := strings.Join(queries, " UNION ALL ") + " ORDER BY rule_index"
+	tracing.SetFingerprint(ctx, fullQuery)
+
+	// Let's fetch all the rows
+	rows, err := s.db.QueryContext(ctx, fullQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tuples := []zanzigo.MarkedTuple{}
+	for rows.Next() {
+		t := zanzigo.MarkedTuple{}
+		var conditionName string
+		var conditionContext []byte
+		err := rows.Scan(&t.CheckIndex, &t.RuleIndex, &t.ObjectType, &t.ObjectID, &t.ObjectRelation, &t.SubjectType, &t.SubjectID, &t.SubjectRelation, &conditionName, &conditionContext)
+		if err != nil {
+			return nil, err
+		}
+		t.Condition, err = toConditionRef(conditionName, conditionContext)
+		if err != nil {
+			return nil, err
+		}
+		tuples = append(tuples, t)
+	}
+	return tuples, rows.Err()
+}
@@ -0,0 +1,163 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/trevex/zanzigo"
+	testsuite "github.com/trevex/zanzigo/storage"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	dsn     = ""
+	storage zanzigo.Storage
+)
+
+func TestMain(m *testing.M) {
+	var (
+		pool     *dockertest.Pool
+		resource *dockertest.Resource
+		err      error
+	)
+
+	dsn = os.Getenv("TEST_MYSQL_DSN")
+
+	if dsn == "" {
+		pool, err = dockertest.NewPool("")
+		if err != nil {
+			log.Fatalf("Could not connect to docker: %s", err)
+		}
+
+		resource, err = pool.RunWithOptions(&dockertest.RunOptions{
+			Repository: "mysql",
+			Tag:        "8.0",
+			Env: []string{
+				"MYSQL_ROOT_PASSWORD=zanzigo",
+				"MYSQL_USER=zanzigo",
+				"MYSQL_PASSWORD=zanzigo",
+				"MYSQL_DATABASE=zanzigo",
+			},
+		}, func(config *docker.HostConfig) {
+			config.AutoRemove = true // Stopped container should be removed
+			config.RestartPolicy = docker.RestartPolicy{Name: "no"}
+		})
+		if err != nil {
+			log.Fatalf("Could not start resource: %s", err)
+		}
+		_ = resource.Expire(300) // In any case container should be killed in 5min
+
+		hostAndPort := resource.GetHostPort("3306/tcp")
+		dsn = fmt.Sprintf("zanzigo:zanzigo@tcp(%s)/zanzigo", hostAndPort)
+
+		// We connect with exponential backoff (maximum wait 2min)
+		pool.MaxWait = 120 * time.Second
+		if err = pool.Retry(func() error {
+			db, err := sql.Open("mysql", dsn)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			return db.Ping()
+		}); err != nil {
+			log.Fatalf("Could not connect to mysql: %s", err)
+		}
+	}
+
+	if err := RunMigrations(dsn); err != nil {
+		log.Fatalf("Could not migrate db: %s", err)
+	}
+
+	storage, err = NewMySQLStorage(dsn)
+	if err != nil {
+		log.Fatalf("MySQLStorage creation failed: %v", err)
+	}
+
+	// Let's load the testsuite-data
+	err = testsuite.Load(context.Background(), storage)
+	if err != nil {
+		log.Fatalf("Failed loading data into storage: %v", err)
+	}
+
+	code := m.Run()
+
+	// os.Exit doesn't care for defer, so let's explicitly purge and close...
+	storage.Close()
+	if pool != nil {
+		if err := pool.Purge(resource); err != nil {
+			log.Fatalf("Could not purge resource: %s", err)
+		}
+	}
+
+	os.Exit(code)
+}
+
+func TestMySQLWithTestSuite(t *testing.T) {
+	testsuite.RunTestAll(t, map[string]testsuite.TestConfig{
+		"queries": {
+			Storage: storage,
+			Expectations: testsuite.Expectations{
+				UserdataCheckQueryTuple: zanzigo.MarkedTuple{
+					CheckIndex: 0,
+					RuleIndex:  2,
+					Tuple:      zanzigo.TupleString("doc:mydoc#parent@folder:myfolder"),
+				},
+			},
+		},
+	})
+}
+
+func TestMySQLSessionTimeZone(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	valid := zanzigo.TupleString("doc:mytimezonedoc#viewer@user:myvaliduser")
+	expiresAt := now.Add(time.Hour)
+	valid.ExpiresAt = &expiresAt
+	expired := zanzigo.TupleString("doc:mytimezonedoc#viewer@user:myexpireduser")
+	expiredAt := now.Add(-time.Hour)
+	expired.ExpiresAt = &expiredAt
+	resolver, err := zanzigo.NewResolver(testsuite.Model, storage, 16)
+	require.NoError(t, err)
+	require.NoError(t, storage.Write(ctx, valid))
+	require.NoError(t, storage.Write(ctx, expired))
+
+	// Expirations are compared in UTC, so sessions ahead and behind of UTC neither expire tuples early nor late
+	for _, timeZone := range []string{"'+05:00'", "'-05:00'"} {
+		cfg, err := mysql.ParseDSN(dsn)
+		require.NoError(t, err)
+		if cfg.Params == nil {
+			cfg.Params = map[string]string{}
+		}
+		cfg.Params["time_zone"] = timeZone
+		s, err := NewMySQLStorage(cfg.FormatDSN())
+		require.NoError(t, err)
+		defer s.Close()
+
+		_, err = s.Read(ctx, valid)
+		require.NoError(t, err, timeZone)
+		_, err = s.Read(ctx, expired)
+		require.ErrorIs(t, err, zanzigo.ErrNotFound, timeZone)
+		userdata, err := s.PrepareRuleset("doc", "viewer", resolver.RulesetFor("doc", "viewer"))
+		require.NoError(t, err)
+		for _, tuple := range []zanzigo.Tuple{valid, expired} {
+			tuples, err := s.QueryChecks(ctx, []zanzigo.Check{{Tuple: tuple, Userdata: userdata, Ruleset: resolver.RulesetFor("doc", "viewer")}})
+			require.NoError(t, err)
+			require.Equal(t, tuple == valid, len(tuples) == 1, timeZone)
+		}
+	}
+}
+
+func BenchmarkMySQL(b *testing.B) {
+	testsuite.RunBenchmarkAll(b, map[string]zanzigo.Storage{
+		"queries": storage,
+	})
+}
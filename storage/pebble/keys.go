@@ -0,0 +1,240 @@
+package pebble
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/trevex/zanzigo"
+)
+
+// Keys are encoded as a namespace byte followed by length-prefixed fields.
+// Every field is prefixed by its length as uvarint, so arbitrary bytes can be used in identifiers
+// and prefixes always end at field boundaries, which avoids over-matching IDs sharing a common prefix.
+//
+// Every tuple belongs to a store, which is the first field of both tuple indices, so stores are isolated by prefix.
+// The object-first primary index uses the following layout:
+//
+//	'o' | store | object_type | object_id | object_relation | subject_kind | subject_type | subject_id | subject_relation
+//
+// The subject_kind is a single byte distinguishing direct subjects from usersets,
+// which allows scanning all usersets of an object's relation.
+//
+// The subject-first secondary index uses the following layout:
+//
+//	's' | store | subject_type | subject_id | subject_relation | object_type | object_id | object_relation
+//
+// Tuples with an expiration are additionally stored in the expiration index, which is ordered by the expiration time
+// encoded as big-endian unix nanoseconds and references the key of the primary index:
+//
+//	'e' | expires_at | primary key
+//
+// The values of both the primary and secondary index are described in values.go.
+//
+// Stores themselves are persisted with their ID as key and the JSON-encoded [storeValue] as value:
+//
+//	't' | store
+const (
+	subjectKindDirect  = byte(0)
+	subjectKindUserset = byte(1)
+)
+
+var (
+	ErrMalformedKey = errors.New("malformed key")
+)
+
+type keyBuilder []byte
+
+func newKeyBuilder(namespace byte) keyBuilder {
+	return keyBuilder{namespace}
+}
+
+func (b keyBuilder) field(s string) keyBuilder {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func (b keyBuilder) byte(c byte) keyBuilder {
+	return append(b, c)
+}
+
+type keyReader struct {
+	key []byte
+	err error
+}
+
+func newKeyReader(key []byte, namespace byte) *keyReader {
+	if len(key) == 0 || key[0] != namespace {
+		return &keyReader{err: fmt.Errorf("%w: unexpected namespace", ErrMalformedKey)}
+	}
+	return &keyReader{key: key[1:]}
+}
+
+func (r *keyReader) field() string {
+	if r.err != nil {
+		return ""
+	}
+	l, n := binary.Uvarint(r.key)
+	if n <= 0 || uint64(len(r.key)-n) < l {
+		r.err = fmt.Errorf("%w: invalid field length", ErrMalformedKey)
+		return ""
+	}
+	s := string(r.key[n : n+int(l)])
+	r.key = r.key[n+int(l):]
+	return s
+}
+
+func (r *keyReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.key) == 0 {
+		r.err = fmt.Errorf("%w: unexpected end of key", ErrMalformedKey)
+		return 0
+	}
+	c := r.key[0]
+	r.key = r.key[1:]
+	return c
+}
+
+func (r *keyReader) done() error {
+	if r.err == nil && len(r.key) > 0 {
+		r.err = fmt.Errorf("%w: trailing bytes", ErrMalformedKey)
+	}
+	return r.err
+}
+
+func subjectKind(t zanzigo.Tuple) byte {
+	if t.SubjectRelation != "" {
+		return subjectKindUserset
+	}
+	return subjectKindDirect
+}
+
+func toKey(store string, t zanzigo.Tuple) []byte {
+	return newKeyBuilder(namespaceObject).field(store).
+		field(t.ObjectType).field(t.ObjectID).field(t.ObjectRelation).
+		byte(subjectKind(t)).
+		field(t.SubjectType).field(t.SubjectID).field(t.SubjectRelation)
+}
+
+func fromKey(key []byte) (string, zanzigo.Tuple, error) {
+	r := newKeyReader(key, namespaceObject)
+	store := r.field()
+	t := zanzigo.Tuple{}
+	t.ObjectType = r.field()
+	t.ObjectID = r.field()
+	t.ObjectRelation = r.field()
+	_ = r.byte()
+	t.SubjectType = r.field()
+	t.SubjectID = r.field()
+	t.SubjectRelation = r.field()
+	return store, t, r.done()
+}
+
+func toSubjectKey(store string, t zanzigo.Tuple) []byte {
+	return newKeyBuilder(namespaceSubject).field(store).
+		field(t.SubjectType).field(t.SubjectID).field(t.SubjectRelation).
+		field(t.ObjectType).field(t.ObjectID).field(t.ObjectRelation)
+}
+
+func fromSubjectKey(key []byte) (string, zanzigo.Tuple, error) {
+	r := newKeyReader(key, namespaceSubject)
+	store := r.field()
+	t := zanzigo.Tuple{}
+	t.SubjectType = r.field()
+	t.SubjectID = r.field()
+	t.SubjectRelation = r.field()
+	t.ObjectType = r.field()
+	t.ObjectID = r.field()
+	t.ObjectRelation = r.field()
+	return store, t, r.done()
+}
+
+// Returns the longest prefix of the object-first index derivable from the filter.
+// Subject-fields are not part of the prefix, as the subject kind precedes them.
+func toObjectPrefix(store string, f zanzigo.Tuple) []byte {
+	b := newKeyBuilder(namespaceObject).field(store)
+	if f.ObjectType == "" {
+		return b
+	}
+	b = b.field(f.ObjectType)
+	if f.ObjectID == "" {
+		return b
+	}
+	b = b.field(f.ObjectID)
+	if f.ObjectRelation == "" {
+		return b
+	}
+	return b.field(f.ObjectRelation)
+}
+
+// Returns the longest prefix of the subject-first index derivable from the filter.
+// As an empty subject relation matches any relation, it can not be part of the prefix.
+func toSubjectPrefix(store string, f zanzigo.Tuple) []byte {
+	b := newKeyBuilder(namespaceSubject).field(store)
+	if f.SubjectType == "" {
+		return b
+	}
+	b = b.field(f.SubjectType)
+	if f.SubjectID == "" {
+		return b
+	}
+	b = b.field(f.SubjectID)
+	if f.SubjectRelation == "" {
+		return b
+	}
+	return b.field(f.SubjectRelation)
+}
+
+func toDirectUsersetPrefix(store, objectType, objectID, objectRelation string) []byte {
+	return newKeyBuilder(namespaceObject).field(store).
+		field(objectType).field(objectID).field(objectRelation).
+		byte(subjectKindUserset)
+}
+
+func toIndirectPrefix(store, objectType, objectID, objectRelation, subjectType string) []byte {
+	return newKeyBuilder(namespaceObject).field(store).
+		field(objectType).field(objectID).field(objectRelation).
+		byte(subjectKindDirect).
+		field(subjectType)
+}
+
+func toStoreKey(store string) []byte {
+	return newKeyBuilder(namespaceStore).field(store)
+}
+
+func fromStoreKey(key []byte) (string, error) {
+	r := newKeyReader(key, namespaceStore)
+	store := r.field()
+	return store, r.done()
+}
+
+func encodeTime(t time.Time) []byte {
+	nanos := t.UnixNano()
+	if nanos < 0 {
+		nanos = 0
+	}
+	return binary.BigEndian.AppendUint64(nil, uint64(nanos))
+}
+
+func decodeTime(b []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b))).UTC()
+}
+
+func toExpirationKey(expiresAt time.Time, key []byte) []byte {
+	return append(append([]byte{namespaceExpiration}, encodeTime(expiresAt)...), key...)
+}
+
+// Returns the exclusive upper bound of the expiration index for all tuples expired at the specified time.
+func toExpirationUpperBound(t time.Time) []byte {
+	return toExpirationKey(t.Add(time.Nanosecond), nil)
+}
+
+func fromExpirationKey(key []byte) ([]byte, error) {
+	if len(key) < 9 || key[0] != namespaceExpiration {
+		return nil, fmt.Errorf("%w: invalid expiration key", ErrMalformedKey)
+	}
+	return key[9:], nil
+}
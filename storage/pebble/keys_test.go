@@ -0,0 +1,68 @@
+package pebble
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/trevex/zanzigo"
+)
+
+func TestKeyEncoding(t *testing.T) {
+	tuples := []zanzigo.Tuple{
+		zanzigo.TupleString("doc:mydoc#viewer@user:myuser"),
+		zanzigo.TupleString("doc:mydoc#viewer@group:mygroup#member"),
+		{ObjectType: "doc", ObjectID: "a:b#c@d!e", ObjectRelation: "viewer", SubjectType: "user", SubjectID: "x@y#z:!"},
+		{ObjectType: "doc", ObjectID: "", ObjectRelation: "viewer", SubjectType: "user", SubjectID: "\x00\xff"},
+	}
+	for _, tuple := range tuples {
+		store, decoded, err := fromKey(toKey("mystore", tuple))
+		require.NoError(t, err)
+		require.Equal(t, "mystore", store)
+		require.Equal(t, tuple, decoded)
+
+		store, decoded, err = fromSubjectKey(toSubjectKey("mystore", tuple))
+		require.NoError(t, err)
+		require.Equal(t, "mystore", store)
+		require.Equal(t, tuple, decoded)
+	}
+
+	_, _, err := fromKey(toSubjectKey(zanzigo.DefaultStore, tuples[0]))
+	require.ErrorIs(t, err, ErrMalformedKey)
+	_, _, err = fromKey(toKey(zanzigo.DefaultStore, tuples[0])[:10])
+	require.ErrorIs(t, err, ErrMalformedKey)
+
+	// Prefixes end at field boundaries, so IDs sharing a prefix do not match
+	prefix := toSubjectPrefix("mystore", zanzigo.Tuple{SubjectType: "user", SubjectID: "my"})
+	require.False(t, bytes.HasPrefix(toSubjectKey("mystore", tuples[0]), prefix))
+	prefix = toSubjectPrefix("mystore", zanzigo.Tuple{SubjectType: "user", SubjectID: "myuser"})
+	require.True(t, bytes.HasPrefix(toSubjectKey("mystore", tuples[0]), prefix))
+	// The same applies to stores
+	prefix = toObjectPrefix("my", zanzigo.Tuple{})
+	require.False(t, bytes.HasPrefix(toKey("mystore", tuples[0]), prefix))
+}
+
+func TestArbitraryIdentifiers(t *testing.T) {
+	storage, err := NewPebbleStorage(t.TempDir())
+	require.NoError(t, err)
+	defer storage.Close()
+
+	ctx := context.Background()
+	tuples := []zanzigo.Tuple{
+		{ObjectType: "doc", ObjectID: "a:b#c", ObjectRelation: "viewer", SubjectType: "user", SubjectID: "u@x"},
+		{ObjectType: "doc", ObjectID: "a:b#c", ObjectRelation: "viewer", SubjectType: "user", SubjectID: "u@x2"},
+		{ObjectType: "doc", ObjectID: "a", ObjectRelation: "viewer", SubjectType: "group", SubjectID: "g!1", SubjectRelation: "member"},
+	}
+	for _, tuple := range tuples {
+		require.NoError(t, storage.Write(ctx, tuple))
+	}
+
+	listed, _, err := storage.List(ctx, zanzigo.Tuple{SubjectType: "user", SubjectID: "u@x"}, zanzigo.Pagination{Cursor: storage.CursorStart(), Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, tuples[:1], listed)
+
+	listed, _, err = storage.List(ctx, zanzigo.Tuple{ObjectType: "doc", ObjectID: "a"}, zanzigo.Pagination{Cursor: storage.CursorStart(), Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, tuples[2:], listed)
+}
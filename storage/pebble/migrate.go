@@ -0,0 +1,165 @@
+package pebble
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/trevex/zanzigo"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/gofrs/uuid/v5"
+)
+
+const (
+	// Number of tuples written per batch during migrations
+	migrationBatchSize = 10000
+)
+
+// MigrateReport summarizes a migration.
+type MigrateReport struct {
+	// Number of migrated tuples.
+	Migrated int
+	// Keys, which could not be decoded and were skipped. They are still contained in the backup.
+	Skipped []string
+}
+
+// Migrate upgrades a database created by an earlier version of the storage-implementation to the current format.
+// If the database does not exist, is empty or already up-to-date, nothing is done.
+// Earlier formats did not support stores, so all migrated tuples belong to [zanzigo.DefaultStore].
+// Keys, which can not be decoded, are skipped instead of failing the migration and are listed in the report.
+//
+// The migrated database is written to a temporary directory next to dirname first and only swapped in once complete,
+// so an interrupted migration can safely be restarted. The original database is kept as a backup at dirname + ".bak".
+func Migrate(dirname string) (MigrateReport, error) {
+	report := MigrateReport{}
+	if _, err := os.Stat(dirname); errors.Is(err, os.ErrNotExist) {
+		return report, nil
+	}
+
+	src, err := pebble.Open(dirname, &pebble.Options{ErrorIfNotExists: true})
+	if err != nil {
+		return report, err
+	}
+	version, err := readFormatVersion(src)
+	if err != nil || version == formatVersion {
+		src.Close()
+		return report, err
+	}
+	// Only the initial format of plain tuple strings without a version needs to be migrated
+	if version != "" {
+		src.Close()
+		return report, fmt.Errorf("%w: unable to migrate from version %s", ErrUnsupportedFormat, version)
+	}
+
+	tmpDirname := dirname + ".migrate"
+	backupDirname := dirname + ".bak"
+	if _, err := os.Stat(backupDirname); err == nil {
+		src.Close()
+		return report, fmt.Errorf("backup directory '%s' already exists, remove it before migrating", backupDirname)
+	}
+	if err := os.RemoveAll(tmpDirname); err != nil {
+		src.Close()
+		return report, err
+	}
+	dst, err := pebble.Open(tmpDirname, &pebble.Options{})
+	if err != nil {
+		src.Close()
+		return report, err
+	}
+
+	err = copyTuples(src, dst, &report)
+	if err == nil {
+		err = dst.Set(formatVersionKey, []byte(formatVersion), pebble.Sync)
+	}
+	err = errors.Join(err, src.Close(), dst.Close())
+	if err != nil {
+		return report, err
+	}
+
+	if err := os.Rename(dirname, backupDirname); err != nil {
+		return report, err
+	}
+	return report, os.Rename(tmpDirname, dirname)
+}
+
+// Returns the format version or an empty string if the database contains data, but no version.
+// An empty database is treated as being up-to-date.
+func readFormatVersion(db *pebble.DB) (string, error) {
+	value, closer, err := db.Get(formatVersionKey)
+	if err == nil {
+		defer closer.Close()
+		return string(value), nil
+	} else if err != pebble.ErrNotFound {
+		return "", err
+	}
+	iter, err := db.NewIter(nil)
+	if err != nil {
+		return "", err
+	}
+	empty := !iter.First()
+	if err := iter.Close(); err != nil {
+		return "", err
+	}
+	if empty {
+		return formatVersion, nil
+	}
+	return "", nil
+}
+
+func copyTuples(src, dst *pebble.DB, report *MigrateReport) error {
+	iter, err := src.NewIter(nil)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	batch := dst.NewBatch()
+	for iter.First(); iter.Valid(); iter.Next() {
+		t, err := fromLegacyTupleString(string(iter.Key()))
+		if err != nil {
+			report.Skipped = append(report.Skipped, string(iter.Key()))
+			continue
+		}
+		id, err := uuid.NewV7()
+		if err != nil {
+			batch.Close()
+			return err
+		}
+		value, err := toValue(id, t)
+		if err != nil {
+			batch.Close()
+			return err
+		}
+		if err := batch.Set(toKey(zanzigo.DefaultStore, t), value, nil); err != nil {
+			batch.Close()
+			return err
+		}
+		if err := batch.Set(toSubjectKey(zanzigo.DefaultStore, t), value, nil); err != nil {
+			batch.Close()
+			return err
+		}
+		report.Migrated += 1
+		if report.Migrated%migrationBatchSize == 0 {
+			if err := batch.Commit(pebble.NoSync); err != nil {
+				batch.Close()
+				return err
+			}
+			batch.Close()
+			batch = dst.NewBatch()
+		}
+	}
+	defer batch.Close()
+	return batch.Commit(pebble.Sync)
+}
+
+// The initial format used plain tuple strings as keys without values.
+// Subjects of usersets were prefixed by '!'.
+func fromLegacyTupleString(s string) (zanzigo.Tuple, error) {
+	t := zanzigo.TupleString(strings.Replace(s, "@!", "@", 1))
+	if t == zanzigo.EmptyTuple {
+		return t, fmt.Errorf("%w: unable to parse legacy key '%s'", ErrMalformedKey, s)
+	}
+	return t, nil
+}
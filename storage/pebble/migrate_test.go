@@ -0,0 +1,58 @@
+package pebble
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/stretchr/testify/require"
+	"github.com/trevex/zanzigo"
+)
+
+func TestMigrate(t *testing.T) {
+	dirname := t.TempDir() + "/db"
+
+	// Create a database using the initial format of plain tuple strings
+	db, err := pebble.Open(dirname, &pebble.Options{})
+	require.NoError(t, err)
+	require.NoError(t, db.Set([]byte("group:mygroup#member@user:myuser"), nil, pebble.Sync))
+	require.NoError(t, db.Set([]byte("folder:myfolder#viewer@!group:mygroup#member"), nil, pebble.Sync))
+	require.NoError(t, db.Set([]byte("stray"), nil, pebble.Sync))
+	require.NoError(t, db.Close())
+
+	_, err = NewPebbleStorage(dirname)
+	require.ErrorIs(t, err, ErrUnsupportedFormat)
+
+	// Undecodable keys are reported instead of failing the migration
+	report, err := Migrate(dirname)
+	require.NoError(t, err)
+	require.Equal(t, MigrateReport{Migrated: 2, Skipped: []string{"stray"}}, report)
+	// Migrating an up-to-date database is a no-op
+	report, err = Migrate(dirname)
+	require.NoError(t, err)
+	require.Equal(t, MigrateReport{}, report)
+
+	storage, err := NewPebbleStorage(dirname)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	ctx := context.Background()
+	id, err := storage.Read(ctx, zanzigo.TupleString("folder:myfolder#viewer@group:mygroup#member"))
+	require.NoError(t, err)
+	require.False(t, id.IsNil())
+
+	tuples, _, err := storage.List(ctx, zanzigo.Tuple{SubjectType: "user"}, zanzigo.Pagination{Cursor: storage.CursorStart(), Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, []zanzigo.Tuple{zanzigo.TupleString("group:mygroup#member@user:myuser")}, tuples)
+}
+
+func TestMigrateUnknownVersion(t *testing.T) {
+	dirname := t.TempDir() + "/db"
+	db, err := pebble.Open(dirname, &pebble.Options{})
+	require.NoError(t, err)
+	require.NoError(t, db.Set(formatVersionKey, []byte("99"), pebble.Sync))
+	require.NoError(t, db.Close())
+
+	_, err = Migrate(dirname)
+	require.ErrorIs(t, err, ErrUnsupportedFormat)
+}
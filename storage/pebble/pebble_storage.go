@@ -1,23 +1,127 @@
-package sqlite3
+package pebble
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"strings"
+	"sync"
+	"time"
 
 	"github.com/trevex/zanzigo"
+	"github.com/trevex/zanzigo/internal/tracing"
 
 	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
 	"github.com/gofrs/uuid/v5"
+	"github.com/samber/lo"
 )
 
+type PebbleOption interface {
+	do(*pebbleConfig)
+}
+
+type pebbleConfig struct {
+	cacheSize int64
+	noSync    bool
+	inMemory  bool
+}
+
+type pebbleFunctionAdapter func(*pebbleConfig)
+
+func (fn pebbleFunctionAdapter) do(c *pebbleConfig) {
+	fn(c)
+}
+
+// WithCacheSize sets the size of the block cache in bytes, if not set Pebble's default of 8MB is used.
+func WithCacheSize(size int64) PebbleOption {
+	return pebbleFunctionAdapter(func(c *pebbleConfig) { c.cacheSize = size })
+}
+
+// WithoutSync disables syncing writes to disk before returning.
+// This increases write-throughput, but recent writes might be lost if the machine crashes.
+func WithoutSync() PebbleOption {
+	return pebbleFunctionAdapter(func(c *pebbleConfig) { c.noSync = true })
+}
+
+// WithInMemory keeps the database in memory instead of on disk, so all tuples are lost once the storage is closed,
+// e.g. for tests or sandboxes. The dirname is only used within the in-memory file system.
+func WithInMemory() PebbleOption {
+	return pebbleFunctionAdapter(func(c *pebbleConfig) { c.inMemory = true })
+}
+
+var (
+	// Returned if the database was created by an incompatible version of the pebble storage-implementation.
+	ErrUnsupportedFormat = errors.New("unsupported pebble database format")
+)
+
+const (
+	// The format version is stored in the database to detect incompatible key layouts.
+	// Databases using an earlier format can be upgraded using [Migrate].
+	formatVersion = "1"
+
+	// Every key is prefixed by a namespace, so the primary and secondary index can share the key space.
+	namespaceMeta       = byte(0)
+	namespaceObject     = byte('o') // object-first primary index, the value contains the UUID
+	namespaceSubject    = byte('s') // subject-first secondary index, the value contains the UUID
+	namespaceExpiration = byte('e') // expiration index referencing the primary index, the value is empty
+	namespaceStore      = byte('t') // stores, the value contains the JSON-encoded definition
+)
+
+var formatVersionKey = []byte{namespaceMeta, 'v'}
+
 type PebbleStorage struct {
-	db *pebble.DB
+	db           *pebble.DB
+	writeOptions *pebble.WriteOptions
+	store        string
+	// Serializes writes, so a tuple written concurrently always ends up with a single UUID in both indices.
+	// The mutex is shared by all views of the storage created by ForStore.
+	writeMu *sync.Mutex
 }
 
-func NewPebbleStorage(dirname string) (*PebbleStorage, error) {
-	db, err := pebble.Open(dirname, &pebble.Options{})
-	return &PebbleStorage{db}, err
+func NewPebbleStorage(dirname string, options ...PebbleOption) (*PebbleStorage, error) {
+	opts := pebbleConfig{}
+	lo.ForEach(options, func(o PebbleOption, _ int) { o.do(&opts) })
+
+	pebbleOpts := &pebble.Options{}
+	if opts.cacheSize > 0 {
+		cache := pebble.NewCache(opts.cacheSize)
+		// The database holds its own reference to the cache
+		defer cache.Unref()
+		pebbleOpts.Cache = cache
+	}
+	if opts.inMemory {
+		pebbleOpts.FS = vfs.NewMem()
+	}
+	writeOptions := pebble.Sync
+	if opts.noSync {
+		writeOptions = pebble.NoSync
+	}
+
+	db, err := pebble.Open(dirname, pebbleOpts)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFormat(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &PebbleStorage{db: db, writeOptions: writeOptions, store: zanzigo.DefaultStore, writeMu: &sync.Mutex{}}, nil
+}
+
+// checkFormat verifies the format version of an existing database or initializes it for an empty one.
+func checkFormat(db *pebble.DB) error {
+	version, err := readFormatVersion(db)
+	if err != nil {
+		return err
+	}
+	if version == "" {
+		return fmt.Errorf("%w: database was created by an earlier version and needs to be migrated", ErrUnsupportedFormat)
+	} else if version != formatVersion {
+		return fmt.Errorf("%w: expected version %s, but found %s, the database might need to be migrated", ErrUnsupportedFormat, formatVersion, version)
+	}
+	// Persist the version in case the database is new
+	return db.Set(formatVersionKey, []byte(formatVersion), pebble.Sync)
 }
 
 func (s *PebbleStorage) Close() error {
@@ -25,91 +129,202 @@ func (s *PebbleStorage) Close() error {
 }
 
 func (s *PebbleStorage) Write(ctx context.Context, t zanzigo.Tuple) error {
-	return s.db.Set(toKey(t), nil, pebble.Sync)
+	return s.WriteBatch(ctx, []zanzigo.Tuple{t})
+}
+
+// WriteBatch writes all tuples and their indices in a single batch, which is committed atomically.
+func (s *PebbleStorage) WriteBatch(ctx context.Context, tuples []zanzigo.Tuple) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	// Indexed, so tuples written multiple times within the batch see their previous value
+	batch := s.db.NewIndexedBatch()
+	defer batch.Close()
+	for _, t := range tuples {
+		if err := s.write(batch, t); err != nil {
+			return err
+		}
+	}
+	if batch.Empty() {
+		return nil
+	}
+	return batch.Commit(s.writeOptions)
+}
+
+func (s *PebbleStorage) write(batch *pebble.Batch, t zanzigo.Tuple) error {
+	key := toKey(s.store, t)
+	var previousExpiresAt *time.Time
+	value, closer, err := batch.Get(key)
+	if err == nil {
+		// The tuple already exists, so we keep the existing UUID and only update expiration and condition
+		previous, err := fromValue(value)
+		if err != nil {
+			closer.Close()
+			return err
+		}
+		newValue, err := toValue(previous.id, t)
+		unchanged := bytes.Equal(newValue, value)
+		closer.Close()
+		if err != nil || unchanged {
+			return err
+		}
+		value = newValue
+		previousExpiresAt = previous.expiresAt
+	} else if err == pebble.ErrNotFound {
+		id, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+		value, err = toValue(id, t)
+		if err != nil {
+			return err
+		}
+	} else {
+		return err
+	}
+
+	// All indices are updated atomically
+	if err := batch.Set(key, value, nil); err != nil {
+		return err
+	}
+	if err := batch.Set(toSubjectKey(s.store, t), value, nil); err != nil {
+		return err
+	}
+	if previousExpiresAt != nil && (t.ExpiresAt == nil || !previousExpiresAt.Equal(*t.ExpiresAt)) {
+		if err := batch.Delete(toExpirationKey(*previousExpiresAt, key), nil); err != nil {
+			return err
+		}
+	}
+	if t.ExpiresAt != nil {
+		if err := batch.Set(toExpirationKey(*t.ExpiresAt, key), nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *PebbleStorage) Read(ctx context.Context, t zanzigo.Tuple) (uuid.UUID, error) {
-	// TODO: the uuid is pointless for kv-store...
-	id := uuid.UUID{}
-	_, closer, err := s.db.Get(toKey(t))
+	value, closer, err := s.db.Get(toKey(s.store, t))
 	if err == pebble.ErrNotFound {
-		return id, zanzigo.ErrNotFound
+		return uuid.UUID{}, zanzigo.ErrNotFound
 	} else if err != nil {
-		return id, err
+		return uuid.UUID{}, err
+	}
+	defer closer.Close()
+	if isExpiredValue(value, time.Now()) {
+		return uuid.UUID{}, zanzigo.ErrNotFound
 	}
+	v, err := fromValue(value)
+	return v.id, err
+}
+
+// Delete removes the tuple from all indices atomically.
+func (s *PebbleStorage) Delete(ctx context.Context, t zanzigo.Tuple) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	key := toKey(s.store, t)
+	value, closer, err := s.db.Get(key)
+	if err == pebble.ErrNotFound {
+		return zanzigo.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	v, err := fromValue(value)
 	closer.Close()
-	return id, nil
+	if err != nil {
+		return err
+	}
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+	err = errors.Join(batch.Delete(key, nil), batch.Delete(toSubjectKey(s.store, t), nil))
+	if v.expiresAt != nil {
+		err = errors.Join(err, batch.Delete(toExpirationKey(*v.expiresAt, key), nil))
+	}
+	if err != nil {
+		return err
+	}
+	return batch.Commit(s.writeOptions)
 }
 
 func (s *PebbleStorage) CursorStart() zanzigo.Cursor {
 	return []byte("")
 }
 
+// List supports filtering by any combination of fields. If the object-type is specified, the object-first index is used,
+// if only subject-fields are specified, the subject-first index is used. The longest prefix derivable from the filter is
+// used to scan the index, remaining fields are filtered while iterating.
 func (s *PebbleStorage) List(ctx context.Context, t zanzigo.Tuple, p zanzigo.Pagination) ([]zanzigo.Tuple, zanzigo.Cursor, error) {
-	prefix := ""
-	fieldErr := fmt.Errorf("Pebble List implementation only allows listing for valid prefixes in tuple string notation: %v", t)
-
-	if t.ObjectType != "" {
-		prefix += t.ObjectType + ":"
-	} else if t.ObjectID != "" || t.ObjectRelation != "" || t.SubjectType != "" || t.SubjectID != "" || t.SubjectRelation != "" {
-		return nil, nil, fieldErr
-	}
-	if t.ObjectType != "" {
-		prefix += t.ObjectID + "#"
-	} else if t.ObjectRelation != "" || t.SubjectType != "" || t.SubjectID != "" || t.SubjectRelation != "" {
-		return nil, nil, fieldErr
-	}
-	if t.ObjectRelation != "" {
-		prefix += t.ObjectRelation + "@"
-	} else if t.SubjectType != "" || t.SubjectID != "" || t.SubjectRelation != "" {
-		return nil, nil, fieldErr
-	}
-	if t.SubjectType != "" {
-		prefix += t.SubjectType + ":"
-	} else if t.SubjectID != "" || t.SubjectRelation != "" {
-		return nil, nil, fieldErr
-	}
-	if t.SubjectID != "" {
-		prefix += t.SubjectID // TODO: might find too much, we should add an "end" character
-	} else if t.SubjectRelation != "" {
-		return nil, nil, fieldErr
-	}
-	if t.SubjectRelation != "" {
-		prefix += "#" + t.SubjectRelation
+	var (
+		prefix []byte
+		decode func([]byte) (string, zanzigo.Tuple, error)
+	)
+	if t.ObjectType != "" || t.SubjectType == "" {
+		prefix = toObjectPrefix(s.store, t)
+		decode = fromKey
+	} else {
+		prefix = toSubjectPrefix(s.store, t)
+		decode = fromSubjectKey
 	}
 
-	iterOpts := prefixIterOptions([]byte(prefix))
-	if len(p.Cursor) > 0 {
+	iterOpts := prefixIterOptions(prefix)
+	if len(p.Cursor) > 0 && bytes.Compare(p.Cursor, iterOpts.LowerBound) > 0 {
 		iterOpts.LowerBound = p.Cursor
 	}
 	iter, err := s.db.NewIter(iterOpts)
 	if err != nil {
 		return nil, nil, err
 	}
-	i := p.Limit
-	cursor := p.Cursor
+	now := time.Now()
+	// The key is copied, as the iterator reuses its buffer once moved
+	cursor := bytes.Clone(p.Cursor)
 	tuples := make([]zanzigo.Tuple, 0, p.Limit)
-	for iter.First(); iter.Valid(); iter.Next() {
-		cursor = iter.Key()
-		t := zanzigo.TupleString(string(cursor))
-		tuples = append(tuples, t)
-		i -= 1
-		if i == 0 {
-			break
+	for iter.First(); iter.Valid() && len(tuples) < p.Limit; iter.Next() {
+		cursor = append(cursor[:0], iter.Key()...)
+		_, tuple, err := decode(cursor)
+		if err != nil {
+			iter.Close()
+			return nil, nil, err
 		}
+		if !matchesFilter(tuple, t) || isExpiredValue(iter.Value(), now) {
+			continue
+		}
+		v, err := fromValue(iter.Value())
+		if err != nil {
+			iter.Close()
+			return nil, nil, err
+		}
+		tuple.ExpiresAt, tuple.Condition = v.expiresAt, v.condition
+		tuples = append(tuples, tuple)
 	}
+	// The cursor is the smallest key greater than the last visited key
+	cursor = append(cursor, 0)
 	if err := iter.Close(); err != nil {
 		return nil, nil, err
 	}
 
-	return tuples, keyUpperBound(cursor), nil
+	return tuples, cursor, nil
+}
+
+func matchesFilter(t, f zanzigo.Tuple) bool {
+	return (f.ObjectType == "" || f.ObjectType == t.ObjectType) &&
+		(f.ObjectID == "" || f.ObjectID == t.ObjectID) &&
+		(f.ObjectRelation == "" || f.ObjectRelation == t.ObjectRelation) &&
+		(f.SubjectType == "" || f.SubjectType == t.SubjectType) &&
+		(f.SubjectID == "" || f.SubjectID == t.SubjectID) &&
+		(f.SubjectRelation == "" || f.SubjectRelation == t.SubjectRelation)
 }
 
 func (s *PebbleStorage) PrepareRuleset(object, relation string, ruleset []zanzigo.InferredRule) (zanzigo.Userdata, error) {
 	return nil, nil
 }
 
-func (s *PebbleStorage) QueryChecks(ctx context.Context, checks []zanzigo.Check) ([]zanzigo.MarkedTuple, error) {
+func (s *PebbleStorage) QueryChecks(ctx context.Context, checks []zanzigo.Check) (_ []zanzigo.MarkedTuple, err error) {
+	ctx, span := tracing.StartQueryChecks(ctx, "pebble", len(checks))
+	defer func() { tracing.End(span, err) }()
+
+	now := time.Now()
 	tuples := []zanzigo.MarkedTuple{}
 
 	// We iterate over all check and combine all the results
@@ -126,22 +341,44 @@ func (s *PebbleStorage) QueryChecks(ctx context.Context, checks []zanzigo.Check)
 						SubjectID:       check.Tuple.SubjectID,
 						SubjectRelation: check.Tuple.SubjectRelation,
 					}
-					_, closer, err := s.db.Get(toKey(t))
+					value, closer, err := s.db.Get(toKey(s.store, t))
 					if err == nil {
+						expired := isExpiredValue(value, now)
+						v, err := fromValue(value)
 						closer.Close()
-						tuples = append(tuples, zanzigo.MarkedTuple{Tuple: t, CheckIndex: i, RuleIndex: j})
+						if err != nil {
+							return nil, err
+						}
+						if !expired {
+							t.Condition = v.condition
+							tuples = append(tuples, zanzigo.MarkedTuple{Tuple: t, CheckIndex: i, RuleIndex: j})
+						}
+					} else if err != pebble.ErrNotFound {
+						return nil, err
 					}
 				}
 			case zanzigo.KindDirectUserset:
 				for _, relation := range rule.Relations {
-					prefix := toDirectUsersetPrefix(rule.Object, check.Tuple.ObjectID, relation)
+					prefix := toDirectUsersetPrefix(s.store, rule.Object, check.Tuple.ObjectID, relation)
 					iter, err := s.db.NewIter(prefixIterOptions(prefix))
 					if err != nil {
 						return nil, err
 					}
 					for iter.First(); iter.Valid(); iter.Next() {
-						st := strings.ReplaceAll(string(iter.Key()), "!", "")
-						t := zanzigo.TupleString(st)
+						if isExpiredValue(iter.Value(), now) {
+							continue
+						}
+						_, t, err := fromKey(iter.Key())
+						if err != nil {
+							iter.Close()
+							return nil, err
+						}
+						v, err := fromValue(iter.Value())
+						if err != nil {
+							iter.Close()
+							return nil, err
+						}
+						t.Condition = v.condition
 						tuples = append(tuples, zanzigo.MarkedTuple{Tuple: t, CheckIndex: i, RuleIndex: j})
 					}
 					if err := iter.Close(); err != nil {
@@ -151,13 +388,26 @@ func (s *PebbleStorage) QueryChecks(ctx context.Context, checks []zanzigo.Check)
 			case zanzigo.KindIndirect:
 				// TODO: do we need to check usersets as well!? assumption: no
 				for _, relation := range rule.Relations {
-					prefix := toIndirectPrefix(rule.Object, check.Tuple.ObjectID, relation, rule.Subject)
+					prefix := toIndirectPrefix(s.store, rule.Object, check.Tuple.ObjectID, relation, rule.Subject)
 					iter, err := s.db.NewIter(prefixIterOptions(prefix))
 					if err != nil {
 						return nil, err
 					}
 					for iter.First(); iter.Valid(); iter.Next() {
-						t := zanzigo.TupleString(string(iter.Key()))
+						if isExpiredValue(iter.Value(), now) {
+							continue
+						}
+						_, t, err := fromKey(iter.Key())
+						if err != nil {
+							iter.Close()
+							return nil, err
+						}
+						v, err := fromValue(iter.Value())
+						if err != nil {
+							iter.Close()
+							return nil, err
+						}
+						t.Condition = v.condition
 						tuples = append(tuples, zanzigo.MarkedTuple{Tuple: t, CheckIndex: i, RuleIndex: j})
 					}
 					if err := iter.Close(); err != nil {
@@ -173,6 +423,143 @@ func (s *PebbleStorage) QueryChecks(ctx context.Context, checks []zanzigo.Check)
 	return tuples, nil
 }
 
+// DeleteExpired uses the expiration index to find expired tuples of all stores and removes them from all indices.
+func (s *PebbleStorage) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: []byte{namespaceExpiration},
+		UpperBound: toExpirationUpperBound(before),
+	})
+	if err != nil {
+		return 0, err
+	}
+	batch := s.db.NewBatch()
+	defer batch.Close()
+	removed := 0
+	for iter.First(); iter.Valid(); iter.Next() {
+		key, err := fromExpirationKey(iter.Key())
+		if err != nil {
+			iter.Close()
+			return 0, err
+		}
+		store, t, err := fromKey(key)
+		if err != nil {
+			iter.Close()
+			return 0, err
+		}
+		err = errors.Join(batch.Delete(key, nil), batch.Delete(toSubjectKey(store, t), nil), batch.Delete(iter.Key(), nil))
+		if err != nil {
+			iter.Close()
+			return 0, err
+		}
+		removed += 1
+	}
+	if err := iter.Close(); err != nil {
+		return 0, err
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, batch.Commit(s.writeOptions)
+}
+
+func (s *PebbleStorage) ForStore(id string) zanzigo.Storage {
+	return &PebbleStorage{db: s.db, writeOptions: s.writeOptions, store: id, writeMu: s.writeMu}
+}
+
+func (s *PebbleStorage) CreateStore(ctx context.Context, store zanzigo.Store) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	key := toStoreKey(store.ID)
+	_, closer, err := s.db.Get(key)
+	if err == nil {
+		closer.Close()
+		return zanzigo.ErrAlreadyExists
+	} else if err != pebble.ErrNotFound {
+		return err
+	}
+	value, err := toStoreValue(store)
+	if err != nil {
+		return err
+	}
+	return s.db.Set(key, value, s.writeOptions)
+}
+
+func (s *PebbleStorage) ListStores(ctx context.Context) ([]zanzigo.Store, error) {
+	iter, err := s.db.NewIter(prefixIterOptions([]byte{namespaceStore}))
+	if err != nil {
+		return nil, err
+	}
+	stores := []zanzigo.Store{}
+	for iter.First(); iter.Valid(); iter.Next() {
+		id, err := fromStoreKey(iter.Key())
+		if err != nil {
+			iter.Close()
+			return nil, err
+		}
+		store, err := fromStoreValue(id, iter.Value())
+		if err != nil {
+			iter.Close()
+			return nil, err
+		}
+		stores = append(stores, store)
+	}
+	return stores, iter.Close()
+}
+
+// DeleteStore removes the ranges of both tuple indices belonging to the store.
+// The expiration index is not ordered by store, so its entries are removed while iterating the primary index.
+func (s *PebbleStorage) DeleteStore(ctx context.Context, id string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	key := toStoreKey(id)
+	_, closer, err := s.db.Get(key)
+	if err == pebble.ErrNotFound {
+		return zanzigo.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	closer.Close()
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+	objectPrefix := toObjectPrefix(id, zanzigo.Tuple{})
+	iter, err := s.db.NewIter(prefixIterOptions(objectPrefix))
+	if err != nil {
+		return err
+	}
+	for iter.First(); iter.Valid(); iter.Next() {
+		v, err := fromValue(iter.Value())
+		if err != nil {
+			iter.Close()
+			return err
+		}
+		if v.expiresAt != nil {
+			if err := batch.Delete(toExpirationKey(*v.expiresAt, iter.Key()), nil); err != nil {
+				iter.Close()
+				return err
+			}
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	subjectPrefix := toSubjectPrefix(id, zanzigo.Tuple{})
+	err = errors.Join(
+		batch.DeleteRange(objectPrefix, keyUpperBound(objectPrefix), nil),
+		batch.DeleteRange(subjectPrefix, keyUpperBound(subjectPrefix), nil),
+		batch.Delete(key, nil),
+	)
+	if err != nil {
+		return err
+	}
+	return batch.Commit(s.writeOptions)
+}
+
 func keyUpperBound(b []byte) []byte {
 	end := make([]byte, len(b))
 	copy(end, b)
@@ -191,21 +578,3 @@ func prefixIterOptions(prefix []byte) *pebble.IterOptions {
 		UpperBound: keyUpperBound(prefix),
 	}
 }
-
-func toKey(t zanzigo.Tuple) []byte {
-	var s string
-	if t.SubjectRelation != "" {
-		s = fmt.Sprintf("%s:%s#%s@!%s:%s#%s", t.ObjectType, t.ObjectID, t.ObjectRelation, t.SubjectType, t.SubjectID, t.SubjectRelation)
-	} else {
-		s = fmt.Sprintf("%s:%s#%s@%s:%s", t.ObjectType, t.ObjectID, t.ObjectRelation, t.SubjectType, t.SubjectID)
-	}
-	return []byte(s)
-}
-
-func toDirectUsersetPrefix(objectType, objectID, objectRelation string) []byte {
-	return []byte(fmt.Sprintf("%s:%s#%s@!", objectType, objectID, objectRelation))
-}
-
-func toIndirectPrefix(objectType, objectID, objectRelation, subjectType string) []byte {
-	return []byte(fmt.Sprintf("%s:%s#%s@%s:", objectType, objectID, objectRelation, subjectType))
-}
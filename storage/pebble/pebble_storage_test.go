@@ -1,4 +1,4 @@
-package sqlite3
+package pebble
 
 import (
 	"context"
@@ -8,6 +8,8 @@ import (
 
 	"github.com/trevex/zanzigo"
 	testsuite "github.com/trevex/zanzigo/storage"
+
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -59,6 +61,24 @@ func TestPebbleWithTestSuite(t *testing.T) {
 	})
 }
 
+func TestPebbleInMemory(t *testing.T) {
+	ctx := context.Background()
+	tuple := zanzigo.TupleString("doc:mydoc#viewer@user:myuser")
+	for i := 0; i < 2; i++ {
+		// Every in-memory storage starts empty, even with the same dirname
+		storage, err := NewPebbleStorage("memory", WithInMemory())
+		require.NoError(t, err)
+		_, err = storage.Read(ctx, tuple)
+		require.ErrorIs(t, err, zanzigo.ErrNotFound)
+		require.NoError(t, storage.Write(ctx, tuple))
+		_, err = storage.Read(ctx, tuple)
+		require.NoError(t, err)
+		require.NoError(t, storage.Close())
+	}
+	_, err := os.Stat("memory")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
 func BenchmarkPebble(b *testing.B) {
 	testsuite.RunBenchmarkAll(b, map[string]zanzigo.Storage{
 		"pebble": storage,
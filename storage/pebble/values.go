@@ -0,0 +1,122 @@
+package pebble
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/trevex/zanzigo"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// Values of the primary and secondary index use the following layout:
+//
+//	uuid | flags | [expires_at] | [condition_name | condition_context]
+//
+// The flags indicate which optional fields follow. The expiration time is encoded as in the expiration index,
+// the condition name and JSON-encoded context are length-prefixed fields as used by keys.
+const (
+	valueFlagExpiration = byte(1 << 0)
+	valueFlagCondition  = byte(1 << 1)
+)
+
+var (
+	ErrMalformedValue = errors.New("malformed value")
+)
+
+// The decoded value of a tuple.
+type tupleValue struct {
+	id        uuid.UUID
+	expiresAt *time.Time
+	condition *zanzigo.ConditionRef
+}
+
+func toValue(id uuid.UUID, t zanzigo.Tuple) ([]byte, error) {
+	flags := byte(0)
+	if t.ExpiresAt != nil {
+		flags |= valueFlagExpiration
+	}
+	if t.Condition != nil {
+		flags |= valueFlagCondition
+	}
+	value := append(id.Bytes(), flags)
+	if t.ExpiresAt != nil {
+		value = append(value, encodeTime(*t.ExpiresAt)...)
+	}
+	if t.Condition != nil {
+		context := []byte{}
+		if t.Condition.Context != nil {
+			var err error
+			context, err = json.Marshal(t.Condition.Context)
+			if err != nil {
+				return nil, err
+			}
+		}
+		value = keyBuilder(value).field(t.Condition.Name).field(string(context))
+	}
+	return value, nil
+}
+
+func fromValue(value []byte) (tupleValue, error) {
+	v := tupleValue{}
+	if len(value) < uuid.Size+1 {
+		return v, fmt.Errorf("%w: invalid value length %d", ErrMalformedValue, len(value))
+	}
+	v.id = uuid.FromBytesOrNil(value[:uuid.Size])
+	flags := value[uuid.Size]
+	rest := value[uuid.Size+1:]
+	if flags&valueFlagExpiration != 0 {
+		if len(rest) < 8 {
+			return v, fmt.Errorf("%w: truncated expiration", ErrMalformedValue)
+		}
+		expiresAt := decodeTime(rest[:8])
+		v.expiresAt = &expiresAt
+		rest = rest[8:]
+	}
+	if flags&valueFlagCondition != 0 {
+		// The condition is encoded like the fields of a key, so we reuse the reader without namespace
+		r := &keyReader{key: rest}
+		v.condition = &zanzigo.ConditionRef{Name: r.field()}
+		context := r.field()
+		if err := r.done(); err != nil {
+			return v, fmt.Errorf("%w: %v", ErrMalformedValue, err)
+		}
+		if context != "" {
+			if err := json.Unmarshal([]byte(context), &v.condition.Context); err != nil {
+				return v, fmt.Errorf("%w: %v", ErrMalformedValue, err)
+			}
+		}
+	} else if len(rest) > 0 {
+		return v, fmt.Errorf("%w: trailing bytes", ErrMalformedValue)
+	}
+	return v, nil
+}
+
+// Returns true, if the value belongs to a tuple that expired at the specified time.
+// Only the expiration is decoded, as this is called for every visited tuple.
+func isExpiredValue(value []byte, now time.Time) bool {
+	if len(value) < uuid.Size+1+8 || value[uuid.Size]&valueFlagExpiration == 0 {
+		return false
+	}
+	return !decodeTime(value[uuid.Size+1 : uuid.Size+9]).After(now)
+}
+
+// Stores are persisted as JSON, as the model definition is already JSON-serializable.
+type storeValue struct {
+	Model     zanzigo.ModelDefinition `json:"model"`
+	CreatedAt time.Time               `json:"created_at"`
+}
+
+func toStoreValue(store zanzigo.Store) ([]byte, error) {
+	return json.Marshal(storeValue{store.Model, store.CreatedAt})
+}
+
+func fromStoreValue(id string, value []byte) (zanzigo.Store, error) {
+	v := storeValue{}
+	if err := json.Unmarshal(value, &v); err != nil {
+		return zanzigo.Store{}, fmt.Errorf("%w: %v", ErrMalformedValue, err)
+	}
+	return zanzigo.Store{ID: id, Model: v.Model, CreatedAt: v.CreatedAt}, nil
+}
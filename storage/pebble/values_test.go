@@ -0,0 +1,38 @@
+package pebble
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/stretchr/testify/require"
+	"github.com/trevex/zanzigo"
+)
+
+func TestValueEncoding(t *testing.T) {
+	id := uuid.Must(uuid.NewV7())
+	expiresAt := time.Now().Add(time.Hour).UTC()
+	tuple := zanzigo.TupleString("doc:mydoc#viewer@user:myuser")
+
+	value, err := toValue(id, tuple)
+	require.NoError(t, err)
+	v, err := fromValue(value)
+	require.NoError(t, err)
+	require.Equal(t, tupleValue{id: id}, v)
+
+	tuple.ExpiresAt = &expiresAt
+	tuple.Condition = &zanzigo.ConditionRef{Name: "before", Context: map[string]any{"date": "2030-01-01T00:00:00Z"}}
+	value, err = toValue(id, tuple)
+	require.NoError(t, err)
+	v, err = fromValue(value)
+	require.NoError(t, err)
+	require.Equal(t, id, v.id)
+	require.True(t, expiresAt.Equal(*v.expiresAt))
+	require.Equal(t, tuple.Condition, v.condition)
+
+	require.False(t, isExpiredValue(value, time.Now()))
+	require.True(t, isExpiredValue(value, expiresAt))
+
+	_, err = fromValue(value[:len(value)-1])
+	require.ErrorIs(t, err, ErrMalformedValue)
+}
@@ -0,0 +1,2 @@
+DROP INDEX idx_tuples_partial_for_expiration;
+ALTER TABLE tuples DROP COLUMN expires_at;
@@ -0,0 +1,4 @@
+ALTER TABLE tuples ADD COLUMN expires_at TIMESTAMPTZ;
+
+-- Only tuples with an expiration are of interest to the garbage collector
+CREATE INDEX idx_tuples_partial_for_expiration ON tuples (expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE tuples DROP COLUMN condition_context;
+ALTER TABLE tuples DROP COLUMN condition_name;
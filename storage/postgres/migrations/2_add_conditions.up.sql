@@ -0,0 +1,3 @@
+-- Conditional tuples reference a condition of the model by name, which is empty for unconditional tuples.
+ALTER TABLE tuples ADD COLUMN condition_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE tuples ADD COLUMN condition_context JSONB;
@@ -0,0 +1,20 @@
+DELETE FROM tuples WHERE store_id <> 'default';
+
+DROP INDEX idx_tuples_partial_for_usersets;
+DROP INDEX idx_tuples_partial_for_indirect;
+DROP INDEX idx_tuples_partial_for_list_obj;
+DROP INDEX idx_tuples_partial_for_list_obj_rel;
+DROP INDEX idx_tuples_partial_for_list_sub;
+DROP INDEX idx_tuples_partial_for_list_sub_rel;
+CREATE INDEX idx_tuples_partial_for_usersets ON tuples (object_type, object_id, object_relation) WHERE subject_relation <> '';
+CREATE INDEX idx_tuples_partial_for_indirect ON tuples (object_type, object_id, subject_type);
+CREATE INDEX idx_tuples_partial_for_list_obj ON tuples (object_type, object_id);
+CREATE INDEX idx_tuples_partial_for_list_obj_rel ON tuples (object_type, object_id, object_relation);
+CREATE INDEX idx_tuples_partial_for_list_sub ON tuples (subject_type, subject_id);
+CREATE INDEX idx_tuples_partial_for_list_sub_rel ON tuples (subject_type, subject_id, subject_relation);
+
+ALTER TABLE tuples DROP CONSTRAINT tuples_pkey;
+ALTER TABLE tuples ADD PRIMARY KEY (object_type, object_id, object_relation, subject_type, subject_id, subject_relation);
+ALTER TABLE tuples DROP COLUMN store_id;
+
+DROP TABLE stores;
@@ -0,0 +1,24 @@
+-- Stores isolate tuples and have their own model, tuples written before belong to the default store.
+CREATE TABLE stores (
+    id TEXT NOT NULL PRIMARY KEY,
+    model JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE tuples ADD COLUMN store_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE tuples DROP CONSTRAINT tuples_pkey;
+ALTER TABLE tuples ADD PRIMARY KEY (store_id, object_type, object_id, object_relation, subject_type, subject_id, subject_relation);
+
+-- All queries are scoped to a store, so the indices are prefixed by the store as well
+DROP INDEX idx_tuples_partial_for_usersets;
+DROP INDEX idx_tuples_partial_for_indirect;
+DROP INDEX idx_tuples_partial_for_list_obj;
+DROP INDEX idx_tuples_partial_for_list_obj_rel;
+DROP INDEX idx_tuples_partial_for_list_sub;
+DROP INDEX idx_tuples_partial_for_list_sub_rel;
+CREATE INDEX idx_tuples_partial_for_usersets ON tuples (store_id, object_type, object_id, object_relation) WHERE subject_relation <> '';
+CREATE INDEX idx_tuples_partial_for_indirect ON tuples (store_id, object_type, object_id, subject_type);
+CREATE INDEX idx_tuples_partial_for_list_obj ON tuples (store_id, object_type, object_id);
+CREATE INDEX idx_tuples_partial_for_list_obj_rel ON tuples (store_id, object_type, object_id, object_relation);
+CREATE INDEX idx_tuples_partial_for_list_sub ON tuples (store_id, subject_type, subject_id);
+CREATE INDEX idx_tuples_partial_for_list_sub_rel ON tuples (store_id, subject_type, subject_id, subject_relation);
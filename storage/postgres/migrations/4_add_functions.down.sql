@@ -0,0 +1,11 @@
+DO $$
+DECLARE
+    f RECORD;
+BEGIN
+    FOR f IN SELECT name FROM functions LOOP
+        EXECUTE FORMAT('DROP FUNCTION IF EXISTS %I(TEXT, TEXT, TEXT, TEXT)', f.name);
+    END LOOP;
+END;
+$$;
+
+DROP TABLE functions;
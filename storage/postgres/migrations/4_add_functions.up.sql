@@ -0,0 +1,23 @@
+-- Functions created in functions mode, so functions of revisions of a model no longer prepared can be dropped.
+CREATE TABLE functions (
+    name TEXT NOT NULL PRIMARY KEY,
+    store_id TEXT NOT NULL,
+    revision TEXT NOT NULL,
+    prepared_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_functions_store ON functions (store_id, revision);
+
+-- Functions of previous naming schemes are not recorded, so they are dropped and recreated with bounded names when a model is prepared.
+DO $$
+DECLARE
+    f RECORD;
+BEGIN
+    FOR f IN
+        SELECT p.oid::regprocedure AS signature FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+        WHERE n.nspname = current_schema() AND p.proname LIKE 'zanzigo\_%' AND p.proname !~ '^zanzigo_[0-9a-f]{32}$'
+    LOOP
+        EXECUTE 'DROP FUNCTION ' || f.signature;
+    END LOOP;
+END;
+$$;
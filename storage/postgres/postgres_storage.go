@@ -2,13 +2,19 @@ package postgres
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
 	"embed"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/trevex/zanzigo"
+	"github.com/trevex/zanzigo/internal/tracing"
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/golang-migrate/migrate/v4"
@@ -16,6 +22,7 @@ import (
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 	pgxuuid "github.com/jackc/pgx-gofrs-uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/samber/lo"
 )
@@ -23,6 +30,13 @@ import (
 //go:embed migrations/*.sql
 var fs embed.FS
 
+const (
+	// Condition excluding expired tuples, the same condition is used by [SelectQueryFor].
+	notExpired = "(expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)"
+
+	defaultFunctionRetention = 24 * time.Hour
+)
+
 func RunMigrations(databaseURL string) error {
 	driver, err := iofs.New(fs, "migrations")
 	if err != nil {
@@ -44,7 +58,14 @@ type PostgresOption interface {
 }
 
 type postgresConfig struct {
-	useFunctions bool
+	useFunctions      bool
+	functionRetention time.Duration
+	maxConns          int32
+	minConns          int32
+	statementTimeout  time.Duration
+	applicationName   string
+	tlsConfig         *tls.Config
+	configHooks       []func(*pgxpool.Config) error
 }
 
 type postgresFunctionAdapter func(*postgresConfig)
@@ -53,31 +74,118 @@ func (fn postgresFunctionAdapter) do(c *postgresConfig) {
 	fn(c)
 }
 
+// UseFunctions runs checks using Postgres-functions prepared for every relation of the model, see [PostgresStorage.PrepareModel].
 func UseFunctions() PostgresOption {
 	return postgresFunctionAdapter(func(c *postgresConfig) { c.useFunctions = true })
 }
 
+// WithFunctionRetention sets how long the functions of a revision of a model are kept after it was last prepared,
+// before they are dropped when another revision of the model of the store is prepared. Defaults to 24 hours.
+func WithFunctionRetention(retention time.Duration) PostgresOption {
+	return postgresFunctionAdapter(func(c *postgresConfig) { c.functionRetention = retention })
+}
+
+// WithMaxConns sets the maximum size of the pool, overriding pool_max_conns of the database URL.
+func WithMaxConns(n int32) PostgresOption {
+	return postgresFunctionAdapter(func(c *postgresConfig) { c.maxConns = n })
+}
+
+// WithMinConns sets the number of connections kept open even if idle, overriding pool_min_conns of the database URL.
+func WithMinConns(n int32) PostgresOption {
+	return postgresFunctionAdapter(func(c *postgresConfig) { c.minConns = n })
+}
+
+// WithStatementTimeout aborts statements running longer than the timeout on the server,
+// even if the context of the query is not canceled.
+func WithStatementTimeout(timeout time.Duration) PostgresOption {
+	return postgresFunctionAdapter(func(c *postgresConfig) { c.statementTimeout = timeout })
+}
+
+// WithApplicationName sets the application_name of the connections, e.g. shown in pg_stat_activity.
+func WithApplicationName(name string) PostgresOption {
+	return postgresFunctionAdapter(func(c *postgresConfig) { c.applicationName = name })
+}
+
+// WithTLSConfig uses the TLS configuration to connect, e.g. to present a client certificate,
+// instead of the configuration derived from the sslmode of the database URL.
+func WithTLSConfig(config *tls.Config) PostgresOption {
+	return postgresFunctionAdapter(func(c *postgresConfig) { c.tlsConfig = config })
+}
+
+// WithPoolConfig calls fn with the parsed configuration after all other options are applied and before the pool is created,
+// so settings without a dedicated option can be changed. Registering the UUID type in AfterConnect is preserved.
+func WithPoolConfig(fn func(*pgxpool.Config) error) PostgresOption {
+	return postgresFunctionAdapter(func(c *postgresConfig) { c.configHooks = append(c.configHooks, fn) })
+}
+
+// RegisterTypes registers the types used by [PostgresStorage] with the connection.
+// It has to be called in AfterConnect of pools passed to [NewPostgresStorageFromPool].
+func RegisterTypes(ctx context.Context, conn *pgx.Conn) error {
+	pgxuuid.Register(conn.TypeMap())
+	return nil
+}
+
 type PostgresStorage struct {
-	pool         *pgxpool.Pool
-	useFunctions bool
+	pool              *pgxpool.Pool
+	useFunctions      bool
+	functionRetention time.Duration
+	store             string
 }
 
 func NewPostgresStorage(databaseURL string, options ...PostgresOption) (*PostgresStorage, error) {
-	opts := postgresConfig{}
+	opts := postgresConfig{functionRetention: defaultFunctionRetention}
 	lo.ForEach(options, func(o PostgresOption, _ int) { o.do(&opts) })
 	config, err := pgxpool.ParseConfig(databaseURL)
 	if err != nil {
 		return nil, err // TODO: wrap?
 	}
-	config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
-		pgxuuid.Register(conn.TypeMap())
-		return nil
+	if opts.maxConns > 0 {
+		config.MaxConns = opts.maxConns
+	}
+	if opts.minConns > 0 {
+		config.MinConns = opts.minConns
+	}
+	if opts.minConns > config.MaxConns {
+		return nil, fmt.Errorf("invalid pool size: min connections (%d) exceed max connections (%d)", opts.minConns, config.MaxConns)
+	}
+	if opts.statementTimeout > 0 {
+		config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(opts.statementTimeout.Milliseconds(), 10)
+	}
+	if opts.applicationName != "" {
+		config.ConnConfig.RuntimeParams["application_name"] = opts.applicationName
+	}
+	if opts.tlsConfig != nil {
+		config.ConnConfig.TLSConfig = opts.tlsConfig
+		config.ConnConfig.Fallbacks = nil
+	}
+	for _, hook := range opts.configHooks {
+		if err := hook(config); err != nil {
+			return nil, err
+		}
+	}
+	if afterConnect := config.AfterConnect; afterConnect == nil {
+		config.AfterConnect = RegisterTypes
+	} else {
+		config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+			if err := RegisterTypes(ctx, conn); err != nil {
+				return err
+			}
+			return afterConnect(ctx, conn)
+		}
 	}
 	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
 		return nil, err
 	}
-	return &PostgresStorage{pool, opts.useFunctions}, nil
+	return &PostgresStorage{pool, opts.useFunctions, opts.functionRetention, zanzigo.DefaultStore}, nil
+}
+
+// NewPostgresStorageFromPool uses an existing pool, whose AfterConnect has to call [RegisterTypes].
+// Options configuring connections are ignored, only [UseFunctions] and [WithFunctionRetention] apply. Closing the storage closes the pool.
+func NewPostgresStorageFromPool(pool *pgxpool.Pool, options ...PostgresOption) *PostgresStorage {
+	opts := postgresConfig{functionRetention: defaultFunctionRetention}
+	lo.ForEach(options, func(o PostgresOption, _ int) { o.do(&opts) })
+	return &PostgresStorage{pool, opts.useFunctions, opts.functionRetention, zanzigo.DefaultStore}
 }
 
 func (s *PostgresStorage) Close() error {
@@ -85,14 +193,62 @@ func (s *PostgresStorage) Close() error {
 	return nil
 }
 
+func (s *PostgresStorage) Ping(ctx context.Context) error {
+	return s.pool.Ping(ctx)
+}
+
+func (s *PostgresStorage) PoolStats() zanzigo.PoolStats {
+	stat := s.pool.Stat()
+	return zanzigo.PoolStats{
+		MaxConns:             int(stat.MaxConns()),
+		AcquiredConns:        int(stat.AcquiredConns()),
+		IdleConns:            int(stat.IdleConns()),
+		AcquireCount:         stat.AcquireCount(),
+		AcquireDuration:      stat.AcquireDuration(),
+		CanceledAcquireCount: stat.CanceledAcquireCount(),
+	}
+}
+
 func (s *PostgresStorage) Write(ctx context.Context, t zanzigo.Tuple) error {
-	_, err := s.pool.Exec(ctx, "INSERT INTO tuples (object_type, object_id, object_relation, subject_type, subject_id, subject_relation) values($1, $2, $3, $4, $5, $6)", t.ObjectType, t.ObjectID, t.ObjectRelation, t.SubjectType, t.SubjectID, t.SubjectRelation)
+	conditionName, conditionContext := "", map[string]any(nil)
+	if t.Condition != nil {
+		conditionName, conditionContext = t.Condition.Name, t.Condition.Context
+	}
+	_, err := s.pool.Exec(ctx, "INSERT INTO tuples (store_id, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, expires_at, condition_name, condition_context) values($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) ON CONFLICT (store_id, object_type, object_id, object_relation, subject_type, subject_id, subject_relation) DO UPDATE SET expires_at=EXCLUDED.expires_at, condition_name=EXCLUDED.condition_name, condition_context=EXCLUDED.condition_context", s.store, t.ObjectType, t.ObjectID, t.ObjectRelation, t.SubjectType, t.SubjectID, t.SubjectRelation, t.ExpiresAt, conditionName, conditionContext)
 	return err
 }
 
+// WriteBatch copies the tuples into a temporary table using COPY, which are then merged into the tuples in the same transaction.
+// This way existing tuples are updated like by Write, which is not supported by COPY itself.
+func (s *PostgresStorage) WriteBatch(ctx context.Context, tuples []zanzigo.Tuple) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "CREATE TEMPORARY TABLE tuples_import (seq BIGINT, object_type TEXT, object_id TEXT, object_relation TEXT, subject_type TEXT, subject_id TEXT, subject_relation TEXT, expires_at TIMESTAMPTZ, condition_name TEXT, condition_context JSONB) ON COMMIT DROP")
+		if err != nil {
+			return err
+		}
+		rows := make([][]any, 0, len(tuples))
+		for i, t := range tuples {
+			conditionName, conditionContext := "", map[string]any(nil)
+			if t.Condition != nil {
+				conditionName, conditionContext = t.Condition.Name, t.Condition.Context
+			}
+			rows = append(rows, []any{i, t.ObjectType, t.ObjectID, t.ObjectRelation, t.SubjectType, t.SubjectID, t.SubjectRelation, t.ExpiresAt, conditionName, conditionContext})
+		}
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"tuples_import"},
+			[]string{"seq", "object_type", "object_id", "object_relation", "subject_type", "subject_id", "subject_relation", "expires_at", "condition_name", "condition_context"},
+			pgx.CopyFromRows(rows))
+		if err != nil {
+			return err
+		}
+		// A row can only be updated once per statement, so only the last occurrence of a tuple is kept
+		_, err = tx.Exec(ctx, "INSERT INTO tuples (store_id, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, expires_at, condition_name, condition_context) SELECT DISTINCT ON (object_type, object_id, object_relation, subject_type, subject_id, subject_relation) $1::TEXT, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, expires_at, condition_name, condition_context FROM tuples_import ORDER BY object_type, object_id, object_relation, subject_type, subject_id, subject_relation, seq DESC ON CONFLICT (store_id, object_type, object_id, object_relation, subject_type, subject_id, subject_relation) DO UPDATE SET expires_at=EXCLUDED.expires_at, condition_name=EXCLUDED.condition_name, condition_context=EXCLUDED.condition_context", s.store)
+		return err
+	})
+}
+
 func (s *PostgresStorage) Read(ctx context.Context, t zanzigo.Tuple) (uuid.UUID, error) {
 	uuid := uuid.UUID{}
-	err := s.pool.QueryRow(ctx, "SELECT uuid FROM tuples WHERE object_type=$1 AND object_id=$2 AND object_relation=$3 AND subject_type=$4 AND subject_id=$5 AND subject_relation=$6", t.ObjectType, t.ObjectID, t.ObjectRelation, t.SubjectType, t.SubjectID, t.SubjectRelation).
+	err := s.pool.QueryRow(ctx, "SELECT uuid FROM tuples WHERE store_id=$1 AND object_type=$2 AND object_id=$3 AND object_relation=$4 AND subject_type=$5 AND subject_id=$6 AND subject_relation=$7 AND "+notExpired, s.store, t.ObjectType, t.ObjectID, t.ObjectRelation, t.SubjectType, t.SubjectID, t.SubjectRelation).
 		Scan(&uuid)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return uuid, zanzigo.ErrNotFound
@@ -100,13 +256,24 @@ func (s *PostgresStorage) Read(ctx context.Context, t zanzigo.Tuple) (uuid.UUID,
 	return uuid, err
 }
 
+func (s *PostgresStorage) Delete(ctx context.Context, t zanzigo.Tuple) error {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM tuples WHERE store_id=$1 AND object_type=$2 AND object_id=$3 AND object_relation=$4 AND subject_type=$5 AND subject_id=$6 AND subject_relation=$7", s.store, t.ObjectType, t.ObjectID, t.ObjectRelation, t.SubjectType, t.SubjectID, t.SubjectRelation)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return zanzigo.ErrNotFound
+	}
+	return nil
+}
+
 func (s *PostgresStorage) CursorStart() zanzigo.Cursor {
 	return uuid.Must(uuid.FromString("ffffffff-ffff-ffff-ffff-ffffffffffff")).Bytes()
 }
 
 func (s *PostgresStorage) List(ctx context.Context, t zanzigo.Tuple, p zanzigo.Pagination) ([]zanzigo.Tuple, zanzigo.Cursor, error) {
-	args := make([]any, 0, 8)
-	whereClauses := ""
+	args := []any{s.store}
+	whereClauses := "store_id=$1 AND "
 	if t.ObjectType != "" {
 		args = append(args, t.ObjectType)
 		whereClauses += "object_type=$" + strconv.Itoa(len(args)) + " AND "
@@ -137,12 +304,12 @@ func (s *PostgresStorage) List(ctx context.Context, t zanzigo.Tuple, p zanzigo.P
 		return nil, nil, err
 	}
 	args = append(args, cursor)
-	whereClauses += "uuid<$" + strconv.Itoa(len(args))
+	whereClauses += "uuid<$" + strconv.Itoa(len(args)) + " AND " + notExpired
 
 	args = append(args, p.Limit)
 	limit := "LIMIT $" + strconv.Itoa(len(args))
 
-	rows, err := s.pool.Query(ctx, "SELECT uuid, object_type, object_id, object_relation, subject_type, subject_id, subject_relation FROM tuples WHERE "+whereClauses+" ORDER BY uuid DESC "+limit, args...)
+	rows, err := s.pool.Query(ctx, "SELECT uuid, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, expires_at, condition_name, condition_context FROM tuples WHERE "+whereClauses+" ORDER BY uuid DESC "+limit, args...)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -152,10 +319,13 @@ func (s *PostgresStorage) List(ctx context.Context, t zanzigo.Tuple, p zanzigo.P
 
 	for rows.Next() {
 		var t zanzigo.Tuple
-		err := rows.Scan(&cursor, &t.ObjectType, &t.ObjectID, &t.ObjectRelation, &t.SubjectType, &t.SubjectID, &t.SubjectRelation)
+		var conditionName string
+		var conditionContext map[string]any
+		err := rows.Scan(&cursor, &t.ObjectType, &t.ObjectID, &t.ObjectRelation, &t.SubjectType, &t.SubjectID, &t.SubjectRelation, &t.ExpiresAt, &conditionName, &conditionContext)
 		if err != nil {
 			return nil, nil, err
 		}
+		t.Condition = toConditionRef(conditionName, conditionContext)
 		tuples = append(tuples, t)
 	}
 	if err := rows.Err(); err != nil {
@@ -166,14 +336,127 @@ func (s *PostgresStorage) List(ctx context.Context, t zanzigo.Tuple, p zanzigo.P
 	return tuples, cursor.Bytes(), nil
 }
 
+// Unconditional tuples are stored with an empty condition name.
+func toConditionRef(name string, context map[string]any) *zanzigo.ConditionRef {
+	if name == "" {
+		return nil
+	}
+	return &zanzigo.ConditionRef{Name: name, Context: context}
+}
+
+func (s *PostgresStorage) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM tuples WHERE expires_at IS NOT NULL AND expires_at <= $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (s *PostgresStorage) ForStore(id string) zanzigo.Storage {
+	return &PostgresStorage{s.pool, s.useFunctions, s.functionRetention, id}
+}
+
+func (s *PostgresStorage) CreateStore(ctx context.Context, store zanzigo.Store) error {
+	tag, err := s.pool.Exec(ctx, "INSERT INTO stores (id, model, created_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", store.ID, store.Model, store.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return zanzigo.ErrAlreadyExists
+	}
+	return nil
+}
+
+func (s *PostgresStorage) ListStores(ctx context.Context) ([]zanzigo.Store, error) {
+	rows, err := s.pool.Query(ctx, "SELECT id, model, created_at FROM stores ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stores := []zanzigo.Store{}
+	for rows.Next() {
+		store := zanzigo.Store{}
+		if err := rows.Scan(&store.ID, &store.Model, &store.CreatedAt); err != nil {
+			return nil, err
+		}
+		stores = append(stores, store)
+	}
+	return stores, rows.Err()
+}
+
+func (s *PostgresStorage) DeleteStore(ctx context.Context, id string) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "DELETE FROM stores WHERE id=$1", id)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return zanzigo.ErrNotFound
+		}
+		_, err = tx.Exec(ctx, "DELETE FROM tuples WHERE store_id=$1", id)
+		if err != nil {
+			return err
+		}
+		return dropFunctions(ctx, tx, "store_id=$1", id)
+	})
+}
+
 func (s *PostgresStorage) PrepareRuleset(object, relation string, ruleset []zanzigo.InferredRule) (zanzigo.Userdata, error) {
-	if !s.useFunctions {
-		return SelectQueryFor(ruleset, true, "$%d")
+	return s.prepareRuleset("", object, relation, ruleset)
+}
+
+// PrepareModel prepares all rulesets of the model. With functions, the functions of every revision of the model get their own names,
+// so preparing a changed model does not change the functions used by resolvers of the previous model, e.g. while the model is reloaded.
+// Functions of other revisions of the model of the store, which were not prepared within the retention (see [WithFunctionRetention]), are dropped.
+// Instances still using them fall back to queries. All functions of a store are dropped by DeleteStore.
+func (s *PostgresStorage) PrepareModel(rules zanzigo.InferredRuleMap) (zanzigo.UserdataMap, error) {
+	revision := ""
+	if s.useFunctions {
+		data, err := json.Marshal(rules)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		revision = hex.EncodeToString(sum[:4])
 	}
-	return s.createOrReplaceFunctionFor(object, relation, ruleset)
+	userdata := zanzigo.UserdataMap{}
+	for object, relations := range rules {
+		userdata[object] = map[string]zanzigo.Userdata{}
+		for relation, ruleset := range relations {
+			var err error
+			userdata[object][relation], err = s.prepareRuleset(revision, object, relation, ruleset)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if s.useFunctions {
+		ctx := context.Background()
+		err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+			return dropFunctions(ctx, tx, "store_id=$1 AND revision<>$2 AND prepared_at < CURRENT_TIMESTAMP - $3 * INTERVAL '1 second'",
+				s.store, revision, s.functionRetention.Seconds())
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return userdata, nil
+}
+
+func (s *PostgresStorage) prepareRuleset(revision, object, relation string, ruleset []zanzigo.InferredRule) (zanzigo.Userdata, error) {
+	query, err := SelectQueryFor(DialectPostgres, s.store, ruleset, true, "$%d")
+	if err != nil || !s.useFunctions {
+		return query, err
+	}
+	function, err := s.createOrReplaceFunctionFor(revision, object, relation, ruleset)
+	return functionUserdata{query, function}, err
 }
 
-func (s *PostgresStorage) QueryChecks(ctx context.Context, crs []zanzigo.Check) ([]zanzigo.MarkedTuple, error) {
+func (s *PostgresStorage) QueryChecks(ctx context.Context, crs []zanzigo.Check) (_ []zanzigo.MarkedTuple, err error) {
+	ctx, span := tracing.StartQueryChecks(ctx, "postgresql", len(crs))
+	defer func() { tracing.End(span, err) }()
+
 	if !s.useFunctions {
 		return s.queryChecksWithQuery(ctx, crs)
 	}
@@ -193,10 +476,7 @@ func (s *PostgresStorage) queryChecksWithQuery(ctx context.Context, checks []zan
 
 	// We iterate over all check and combine all the queries
 	for i, check := range checks {
-		query, ok := check.Userdata.(string)
-		if !ok {
-			panic("malformed query data")
-		}
+		query := selectQueryOf(check.Userdata)
 		for _, rule := range check.Ruleset {
 			switch rule.Kind { // NEEDS TO BE IN SYNC WITH `NewPostgresCheckQuery`
 			case zanzigo.KindDirect:
@@ -211,12 +491,13 @@ func (s *PostgresStorage) queryChecksWithQuery(ctx context.Context, checks []zan
 		}
 		// Every ruleset always contains a direct relationship, so we can safely add all values
 		args = append(args, check.Tuple.ObjectID, check.Tuple.SubjectType, check.Tuple.SubjectID, check.Tuple.SubjectRelation)
-		queries = append(queries, fmt.Sprintf("SELECT %d AS check_index", i)+", rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation FROM ("+query+fmt.Sprintf(") AS cr%d", i))
+		queries = append(queries, fmt.Sprintf("SELECT %d AS check_index", i)+", rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, condition_name, condition_context FROM ("+query+fmt.Sprintf(") AS cr%d", i))
 		argNum += 4
 	}
 
 	// We append the query and replace all the $%d with the proper placeholder numbers corresponding to args
 	fullQuery := fmt.Sprintf(strings.Join(queries, " UNION ALL ")+" ORDER BY rule_index", placesholders...)
+	tracing.SetFingerprint(ctx, fullQuery)
 
 	// Let's fetch all the rows
 	rows, err := s.pool.Query(ctx, fullQuery, args...)
@@ -226,10 +507,13 @@ func (s *PostgresStorage) queryChecksWithQuery(ctx context.Context, checks []zan
 	tuples := []zanzigo.MarkedTuple{}
 	for rows.Next() {
 		t := zanzigo.MarkedTuple{}
-		err := rows.Scan(&t.CheckIndex, &t.RuleIndex, &t.ObjectType, &t.ObjectID, &t.ObjectRelation, &t.SubjectType, &t.SubjectID, &t.SubjectRelation)
+		var conditionName string
+		var conditionContext map[string]any
+		err := rows.Scan(&t.CheckIndex, &t.RuleIndex, &t.ObjectType, &t.ObjectID, &t.ObjectRelation, &t.SubjectType, &t.SubjectID, &t.SubjectRelation, &conditionName, &conditionContext)
 		if err != nil {
 			return nil, err
 		}
+		t.Condition = toConditionRef(conditionName, conditionContext)
 		tuples = append(tuples, t)
 	}
 	return tuples, nil
@@ -239,33 +523,87 @@ func (s *PostgresStorage) queryChecksWithQuery(ctx context.Context, checks []zan
 // FUNCTION-BASED IMPLEMENTATION
 ///////////////////////////////////////////////////////////////////////////////
 
+// Userdata of rulesets in functions mode, the query is used whenever the resolver has to traverse the tuples itself.
+type functionUserdata struct {
+	query    string
+	function string
+}
+
+func selectQueryOf(userdata zanzigo.Userdata) string {
+	switch userdata := userdata.(type) {
+	case string:
+		return userdata
+	case functionUserdata:
+		return userdata.query
+	default:
+		panic("malformed query data")
+	}
+}
+
+// queryChecksWithFunction resolves a single check within the database. Contextual tuples have to be merged by the resolver,
+// as do the subsequent checks of several tuples, e.g. resulting from contextual tuples, so those are queried like without functions.
+// If the function encountered conditional tuples without granting access otherwise, the tuples are returned as well,
+// so the resolver can evaluate the conditions.
 func (s *PostgresStorage) queryChecksWithFunction(ctx context.Context, checks []zanzigo.Check) ([]zanzigo.MarkedTuple, error) {
-	if len(checks) != 1 {
-		panic("unreachable")
+	if len(checks) != 1 || checks[0].Contextual {
+		return s.queryChecksWithQuery(ctx, checks)
 	}
 	check := checks[0]
-	query, ok := check.Userdata.(string)
+	userdata, ok := check.Userdata.(functionUserdata)
 	if !ok {
 		panic("malformed query data")
 	}
-	result := false
-	err := s.pool.QueryRow(ctx, query, check.Tuple.ObjectID, check.Tuple.SubjectType, check.Tuple.SubjectID, check.Tuple.SubjectRelation).Scan(&result)
+	tracing.SetFingerprint(ctx, userdata.function)
+	var result *bool
+	err := s.pool.QueryRow(ctx, userdata.function, check.Tuple.ObjectID, check.Tuple.SubjectType, check.Tuple.SubjectID, check.Tuple.SubjectRelation).Scan(&result)
+	// The functions of a revision no longer prepared by other instances might have been dropped (undefined_function)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "42883" {
+		return s.queryChecksWithQuery(ctx, checks)
+	}
 	if err != nil {
 		return nil, err
 	}
-	if !result {
+	if result == nil {
+		return s.queryChecksWithQuery(ctx, checks)
+	}
+	if !*result {
 		return nil, nil
 	}
 
 	return []zanzigo.MarkedTuple{{CheckIndex: 0, RuleIndex: 0, Tuple: check.Tuple}}, nil
 }
 
-func (s *PostgresStorage) createOrReplaceFunctionFor(object, relation string, ruleset []zanzigo.InferredRule) (string, error) {
-	funcDecl, query, err := FunctionFor(fmt.Sprintf("zanzigo_%s_%s", object, relation), ruleset)
+func (s *PostgresStorage) createOrReplaceFunctionFor(revision, object, relation string, ruleset []zanzigo.InferredRule) (string, error) {
+	funcDecl, query, err := FunctionFor(s.store, revision, object, relation, ruleset)
 	if err != nil {
 		return "", err
 	}
 
-	_, err = s.pool.Exec(context.Background(), funcDecl)
+	ctx := context.Background()
+	if _, err = s.pool.Exec(ctx, funcDecl); err != nil {
+		return "", err
+	}
+	// Functions are recorded, so they can be dropped once their revision is no longer prepared
+	_, err = s.pool.Exec(ctx, "INSERT INTO functions (name, store_id, revision) VALUES ($1, $2, $3) ON CONFLICT (name) DO UPDATE SET prepared_at=CURRENT_TIMESTAMP",
+		FunctionName(s.store, revision, object, relation), s.store, revision)
 	return query, err
 }
+
+// dropFunctions drops the recorded functions matching the condition.
+func dropFunctions(ctx context.Context, tx pgx.Tx, condition string, args ...any) error {
+	rows, err := tx.Query(ctx, "DELETE FROM functions WHERE "+condition+" RETURNING name", args...)
+	if err != nil {
+		return err
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err := tx.Exec(ctx, "DROP FUNCTION IF EXISTS "+pgx.Identifier{name}.Sanitize()+"(TEXT, TEXT, TEXT, TEXT)"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/trevex/zanzigo"
 	testsuite "github.com/trevex/zanzigo/storage"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
@@ -131,6 +132,115 @@ func TestPostgresWithTestSuite(t *testing.T) {
 	})
 }
 
+func TestPostgresFunctionRevisions(t *testing.T) {
+	ctx := context.Background()
+	storageFunctions, err := NewPostgresStorage(databaseURL, UseFunctions())
+	require.NoError(t, err)
+	defer storageFunctions.Close()
+
+	tuple := zanzigo.TupleString("doc:mydoc#viewer@user:myuser")
+	previous, err := zanzigo.NewResolver(testsuite.Model, storageFunctions, 16)
+	require.NoError(t, err)
+	allowed, err := previous.Check(ctx, tuple)
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	// Viewers of the folder no longer view its documents, which does not affect the functions of the previous model
+	model, err := zanzigo.NewModel(zanzigo.ObjectMap{
+		"user":   zanzigo.RelationMap{},
+		"group":  zanzigo.RelationMap{"member": zanzigo.Rule{}},
+		"folder": zanzigo.RelationMap{"viewer": zanzigo.Rule{}},
+		"doc":    zanzigo.RelationMap{"parent": zanzigo.Rule{}, "viewer": zanzigo.Rule{}},
+	})
+	require.NoError(t, err)
+	current, err := zanzigo.NewResolver(model, storageFunctions, 16)
+	require.NoError(t, err)
+	allowed, err = current.Check(ctx, tuple)
+	require.NoError(t, err)
+	require.False(t, allowed)
+	allowed, err = previous.Check(ctx, tuple)
+	require.NoError(t, err)
+	require.True(t, allowed)
+}
+
+func TestPostgresFunctionCleanup(t *testing.T) {
+	ctx := context.Background()
+	storageFunctions, err := NewPostgresStorage(databaseURL, UseFunctions(), WithFunctionRetention(0))
+	require.NoError(t, err)
+	defer storageFunctions.Close()
+	require.NoError(t, storageFunctions.CreateStore(ctx, zanzigo.Store{ID: "cleanup", CreatedAt: time.Now()}))
+	scoped := storageFunctions.ForStore("cleanup")
+	// Counts the recorded functions of the store, which still exist
+	functions := func() int {
+		var count int
+		require.NoError(t, storageFunctions.pool.QueryRow(ctx, "SELECT COUNT(*) FROM functions JOIN pg_proc ON proname=name WHERE store_id='cleanup'").Scan(&count))
+		return count
+	}
+
+	tuple := zanzigo.TupleString("doc:mydoc#viewer@user:myuser")
+	require.NoError(t, scoped.Write(ctx, tuple))
+	previous, err := zanzigo.NewResolver(testsuite.Model, scoped, 16)
+	require.NoError(t, err)
+	relations := 0
+	for _, rulesets := range testsuite.Model.InferredRules {
+		relations += len(rulesets)
+	}
+	require.Equal(t, relations, functions())
+
+	// Preparing another revision drops the functions of the previous revision, which falls back to queries
+	model, err := zanzigo.NewModel(zanzigo.ObjectMap{
+		"user": zanzigo.RelationMap{},
+		"doc":  zanzigo.RelationMap{"viewer": zanzigo.Rule{}},
+	})
+	require.NoError(t, err)
+	_, err = zanzigo.NewResolver(model, scoped, 16)
+	require.NoError(t, err)
+	require.Equal(t, 1, functions())
+	allowed, err := previous.Check(ctx, tuple)
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	// Deleting the store drops all of its functions
+	require.NoError(t, storageFunctions.DeleteStore(ctx, "cleanup"))
+	require.Equal(t, 0, functions())
+}
+
+func TestPostgresOptions(t *testing.T) {
+	ctx := context.Background()
+	hooked := false
+	s, err := NewPostgresStorage(databaseURL, WithMaxConns(2), WithMinConns(1), WithStatementTimeout(100*time.Millisecond), WithApplicationName("zanzigo-test"),
+		WithPoolConfig(func(config *pgxpool.Config) error {
+			hooked = true
+			require.Equal(t, "zanzigo-test", config.ConnConfig.RuntimeParams["application_name"])
+			return nil
+		}))
+	require.NoError(t, err)
+	defer s.Close()
+	require.True(t, hooked)
+	require.Equal(t, 2, s.PoolStats().MaxConns)
+
+	var name string
+	require.NoError(t, s.pool.QueryRow(ctx, "SHOW application_name").Scan(&name))
+	require.Equal(t, "zanzigo-test", name)
+	_, err = s.pool.Exec(ctx, "SELECT pg_sleep(1)")
+	require.ErrorContains(t, err, "statement timeout")
+	require.NoError(t, s.Ping(ctx))
+
+	_, err = NewPostgresStorage(databaseURL, WithMaxConns(1), WithMinConns(2))
+	require.ErrorContains(t, err, "min connections (2) exceed max connections (1)")
+
+	// Existing pools register the types themselves
+	config, err := pgxpool.ParseConfig(databaseURL)
+	require.NoError(t, err)
+	config.AfterConnect = RegisterTypes
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	fromPool := NewPostgresStorageFromPool(pool)
+	defer fromPool.Close()
+	_, err = fromPool.Read(ctx, zanzigo.TupleString("doc:mydoc#parent@folder:myfolder"))
+	require.NoError(t, err)
+}
+
 func BenchmarkPostgres(b *testing.B) {
 	storageFunctions, err := NewPostgresStorage(databaseURL, UseFunctions())
 	require.NoError(b, err)
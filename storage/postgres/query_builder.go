@@ -2,6 +2,8 @@ package postgres
 
 import (
 	"bytes"
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
 	"strings"
 	"text/template"
@@ -20,6 +22,14 @@ var (
 {{- $KindIndirect := .KindIndirect -}}
 {{- $Brackets := .Brackets -}}
 
+{{- define "store" -}}
+	store_id='{{ . }}' AND
+{{- end -}}
+
+{{- define "notExpired" -}}
+	AND (expires_at IS NULL OR expires_at > {{ . }})
+{{- end -}}
+
 {{- define "relations" -}}
 {{- range $i, $relation := . -}}
 	{{- if $i }} OR {{ end -}}object_relation='{{ $relation }}'
@@ -30,32 +40,62 @@ var (
 	{{ if $id }}UNION ALL{{ end }}
 	{{ if $Brackets }}({{ end -}}
 	{{- if eq $rule.Kind $KindDirect -}}
-	    SELECT {{ $id }} AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation FROM tuples
-		 WHERE object_type='{{ $rule.Object }}'
+	    SELECT {{ $id }} AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, condition_name, condition_context FROM tuples
+		 WHERE {{ template "store" $.Store }} object_type='{{ $rule.Object }}'
 		 AND object_id={{ $p0 }}
 		 AND ({{- template "relations" $rule.Relations -}})
 		 AND subject_type={{ $p1 }}
 		 AND subject_id={{ $p2 }}
 		 AND subject_relation={{ $p3 }}
+		 {{ template "notExpired" $.Now }}
 	{{- else if eq $rule.Kind $KindDirectUserset -}}
-		SELECT {{ $id }} AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation FROM tuples
-		 WHERE object_type='{{ $rule.Object }}'
+		SELECT {{ $id }} AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, condition_name, condition_context FROM tuples
+		 WHERE {{ template "store" $.Store }} object_type='{{ $rule.Object }}'
 		 AND object_id={{ $p0 }}
 		 AND ({{- template "relations" $rule.Relations -}})
 		 AND subject_relation <> ''
+		 {{ template "notExpired" $.Now }}
 	{{- else if eq $rule.Kind $KindIndirect -}}
-		SELECT {{ $id }} AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation FROM tuples
-		 WHERE object_type='{{ $rule.Object }}'
+		SELECT {{ $id }} AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, condition_name, condition_context FROM tuples
+		 WHERE {{ template "store" $.Store }} object_type='{{ $rule.Object }}'
 		 AND object_id={{ $p0 }}
 		 AND ({{- template "relations" $rule.Relations -}})
 		 AND subject_type='{{ $rule.Subject }}'
+		 {{ template "notExpired" $.Now }}
 	{{- end -}}
 	{{- if $Brackets }}){{ end -}}
 {{- end }}
 	`))
 )
 
-func SelectQueryFor(ruleset []zanzigo.InferredRule, brackets bool, placeholders ...string) (string, error) {
+// Dialect adapts the queries built by [SelectQueryFor] to the database.
+type Dialect int
+
+const (
+	DialectPostgres Dialect = iota
+	DialectSQLite
+	// MySQL evaluates CURRENT_TIMESTAMP in the time zone of the session, so UTC_TIMESTAMP is used instead.
+	DialectMySQL
+)
+
+// Now returns the expression evaluating to the current time in UTC, which expirations are stored in.
+// SQLite stores expirations as text with milliseconds, while its CURRENT_TIMESTAMP only has a precision of seconds.
+func (d Dialect) Now() string {
+	switch d {
+	case DialectMySQL:
+		return "UTC_TIMESTAMP(6)"
+	case DialectSQLite:
+		return "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+	}
+	return "CURRENT_TIMESTAMP"
+}
+
+// SelectQueryFor returns the query selecting all tuples of the store relevant for the ruleset.
+// The store ID is embedded into the query, so it is validated first.
+func SelectQueryFor(dialect Dialect, store string, ruleset []zanzigo.InferredRule, brackets bool, placeholders ...string) (string, error) {
+	if err := zanzigo.ValidateStoreID(store); err != nil {
+		return "", err
+	}
 	if len(placeholders) == 1 {
 		placeholders = []string{placeholders[0], placeholders[0], placeholders[0], placeholders[0]}
 	}
@@ -65,6 +105,8 @@ func SelectQueryFor(ruleset []zanzigo.InferredRule, brackets bool, placeholders
 
 	var out bytes.Buffer
 	err := selectQueryTmpl.Execute(&out, map[string]any{
+		"Store":             store,
+		"Now":               dialect.Now(),
 		"Ruleset":           ruleset,
 		"Placeholders":      placeholders,
 		"Brackets":          brackets,
@@ -86,45 +128,79 @@ CREATE OR REPLACE FUNCTION {{ .FuncName }}(TEXT, TEXT, TEXT, TEXT) RETURNS BOOLE
 DECLARE
 mt RECORD;
 result BOOLEAN;
+conditional BOOLEAN := FALSE;
 BEGIN
 FOR mt IN
 {{ .SelectQuery }} ORDER BY rule_index
 LOOP
+	{{- /* Conditions can only be evaluated by the resolver, so NULL is returned if conditional tuples might grant access */}}
+	IF mt.condition_name <> '' THEN
+		conditional := TRUE;
+		CONTINUE;
+	END IF;
 {{- range  $id, $rule := .Ruleset }}
 	{{ if $id }}ELSIF{{ else }}IF{{ end }} mt.rule_index = {{ $id }} THEN
 	{{ if eq $rule.Kind $KindDirect }}
 		RETURN TRUE;
 	{{ else if eq $rule.Kind $KindDirectUserset }}
-		EXECUTE FORMAT('SELECT zanzigo_%s_%s($1, $2, $3, $4)', mt.subject_type, mt.subject_relation) USING mt.subject_id, $2, $3, $4 INTO result;
+		EXECUTE FORMAT('SELECT zanzigo_%s($1, $2, $3, $4)', md5('{{ $.FuncPrefix }}' || mt.subject_type || '#' || mt.subject_relation)) USING mt.subject_id, $2, $3, $4 INTO result;
 		IF result = TRUE THEN
 			RETURN TRUE;
+		ELSIF result IS NULL THEN
+			conditional := TRUE;
 		END IF;
 	{{ else if eq $rule.Kind $KindIndirect }}
 		{{- range $rule.WithRelationToSubject }}
-		SELECT zanzigo_{{ $rule.Subject }}_{{ . }}(mt.subject_id, $2, $3, $4) INTO result;
+		SELECT {{ call $.FuncNameOf $rule.Subject . }}(mt.subject_id, $2, $3, $4) INTO result;
 		IF result = TRUE THEN
 			RETURN TRUE;
+		ELSIF result IS NULL THEN
+			conditional := TRUE;
 		END IF;
 		{{- end }}
 	{{ end }}
 {{- end }}
 	END IF;
 END LOOP;
+IF conditional THEN
+	RETURN NULL;
+END IF;
 RETURN FALSE;
 END;
 $$;`))
 )
 
+// FunctionName returns the name of the function checking the relation of the object for the revision of the model of the store.
+// The name is derived from a hash, as Postgres silently truncates identifiers longer than 63 bytes,
+// so functions of different stores or relations could otherwise share a name and overwrite each other.
+// Functions dispatching to the functions of usersets compute the same name using md5 of Postgres.
+func FunctionName(store, revision, object, relation string) string {
+	sum := md5.Sum([]byte(functionNamePrefix(store, revision) + object + "#" + relation))
+	return "zanzigo_" + hex.EncodeToString(sum[:])
+}
+
+func functionNamePrefix(store, revision string) string {
+	return store + ":" + revision + ":"
+}
+
+// FunctionFor returns the declaration and the query calling the function checking the relation of the object.
+// Functions of different stores and revisions of the model of a store are separated by their names, see [FunctionName].
 // TODO: respect maxDepth!
-func FunctionFor(funcName string, ruleset []zanzigo.InferredRule) (string, string, error) {
-	innerSelect, err := SelectQueryFor(ruleset, true, "$1", "$2", "$3", "$4")
+func FunctionFor(store, revision, object, relation string, ruleset []zanzigo.InferredRule) (string, string, error) {
+	innerSelect, err := SelectQueryFor(DialectPostgres, store, ruleset, true, "$1", "$2", "$3", "$4")
 	if err != nil {
 		return "", "", err
 	}
+	funcNameOf := func(object, relation string) string {
+		return FunctionName(store, revision, object, relation)
+	}
+	funcName := funcNameOf(object, relation)
 
 	var out bytes.Buffer
 	err = functionTmpl.Execute(&out, map[string]any{
 		"FuncName":          funcName,
+		"FuncPrefix":        functionNamePrefix(store, revision),
+		"FuncNameOf":        funcNameOf,
 		"SelectQuery":       innerSelect,
 		"Ruleset":           ruleset,
 		"KindDirect":        zanzigo.KindDirect,
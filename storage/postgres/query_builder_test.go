@@ -1,6 +1,8 @@
 package postgres
 
 import (
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/trevex/zanzigo"
@@ -14,14 +16,14 @@ func TestPostgresSelectQueryFor(t *testing.T) {
 	require.NoError(t, err)
 
 	ruleset := resolver.RulesetFor("doc", "viewer")
-	query, err := SelectQueryFor(ruleset, true, "$%d")
+	query, err := SelectQueryFor(DialectPostgres, zanzigo.DefaultStore, ruleset, true, "$%d")
 	require.NoError(t, err)
 	expectedQuery := standardizeSpaces(`
-		(SELECT 0 AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation FROM tuples WHERE object_type='doc' AND object_id=$%d AND (object_relation='editor' OR object_relation='owner' OR object_relation='viewer') AND subject_type=$%d AND subject_id=$%d AND subject_relation=$%d)
+		(SELECT 0 AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, condition_name, condition_context FROM tuples WHERE store_id='default' AND object_type='doc' AND object_id=$%d AND (object_relation='editor' OR object_relation='owner' OR object_relation='viewer') AND subject_type=$%d AND subject_id=$%d AND subject_relation=$%d AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP))
 		UNION ALL
-		(SELECT 1 AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation FROM tuples WHERE object_type='doc' AND object_id=$%d AND (object_relation='editor' OR object_relation='owner' OR object_relation='viewer') AND subject_relation <> '')
+		(SELECT 1 AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, condition_name, condition_context FROM tuples WHERE store_id='default' AND object_type='doc' AND object_id=$%d AND (object_relation='editor' OR object_relation='owner' OR object_relation='viewer') AND subject_relation <> '' AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP))
 		UNION ALL
-		(SELECT 2 AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation FROM tuples WHERE object_type='doc' AND object_id=$%d AND (object_relation='parent') AND subject_type='folder')
+		(SELECT 2 AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, condition_name, condition_context FROM tuples WHERE store_id='default' AND object_type='doc' AND object_id=$%d AND (object_relation='parent') AND subject_type='folder' AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP))
 	`)
 	require.Equal(t, expectedQuery, query)
 }
@@ -36,54 +38,113 @@ func TestPostgresFunctionFor(t *testing.T) {
 
 	ruleset := resolver.RulesetFor("doc", "viewer")
 
-	decl, query, err := FunctionFor("zanzigo_doc_viewer", ruleset)
+	decl, query, err := FunctionFor(zanzigo.DefaultStore, "", "doc", "viewer", ruleset)
 	require.NoError(t, err)
-	expectedQuery := `SELECT zanzigo_doc_viewer($1, $2, $3, $4)`
+	expectedQuery := `SELECT zanzigo_ea9c38aa275b900db3c1dc7ae97070af($1, $2, $3, $4)`
 	decl = standardizeSpaces(decl)
 	expectedDecl := standardizeSpaces(`
-CREATE OR REPLACE FUNCTION zanzigo_doc_viewer(TEXT, TEXT, TEXT, TEXT) RETURNS BOOLEAN LANGUAGE 'plpgsql' AS $$
+CREATE OR REPLACE FUNCTION zanzigo_ea9c38aa275b900db3c1dc7ae97070af(TEXT, TEXT, TEXT, TEXT) RETURNS BOOLEAN LANGUAGE 'plpgsql' AS $$
 DECLARE
 	mt RECORD;
 	result BOOLEAN;
+	conditional BOOLEAN := FALSE;
 BEGIN
 	FOR mt IN
-		(SELECT 0 AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation FROM tuples WHERE object_type='doc' AND object_id=$1 AND (object_relation='editor' OR object_relation='owner' OR object_relation='viewer') AND subject_type=$2 AND subject_id=$3 AND subject_relation=$4)
+		(SELECT 0 AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, condition_name, condition_context FROM tuples WHERE store_id='default' AND object_type='doc' AND object_id=$1 AND (object_relation='editor' OR object_relation='owner' OR object_relation='viewer') AND subject_type=$2 AND subject_id=$3 AND subject_relation=$4 AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP))
 		UNION ALL
-		(SELECT 1 AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation FROM tuples WHERE object_type='doc' AND object_id=$1 AND (object_relation='editor' OR object_relation='owner' OR object_relation='viewer') AND subject_relation <> '')
+		(SELECT 1 AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, condition_name, condition_context FROM tuples WHERE store_id='default' AND object_type='doc' AND object_id=$1 AND (object_relation='editor' OR object_relation='owner' OR object_relation='viewer') AND subject_relation <> '' AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP))
 		UNION ALL
-		(SELECT 2 AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation FROM tuples WHERE object_type='doc' AND object_id=$1 AND (object_relation='parent') AND subject_type='folder') ORDER BY rule_index
+		(SELECT 2 AS rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, condition_name, condition_context FROM tuples WHERE store_id='default' AND object_type='doc' AND object_id=$1 AND (object_relation='parent') AND subject_type='folder' AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)) ORDER BY rule_index
 	LOOP
+		IF mt.condition_name <> '' THEN
+			conditional := TRUE;
+			CONTINUE;
+		END IF;
 		IF mt.rule_index = 0 THEN
 			RETURN TRUE;
 		ELSIF mt.rule_index = 1 THEN
-			EXECUTE FORMAT('SELECT zanzigo_%s_%s($1, $2, $3, $4)', mt.subject_type, mt.subject_relation) USING mt.subject_id, $2, $3, $4 INTO result;
+			EXECUTE FORMAT('SELECT zanzigo_%s($1, $2, $3, $4)', md5('default::' || mt.subject_type || '#' || mt.subject_relation)) USING mt.subject_id, $2, $3, $4 INTO result;
 			IF result = TRUE THEN
 				RETURN TRUE;
+			ELSIF result IS NULL THEN
+				conditional := TRUE;
 			END IF;
 		ELSIF mt.rule_index = 2 THEN
-			SELECT zanzigo_folder_editor(mt.subject_id, $2, $3, $4) INTO result;
+			SELECT zanzigo_f93b59a78471a7746074fa316d233eb3(mt.subject_id, $2, $3, $4) INTO result;
 			IF result = TRUE THEN
 				RETURN TRUE;
+			ELSIF result IS NULL THEN
+				conditional := TRUE;
 			END IF;
-			SELECT zanzigo_folder_owner(mt.subject_id, $2, $3, $4) INTO result;
+			SELECT zanzigo_3857f42acf1bfc23ac9ee4d64b056a87(mt.subject_id, $2, $3, $4) INTO result;
 			IF result = TRUE THEN
 				RETURN TRUE;
+			ELSIF result IS NULL THEN
+				conditional := TRUE;
 			END IF;
-			SELECT zanzigo_folder_viewer(mt.subject_id, $2, $3, $4) INTO result;
+			SELECT zanzigo_b6a876810ab214727f957917de0df4e7(mt.subject_id, $2, $3, $4) INTO result;
 			IF result = TRUE THEN
 				RETURN TRUE;
+			ELSIF result IS NULL THEN
+				conditional := TRUE;
 			END IF;
 		END IF;
 	END LOOP;
+	IF conditional THEN
+		RETURN NULL;
+	END IF;
 	RETURN FALSE;
 END;
 $$;`)
 	require.Equal(t, expectedDecl, decl)
 	require.Equal(t, expectedQuery, query)
 
-	_, err = storageFunctions.createOrReplaceFunctionFor("doc", "viewer", ruleset)
+	_, err = storageFunctions.createOrReplaceFunctionFor("", "doc", "viewer", ruleset)
 	if err != nil {
 		t.Fatalf("Expected function to be created, but failed with: %v", err)
 	}
 
 }
+
+func TestPostgresFunctionName(t *testing.T) {
+	store := "store_with_the_longest_valid_id_"
+	require.NoError(t, zanzigo.ValidateStoreID(store))
+	long := strings.Repeat("relation", 8)
+
+	// Names fit into the identifiers of Postgres and differ even if the names of the relations would be truncated
+	name := FunctionName(store, "0123abcd", "document", long+"_viewer")
+	require.LessOrEqual(t, len(name), 63)
+	require.NotEqual(t, name, FunctionName(store, "0123abcd", "document", long+"_editor"))
+	require.NotEqual(t, name, FunctionName(store+"2", "0123abcd", "document", long+"_viewer"))
+	require.NotEqual(t, name, FunctionName(store, "", "document", long+"_viewer"))
+	// Separators prevent names of different objects and relations from colliding
+	require.NotEqual(t, FunctionName(store, "", "doc_a", "viewer"), FunctionName(store, "", "doc", "a_viewer"))
+
+	// Functions with long names are created and called using their bounded names
+	ctx := context.Background()
+	require.NoError(t, storage.CreateStore(ctx, zanzigo.Store{ID: store}))
+	defer func() { require.NoError(t, storage.DeleteStore(ctx, store)) }()
+	storageFunctions, err := NewPostgresStorage(databaseURL, UseFunctions())
+	require.NoError(t, err)
+	defer storageFunctions.Close()
+	scoped := storageFunctions.ForStore(store)
+	model, err := zanzigo.NewModel(zanzigo.ObjectMap{
+		"user":  zanzigo.RelationMap{},
+		"group": zanzigo.RelationMap{long + "_member": zanzigo.Rule{}},
+		"document": zanzigo.RelationMap{
+			long + "_editor": zanzigo.Rule{},
+			long + "_viewer": zanzigo.Rule{InheritIf: long + "_editor"},
+		},
+	})
+	require.NoError(t, err)
+	resolver, err := zanzigo.NewResolver(model, scoped, 16)
+	require.NoError(t, err)
+	require.NoError(t, scoped.Write(ctx, zanzigo.Tuple{ObjectType: "document", ObjectID: "readme", ObjectRelation: long + "_editor", SubjectType: "group", SubjectID: "eng", SubjectRelation: long + "_member"}))
+	require.NoError(t, scoped.Write(ctx, zanzigo.Tuple{ObjectType: "group", ObjectID: "eng", ObjectRelation: long + "_member", SubjectType: "user", SubjectID: "alice"}))
+	allowed, err := resolver.Check(ctx, zanzigo.Tuple{ObjectType: "document", ObjectID: "readme", ObjectRelation: long + "_viewer", SubjectType: "user", SubjectID: "alice"})
+	require.NoError(t, err)
+	require.True(t, allowed)
+	allowed, err = resolver.Check(ctx, zanzigo.Tuple{ObjectType: "document", ObjectID: "readme", ObjectRelation: long + "_viewer", SubjectType: "user", SubjectID: "bob"})
+	require.NoError(t, err)
+	require.False(t, allowed)
+}
@@ -0,0 +1,5 @@
+-- Expirations are stored as UTC text using the format of CURRENT_TIMESTAMP (with milliseconds),
+-- so they can be compared lexicographically.
+ALTER TABLE tuples ADD COLUMN expires_at TEXT;
+
+CREATE INDEX idx_tuples_partial_for_expiration ON tuples (expires_at) WHERE expires_at IS NOT NULL;
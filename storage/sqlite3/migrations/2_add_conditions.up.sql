@@ -0,0 +1,4 @@
+-- Conditional tuples reference a condition of the model by name, which is empty for unconditional tuples.
+-- The context is stored as JSON.
+ALTER TABLE tuples ADD COLUMN condition_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE tuples ADD COLUMN condition_context TEXT;
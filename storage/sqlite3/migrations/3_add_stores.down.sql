@@ -0,0 +1,29 @@
+CREATE TABLE tuples_without_store (
+    uuid TEXT NOT NULL,
+    object_type TEXT NOT NULL,
+    object_id TEXT NOT NULL,
+    object_relation TEXT NOT NULL,
+    subject_type TEXT NOT NULL,
+    subject_id TEXT NOT NULL,
+    subject_relation TEXT NOT NULL,
+    expires_at TEXT,
+    condition_name TEXT NOT NULL DEFAULT '',
+    condition_context TEXT,
+    PRIMARY KEY (object_type, object_id, object_relation, subject_type, subject_id, subject_relation)
+);
+INSERT INTO tuples_without_store (uuid, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, expires_at, condition_name, condition_context)
+    SELECT uuid, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, expires_at, condition_name, condition_context FROM tuples WHERE store_id = 'default';
+DROP TABLE tuples;
+ALTER TABLE tuples_without_store RENAME TO tuples;
+
+CREATE INDEX idx_tuple ON tuples (object_type, object_id, object_relation, subject_type, subject_id, subject_relation);
+CREATE INDEX idx_tuples_partial_for_usersets ON tuples (object_type, object_id, object_relation) WHERE subject_relation <> '';
+CREATE INDEX idx_tuples_partial_for_indirect ON tuples (object_type, object_id, subject_type);
+CREATE UNIQUE INDEX idx_tuples_uuid ON tuples (uuid);
+CREATE INDEX idx_tuples_partial_for_list_obj ON tuples (object_type, object_id);
+CREATE INDEX idx_tuples_partial_for_list_obj_rel ON tuples (object_type, object_id, object_relation);
+CREATE INDEX idx_tuples_partial_for_list_sub ON tuples (subject_type, subject_id);
+CREATE INDEX idx_tuples_partial_for_list_sub_rel ON tuples (subject_type, subject_id, subject_relation);
+CREATE INDEX idx_tuples_partial_for_expiration ON tuples (expires_at) WHERE expires_at IS NOT NULL;
+
+DROP TABLE stores;
@@ -0,0 +1,36 @@
+-- Stores isolate tuples and have their own model, tuples written before belong to the default store.
+-- The model is stored as JSON, the creation time uses the same format as expirations.
+CREATE TABLE stores (
+    id TEXT NOT NULL PRIMARY KEY,
+    model TEXT NOT NULL,
+    created_at TEXT NOT NULL
+);
+
+-- SQLite can not alter the primary key, so the table is rebuilt with the store as part of it.
+CREATE TABLE tuples_with_store (
+    uuid TEXT NOT NULL,
+    store_id TEXT NOT NULL DEFAULT 'default',
+    object_type TEXT NOT NULL,
+    object_id TEXT NOT NULL,
+    object_relation TEXT NOT NULL,
+    subject_type TEXT NOT NULL,
+    subject_id TEXT NOT NULL,
+    subject_relation TEXT NOT NULL,
+    expires_at TEXT,
+    condition_name TEXT NOT NULL DEFAULT '',
+    condition_context TEXT,
+    PRIMARY KEY (store_id, object_type, object_id, object_relation, subject_type, subject_id, subject_relation)
+);
+INSERT INTO tuples_with_store (uuid, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, expires_at, condition_name, condition_context)
+    SELECT uuid, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, expires_at, condition_name, condition_context FROM tuples;
+DROP TABLE tuples;
+ALTER TABLE tuples_with_store RENAME TO tuples;
+
+CREATE INDEX idx_tuples_partial_for_usersets ON tuples (store_id, object_type, object_id, object_relation) WHERE subject_relation <> '';
+CREATE INDEX idx_tuples_partial_for_indirect ON tuples (store_id, object_type, object_id, subject_type);
+CREATE UNIQUE INDEX idx_tuples_uuid ON tuples (uuid);
+CREATE INDEX idx_tuples_partial_for_list_obj ON tuples (store_id, object_type, object_id);
+CREATE INDEX idx_tuples_partial_for_list_obj_rel ON tuples (store_id, object_type, object_id, object_relation);
+CREATE INDEX idx_tuples_partial_for_list_sub ON tuples (store_id, subject_type, subject_id);
+CREATE INDEX idx_tuples_partial_for_list_sub_rel ON tuples (store_id, subject_type, subject_id, subject_relation);
+CREATE INDEX idx_tuples_partial_for_expiration ON tuples (expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,92 @@
+package sqlite3
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/trevex/zanzigo"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// pool wraps [sqlitex.Pool] to keep track of its usage, as it does not provide statistics itself.
+type pool struct {
+	*sqlitex.Pool
+	size                 int
+	acquired             atomic.Int64
+	acquireCount         atomic.Int64
+	acquireDuration      atomic.Int64
+	canceledAcquireCount atomic.Int64
+}
+
+func openPool(filepath string, c *sqlite3Config) (*pool, error) {
+	flags := sqlite.OpenReadWrite | sqlite.OpenCreate | sqlite.OpenURI
+	if !c.noWAL {
+		flags |= sqlite.OpenWAL
+	}
+	p, err := sqlitex.Open(filepath, flags, c.poolSize)
+	if err != nil {
+		return nil, err
+	}
+	// Busy timeout and synchronous level are set per connection, so all connections are taken out of the pool once
+	conns := make([]*sqlite.Conn, 0, c.poolSize)
+	for i := 0; i < c.poolSize; i++ {
+		conns = append(conns, p.Get(context.Background()))
+	}
+	for _, conn := range conns {
+		if err == nil {
+			err = configureConn(conn, c)
+		}
+		p.Put(conn)
+	}
+	if err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+	return &pool{Pool: p, size: c.poolSize}, nil
+}
+
+func configureConn(conn *sqlite.Conn, c *sqlite3Config) error {
+	if c.busyTimeout > 0 {
+		conn.SetBusyTimeout(c.busyTimeout)
+	}
+	if c.synchronous != "" {
+		return sqlitex.ExecuteTransient(conn, "PRAGMA synchronous="+c.synchronous, nil)
+	}
+	return nil
+}
+
+func (p *pool) Get(ctx context.Context) *sqlite.Conn {
+	start := time.Now()
+	conn := p.Pool.Get(ctx)
+	if conn == nil {
+		p.canceledAcquireCount.Add(1)
+		return nil
+	}
+	p.acquired.Add(1)
+	p.acquireCount.Add(1)
+	p.acquireDuration.Add(int64(time.Since(start)))
+	return conn
+}
+
+func (p *pool) Put(conn *sqlite.Conn) {
+	if conn == nil {
+		return
+	}
+	p.acquired.Add(-1)
+	p.Pool.Put(conn)
+}
+
+func (p *pool) stats() zanzigo.PoolStats {
+	acquired := int(p.acquired.Load())
+	return zanzigo.PoolStats{
+		MaxConns:             p.size,
+		AcquiredConns:        acquired,
+		IdleConns:            p.size - acquired,
+		AcquireCount:         p.acquireCount.Load(),
+		AcquireDuration:      time.Duration(p.acquireDuration.Load()),
+		CanceledAcquireCount: p.canceledAcquireCount.Load(),
+	}
+}
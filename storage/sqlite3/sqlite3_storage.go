@@ -3,17 +3,22 @@ package sqlite3
 import (
 	"context"
 	"embed"
+	"encoding/json"
 	"fmt"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/trevex/zanzigo"
+	"github.com/trevex/zanzigo/internal/tracing"
 	"github.com/trevex/zanzigo/storage/postgres"
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/samber/lo"
+	"zombiezen.com/go/sqlite"
 	"zombiezen.com/go/sqlite/sqlitex"
 )
 
@@ -24,6 +29,22 @@ var (
 	ErrUnableToGetConn = fmt.Errorf("unable to get connection from pool")
 )
 
+const (
+	// Condition excluding expired tuples, the same condition is used by [postgres.SelectQueryFor].
+	// CURRENT_TIMESTAMP only has a precision of seconds, so the current time is formatted with milliseconds like expirations.
+	notExpired = "(expires_at IS NULL OR expires_at > strftime('%Y-%m-%d %H:%M:%f', 'now'))"
+	// Format of the current time with milliseconds as returned by strftime, which keeps timestamps lexicographically comparable.
+	timestampFormat = "2006-01-02 15:04:05.000"
+)
+
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(timestampFormat)
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	return time.ParseInLocation(timestampFormat, s, time.UTC)
+}
+
 func RunMigrations(filepath string) error {
 	driver, err := iofs.New(fs, "migrations")
 	if err != nil {
@@ -40,42 +61,150 @@ func RunMigrations(filepath string) error {
 	return nil
 }
 
+type SQLite3Option interface {
+	do(*sqlite3Config)
+}
+
+type sqlite3Config struct {
+	poolSize    int
+	noWAL       bool
+	busyTimeout time.Duration
+	synchronous string
+}
+
+type sqlite3FunctionAdapter func(*sqlite3Config)
+
+func (fn sqlite3FunctionAdapter) do(c *sqlite3Config) {
+	fn(c)
+}
+
+// WithPoolSize sets the number of connections, if not set max(4, runtime.NumCPU()) connections are opened.
+func WithPoolSize(size int) SQLite3Option {
+	return sqlite3FunctionAdapter(func(c *sqlite3Config) { c.poolSize = size })
+}
+
+// WithoutWAL opens the connections without switching the database to write-ahead logging.
+// A database already using WAL keeps doing so, as the journal mode is persisted in the database file.
+func WithoutWAL() SQLite3Option {
+	return sqlite3FunctionAdapter(func(c *sqlite3Config) { c.noWAL = true })
+}
+
+// WithBusyTimeout limits how long a connection waits for a lock held by another connection before failing with SQLITE_BUSY.
+// If not set, connections wait until the context of the operation is done.
+func WithBusyTimeout(timeout time.Duration) SQLite3Option {
+	return sqlite3FunctionAdapter(func(c *sqlite3Config) { c.busyTimeout = timeout })
+}
+
+// WithSynchronous sets the synchronous level of all connections, one of OFF, NORMAL, FULL or EXTRA.
+// NORMAL is considerably faster with WAL, but recent writes might be lost if the machine crashes.
+func WithSynchronous(level string) SQLite3Option {
+	return sqlite3FunctionAdapter(func(c *sqlite3Config) { c.synchronous = strings.ToUpper(level) })
+}
+
+var synchronousLevels = []string{"OFF", "NORMAL", "FULL", "EXTRA"}
+
 type SQLite3Storage struct {
-	pool *sqlitex.Pool
+	pool  *pool
+	store string
+}
+
+func NewSQLite3Storage(filepath string, options ...SQLite3Option) (*SQLite3Storage, error) {
+	opts := sqlite3Config{poolSize: max(4, runtime.NumCPU())}
+	lo.ForEach(options, func(o SQLite3Option, _ int) { o.do(&opts) })
+	if opts.poolSize < 1 {
+		return nil, fmt.Errorf("invalid pool size %d: at least one connection is required", opts.poolSize)
+	}
+	if opts.synchronous != "" && !lo.Contains(synchronousLevels, opts.synchronous) {
+		return nil, fmt.Errorf("invalid synchronous level '%s': expected one of %s", opts.synchronous, strings.Join(synchronousLevels, ", "))
+	}
+	pool, err := openPool(filepath, &opts)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLite3Storage{pool, zanzigo.DefaultStore}, nil
 }
 
-func NewSQLite3Storage(filepath string) (*SQLite3Storage, error) {
-	pool, err := sqlitex.Open(filepath, 0, max(4, runtime.NumCPU()))
-	return &SQLite3Storage{pool}, err
+// NewSQLite3StorageFromPool uses an existing pool of the specified size, which is only used to report [zanzigo.PoolStats].
+// The connections are used as they are, so they have to be configured by the caller. Closing the storage closes the pool.
+func NewSQLite3StorageFromPool(p *sqlitex.Pool, size int) *SQLite3Storage {
+	return &SQLite3Storage{&pool{Pool: p, size: size}, zanzigo.DefaultStore}
 }
 
 func (s *SQLite3Storage) Close() error {
 	return s.pool.Close()
 }
 
+func (s *SQLite3Storage) PoolStats() zanzigo.PoolStats {
+	return s.pool.stats()
+}
+
+func (s *SQLite3Storage) Ping(ctx context.Context) error {
+	conn := s.pool.Get(ctx)
+	if conn == nil {
+		return ErrUnableToGetConn
+	}
+	defer s.pool.Put(conn)
+	return sqlitex.ExecuteTransient(conn, "SELECT 1", nil)
+}
+
 func (s *SQLite3Storage) Write(ctx context.Context, t zanzigo.Tuple) error {
-	id, err := uuid.NewV7()
-	if err != nil {
-		return err
+	conn := s.pool.Get(ctx)
+	if conn == nil {
+		return ErrUnableToGetConn
 	}
+	defer s.pool.Put(conn)
+	return s.write(conn, t)
+}
 
+// WriteBatch writes all tuples in a single transaction, which is considerably faster than a transaction per tuple.
+func (s *SQLite3Storage) WriteBatch(ctx context.Context, tuples []zanzigo.Tuple) (err error) {
 	conn := s.pool.Get(ctx)
 	if conn == nil {
 		return ErrUnableToGetConn
 	}
 	defer s.pool.Put(conn)
 
-	stmt, err := conn.Prepare("INSERT INTO tuples (uuid, object_type, object_id, object_relation, subject_type, subject_id, subject_relation) values(?, ?, ?, ?, ?, ?, ?)")
+	defer sqlitex.Save(conn)(&err)
+	for _, t := range tuples {
+		if err := s.write(conn, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLite3Storage) write(conn *sqlite.Conn, t zanzigo.Tuple) error {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+	conditionName, conditionContext, err := fromConditionRef(t.Condition)
+	if err != nil {
+		return err
+	}
+	stmt, err := conn.Prepare("INSERT INTO tuples (uuid, store_id, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, expires_at, condition_name, condition_context) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (store_id, object_type, object_id, object_relation, subject_type, subject_id, subject_relation) DO UPDATE SET expires_at=excluded.expires_at, condition_name=excluded.condition_name, condition_context=excluded.condition_context")
 	if err != nil {
 		return err
 	}
 	stmt.BindText(1, id.String())
-	stmt.BindText(2, t.ObjectType)
-	stmt.BindText(3, t.ObjectID)
-	stmt.BindText(4, t.ObjectRelation)
-	stmt.BindText(5, t.SubjectType)
-	stmt.BindText(6, t.SubjectID)
-	stmt.BindText(7, t.SubjectRelation)
+	stmt.BindText(2, s.store)
+	stmt.BindText(3, t.ObjectType)
+	stmt.BindText(4, t.ObjectID)
+	stmt.BindText(5, t.ObjectRelation)
+	stmt.BindText(6, t.SubjectType)
+	stmt.BindText(7, t.SubjectID)
+	stmt.BindText(8, t.SubjectRelation)
+	if t.ExpiresAt != nil {
+		stmt.BindText(9, formatTimestamp(*t.ExpiresAt))
+	} else {
+		stmt.BindNull(9)
+	}
+	stmt.BindText(10, conditionName)
+	if conditionContext != nil {
+		stmt.BindText(11, string(conditionContext))
+	} else {
+		stmt.BindNull(11)
+	}
 
 	_, err = stmt.Step()
 	return err
@@ -90,32 +219,64 @@ func (s *SQLite3Storage) Read(ctx context.Context, t zanzigo.Tuple) (uuid.UUID,
 	}
 	defer s.pool.Put(conn)
 
-	stmt, err := conn.Prepare("SELECT uuid FROM tuples WHERE object_type=? AND object_id=? AND object_relation=? AND subject_type=? AND subject_id=? AND subject_relation=?")
+	stmt, err := conn.Prepare("SELECT uuid FROM tuples WHERE store_id=? AND object_type=? AND object_id=? AND object_relation=? AND subject_type=? AND subject_id=? AND subject_relation=? AND " + notExpired)
 	if err != nil {
 		return id, err
 	}
-	stmt.BindText(1, t.ObjectType)
-	stmt.BindText(2, t.ObjectID)
-	stmt.BindText(3, t.ObjectRelation)
-	stmt.BindText(4, t.SubjectType)
-	stmt.BindText(5, t.SubjectID)
-	stmt.BindText(6, t.SubjectRelation)
+	stmt.BindText(1, s.store)
+	stmt.BindText(2, t.ObjectType)
+	stmt.BindText(3, t.ObjectID)
+	stmt.BindText(4, t.ObjectRelation)
+	stmt.BindText(5, t.SubjectType)
+	stmt.BindText(6, t.SubjectID)
+	stmt.BindText(7, t.SubjectRelation)
 	hasRows, err := stmt.Step()
-
+	if err != nil {
+		return id, err
+	}
 	if !hasRows {
 		return id, zanzigo.ErrNotFound
 	}
+	// The statement is cached by the connection, so it needs to be reset as we do not step until the end
+	defer stmt.Reset()
 
 	return uuid.FromString(stmt.ColumnText(0))
 }
 
+func (s *SQLite3Storage) Delete(ctx context.Context, t zanzigo.Tuple) error {
+	conn := s.pool.Get(ctx)
+	if conn == nil {
+		return ErrUnableToGetConn
+	}
+	defer s.pool.Put(conn)
+
+	stmt, err := conn.Prepare("DELETE FROM tuples WHERE store_id=? AND object_type=? AND object_id=? AND object_relation=? AND subject_type=? AND subject_id=? AND subject_relation=?")
+	if err != nil {
+		return err
+	}
+	stmt.BindText(1, s.store)
+	stmt.BindText(2, t.ObjectType)
+	stmt.BindText(3, t.ObjectID)
+	stmt.BindText(4, t.ObjectRelation)
+	stmt.BindText(5, t.SubjectType)
+	stmt.BindText(6, t.SubjectID)
+	stmt.BindText(7, t.SubjectRelation)
+	if _, err := stmt.Step(); err != nil {
+		return err
+	}
+	if conn.Changes() == 0 {
+		return zanzigo.ErrNotFound
+	}
+	return nil
+}
+
 func (s *SQLite3Storage) CursorStart() zanzigo.Cursor {
 	return uuid.Must(uuid.FromString("ffffffff-ffff-ffff-ffff-ffffffffffff")).Bytes()
 }
 
 func (s *SQLite3Storage) List(ctx context.Context, t zanzigo.Tuple, p zanzigo.Pagination) ([]zanzigo.Tuple, zanzigo.Cursor, error) {
-	args := make([]string, 0, 8)
-	whereClauses := ""
+	args := []string{s.store}
+	whereClauses := "store_id=? AND "
 	if t.ObjectType != "" {
 		args = append(args, t.ObjectType)
 		whereClauses += "object_type=? AND "
@@ -146,7 +307,7 @@ func (s *SQLite3Storage) List(ctx context.Context, t zanzigo.Tuple, p zanzigo.Pa
 		return nil, nil, err
 	}
 	args = append(args, cursor.String())
-	whereClauses += "uuid<?"
+	whereClauses += "uuid<? AND " + notExpired
 	limit := "LIMIT ?"
 
 	conn := s.pool.Get(ctx)
@@ -155,7 +316,7 @@ func (s *SQLite3Storage) List(ctx context.Context, t zanzigo.Tuple, p zanzigo.Pa
 	}
 	defer s.pool.Put(conn)
 
-	stmt, err := conn.Prepare("SELECT uuid, object_type, object_id, object_relation, subject_type, subject_id, subject_relation FROM tuples WHERE " + whereClauses + " ORDER BY uuid DESC " + limit)
+	stmt, err := conn.Prepare("SELECT uuid, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, expires_at, condition_name, condition_context FROM tuples WHERE " + whereClauses + " ORDER BY uuid DESC " + limit)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -186,19 +347,160 @@ func (s *SQLite3Storage) List(ctx context.Context, t zanzigo.Tuple, p zanzigo.Pa
 		t.SubjectType = stmt.ColumnText(4)
 		t.SubjectID = stmt.ColumnText(5)
 		t.SubjectRelation = stmt.ColumnText(6)
+		if stmt.ColumnType(7) != sqlite.TypeNull {
+			expiresAt, err := parseTimestamp(stmt.ColumnText(7))
+			if err != nil {
+				return nil, nil, err
+			}
+			t.ExpiresAt = &expiresAt
+		}
+		t.Condition, err = toConditionRef(stmt.ColumnText(8), stmt.ColumnText(9))
+		if err != nil {
+			return nil, nil, err
+		}
 		tuples = append(tuples, t)
 	}
 
 	return tuples, cursor.Bytes(), nil
 }
 
+// Unconditional tuples are stored with an empty condition name, the context is stored as JSON.
+func fromConditionRef(c *zanzigo.ConditionRef) (string, []byte, error) {
+	if c == nil {
+		return "", nil, nil
+	}
+	if c.Context == nil {
+		return c.Name, nil, nil
+	}
+	context, err := json.Marshal(c.Context)
+	return c.Name, context, err
+}
+
+func toConditionRef(name, context string) (*zanzigo.ConditionRef, error) {
+	if name == "" {
+		return nil, nil
+	}
+	c := &zanzigo.ConditionRef{Name: name}
+	if context != "" {
+		if err := json.Unmarshal([]byte(context), &c.Context); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (s *SQLite3Storage) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	conn := s.pool.Get(ctx)
+	if conn == nil {
+		return 0, ErrUnableToGetConn
+	}
+	defer s.pool.Put(conn)
+
+	stmt, err := conn.Prepare("DELETE FROM tuples WHERE expires_at IS NOT NULL AND expires_at <= ?")
+	if err != nil {
+		return 0, err
+	}
+	stmt.BindText(1, formatTimestamp(before))
+	if _, err := stmt.Step(); err != nil {
+		return 0, err
+	}
+	return conn.Changes(), nil
+}
+
+func (s *SQLite3Storage) ForStore(id string) zanzigo.Storage {
+	return &SQLite3Storage{s.pool, id}
+}
+
+func (s *SQLite3Storage) CreateStore(ctx context.Context, store zanzigo.Store) error {
+	model, err := json.Marshal(store.Model)
+	if err != nil {
+		return err
+	}
+
+	conn := s.pool.Get(ctx)
+	if conn == nil {
+		return ErrUnableToGetConn
+	}
+	defer s.pool.Put(conn)
+
+	stmt, err := conn.Prepare("INSERT INTO stores (id, model, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING")
+	if err != nil {
+		return err
+	}
+	stmt.BindText(1, store.ID)
+	stmt.BindText(2, string(model))
+	stmt.BindText(3, formatTimestamp(store.CreatedAt))
+	if _, err := stmt.Step(); err != nil {
+		return err
+	}
+	if conn.Changes() == 0 {
+		return zanzigo.ErrAlreadyExists
+	}
+	return nil
+}
+
+func (s *SQLite3Storage) ListStores(ctx context.Context) ([]zanzigo.Store, error) {
+	conn := s.pool.Get(ctx)
+	if conn == nil {
+		return nil, ErrUnableToGetConn
+	}
+	defer s.pool.Put(conn)
+
+	stmt, err := conn.Prepare("SELECT id, model, created_at FROM stores ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	stores := []zanzigo.Store{}
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return nil, err
+		} else if !hasRow {
+			break
+		}
+
+		store := zanzigo.Store{ID: stmt.ColumnText(0)}
+		if err := json.Unmarshal([]byte(stmt.ColumnText(1)), &store.Model); err != nil {
+			stmt.Reset()
+			return nil, err
+		}
+		store.CreatedAt, err = parseTimestamp(stmt.ColumnText(2))
+		if err != nil {
+			stmt.Reset()
+			return nil, err
+		}
+		stores = append(stores, store)
+	}
+	return stores, nil
+}
+
+func (s *SQLite3Storage) DeleteStore(ctx context.Context, id string) (err error) {
+	conn := s.pool.Get(ctx)
+	if conn == nil {
+		return ErrUnableToGetConn
+	}
+	defer s.pool.Put(conn)
+
+	defer sqlitex.Save(conn)(&err)
+	err = sqlitex.Execute(conn, "DELETE FROM stores WHERE id=?", &sqlitex.ExecOptions{Args: []any{id}})
+	if err != nil {
+		return err
+	}
+	if conn.Changes() == 0 {
+		return zanzigo.ErrNotFound
+	}
+	return sqlitex.Execute(conn, "DELETE FROM tuples WHERE store_id=?", &sqlitex.ExecOptions{Args: []any{id}})
+}
+
 func (s *SQLite3Storage) PrepareRuleset(object, relation string, ruleset []zanzigo.InferredRule) (zanzigo.Userdata, error) {
 	// TODO: Checking the query plan reveals idx_tuples-index is used for all selects (this is not the case for Postgres and not expected).
 	//       This can be changed using INDEXED BY, but rather it should be verified how SQLite is supposed to plan the queries.
-	return postgres.SelectQueryFor(ruleset, false, "?")
+	return postgres.SelectQueryFor(postgres.DialectSQLite, s.store, ruleset, false, "?")
 }
 
-func (s *SQLite3Storage) QueryChecks(ctx context.Context, checks []zanzigo.Check) ([]zanzigo.MarkedTuple, error) {
+func (s *SQLite3Storage) QueryChecks(ctx context.Context, checks []zanzigo.Check) (_ []zanzigo.MarkedTuple, err error) {
+	ctx, span := tracing.StartQueryChecks(ctx, "sqlite", len(checks))
+	defer func() { tracing.End(span, err) }()
+
 	// TODO: current implementation could be more memory efficient by using buffer
 	argNum := 1
 	args := make([]string, 0, len(checks)*6)
@@ -222,12 +524,13 @@ func (s *SQLite3Storage) QueryChecks(ctx context.Context, checks []zanzigo.Check
 				panic("unreachable")
 			}
 		}
-		queries = append(queries, fmt.Sprintf("SELECT %d AS check_index", i)+", rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation FROM ("+query+fmt.Sprintf(") AS cr%d", i))
+		queries = append(queries, fmt.Sprintf("SELECT %d AS check_index", i)+", rule_index, object_type, object_id, object_relation, subject_type, subject_id, subject_relation, condition_name, condition_context FROM ("+query+fmt.Sprintf(") AS cr%d", i))
 		argNum += 4
 	}
 
 	// Join all queries with UNION ALL and ORDER BY rule index
 	fullQuery := strings.Join(queries, " UNION ALL ") + " ORDER BY rule_index"
+	tracing.SetFingerprint(ctx, fullQuery)
 
 	conn := s.pool.Get(ctx)
 	if conn == nil {
@@ -261,6 +564,10 @@ func (s *SQLite3Storage) QueryChecks(ctx context.Context, checks []zanzigo.Check
 		t.SubjectType = stmt.ColumnText(5)
 		t.SubjectID = stmt.ColumnText(6)
 		t.SubjectRelation = stmt.ColumnText(7)
+		t.Condition, err = toConditionRef(stmt.ColumnText(8), stmt.ColumnText(9))
+		if err != nil {
+			return nil, err
+		}
 		tuples = append(tuples, t)
 	}
 
@@ -5,9 +5,14 @@ import (
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/trevex/zanzigo"
 	testsuite "github.com/trevex/zanzigo/storage"
+
+	"github.com/stretchr/testify/require"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
 )
 
 var (
@@ -63,6 +68,37 @@ func TestSQLite3WithTestSuite(t *testing.T) {
 	})
 }
 
+func TestSQLite3Options(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewSQLite3Storage(filepath, WithPoolSize(2), WithoutWAL(), WithBusyTimeout(time.Second), WithSynchronous("normal"))
+	require.NoError(t, err)
+	defer s.Close()
+	require.Equal(t, 2, s.PoolStats().MaxConns)
+	require.NoError(t, s.Ping(ctx))
+	conn := s.pool.Get(ctx)
+	synchronous := int64(-1)
+	require.NoError(t, sqlitex.ExecuteTransient(conn, "PRAGMA synchronous", &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			synchronous = stmt.ColumnInt64(0)
+			return nil
+		},
+	}))
+	s.pool.Put(conn)
+	require.Equal(t, int64(1), synchronous) // NORMAL
+
+	_, err = NewSQLite3Storage(filepath, WithSynchronous("sometimes"))
+	require.ErrorContains(t, err, "invalid synchronous level 'SOMETIMES'")
+	_, err = NewSQLite3Storage(filepath, WithPoolSize(0))
+	require.ErrorContains(t, err, "invalid pool size 0")
+
+	pool, err := sqlitex.Open(filepath, 0, 1)
+	require.NoError(t, err)
+	fromPool := NewSQLite3StorageFromPool(pool, 1)
+	defer fromPool.Close()
+	require.NoError(t, fromPool.Ping(ctx))
+	require.Equal(t, 1, fromPool.PoolStats().MaxConns)
+}
+
 func BenchmarkSQLite3(b *testing.B) {
 	testsuite.RunBenchmarkAll(b, map[string]zanzigo.Storage{
 		"queries": storage,
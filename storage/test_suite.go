@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/trevex/zanzigo"
@@ -51,7 +52,15 @@ var Model = func() *zanzigo.Model {
 				},
 			),
 		},
-	})
+	}, zanzigo.WithConditions(zanzigo.ConditionMap{
+		"in_network": zanzigo.Condition{
+			Expression: "inCIDR(ip, cidr)",
+			Parameters: map[string]zanzigo.ConditionParameterType{
+				"ip":   zanzigo.ConditionParameterString,
+				"cidr": zanzigo.ConditionParameterString,
+			},
+		},
+	}))
 	if err != nil {
 		log.Fatalf("Expected storage.Write not to fail: %v", err)
 	}
@@ -164,6 +173,111 @@ func RunTest(t *testing.T, storage zanzigo.Storage, expectations Expectations) {
 		require.NoError(t, err)
 		require.Equal(t, 0, len(tuples))
 		require.NotEqual(t, storage.CursorStart(), newCur)
+
+		// Filter by subject only
+		tuples, _, err = storage.List(ctx, zanzigo.Tuple{SubjectType: "user", SubjectID: "myuser"}, zanzigo.Pagination{Cursor: storage.CursorStart(), Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []zanzigo.Tuple{zanzigo.TupleString("group:mygroup#member@user:myuser")}, tuples)
+
+		// Filter by fields not forming a prefix
+		tuples, _, err = storage.List(ctx, zanzigo.Tuple{ObjectRelation: "viewer", SubjectRelation: "member"}, zanzigo.Pagination{Cursor: storage.CursorStart(), Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []zanzigo.Tuple{zanzigo.TupleString("folder:myfolder#viewer@group:mygroup#member")}, tuples)
+
+		// Paginate one tuple at a time
+		cursor := storage.CursorStart()
+		all := []zanzigo.Tuple{}
+		for {
+			tuples, cursor, err = storage.List(ctx, zanzigo.Tuple{ObjectType: "doc", ObjectID: "mydoc"}, zanzigo.Pagination{Cursor: cursor, Limit: 1})
+			require.NoError(t, err)
+			if len(tuples) == 0 {
+				break
+			}
+			all = append(all, tuples...)
+		}
+		require.Equal(t, 2, len(all))
+	})
+
+	t.Run("read", func(t *testing.T) {
+		ctx := context.Background()
+
+		tuple := zanzigo.TupleString("doc:mydoc#parent@folder:myfolder")
+		id, err := storage.Read(ctx, tuple)
+		require.NoError(t, err)
+		require.False(t, id.IsNil())
+
+		// The UUID is stable
+		again, err := storage.Read(ctx, tuple)
+		require.NoError(t, err)
+		require.Equal(t, id, again)
+
+		_, err = storage.Read(ctx, zanzigo.TupleString("doc:mydoc#parent@folder:nonexistent"))
+		require.ErrorIs(t, err, zanzigo.ErrNotFound)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		ctx := context.Background()
+
+		tuples := []zanzigo.Tuple{}
+		for i := 0; i < 250; i++ {
+			tuples = append(tuples, zanzigo.TupleString(fmt.Sprintf("doc:mybatchdoc#viewer@user:user%d", i)))
+		}
+		// Tuples written multiple times are updated, the last occurrence wins
+		future := time.Now().Add(time.Hour).Truncate(time.Second)
+		updated := tuples[0]
+		updated.ExpiresAt = &future
+		updated.Condition = &zanzigo.ConditionRef{Name: "in_network", Context: map[string]any{"cidr": "10.0.0.0/8"}}
+		tuples = append(tuples, updated)
+		require.NoError(t, zanzigo.WriteBatch(ctx, storage, tuples))
+		require.NoError(t, zanzigo.WriteBatch(ctx, storage, tuples[200:]))
+
+		listed := []zanzigo.Tuple{}
+		cursor := storage.CursorStart()
+		for {
+			page, next, err := storage.List(ctx, zanzigo.Tuple{ObjectType: "doc", ObjectID: "mybatchdoc"}, zanzigo.Pagination{Cursor: cursor, Limit: 100})
+			require.NoError(t, err)
+			listed = append(listed, page...)
+			if len(page) < 100 {
+				break
+			}
+			cursor = next
+		}
+		require.Len(t, listed, 250)
+		for _, l := range listed {
+			if l.SubjectID != "user0" {
+				require.Nil(t, l.ExpiresAt)
+				continue
+			}
+			require.NotNil(t, l.ExpiresAt)
+			require.WithinDuration(t, future, *l.ExpiresAt, time.Second)
+			require.Equal(t, updated.Condition, l.Condition)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		ctx := context.Background()
+
+		tuple := zanzigo.TupleString("doc:mydeleteddoc#viewer@user:myuser")
+		past := time.Now().Add(-time.Minute)
+		tuple.ExpiresAt = &past
+		require.NoError(t, storage.Write(ctx, tuple))
+		// Expired tuples can be deleted as well
+		require.NoError(t, storage.Delete(ctx, tuple))
+		require.ErrorIs(t, storage.Delete(ctx, tuple), zanzigo.ErrNotFound)
+
+		tuple.ExpiresAt = nil
+		require.NoError(t, storage.Write(ctx, tuple))
+		require.NoError(t, storage.Delete(ctx, tuple))
+		_, err := storage.Read(ctx, tuple)
+		require.ErrorIs(t, err, zanzigo.ErrNotFound)
+		tuples, _, err := storage.List(ctx, zanzigo.Tuple{ObjectType: "doc", ObjectID: "mydeleteddoc"}, zanzigo.Pagination{Cursor: storage.CursorStart(), Limit: 10})
+		require.NoError(t, err)
+		require.Empty(t, tuples)
+		tuples, _, err = storage.List(ctx, zanzigo.Tuple{SubjectType: "user", SubjectID: "myuser"}, zanzigo.Pagination{Cursor: storage.CursorStart(), Limit: 10})
+		require.NoError(t, err)
+		for _, listed := range tuples {
+			require.NotEqual(t, "mydeleteddoc", listed.ObjectID)
+		}
 	})
 
 	t.Run("checks", func(t *testing.T) {
@@ -217,12 +331,52 @@ func RunTest(t *testing.T, storage zanzigo.Storage, expectations Expectations) {
 		require.NoError(t, err)
 		require.False(t, result)
 
+		// Tuples not valid for the model are rejected
+		_, err = resolver.Check(ctx, zanzigo.TupleString("doc:mydoc#unknown@user:myuser"))
+		require.ErrorIs(t, err, zanzigo.ErrInvalidTuple)
+		_, err = resolver.Check(ctx, zanzigo.TupleString("doc:mydoc#viewer@unknown:myuser"))
+		require.ErrorIs(t, err, zanzigo.ErrInvalidTuple)
+		_, err = resolver.Check(ctx, zanzigo.TupleString("doc:mydoc#viewer@user:myuser"), zanzigo.WithContextualTuples(zanzigo.TupleString("doc:mydoc#unknown@user:myuser")))
+		require.ErrorIs(t, err, zanzigo.ErrInvalidTuple)
+	})
+
+	t.Run("expand", func(t *testing.T) {
+		ctx := context.Background()
+
+		tree, err := resolver.Expand(ctx, zanzigo.TupleString("doc:mydoc#viewer@user:ignored"))
+		require.NoError(t, err)
+		require.Equal(t, zanzigo.Tuple{ObjectType: "doc", ObjectID: "mydoc", ObjectRelation: "viewer"}, tree.Userset)
+		// Collect the tuples of the whole tree
+		tuples := []string{}
+		var collect func(node *zanzigo.ExpandNode)
+		collect = func(node *zanzigo.ExpandNode) {
+			for _, t := range node.Tuples {
+				tuples = append(tuples, t.ToString())
+			}
+			for _, child := range node.Children {
+				collect(child)
+			}
+		}
+		collect(tree)
+		require.Subset(t, tuples, []string{
+			"doc:mydoc#owner@user:myowner",
+			"doc:mydoc#parent@folder:myfolder",
+			"folder:myfolder#viewer@group:mygroup#member",
+			"folder:myfolder#editor@user:myfoldereditoruser",
+			"group:mygroup#member@user:myuser",
+		})
+		require.Len(t, tree.Children, 3) // viewer, editor and owner of the folder
+
+		_, err = resolver.Expand(ctx, zanzigo.Tuple{ObjectType: "doc", ObjectID: "mydoc", ObjectRelation: "unknown"})
+		require.Error(t, err)
 	})
 
 	t.Run("userdata", func(t *testing.T) {
 		ruleset := resolver.RulesetFor("doc", "viewer")
-		userdata, err := storage.PrepareRuleset("doc", "viewer", ruleset)
+		// Rulesets might reference each other, e.g. using database functions, so all are prepared
+		userdataMap, err := zanzigo.PrepareModel(storage, Model.InferredRules)
 		require.NoError(t, err)
+		userdata := userdataMap["doc"]["viewer"]
 
 		ctx := context.Background()
 		tuples, err := storage.QueryChecks(ctx, []zanzigo.Check{{
@@ -246,6 +400,215 @@ func RunTest(t *testing.T, storage zanzigo.Storage, expectations Expectations) {
 		}
 	})
 
+	t.Run("conditions", func(t *testing.T) {
+		ctx := context.Background()
+
+		conditional := zanzigo.TupleString("doc:myconditionaldoc#viewer@user:myconditionaluser")
+		conditional.Condition = &zanzigo.ConditionRef{Name: "in_network", Context: map[string]any{"cidr": "10.0.0.0/8"}}
+		require.NoError(t, storage.Write(ctx, conditional))
+		// Conditions also apply to usersets
+		conditionalUserset := zanzigo.TupleString("doc:myconditionaldoc#editor@group:mygroup#member")
+		conditionalUserset.Condition = &zanzigo.ConditionRef{Name: "in_network", Context: map[string]any{"cidr": "192.168.0.0/16"}}
+		require.NoError(t, storage.Write(ctx, conditionalUserset))
+
+		tuple := zanzigo.TupleString("doc:myconditionaldoc#viewer@user:myconditionaluser")
+		result, err := resolver.CheckWithResult(ctx, tuple)
+		require.NoError(t, err)
+		require.Equal(t, zanzigo.CheckResultConditional, result)
+		result, err = resolver.CheckWithResult(ctx, tuple, zanzigo.WithRequestContext(map[string]any{"ip": "10.1.2.3"}))
+		require.NoError(t, err)
+		require.Equal(t, zanzigo.CheckResultAllowed, result)
+		result, err = resolver.CheckWithResult(ctx, tuple, zanzigo.WithRequestContext(map[string]any{"ip": "172.16.0.1"}))
+		require.NoError(t, err)
+		require.Equal(t, zanzigo.CheckResultDenied, result)
+
+		tuple = zanzigo.TupleString("doc:myconditionaldoc#viewer@user:myuser")
+		result, err = resolver.CheckWithResult(ctx, tuple, zanzigo.WithRequestContext(map[string]any{"ip": "192.168.1.1"}))
+		require.NoError(t, err)
+		require.Equal(t, zanzigo.CheckResultAllowed, result)
+		allowed, err := resolver.Check(ctx, tuple)
+		require.NoError(t, err)
+		require.False(t, allowed)
+
+		// The stored context is returned when listing
+		tuples, _, err := storage.List(ctx, zanzigo.Tuple{ObjectType: "doc", ObjectID: "myconditionaldoc", ObjectRelation: "viewer"}, zanzigo.Pagination{Cursor: storage.CursorStart(), Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, 1, len(tuples))
+		require.Equal(t, conditional.Condition, tuples[0].Condition)
+
+		// Removing the condition makes the tuple unconditional
+		conditional.Condition = nil
+		require.NoError(t, storage.Write(ctx, conditional))
+		result, err = resolver.CheckWithResult(ctx, zanzigo.TupleString("doc:myconditionaldoc#viewer@user:myconditionaluser"))
+		require.NoError(t, err)
+		require.Equal(t, zanzigo.CheckResultAllowed, result)
+		conditional.Condition = &zanzigo.ConditionRef{Name: "in_network", Context: map[string]any{"cidr": "10.0.0.0/8"}}
+		require.NoError(t, storage.Write(ctx, conditional))
+	})
+
+	t.Run("contextual", func(t *testing.T) {
+		ctx := context.Background()
+
+		// Direct contextual tuples do not require traversal
+		tuple := zanzigo.TupleString("doc:mydoc#viewer@user:mycontextualuser")
+		result, err := resolver.Check(ctx, tuple)
+		require.NoError(t, err)
+		require.False(t, result)
+		result, err = resolver.Check(ctx, tuple, zanzigo.WithContextualTuples(zanzigo.TupleString("doc:mydoc#editor@user:mycontextualuser")))
+		require.NoError(t, err)
+		require.True(t, result)
+
+		// Expired contextual tuples are ignored as well
+		past := time.Now().Add(-time.Minute)
+		expired := zanzigo.TupleString("doc:mydoc#editor@user:mycontextualuser")
+		expired.ExpiresAt = &past
+		result, err = resolver.Check(ctx, tuple, zanzigo.WithContextualTuples(expired))
+		require.NoError(t, err)
+		require.False(t, result)
+
+		// Contextual tuples are merged with stored tuples at every depth, e.g. membership of a group with access to the parent folder
+		result, err = resolver.Check(ctx, tuple, zanzigo.WithContextualTuples(zanzigo.TupleString("group:mygroup#member@user:mycontextualuser")))
+		require.NoError(t, err)
+		require.True(t, result)
+		result, err = resolver.Check(ctx, zanzigo.TupleString("doc:mydoc#editor@user:mycontextualuser"), zanzigo.WithContextualTuples(zanzigo.TupleString("group:mygroup#member@user:mycontextualuser")))
+		require.NoError(t, err)
+		require.False(t, result)
+
+		// A contextual folder containing the document
+		result, err = resolver.Check(ctx, zanzigo.TupleString("doc:mycontextualdoc#viewer@user:myuser"), zanzigo.WithContextualTuples(zanzigo.TupleString("doc:mycontextualdoc#parent@folder:myfolder")))
+		require.NoError(t, err)
+		require.True(t, result)
+
+		// Nothing was persisted
+		_, err = storage.Read(ctx, zanzigo.TupleString("group:mygroup#member@user:mycontextualuser"))
+		require.ErrorIs(t, err, zanzigo.ErrNotFound)
+	})
+
+	t.Run("expiration", func(t *testing.T) {
+		ctx := context.Background()
+		past := time.Now().Add(-time.Minute)
+		future := time.Now().Add(time.Hour)
+
+		expired := zanzigo.TupleString("doc:myexpiringdoc#viewer@user:myexpireduser")
+		expired.ExpiresAt = &past
+		require.NoError(t, storage.Write(ctx, expired))
+		temporary := zanzigo.TupleString("doc:myexpiringdoc#viewer@user:mytemporaryuser")
+		temporary.ExpiresAt = &future
+		require.NoError(t, storage.Write(ctx, temporary))
+
+		result, err := resolver.Check(ctx, zanzigo.TupleString("doc:myexpiringdoc#viewer@user:myexpireduser"))
+		require.NoError(t, err)
+		require.False(t, result)
+		_, err = storage.Read(ctx, expired)
+		require.ErrorIs(t, err, zanzigo.ErrNotFound)
+
+		result, err = resolver.Check(ctx, zanzigo.TupleString("doc:myexpiringdoc#viewer@user:mytemporaryuser"))
+		require.NoError(t, err)
+		require.True(t, result)
+
+		tuples, _, err := storage.List(ctx, zanzigo.Tuple{ObjectType: "doc", ObjectID: "myexpiringdoc"}, zanzigo.Pagination{Cursor: storage.CursorStart(), Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, 1, len(tuples))
+		require.NotNil(t, tuples[0].ExpiresAt)
+		require.WithinDuration(t, future, *tuples[0].ExpiresAt, time.Second)
+
+		// Writing an existing tuple updates its expiration
+		expired.ExpiresAt = nil
+		require.NoError(t, storage.Write(ctx, expired))
+		result, err = resolver.Check(ctx, zanzigo.TupleString("doc:myexpiringdoc#viewer@user:myexpireduser"))
+		require.NoError(t, err)
+		require.True(t, result)
+		expired.ExpiresAt = &past
+		require.NoError(t, storage.Write(ctx, expired))
+
+		removed, err := storage.DeleteExpired(ctx, time.Now())
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, removed, 1)
+		removed, err = storage.DeleteExpired(ctx, time.Now())
+		require.NoError(t, err)
+		require.Equal(t, 0, removed)
+
+		// Tuples expiring in the future are kept
+		_, err = storage.Read(ctx, temporary)
+		require.NoError(t, err)
+
+		// Expirations are compared with sub-second precision, so the tuple is expired within the second it expired in
+		now := time.Now()
+		for now.Nanosecond() < int(200*time.Millisecond) {
+			time.Sleep(10 * time.Millisecond)
+			now = time.Now()
+		}
+		justExpired := now.Add(-100 * time.Millisecond)
+		expired = zanzigo.TupleString("doc:myexpiringdoc#viewer@user:myjustexpireduser")
+		expired.ExpiresAt = &justExpired
+		require.NoError(t, storage.Write(ctx, expired))
+		_, err = storage.Read(ctx, expired)
+		require.ErrorIs(t, err, zanzigo.ErrNotFound)
+		result, err = resolver.Check(ctx, expired)
+		require.NoError(t, err)
+		require.False(t, result)
+	})
+
+	t.Run("stores", func(t *testing.T) {
+		ctx := context.Background()
+		store := zanzigo.Store{
+			ID: "mytenant",
+			Model: zanzigo.ModelDefinition{Objects: zanzigo.ObjectMap{
+				"user": zanzigo.RelationMap{},
+				"doc":  zanzigo.RelationMap{"viewer": zanzigo.Rule{}},
+			}},
+			CreatedAt: time.Now(),
+		}
+		require.NoError(t, storage.CreateStore(ctx, store))
+		require.ErrorIs(t, storage.CreateStore(ctx, store), zanzigo.ErrAlreadyExists)
+
+		stores, err := storage.ListStores(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(stores))
+		require.Equal(t, store.ID, stores[0].ID)
+		require.Equal(t, store.Model, stores[0].Model)
+		require.WithinDuration(t, store.CreatedAt, stores[0].CreatedAt, time.Second)
+
+		// Tuples are only visible within their store
+		scoped := storage.ForStore(store.ID)
+		scopedResolver, err := zanzigo.NewResolver(Model, scoped, 16)
+		require.NoError(t, err)
+		tuple := zanzigo.TupleString("doc:mydoc#viewer@user:mytenantuser")
+		require.NoError(t, scoped.Write(ctx, tuple))
+
+		_, err = scoped.Read(ctx, tuple)
+		require.NoError(t, err)
+		_, err = storage.Read(ctx, tuple)
+		require.ErrorIs(t, err, zanzigo.ErrNotFound)
+		result, err := scopedResolver.Check(ctx, zanzigo.TupleString("doc:mydoc#viewer@user:mytenantuser"))
+		require.NoError(t, err)
+		require.True(t, result)
+		result, err = resolver.Check(ctx, zanzigo.TupleString("doc:mydoc#viewer@user:mytenantuser"))
+		require.NoError(t, err)
+		require.False(t, result)
+		result, err = scopedResolver.Check(ctx, zanzigo.TupleString("doc:mydoc#viewer@user:myuser"))
+		require.NoError(t, err)
+		require.False(t, result)
+
+		tuples, _, err := scoped.List(ctx, zanzigo.Tuple{ObjectType: "doc", ObjectID: "mydoc"}, zanzigo.Pagination{Cursor: scoped.CursorStart(), Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, 1, len(tuples))
+		tuples, _, err = scoped.List(ctx, zanzigo.Tuple{SubjectType: "user", SubjectID: "myuser"}, zanzigo.Pagination{Cursor: scoped.CursorStart(), Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, 0, len(tuples))
+
+		// Deleting the store removes its tuples, but keeps the tuples of other stores
+		require.NoError(t, storage.DeleteStore(ctx, store.ID))
+		require.ErrorIs(t, storage.DeleteStore(ctx, store.ID), zanzigo.ErrNotFound)
+		_, err = scoped.Read(ctx, tuple)
+		require.ErrorIs(t, err, zanzigo.ErrNotFound)
+		_, err = storage.Read(ctx, zanzigo.TupleString("doc:mydoc#parent@folder:myfolder"))
+		require.NoError(t, err)
+		stores, err = storage.ListStores(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 0, len(stores))
+	})
+
 }
 
 func RunBenchmarkAll(b *testing.B, storages map[string]zanzigo.Storage) {
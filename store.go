@@ -0,0 +1,30 @@
+package zanzigo
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// DefaultStore is the store storage-implementations use unless scoped to another store using Storage.ForStore.
+// Tuples written before stores were introduced belong to the default store.
+const DefaultStore = "default"
+
+// Store IDs are embedded into queries and names of database functions by some storage-implementations,
+// so they are restricted to lower-case identifiers.
+var storeIDPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// A Store isolates tuples and has its own [Model], so a single storage can be shared by several tenants.
+type Store struct {
+	ID        string
+	Model     ModelDefinition
+	CreatedAt time.Time
+}
+
+// ValidateStoreID returns an error wrapping [ErrInvalidIdentifier], if id can not be used as a store ID.
+func ValidateStoreID(id string) error {
+	if !storeIDPattern.MatchString(id) {
+		return fmt.Errorf("%w: store id '%s' does not match '%s'", ErrInvalidIdentifier, id, storeIDPattern.String())
+	}
+	return nil
+}
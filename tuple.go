@@ -1,8 +1,10 @@
 package zanzigo
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 )
 
 // ⟨tuple⟩ ::= ⟨object⟩‘#’⟨relation⟩‘@’⟨user⟩
@@ -17,10 +19,20 @@ type Tuple struct {
 	SubjectID   string `json:"user_id"`
 	/// ⟨userset⟩ ::= ⟨object⟩‘#’⟨relation⟩
 	SubjectRelation string `json:"user_relation"`
+	// If set, the tuple is only valid until the specified point in time.
+	// Expired tuples are ignored by all storage-implementations and eventually removed by the [GarbageCollector].
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// If set, the tuple only applies if the referenced [Condition] of the [Model] is met.
+	Condition *ConditionRef `json:"condition,omitempty"`
 }
 
 var EmptyTuple = Tuple{}
 
+// Returns true, if the tuple has an expiration and it is not after now.
+func (t *Tuple) IsExpired(now time.Time) bool {
+	return t.ExpiresAt != nil && !t.ExpiresAt.After(now)
+}
+
 func (t *Tuple) ToString() string {
 	s := fmt.Sprintf("%s:%s#%s@%s:%s", t.ObjectType, t.ObjectID, t.ObjectRelation, t.SubjectType, t.SubjectID)
 	if t.SubjectRelation != "" {
@@ -29,42 +41,65 @@ func (t *Tuple) ToString() string {
 	return s
 }
 
+var (
+	// Returned by [ParseTuple] if the string is not a tuple in Zanzibar-format.
+	ErrMalformedTuple = errors.New("malformed tuple")
+)
+
 // Parses a string in Zanzibar-format and returns the resulting tuple.
 // If the string is malformed, EmptyTuple will be returned.
+// Use [ParseTuple] to learn why a string could not be parsed.
 //
 // Examples for input are: 'doc:mydoc#viewer@user:myuser' or 'doc:mydoc#editor@group:mygroup#member'
 func TupleString(s string) Tuple {
-	splits := strings.Split(s, "@")
-	if len(splits) != 2 {
+	t, err := ParseTuple(s)
+	if err != nil {
 		return EmptyTuple
 	}
-	object := splits[0]
-	subject := splits[1]
+	return t
+}
 
-	// Process object-part first
-	splits = strings.Split(object, "#")
-	if len(splits) != 2 {
-		return EmptyTuple
+// Parses a string in Zanzibar-format and returns the resulting tuple.
+// If the string is malformed, an error wrapping [ErrMalformedTuple] describes the problem.
+//
+// Examples for input are: 'doc:mydoc#viewer@user:myuser' or 'doc:mydoc#editor@group:mygroup#member'
+func ParseTuple(s string) (Tuple, error) {
+	object, subject, ok := strings.Cut(s, "@")
+	if !ok {
+		return EmptyTuple, fmt.Errorf("%w: missing '@' separating object and subject in '%s'", ErrMalformedTuple, s)
 	}
-	objectRelation := splits[1]
-	object = splits[0]
-	splits = strings.Split(object, ":")
-	if len(splits) != 2 {
-		return EmptyTuple
+	if strings.Contains(subject, "@") {
+		return EmptyTuple, fmt.Errorf("%w: more than one '@' in '%s'", ErrMalformedTuple, s)
+	}
+
+	// Process object-part first, the relation is mandatory
+	object, objectRelation, ok := strings.Cut(object, "#")
+	if !ok {
+		return EmptyTuple, fmt.Errorf("%w: missing '#' separating object and relation in '%s'", ErrMalformedTuple, s)
+	}
+	objectType, objectID, err := parseTypeAndID("object", object, s)
+	if err != nil {
+		return EmptyTuple, err
+	}
+	if objectRelation == "" {
+		return EmptyTuple, fmt.Errorf("%w: empty object relation in '%s'", ErrMalformedTuple, s)
+	}
+	if strings.Contains(objectRelation, "#") {
+		return EmptyTuple, fmt.Errorf("%w: more than one '#' in object of '%s'", ErrMalformedTuple, s)
 	}
-	objectType := splits[0]
-	objectID := splits[1]
 
 	// Next process subject-part, but relation is optional
-	subjectRelation := ""
-	splits = strings.Split(subject, "#")
-	if len(splits) == 2 {
-		subjectRelation = splits[1]
+	subject, subjectRelation, hasRelation := strings.Cut(subject, "#")
+	if hasRelation && subjectRelation == "" {
+		return EmptyTuple, fmt.Errorf("%w: empty subject relation after '#' in '%s'", ErrMalformedTuple, s)
+	}
+	if strings.Contains(subjectRelation, "#") {
+		return EmptyTuple, fmt.Errorf("%w: more than one '#' in subject of '%s'", ErrMalformedTuple, s)
+	}
+	subjectType, subjectID, err := parseTypeAndID("subject", subject, s)
+	if err != nil {
+		return EmptyTuple, err
 	}
-	subject = splits[0]
-	splits = strings.Split(subject, ":")
-	subjectType := splits[0]
-	subjectID := splits[1]
 
 	return Tuple{
 		ObjectType:      objectType,
@@ -73,5 +108,22 @@ func TupleString(s string) Tuple {
 		SubjectType:     subjectType,
 		SubjectID:       subjectID,
 		SubjectRelation: subjectRelation,
+	}, nil
+}
+
+func parseTypeAndID(part, typeAndID, s string) (string, string, error) {
+	typ, id, ok := strings.Cut(typeAndID, ":")
+	if !ok {
+		return "", "", fmt.Errorf("%w: missing ':' separating type and id of %s in '%s'", ErrMalformedTuple, part, s)
+	}
+	if typ == "" {
+		return "", "", fmt.Errorf("%w: empty %s type in '%s'", ErrMalformedTuple, part, s)
+	}
+	if id == "" {
+		return "", "", fmt.Errorf("%w: empty %s id in '%s'", ErrMalformedTuple, part, s)
+	}
+	if strings.Contains(id, ":") {
+		return "", "", fmt.Errorf("%w: more than one ':' in %s of '%s'", ErrMalformedTuple, part, s)
 	}
+	return typ, id, nil
 }
@@ -32,3 +32,33 @@ func TestTupleString(t *testing.T) {
 	out2 := t2.ToString()
 	require.Equal(t, input2, out2)
 }
+
+func TestParseTuple(t *testing.T) {
+	tuple, err := ParseTuple("doc:mydoc#editor@group:mygroup#member")
+	require.NoError(t, err)
+	require.Equal(t, TupleString("doc:mydoc#editor@group:mygroup#member"), tuple)
+
+	malformed := map[string]string{
+		"":                               "missing '@'",
+		"doc:mydoc#viewer":               "missing '@'",
+		"doc:mydoc#viewer@user:a@b":      "more than one '@'",
+		"doc:mydoc@user:myuser":          "missing '#' separating object and relation",
+		"doc:mydoc#@user:myuser":         "empty object relation",
+		"doc:mydoc#viewer#x@user:myuser": "more than one '#' in object",
+		"docmydoc#viewer@user:myuser":    "missing ':' separating type and id of object",
+		":mydoc#viewer@user:myuser":      "empty object type",
+		"doc:#viewer@user:myuser":        "empty object id",
+		"doc:my:doc#viewer@user:myuser":  "more than one ':' in object",
+		"doc:mydoc#viewer@user":          "missing ':' separating type and id of subject",
+		"doc:mydoc#viewer@user:":         "empty subject id",
+		"doc:mydoc#viewer@group:g#":      "empty subject relation",
+		"doc:mydoc#viewer@group:g#a#b":   "more than one '#' in subject",
+	}
+	for input, msg := range malformed {
+		_, err := ParseTuple(input)
+		require.ErrorIs(t, err, ErrMalformedTuple, input)
+		require.ErrorContains(t, err, msg, input)
+		// TupleString never panics, but returns EmptyTuple
+		require.Equal(t, EmptyTuple, TupleString(input))
+	}
+}
@@ -0,0 +1,266 @@
+// Package tupleio encodes and decodes tuples for backups and seeding environments and transfers them from and to storages in batches.
+package tupleio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/trevex/zanzigo"
+)
+
+var (
+	// Returned if a format is not one of the supported formats.
+	ErrUnknownFormat = errors.New("unknown format")
+	// Returned by encoders, if the format can not represent the tuple, e.g. a conditional tuple in text format.
+	ErrUnsupportedTuple = errors.New("tuple not supported by format")
+	// Returned by decoders, if the input is malformed.
+	ErrMalformedInput = errors.New("malformed input")
+)
+
+// Format is the encoding of a stream of tuples.
+type Format string
+
+const (
+	// One JSON-encoded [zanzigo.Tuple] per line.
+	FormatNDJSON Format = "ndjson"
+	// Comma-separated values with a header, see [CSVHeader].
+	FormatCSV Format = "csv"
+	// One tuple per line in the notation of [zanzigo.TupleString], which can not represent expirations or conditions.
+	// Empty lines and lines starting with '#' are ignored.
+	FormatText Format = "text"
+)
+
+// Columns of the CSV format, the condition context is JSON-encoded.
+// When decoding, the columns may be in any order and all columns after user_id are optional.
+var CSVHeader = []string{"object_type", "object_id", "relation", "user_type", "user_id", "user_relation", "expires_at", "condition_name", "condition_context"}
+
+// ParseFormat returns the format of the name, if name is empty the format is inferred from the extension of filename.
+// If neither is specified, [FormatNDJSON] is used.
+func ParseFormat(name, filename string) (Format, error) {
+	if name == "" {
+		switch filepath.Ext(filename) {
+		case ".csv":
+			return FormatCSV, nil
+		case ".txt":
+			return FormatText, nil
+		default:
+			return FormatNDJSON, nil
+		}
+	}
+	switch format := Format(name); format {
+	case FormatNDJSON, FormatCSV, FormatText:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w '%s', use '%s', '%s' or '%s'", ErrUnknownFormat, name, FormatNDJSON, FormatCSV, FormatText)
+	}
+}
+
+// An Encoder writes tuples, Flush has to be called after the last tuple.
+type Encoder interface {
+	Encode(t zanzigo.Tuple) error
+	Flush() error
+}
+
+// A Decoder reads tuples and returns [io.EOF] once all tuples were read.
+type Decoder interface {
+	Decode() (zanzigo.Tuple, error)
+}
+
+// NewEncoder returns an encoder of the format writing to w.
+func NewEncoder(w io.Writer, format Format) (Encoder, error) {
+	switch format {
+	case FormatNDJSON:
+		buf := bufio.NewWriter(w)
+		return &ndjsonEncoder{buf, json.NewEncoder(buf)}, nil
+	case FormatCSV:
+		return &csvEncoder{w: csv.NewWriter(w)}, nil
+	case FormatText:
+		return &textEncoder{bufio.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownFormat, format)
+	}
+}
+
+// NewDecoder returns a decoder of the format reading from r.
+func NewDecoder(r io.Reader, format Format) (Decoder, error) {
+	switch format {
+	case FormatNDJSON:
+		return &ndjsonDecoder{decoder: json.NewDecoder(r)}, nil
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		return &csvDecoder{reader: reader}, nil
+	case FormatText:
+		return &textDecoder{scanner: bufio.NewScanner(r)}, nil
+	default:
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownFormat, format)
+	}
+}
+
+type ndjsonEncoder struct {
+	buf     *bufio.Writer
+	encoder *json.Encoder
+}
+
+func (e *ndjsonEncoder) Encode(t zanzigo.Tuple) error {
+	return e.encoder.Encode(t)
+}
+
+func (e *ndjsonEncoder) Flush() error {
+	return e.buf.Flush()
+}
+
+type ndjsonDecoder struct {
+	decoder *json.Decoder
+	count   int
+}
+
+func (d *ndjsonDecoder) Decode() (zanzigo.Tuple, error) {
+	t := zanzigo.Tuple{}
+	if err := d.decoder.Decode(&t); err == io.EOF {
+		return t, err
+	} else if err != nil {
+		return t, fmt.Errorf("%w: tuple %d: %w", ErrMalformedInput, d.count+1, err)
+	}
+	d.count++
+	return t, nil
+}
+
+type csvEncoder struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (e *csvEncoder) Encode(t zanzigo.Tuple) error {
+	if !e.headerWritten {
+		if err := e.w.Write(CSVHeader); err != nil {
+			return err
+		}
+		e.headerWritten = true
+	}
+	expiresAt, conditionName, conditionContext := "", "", ""
+	if t.ExpiresAt != nil {
+		expiresAt = t.ExpiresAt.UTC().Format(time.RFC3339Nano)
+	}
+	if t.Condition != nil {
+		conditionName = t.Condition.Name
+		if t.Condition.Context != nil {
+			data, err := json.Marshal(t.Condition.Context)
+			if err != nil {
+				return err
+			}
+			conditionContext = string(data)
+		}
+	}
+	return e.w.Write([]string{t.ObjectType, t.ObjectID, t.ObjectRelation, t.SubjectType, t.SubjectID, t.SubjectRelation, expiresAt, conditionName, conditionContext})
+}
+
+func (e *csvEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type csvDecoder struct {
+	reader *csv.Reader
+	// Index of each column of CSVHeader in the records, -1 if missing
+	columns []int
+}
+
+func (d *csvDecoder) Decode() (zanzigo.Tuple, error) {
+	t := zanzigo.Tuple{}
+	if d.columns == nil {
+		header, err := d.reader.Read()
+		if err != nil {
+			return t, err
+		}
+		d.columns = make([]int, len(CSVHeader))
+		for i, name := range CSVHeader {
+			d.columns[i] = -1
+			for j, column := range header {
+				if strings.TrimSpace(column) == name {
+					d.columns[i] = j
+				}
+			}
+			// Only the columns of a tuple without subject relation are required
+			if i < 5 && d.columns[i] < 0 {
+				return t, fmt.Errorf("%w: missing column '%s' in header", ErrMalformedInput, name)
+			}
+		}
+	}
+	record, err := d.reader.Read()
+	if err != nil {
+		return t, err
+	}
+	line, _ := d.reader.FieldPos(0)
+	value := func(i int) string {
+		if d.columns[i] < 0 || d.columns[i] >= len(record) {
+			return ""
+		}
+		return record[d.columns[i]]
+	}
+	t.ObjectType, t.ObjectID, t.ObjectRelation = value(0), value(1), value(2)
+	t.SubjectType, t.SubjectID, t.SubjectRelation = value(3), value(4), value(5)
+	if expiresAt := value(6); expiresAt != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, expiresAt)
+		if err != nil {
+			return t, fmt.Errorf("%w: line %d: %w", ErrMalformedInput, line, err)
+		}
+		t.ExpiresAt = &parsed
+	}
+	if name := value(7); name != "" {
+		t.Condition = &zanzigo.ConditionRef{Name: name}
+		if context := value(8); context != "" {
+			if err := json.Unmarshal([]byte(context), &t.Condition.Context); err != nil {
+				return t, fmt.Errorf("%w: line %d: %w", ErrMalformedInput, line, err)
+			}
+		}
+	}
+	return t, nil
+}
+
+type textEncoder struct {
+	w *bufio.Writer
+}
+
+func (e *textEncoder) Encode(t zanzigo.Tuple) error {
+	if t.ExpiresAt != nil || t.Condition != nil {
+		return fmt.Errorf("%w: '%s' has an expiration or condition, which the text format can not represent", ErrUnsupportedTuple, t.ToString())
+	}
+	_, err := e.w.WriteString(t.ToString() + "\n")
+	return err
+}
+
+func (e *textEncoder) Flush() error {
+	return e.w.Flush()
+}
+
+type textDecoder struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (d *textDecoder) Decode() (zanzigo.Tuple, error) {
+	for d.scanner.Scan() {
+		d.line++
+		text := strings.TrimSpace(d.scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		t, err := zanzigo.ParseTuple(text)
+		if err != nil {
+			return t, fmt.Errorf("%w: line %d: %w", ErrMalformedInput, d.line, err)
+		}
+		return t, nil
+	}
+	if err := d.scanner.Err(); err != nil {
+		return zanzigo.EmptyTuple, err
+	}
+	return zanzigo.EmptyTuple, io.EOF
+}
@@ -0,0 +1,154 @@
+package tupleio
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/samber/lo"
+	"github.com/trevex/zanzigo"
+)
+
+// DefaultBatchSize is the number of tuples listed or written at once, if not specified otherwise using [WithBatchSize].
+const DefaultBatchSize = 1000
+
+type Option interface {
+	do(*config)
+}
+
+type config struct {
+	batchSize int
+	progress  func(int)
+	validator func(zanzigo.Tuple) error
+}
+
+type functionAdapter func(*config)
+
+func (fn functionAdapter) do(c *config) {
+	fn(c)
+}
+
+// WithBatchSize sets the number of tuples listed per page on export and written per batch on import.
+func WithBatchSize(size int) Option {
+	return functionAdapter(func(c *config) {
+		if size > 0 {
+			c.batchSize = size
+		}
+	})
+}
+
+// WithProgress calls fn with the total number of transferred tuples after every batch.
+func WithProgress(fn func(int)) Option {
+	return functionAdapter(func(c *config) {
+		c.progress = fn
+	})
+}
+
+// WithValidator calls fn for every imported tuple before it is written and aborts the import, if an error is returned.
+func WithValidator(fn func(zanzigo.Tuple) error) Option {
+	return functionAdapter(func(c *config) {
+		c.validator = fn
+	})
+}
+
+func newConfig(options []Option) config {
+	c := config{batchSize: DefaultBatchSize}
+	lo.ForEach(options, func(o Option, _ int) { o.do(&c) })
+	return c
+}
+
+// ForEachPage lists all tuples of the storage matching the filter in pages of pageSize tuples and calls fn for every page.
+func ForEachPage(ctx context.Context, storage zanzigo.Storage, filter zanzigo.Tuple, pageSize int, fn func([]zanzigo.Tuple) error) error {
+	cursor := storage.CursorStart()
+	for {
+		tuples, next, err := storage.List(ctx, filter, zanzigo.Pagination{Limit: pageSize, Cursor: cursor})
+		if err != nil {
+			return err
+		}
+		if len(tuples) > 0 {
+			if err := fn(tuples); err != nil {
+				return err
+			}
+		}
+		if len(tuples) < pageSize {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// Export encodes all tuples of the storage matching the filter and returns the number of exported tuples.
+// Expired tuples are not exported.
+func Export(ctx context.Context, storage zanzigo.Storage, filter zanzigo.Tuple, enc Encoder, options ...Option) (int, error) {
+	opts := newConfig(options)
+	count := 0
+	err := ForEachPage(ctx, storage, filter, opts.batchSize, func(tuples []zanzigo.Tuple) error {
+		for _, t := range tuples {
+			if err := enc.Encode(t); err != nil {
+				return err
+			}
+		}
+		count += len(tuples)
+		if opts.progress != nil {
+			opts.progress(count)
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, enc.Flush()
+}
+
+// Import decodes all tuples and writes them to the storage in batches, see [zanzigo.WriteBatch].
+// Existing tuples are updated, so an import can be repeated after a failure.
+// Returns the number of written tuples, which only includes complete batches if an error occurred.
+func Import(ctx context.Context, storage zanzigo.Storage, dec Decoder, options ...Option) (int, error) {
+	opts := newConfig(options)
+	return importBatches(dec, opts, func(tuples []zanzigo.Tuple) error {
+		return zanzigo.WriteBatch(ctx, storage, tuples)
+	})
+}
+
+// ImportFunc is like [Import], but passes every batch to write instead of writing it to a storage, e.g. to send it to a server.
+func ImportFunc(dec Decoder, write func([]zanzigo.Tuple) error, options ...Option) (int, error) {
+	return importBatches(dec, newConfig(options), write)
+}
+
+func importBatches(dec Decoder, opts config, write func([]zanzigo.Tuple) error) (int, error) {
+	count := 0
+	batch := make([]zanzigo.Tuple, 0, opts.batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := write(batch); err != nil {
+			return err
+		}
+		count += len(batch)
+		batch = batch[:0]
+		if opts.progress != nil {
+			opts.progress(count)
+		}
+		return nil
+	}
+	for {
+		t, err := dec.Decode()
+		if errors.Is(err, io.EOF) {
+			return count, flush()
+		} else if err != nil {
+			return count, err
+		}
+		if opts.validator != nil {
+			if err := opts.validator(t); err != nil {
+				return count, err
+			}
+		}
+		batch = append(batch, t)
+		if len(batch) >= opts.batchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package tupleio_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/trevex/zanzigo"
+	"github.com/trevex/zanzigo/storage/sqlite3"
+	"github.com/trevex/zanzigo/tupleio"
+)
+
+func decodeAll(t *testing.T, dec tupleio.Decoder) []zanzigo.Tuple {
+	t.Helper()
+	tuples := []zanzigo.Tuple{}
+	for {
+		tuple, err := dec.Decode()
+		if errors.Is(err, io.EOF) {
+			return tuples
+		}
+		require.NoError(t, err)
+		tuples = append(tuples, tuple)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	conditional := zanzigo.TupleString("doc:mydoc#viewer@group:mygroup#member")
+	conditional.ExpiresAt = &expiresAt
+	conditional.Condition = &zanzigo.ConditionRef{Name: "in_network", Context: map[string]any{"cidr": "10.0.0.0/8"}}
+	tuples := []zanzigo.Tuple{zanzigo.TupleString("doc:mydoc#viewer@user:myuser"), conditional}
+
+	for _, format := range []tupleio.Format{tupleio.FormatNDJSON, tupleio.FormatCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			enc, err := tupleio.NewEncoder(buf, format)
+			require.NoError(t, err)
+			for _, tuple := range tuples {
+				require.NoError(t, enc.Encode(tuple))
+			}
+			require.NoError(t, enc.Flush())
+			dec, err := tupleio.NewDecoder(buf, format)
+			require.NoError(t, err)
+			require.Equal(t, tuples, decodeAll(t, dec))
+		})
+	}
+
+	t.Run("text", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		enc, err := tupleio.NewEncoder(buf, tupleio.FormatText)
+		require.NoError(t, err)
+		require.NoError(t, enc.Encode(tuples[0]))
+		require.ErrorIs(t, enc.Encode(conditional), tupleio.ErrUnsupportedTuple)
+		require.NoError(t, enc.Flush())
+		require.Equal(t, "doc:mydoc#viewer@user:myuser\n", buf.String())
+
+		dec, err := tupleio.NewDecoder(strings.NewReader("# comment\n\ndoc:mydoc#viewer@user:myuser\ndoc:mydoc\n"), tupleio.FormatText)
+		require.NoError(t, err)
+		tuple, err := dec.Decode()
+		require.NoError(t, err)
+		require.Equal(t, tuples[0], tuple)
+		_, err = dec.Decode()
+		require.ErrorIs(t, err, tupleio.ErrMalformedInput)
+		require.ErrorContains(t, err, "line 4")
+	})
+
+	t.Run("csv columns", func(t *testing.T) {
+		dec, err := tupleio.NewDecoder(strings.NewReader("user_id,user_type,relation,object_id,object_type\nmyuser,user,viewer,mydoc,doc\n"), tupleio.FormatCSV)
+		require.NoError(t, err)
+		require.Equal(t, tuples[:1], decodeAll(t, dec))
+		dec, err = tupleio.NewDecoder(strings.NewReader("object_type,object_id,relation\n"), tupleio.FormatCSV)
+		require.NoError(t, err)
+		_, err = dec.Decode()
+		require.ErrorIs(t, err, tupleio.ErrMalformedInput)
+	})
+
+	format, err := tupleio.ParseFormat("", "backup.csv")
+	require.NoError(t, err)
+	require.Equal(t, tupleio.FormatCSV, format)
+	format, err = tupleio.ParseFormat("", "")
+	require.NoError(t, err)
+	require.Equal(t, tupleio.FormatNDJSON, format)
+	_, err = tupleio.ParseFormat("xml", "")
+	require.ErrorIs(t, err, tupleio.ErrUnknownFormat)
+}
+
+func TestImportExport(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "test.db")
+	require.NoError(t, sqlite3.RunMigrations(file))
+	storage, err := sqlite3.NewSQLite3Storage(file)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	input := &strings.Builder{}
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		input.WriteString("doc:" + id + "#viewer@user:myuser\n")
+	}
+	input.WriteString("folder:f#viewer@user:myuser\n")
+	dec, err := tupleio.NewDecoder(strings.NewReader(input.String()), tupleio.FormatText)
+	require.NoError(t, err)
+	progress := []int{}
+	count, err := tupleio.Import(ctx, storage, dec, tupleio.WithBatchSize(2), tupleio.WithProgress(func(n int) { progress = append(progress, n) }))
+	require.NoError(t, err)
+	require.Equal(t, 6, count)
+	require.Equal(t, []int{2, 4, 6}, progress)
+
+	buf := &bytes.Buffer{}
+	enc, err := tupleio.NewEncoder(buf, tupleio.FormatText)
+	require.NoError(t, err)
+	count, err = tupleio.Export(ctx, storage, zanzigo.Tuple{ObjectType: "doc"}, enc, tupleio.WithBatchSize(2))
+	require.NoError(t, err)
+	require.Equal(t, 5, count)
+	require.Equal(t, strings.Count(input.String(), "doc:"), strings.Count(buf.String(), "\n"))
+
+	// Invalid tuples abort the import
+	dec, err = tupleio.NewDecoder(strings.NewReader(input.String()), tupleio.FormatText)
+	require.NoError(t, err)
+	errInvalid := errors.New("invalid")
+	_, err = tupleio.Import(ctx, storage, dec, tupleio.WithValidator(func(t zanzigo.Tuple) error {
+		if t.ObjectType == "folder" {
+			return errInvalid
+		}
+		return nil
+	}))
+	require.ErrorIs(t, err, errInvalid)
+}